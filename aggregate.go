@@ -0,0 +1,32 @@
+/*
+ *  aggregate.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+// keepClosestContact is the aggregation policy of the CLM parser: the contact
+// with the smaller meanDist is kept. Ties are broken by the larger number of
+// links and then by strandedness so that the choice is independent of order.
+// The orientation support of both contacts is summed.
+func keepClosestContact(a, b Contact) Contact {
+	c := a
+	switch {
+	case a.meanDist != b.meanDist:
+		if b.meanDist < a.meanDist {
+			c = b
+		}
+	case a.nlinks != b.nlinks:
+		if b.nlinks > a.nlinks {
+			c = b
+		}
+	case b.strandedness > a.strandedness:
+		c = b
+	}
+	c.same = a.same + b.same
+	c.opposite = a.opposite + b.opposite
+	return c
+}
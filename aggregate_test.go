@@ -0,0 +1,73 @@
+/*
+ *  aggregate_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// contactRecord is one element of a synthetic link stream
+type contactRecord struct {
+	pair    allhic.Pair
+	contact allhic.Contact
+}
+
+// syntheticContacts makes n contacts over nPairs distinct pairs, with many
+// duplicates and some exact meanDist ties
+func syntheticContacts(n, nPairs int) []contactRecord {
+	rng := rand.New(rand.NewSource(int64(n)))
+	records := make([]contactRecord, n)
+	for i := range records {
+		k := rng.Intn(nPairs)
+		records[i] = contactRecord{
+			allhic.MakePair(k/1000, k%1000),
+			allhic.MakeContact(int8(2*rng.Intn(2)-1), 1+rng.Intn(50), float64(rng.Intn(20))),
+		}
+	}
+	return records
+}
+
+// aggregateSerial is the single map aggregation as done in the CLM parser
+func aggregateSerial(records []contactRecord) map[allhic.Pair]allhic.Contact {
+	contacts := map[allhic.Pair]allhic.Contact{}
+	for _, r := range records {
+		c := r.contact
+		if p, ok := contacts[r.pair]; ok {
+			c = allhic.KeepClosestContact(p, c)
+		}
+		contacts[r.pair] = c
+	}
+	return contacts
+}
+
+// TestKeepClosestContactOrder checks that the aggregation does not depend on
+// the order of the contacts
+func TestKeepClosestContactOrder(t *testing.T) {
+	records := syntheticContacts(200000, 5000)
+	want := aggregateSerial(records)
+	shuffled := make([]contactRecord, len(records))
+	copy(shuffled, records)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	if !reflect.DeepEqual(aggregateSerial(shuffled), want) {
+		t.Error("aggregation depends on the order of the contacts")
+	}
+	reversed := make([]contactRecord, len(records))
+	for i, r := range records {
+		reversed[len(records)-1-i] = r
+	}
+	if !reflect.DeepEqual(aggregateSerial(reversed), want) {
+		t.Error("aggregation depends on the order of the contacts")
+	}
+}
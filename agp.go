@@ -17,7 +17,6 @@ import (
 
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
-	"github.com/shenwei356/xopen"
 )
 
 const (
@@ -76,8 +75,29 @@ func (r *AGP) Add(row string) {
 	r.lines = append(r.lines, line)
 }
 
-// buildFasta builds target FASTA based on info from agpfile
-func buildFasta(agpfile string, seqs map[string]*seq.Seq) {
+// agpObject groups the AGP lines that make up one output sequence
+type agpObject struct {
+	name  string
+	lines []AGPLine
+}
+
+// objects returns the AGP lines grouped by object, in file order
+func (r *AGP) objects() []agpObject {
+	var objects []agpObject
+	for _, line := range r.lines {
+		if n := len(objects); n == 0 || objects[n-1].name != line.object {
+			objects = append(objects, agpObject{name: line.object})
+		}
+		o := &objects[len(objects)-1]
+		o.lines = append(o.lines, line)
+	}
+	return objects
+}
+
+// buildFasta builds target FASTA based on info from agpfile. Objects are
+// assembled by up to threads workers and written in AGP order, so at most
+// threads objects are held in memory at any time.
+func buildFasta(agpfile string, seqs map[string]*seq.Seq, threads int) {
 	log.Noticef("Parse agpfile `%s`", agpfile)
 	file := mustOpen(agpfile)
 
@@ -86,24 +106,56 @@ func buildFasta(agpfile string, seqs map[string]*seq.Seq) {
 	for scanner.Scan() {
 		agp.Add(scanner.Text())
 	}
+	_ = file.Close()
 
-	var buf bytes.Buffer
-	outFile := RemoveExt(agpfile) + ".fasta"
-	outfh, _ := xopen.Wopen(outFile)
-	prevObject := ""
-	for _, line := range agp.lines {
-		if line.object != prevObject {
-			if prevObject != "" {
-				writeRecord(prevObject, buf, outfh)
-			}
-			prevObject = line.object
-			buf.Reset()
+	if threads < 1 {
+		threads = 1
+	}
+	objects := agp.objects()
+	results := make([]chan fastaRecord, len(objects))
+	for i := range results {
+		results[i] = make(chan fastaRecord, 1)
+	}
+
+	// Each slot is released by the writer once the object is on disk
+	slots := make(chan struct{}, threads)
+	go func() {
+		for i := range objects {
+			slots <- struct{}{}
+			go func(i int) {
+				results[i] <- buildObject(&objects[i], seqs)
+			}(i)
 		}
+	}()
+
+	outFile := RemoveExt(agpfile) + ".fasta"
+	f := mustCreateAtomic(outFile)
+	outfh := bufio.NewWriter(f)
+	for i := range objects {
+		writeRecord(<-results[i], outfh)
+		<-slots
+	}
+	ErrorAbort(outfh.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Assembly FASTA file `%s` built", outFile)
+}
+
+// fastaRecord is an object formatted by a worker, waiting to be written
+type fastaRecord struct {
+	name string
+	size int
+	text []byte
+}
+
+// buildObject concatenates the components and gaps of an object and
+// returns the formatted FASTA record
+func buildObject(o *agpObject, seqs map[string]*seq.Seq) fastaRecord {
+	var buf bytes.Buffer
+	for _, line := range o.lines {
 		if line.isGap {
 			buf.Write(bytes.Repeat([]byte("N"), line.gapLength))
 		} else {
 			if s, ok := seqs[line.componentID]; ok {
-				// fmt.Printf("name: %s seq: %s\n", line.componentID, s.SubSeq(1, 10))
 				s = s.SubSeq(line.componentBeg, line.componentEnd)
 				if line.strand == '-' {
 					s.RevComInplace()
@@ -114,20 +166,15 @@ func buildFasta(agpfile string, seqs map[string]*seq.Seq) {
 			}
 		}
 	}
-	// Last one
-	writeRecord(prevObject, buf, outfh)
-	buf.Reset()
-	log.Noticef("Assembly FASTA file `%s` built", outFile)
+	record, _ := fastx.NewRecordWithoutValidation(seq.DNA, []byte{}, []byte(o.name),
+		[]byte{}, buf.Bytes())
+	return fastaRecord{o.name, buf.Len(), record.Format(LineWidth)}
 }
 
 // writeRecord writes the FASTA record to the file
-func writeRecord(object string, buf bytes.Buffer, outfh *xopen.Writer) {
-	record, _ := fastx.NewRecordWithoutValidation(seq.DNA, []byte{}, []byte(object),
-		[]byte{}, buf.Bytes())
-	size := record.Seq.Length()
-	if size > LargeSequence {
-		log.Noticef("Write sequence %s (size = %d bp)", record.Name, size)
+func writeRecord(record fastaRecord, outfh *bufio.Writer) {
+	if record.size > LargeSequence {
+		log.Noticef("Write sequence %s (size = %d bp)", record.name, record.size)
 	}
-	record.FormatToWriter(outfh, LineWidth)
-	outfh.Flush()
+	_, _ = outfh.Write(record.text)
 }
@@ -0,0 +1,86 @@
+/*
+ *  alias.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AliasMap maps the external names of contigs, e.g. `ctg1|arrow` in the BAM
+// file, to their canonical names, e.g. `ctg1` in the FASTA file
+type AliasMap map[string]string
+
+// ReadAliasFile parses the alias file, with one external name and its
+// canonical name per line
+// ctg1|arrow      ctg1
+// ctg2|arrow      ctg2
+func ReadAliasFile(filename string) (AliasMap, error) {
+	f, err := openReader(filename)
+	if err != nil {
+		return nil, openError("alias", filename, err)
+	}
+	defer f.Close()
+
+	aliases := make(AliasMap)
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) != 2 {
+			return nil, fmt.Errorf("expected 2 columns at line %d of %s: %s",
+				lineno, filename, scanner.Text())
+		}
+		if name, ok := aliases[words[0]]; ok && name != words[1] {
+			return nil, fmt.Errorf("contig %s is aliased to both %s and %s in %s",
+				words[0], name, words[1], filename)
+		}
+		aliases[words[0]] = words[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read alias file %s: %s", filename, err)
+	}
+	log.Noticef("Loaded %d contig aliases from `%s`", len(aliases), filename)
+	return aliases, nil
+}
+
+// Name returns the canonical name of the contig, which is name itself when
+// it has no alias
+func (r AliasMap) Name(name string) string {
+	if canonical, ok := r[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// aliasedNames checks that no two contigs in a file end up with the same
+// canonical name
+type aliasedNames struct {
+	aliases AliasMap
+	from    map[string]string // Canonical name to the name it was read as
+}
+
+// newAliasedNames is the constructor for aliasedNames
+func newAliasedNames(aliases AliasMap) *aliasedNames {
+	return &aliasedNames{aliases: aliases, from: make(map[string]string)}
+}
+
+// canonical returns the canonical name of the contig read as name, and an
+// error if another contig already had that canonical name
+func (r *aliasedNames) canonical(name string) (string, error) {
+	canonical := r.aliases.Name(name)
+	if from, ok := r.from[canonical]; ok && from != name {
+		return canonical, fmt.Errorf("contigs %s and %s are both %s after aliasing",
+			from, name, canonical)
+	}
+	r.from[canonical] = name
+	return canonical, nil
+}
@@ -0,0 +1,112 @@
+/*
+ *  alias_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestReadAliasFile(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"ok.alias":       "# external canonical\nt0|arrow\tt0\nt1|arrow\tt1\nt1|arrow\tt1\n",
+			"conflict.alias": "t0|arrow\tt0\nt0|arrow\tt9\n",
+		})
+		aliases, err := allhic.ReadAliasFile("ok.alias")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(aliases) != 2 || aliases.Name("t1|arrow") != "t1" || aliases.Name("t2") != "t2" {
+			t.Errorf("got aliases %v", aliases)
+		}
+		_, err = allhic.ReadAliasFile("conflict.alias")
+		if err == nil || !strings.Contains(err.Error(), "contig t0|arrow is aliased to both t0 and t9") {
+			t.Errorf("got error %v, want a conflict on t0|arrow", err)
+		}
+	})
+}
+
+// TestCLMAliases reads the ids and clm files with the names of the BAM file,
+// which the aliases map to the names of the FASTA file
+func TestCLMAliases(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"bam.ids":   "t0|arrow\t5000\nt1|arrow\t6000\nt2\t7000\n",
+			"bam.clm":   "t0|arrow+ t1|arrow+\t2\t1000 2000\nt1|arrow+ t2-\t1\t5000\n",
+			"fasta.ids": "t0\t5000\nt1\t6000\nt2\t7000\n",
+			"fasta.clm": "t0+ t1+\t2\t1000 2000\nt1+ t2-\t1\t5000\n",
+			"bam.alias": "t0|arrow\tt0\nt1|arrow\tt1\n",
+			"clash.ids": "t0|arrow\t5000\nt0\t5000\n",
+			"clash.clm": "t0|arrow+ t0+\t1\t100\n",
+		})
+		aliases, err := allhic.ReadAliasFile("bam.alias")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := allhic.CLMOptions{Aliases: aliases}
+		aliased, err := allhic.NewCLMWithOptions("bam.clm", "bam.ids", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := mustNewCLM(t, "fasta.clm", "fasta.ids")
+		for i, tig := range want.Tigs {
+			if aliased.Tigs[i].Name != tig.Name {
+				t.Errorf("tig %d: got %s, want %s", i, aliased.Tigs[i].Name, tig.Name)
+			}
+		}
+		if !reflect.DeepEqual(aliased.M(), want.M()) {
+			t.Error("contact matrices differ after aliasing")
+		}
+
+		_, err = allhic.NewCLMWithOptions("clash.clm", "clash.ids", opts)
+		if err == nil || !strings.Contains(err.Error(), "contigs t0|arrow and t0 are both t0 after aliasing in clash.ids") {
+			t.Errorf("got error %v, want a collision on t0", err)
+		}
+	})
+}
+
+// TestBuildAliases builds the same scaffold from FASTA records named as in
+// the BAM file, given the aliases to the names in the tour
+func TestBuildAliases(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"plain.fasta":   ">t0\nAAAA\n>t1\nCCGG\n",
+			"arrow.fasta":   ">t0|arrow\nAAAA\n>t1|arrow\nCCGG\n",
+			"arrow.alias":   "t0|arrow\tt0\nt1|arrow\tt1\n",
+			"g1.tour":       ">INIT\nt0+ t1-\n",
+			"g1.arrow.tour": ">INIT\nt0|arrow+ t1-\n",
+		})
+		var outputs []string
+		for _, b := range []allhic.Builder{
+			{Tourfiles: []string{"g1.tour"}, Fastafile: "plain.fasta", OutFastafile: "plain.out.fasta"},
+			{Tourfiles: []string{"g1.tour"}, Fastafile: "arrow.fasta", OutFastafile: "arrow.out.fasta",
+				AliasFile: "arrow.alias"},
+			{Tourfiles: []string{"g1.arrow.tour"}, Fastafile: "plain.fasta", OutFastafile: "tour.out.fasta",
+				AliasFile: "arrow.alias"},
+		} {
+			b.Threads = 1
+			b.Run()
+			out, err := ioutil.ReadFile(b.OutFastafile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, string(out))
+		}
+		for i, out := range outputs[1:] {
+			if out != outputs[0] {
+				t.Errorf("build %d: got %q, want %q", i+1, out, outputs[0])
+			}
+		}
+	})
+}
@@ -10,12 +10,20 @@
 package allhic
 
 import (
+	"context"
 	"fmt"
+	"github.com/op/go-logging"
 	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"os/signal"
 	"path"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // Logo banner (Varsity style):
@@ -33,8 +41,16 @@ _/ /   \ \_  _| |__/ | _| |__/ | _| |  | |_  _| |_\ ` + "`" + `.___.'\
 
 `,
 	Version: Version,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if quiet {
+			logging.SetLevel(logging.NOTICE, "allhic")
+		}
+	},
 }
 
+// quiet hides the INFO messages, such as the progress of long reads
+var quiet bool
+
 // Execute executes the root command.
 func Execute() error {
 	return rootCmd.Execute()
@@ -48,29 +64,128 @@ func banner(message string) {
 	log.Noticef(strings.Repeat("*", len(message)))
 }
 
+// interruptContext is canceled by the first SIGINT or SIGTERM, after which
+// the signals kill the process as usual, until stop
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			log.Warningf("Received %s, stop after the current generation, again to abort", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// scratchDir creates a temporary directory under tempDir, the system one
+// when empty, for the sorts of extract. It is removed by remove, or on
+// SIGINT or SIGTERM before the process exits.
+func scratchDir(tempDir string) (dir string, remove func()) {
+	dir, err := ioutil.TempDir(tempDir, "allhic-*")
+	ErrorAbort(err)
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warningf("Received %s, remove the temporary files in `%s`", sig, dir)
+			_ = os.RemoveAll(dir)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return dir, func() {
+		signal.Stop(signals)
+		close(done)
+		ErrorAbort(os.RemoveAll(dir))
+	}
+}
+
 // init adds all the sub-commands
 func init() {
 	var RE string
-	var minLinks int
+	var minLinks, window, minMapq, bins, minDist, maxDist, distLowerBound int
+	var binScale, includefile, mode, format string
+	var dedup, keepSecondary, keepSupplementary, keepQCFail, porec, porecDownweight bool
+	var threads int
+	var repeatRatio, minOverlap float64
+	var qcThresholds QCThresholds
+	var excludefile, outPrefix string
+	var force, lowmem bool
+	var tmpdir string
 	extractCmd := &cobra.Command{
-		Use:   "extract bamfile fastafile",
+		Use:   "extract bamfile [bamfile ...] fastafile",
 		Short: "Extract Hi-C link size distribution",
 		Long: `
 Extract function:
 Given a bamfile, the goal of the extract step is to calculate an empirical
 distribution of Hi-C link size based on intra-contig links. The Extract function
-also prepares for the latter steps of ALLHiC.
+also prepares for the latter steps of ALLHiC. Several bamfiles, e.g. of the
+lanes of a library, are read as if they were one, and their headers must list
+the same contigs. The allValidPairs of HiC-Pro can stand in for the bamfiles,
+their contigs and sizes being those of the fastafile.
 `,
-		Args: cobra.ExactArgs(2),
+		Args: cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			bamfile := args[0]
-			fastafile := args[1]
-			p := Extracter{Bamfile: bamfile, Fastafile: fastafile, RE: RE, MinLinks: minLinks}
-			p.Run()
+			bamfiles := args[:len(args)-1]
+			fastafile := args[len(args)-1]
+			p := Extracter{Bamfile: bamfiles[0], Bamfiles: bamfiles, Format: format, Fastafile: fastafile,
+				RE: RE, Mode: mode, MinLinks: minLinks, MinMapq: minMapq, Dedup: dedup, Window: window,
+				KeepSecondary: keepSecondary, KeepSupplementary: keepSupplementary, KeepQCFail: keepQCFail,
+				Bins: bins, BinScale: binScale, MinDist: minDist, MaxDist: maxDist, Threads: threads,
+				Includefile: includefile, DistLowerBound: distLowerBound, Excludefile: excludefile, RepeatRatio: repeatRatio,
+				PoreC: porec, PoreCDownweight: porecDownweight, QCThresholds: qcThresholds,
+				LowMem: lowmem, TempDir: tmpdir, MinOverlap: minOverlap, Force: force, OutPrefix: outPrefix}
+			// Removed on the errors of Run too, before they exit
+			remove := func() {}
+			if dedup || lowmem {
+				p.TempDir, remove = scratchDir(tmpdir)
+			}
+			err := p.Run()
+			remove()
+			ErrorAbort(err)
 		},
 	}
 	extractCmd.Flags().StringVarP(&RE, "RE", "", DefaultRE, "Restriction site pattern, use comma to separate multiple patterns (N is considered as [ACGT]), e.g. 'GATCGATC,GANTGATC,GANTANTC,GATCANTC'")
+	extractCmd.Flags().StringVarP(&format, "format", "", "", "Format of the read pairs, bam or validpairs for the validPairs of HiC-Pro, default is told by the extension, .validPairs or .allValidPairs with or without .gz")
+	extractCmd.Flags().StringVarP(&mode, "mode", "", ModeRE, "Counts of the contigs, re for the sites of --RE or omnic for their lengths less the Ns, for Omni-C and other enzyme-free libraries")
 	extractCmd.Flags().IntVarP(&minLinks, "minLinks", "", MinLinks, "Minimum number of links for contig pair")
+	extractCmd.Flags().IntVarP(&bins, "bins", "", 0, "Number of bins of the link size distribution from 2 kb to 128 Mb, 0 for 16 bins in each doubling as in LACHESIS")
+	extractCmd.Flags().StringVarP(&binScale, "binScale", "", BinScaleLog, "Spacing of the --bins, log or linear")
+	extractCmd.Flags().IntVarP(&minDist, "minDist", "", 0, "Leave the intra-contig links shorter than this out of the distribution, and the inter-contig link sizes, to the contig ends, out of the clmfile")
+	extractCmd.Flags().IntVarP(&maxDist, "maxDist", "", 0, "Leave the intra-contig links longer than this out of the distribution, 0 for no limit")
+	extractCmd.Flags().IntVarP(&distLowerBound, "distLowerBound", "", DistLowerBound, "Leave the intra-contig links shorter than this out of the distribution alone, as the religated and uncut fragments, the clmfile keeping them")
+	extractCmd.Flags().StringVarP(&includefile, "include", "", "", "Keep only the contigs listed in the first column of this file, skipping the reads on the others or whose mate is")
+	extractCmd.Flags().StringVarP(&excludefile, "exclude", "", "", "Leave the contigs listed in the first column of this file out, e.g. organelles and contaminants, skipping the reads on them or whose mate is")
+	extractCmd.Flags().IntVarP(&minMapq, "minMapq", "", 0, "Skip the reads with a lower MAPQ, or whose mate has one by its MQ tag, 0 only skips MAPQ 0")
+	extractCmd.Flags().BoolVarP(&keepSecondary, "keepSecondary", "", false, "Use the secondary alignments (flag 0x100), skipped by default")
+	extractCmd.Flags().BoolVarP(&keepSupplementary, "keepSupplementary", "", false, "Use the supplementary alignments (flag 0x800), skipped by default")
+	extractCmd.Flags().BoolVarP(&keepQCFail, "keepQCFail", "", false, "Use the reads failing the quality checks (flag 0x200), skipped by default")
+	extractCmd.Flags().BoolVarP(&porec, "porec", "", false, "Read the multiway contacts of Pore-C, the segments of each read grouped by name, as the links of all their pairs, default is told by the bam header")
+	extractCmd.Flags().BoolVarP(&porecDownweight, "porecDownweight", "", false, "Weigh the pairs of a Pore-C read of n segments by 2/(n-1), so that the reads of many segments do not dominate")
+	extractCmd.Flags().BoolVarP(&dedup, "dedup", "", false, "Keep one of the read pairs of the same contigs, positions and strands, dropping the PCR and optical duplicates")
+	extractCmd.Flags().BoolVarP(&lowmem, "lowmem", "", false, "Sort the inter-contig links on disk and merge them into the clmfile, for the genomes of millions of contigs whose links do not fit in memory, the outputs being the same")
+	extractCmd.Flags().StringVarP(&tmpdir, "tmpdir", "", "", "Directory of the temporary files of --lowmem and --dedup, removed on exit, default is the system one")
+	extractCmd.Flags().IntVarP(&window, "window", "", CoverageWindow, "Window size of the Hi-C coverage track")
+	extractCmd.Flags().Float64VarP(&repeatRatio, "repeatRatio", "", RepeatRatio, "Coverage over the assembly median that marks a contig as a candidate repeat")
+	extractCmd.Flags().Float64VarP(&qcThresholds.MinMapped, "qcMinMapped", "", QCMinMapped, "Warn in the library QC when fewer pairs than this fraction have both reads mapped")
+	extractCmd.Flags().Float64VarP(&qcThresholds.MaxDuplicates, "qcMaxDuplicates", "", QCMaxDuplicates, "Warn in the library QC when more pairs passing MAPQ than this fraction are duplicates")
+	extractCmd.Flags().Float64VarP(&qcThresholds.MinLongCis, "qcMinLongCis", "", QCMinLongCis, "Warn in the library QC when fewer pairs than this fraction are within a contig and over 10 kb apart")
+	extractCmd.Flags().Float64VarP(&qcThresholds.MaxReligation, "qcMaxReligation", "", QCMaxReligation, "Warn in the library QC when more intra-contig pairs than this fraction are inward and under 2 kb apart, religated or uncut")
+	extractCmd.Flags().Float64VarP(&qcThresholds.MaxSelfCircle, "qcMaxSelfCircle", "", QCMaxSelfCircle, "Warn in the library QC when more intra-contig pairs than this fraction are outward and under 2 kb apart, self-circles")
+	extractCmd.Flags().IntVarP(&threads, "threads", "", runtime.NumCPU(), "Number of threads used to decompress and decode the bamfiles, the outputs being those of 1 thread")
+	extractCmd.Flags().Float64VarP(&minOverlap, "minOverlap", "", MinRefOverlap, "Abort when fewer sequences than this fraction match between the bam header and the FASTA")
+	extractCmd.Flags().BoolVarP(&force, "force", "", false, "Carry on when the bam header does not match the FASTA")
+	extractCmd.Flags().StringVarP(&outPrefix, "outPrefix", "o", "", "Write the outputs to <outPrefix>.*, creating its directory, default is the first bamfile without .bam")
 
 	allelesCmd := &cobra.Command{
 		Use:   "alleles genome.paf genome.counts_RE.txt",
@@ -123,10 +238,11 @@ tig00030660,PRIMARY -> tig00003333,HAPLOTIG
 		Run: func(cmd *cobra.Command, args []string) {
 			allelesFile := args[0]
 			pairsFile := args[1]
-			p := Pruner{AllelesFile: allelesFile, PairsFile: pairsFile}
+			p := Pruner{AllelesFile: allelesFile, PairsFile: pairsFile, OutPrefix: outPrefix}
 			p.Run()
 		},
 	}
+	pruneCmd.Flags().StringVarP(&outPrefix, "outPrefix", "o", "", "Write the pruned pairs to <outPrefix>.prune.txt, creating its directory, default is the pairs.txt without .txt")
 
 	var minREs, maxLinkDensity, nonInformativeRatio int
 	partitionCmd := &cobra.Command{
@@ -147,20 +263,25 @@ can be generated with the "extract" sub-command.
 			k, _ := strconv.Atoi(args[2])
 			p := Partitioner{Contigsfile: contigsfile, PairsFile: pairsFile, K: k,
 				MinREs: minREs, MaxLinkDensity: maxLinkDensity,
-				NonInformativeRatio: nonInformativeRatio}
+				NonInformativeRatio: nonInformativeRatio, Excludefile: excludefile, OutPrefix: outPrefix}
 			p.Run()
 		},
 	}
 	partitionCmd.Flags().IntVarP(&minREs, "minREs", "", MinREs, "Minimum number of RE sites in a contig to be clustered (CLUSTER_MIN_RE_SITES in LACHESIS)")
 	partitionCmd.Flags().IntVarP(&maxLinkDensity, "maxLinkDensity", "", MaxLinkDensity, "Density threshold before marking contig as repetitive (CLUSTER_MAX_LINK_DENSITY in LACHESIS)")
 	partitionCmd.Flags().IntVarP(&nonInformativeRatio, "nonInformativeRatio", "", NonInformativeRatio, "cutoff for recovering skipped contigs back into the clusters (CLUSTER_NON-INFORMATIVE_RATIO in LACHESIS)")
+	partitionCmd.Flags().StringVarP(&excludefile, "exclude", "", "", "Contigs to hold out of clustering, e.g. the repeats.txt from extract")
+	partitionCmd.Flags().StringVarP(&outPrefix, "outPrefix", "o", "", "Write the groups to <outPrefix>.<k>g<i>.txt and the clusters to <outPrefix>.clusters.txt, creating its directory, default is after the input files")
 
-	var skipGA, resume bool
+	var skipGA, noPolish, resume, debugPrune, strict, useCache, activeClm bool
+	var noPruneSize, noPruneDensity, noPruneTour, jointOrient, fixOrientation, orientOnly, resumeCheckpoint, inject, keepRestarts bool
 	var seed int64
-	var npop, ngen int
-	var mutpb float64
+	var timeLimit time.Duration
+	var npop, ngen, logInterval, tourInterval, keepBest, restarts, islands, migrationInterval, iterations, polishWindow, patience, injectStall, tournamentSize, elite, checkpointEvery, endDist, minSize, minPairLinks, distLB, distUB, distBins int
+	var mutpb, cxpb, startFraction, gfaWeight, gfaPenalty, tstart, tfactor, minDelta, diversityThreshold, injectFraction, minDensity, minOrientDelta float64
+	var score, normalize, recounts, selection, method, mutWeights, crossover, distFile, orientInit, stopAfter, startFrom, resumeFile, startTour, constraints, strands, gfa, dumpMatrix, aliasFile string
 	optimizeCmd := &cobra.Command{
-		Use:   "optimize counts_RE.txt clmfile",
+		Use:   "optimize counts_RE.txt [counts_RE.txt ...] clmfile [clmfile ...]",
 		Short: "Order-and-orient tigs in a group",
 		Long: `
 Optimize function:
@@ -170,24 +291,129 @@ for these contigs. Optimize run on a specific partition in "clusters.txt"
 as generated by "partition" sub-command, with the group_number matching the
 order appearing in "clusters.txt". Typically, if there are k clusters, we
 can start k separate "optimize" commands for parallelism (for example,
-on a cluster).
+on a cluster). The clmfile can be - to read it from stdin, e.g. from a
+filtering script, which cannot be combined with --resume, --startFrom,
+--useCache or --activeClm.
+
+Several groups can also run in one invocation, given their counts_RE files
+and either one clmfile for all of them or one for each, paired in order,
+e.g. "optimize group*.txt sample.clm". The groups share the --threads, and
+a summary of their contigs, scores and runtimes closes the run, which fails
+when any group does.
+
+With --timeLimit, or on SIGINT or SIGTERM, the GA stops after the current
+generation, writes the best tour so far and the checkpoint, and exits with
+status 75. Rerun with --resumeCheckpoint to carry on. A second signal aborts
+at once.
 `,
-		Args: cobra.ExactArgs(2),
+		Args: cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			refile := args[0]
-			clmfile := args[1]
-			p := Optimizer{REfile: refile, Clmfile: clmfile,
-				RunGA: !skipGA, Resume: resume,
-				Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb}
-			p.Run()
+			refiles, clmfiles, err := SplitGroupArgs(args)
+			ErrorAbort(err)
+			p := Optimizer{REfile: refiles[0], Clmfile: clmfiles[0],
+				RunGA: !skipGA, Method: method, TStart: tstart, TFactor: tfactor, Iterations: iterations,
+				NoPolish: noPolish, PolishWindow: polishWindow, ResumeFile: resumeFile,
+				StartTour: startTour, StartFraction: startFraction, ConstraintsFile: constraints, StrandsFile: strands,
+				GFAfile: gfa, GFAWeight: gfaWeight, GFAPenalty: gfaPenalty,
+				Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb,
+				LogInterval: logInterval, TourInterval: tourInterval, KeepBest: keepBest, Restarts: restarts, KeepRestarts: keepRestarts, Islands: islands, MigrationInterval: migrationInterval, MutWeights: mutWeights, Crossover: crossover, CrossProb: cxpb,
+				Selection: selection, TournamentSize: tournamentSize, Elite: elite, Patience: patience, MinDelta: minDelta,
+				Inject: inject, DiversityThreshold: diversityThreshold, InjectStall: injectStall, InjectFraction: injectFraction,
+				DebugPrune: debugPrune, Score: score, EndDist: endDist, DistFile: distFile, Normalize: normalize, REcounts: recounts,
+				OrientInit: orientInit, JointOrient: jointOrient, FixOrientation: fixOrientation, OrientOnly: orientOnly, StopAfter: stopAfter, StartFrom: startFrom, Strict: strict,
+				UseCache: useCache, MinContigSize: minSize, DensityLowerBound: minDensity,
+				Threads: threads, ActiveClm: activeClm, MinLinks: minPairLinks,
+				DistLB: distLB, DistUB: distUB, DistBins: distBins, DumpMatrix: dumpMatrix,
+				MinOrientationDelta: minOrientDelta, NoPruneSize: noPruneSize,
+				NoPruneDensity: noPruneDensity, NoPruneTour: noPruneTour, AliasFile: aliasFile,
+				CheckpointEvery: checkpointEvery, ResumeCheckpoint: resumeCheckpoint, TimeLimit: timeLimit,
+				OutPrefix: outPrefix}
+			ctx, stop := interruptContext()
+			defer stop()
+			p.Context = ctx
+			if len(refiles) == 1 {
+				err = p.Run()
+			} else {
+				_, err = OptimizeGroups(p, refiles, clmfiles)
+			}
+			if err == ErrInterrupted {
+				log.Warning("Optimization interrupted, rerun with --resumeCheckpoint to carry on")
+				stop()
+				os.Exit(ExitInterrupted)
+			}
+			ErrorAbort(err)
 		},
 	}
-	optimizeCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step")
-	optimizeCmd.Flags().BoolVarP(&resume, "resume", "", false, "Resume from existing tour file")
+	optimizeCmd.Flags().BoolVarP(&skipGA, "skipGA", "", false, "Skip GA step, or the SA with --method sa")
+	optimizeCmd.Flags().StringVarP(&method, "method", "", MethodGA, "Ordering method, ga for the genetic algorithm or sa for simulated annealing, which suits groups under 200 contigs")
+	optimizeCmd.Flags().Float64VarP(&tstart, "tstart", "", SATStart, "Starting temperature of SA, relative to the score of the initial tour")
+	optimizeCmd.Flags().Float64VarP(&tfactor, "tfactor", "", SATFactor, "Factor of the temperature of SA at each iteration")
+	optimizeCmd.Flags().IntVarP(&iterations, "iterations", "", SAIterations, "Number of SA iterations")
+	optimizeCmd.Flags().BoolVarP(&noPolish, "noPolish", "", false, "Skip the hill climbing by segment reversals and contig moves after the GA")
+	optimizeCmd.Flags().IntVarP(&polishWindow, "polishWindow", "", PolishWindow, "Longest segment reversed, and farthest contig move, when polishing the tour after the GA")
+	optimizeCmd.Flags().StringVarP(&resumeFile, "resume", "", "", "Resume from the last tour in this tour file, e.g. the .tour of an earlier run")
+	optimizeCmd.Flags().StringVarP(&startTour, "startTour", "", "", "Order the active contigs as in the last tour of this file rather than shuffled, e.g. from a genetic map, the missing ones appended")
+	optimizeCmd.Flags().StringVarP(&constraints, "constraints", "", "", "Pin contigs during the optimization, from a file of rows of contig, position and fixed, left or right, left and right keeping them in the first and last 10% of the tour")
+	optimizeCmd.Flags().StringVarP(&strands, "strands", "", "", "Impose the orientations of contigs, from a file of rows of contig and + or -, e.g. from long reads")
+	optimizeCmd.Flags().StringVarP(&gfa, "gfa", "", "", "Favor the contigs joined by the L-lines of this assembly graph in GFA, when next to each other in the orientations of the edge")
+	optimizeCmd.Flags().Float64VarP(&gfaWeight, "gfaWeight", "", GFAWeight, "Bonus of each edge of --gfa whose contigs are next to each other, relative to the score of a contig next to its best-linked partner")
+	optimizeCmd.Flags().Float64VarP(&gfaPenalty, "gfaPenalty", "", 0, "Penalty of each edge of --gfa whose contigs are apart in the tour, relative as --gfaWeight")
+	optimizeCmd.Flags().Float64VarP(&startFraction, "startFraction", "", StartFraction, "Fraction of the GA population seeded with perturbed copies of --startTour, the rest shuffled")
 	optimizeCmd.Flags().Int64VarP(&seed, "seed", "", Seed, "Random seed")
 	optimizeCmd.Flags().IntVarP(&npop, "npop", "", Npop, "Population size")
 	optimizeCmd.Flags().IntVarP(&ngen, "ngen", "", Ngen, "Number of generations for convergence")
+	optimizeCmd.Flags().IntVarP(&logInterval, "logInterval", "", 1, "Write the best, mean and std-dev of the scores to <prefix>.ga.log.csv every this many generations")
+	optimizeCmd.Flags().IntVarP(&tourInterval, "tourInterval", "", TourInterval, "Append the best tour of the GA to the tour file every this many generations")
+	optimizeCmd.Flags().IntVarP(&keepBest, "keepBest", "", 0, "Keep this many best distinct tours of the GA in <prefix>.best<N>.tour, a tour and its reverse being the same")
+	optimizeCmd.Flags().IntVarP(&restarts, "restarts", "", 1, "Run the GA this many times from the same contigs with seeds derived from --seed, go on from the best tour, and write the scores to <prefix>.restarts.tsv")
+	optimizeCmd.Flags().BoolVarP(&keepRestarts, "keepRestarts", "", false, "Keep the tour file of each of the --restarts, <prefix>.restart<N>.tour")
+	optimizeCmd.Flags().IntVarP(&islands, "islands", "", 1, "Number of GA populations of --npop tours evolved in parallel, which exchange their best tours")
+	optimizeCmd.Flags().IntVarP(&migrationInterval, "migrationInterval", "", MigrationInterval, "Number of generations between the exchanges of the best tours of the --islands")
+	optimizeCmd.Flags().IntVarP(&patience, "patience", "", 0, "Stop the GA after this many generations without improving the best score by more than --minDelta, 0 uses --ngen")
+	optimizeCmd.Flags().Float64VarP(&minDelta, "minDelta", "", 0, "Smallest improvement of the best score, relative to it, that resets --patience")
+	optimizeCmd.Flags().BoolVarP(&inject, "inject", "", false, "Replace the worst tours of a GA population with shuffled ones when it stagnates under --diversity for --injectStall generations")
+	optimizeCmd.Flags().Float64VarP(&diversityThreshold, "diversity", "", DiversityThreshold, "Mean Kendall tau distance between the tours of a GA population, 0 for copies to 1 for random ones, under which it stagnates with --inject")
+	optimizeCmd.Flags().IntVarP(&injectStall, "injectStall", "", InjectStall, "Number of generations in a row under --diversity before the injection")
+	optimizeCmd.Flags().Float64VarP(&injectFraction, "injectFraction", "", InjectFraction, "Fraction of the worst tours of a stagnant GA population replaced by shuffled ones with --inject")
 	optimizeCmd.Flags().Float64VarP(&mutpb, "mutapb", "", MutaProb, "Mutation prob in GA")
+	optimizeCmd.Flags().StringVarP(&mutWeights, "mutWeights", "", "", "Weights of the GA mutations swap, splice, insert, reverse and translocate, e.g. swap:1,reverse:1,translocate:0.5, unlisted ones are off, default is swap:0.2,splice:0.2,insert:0.3,reverse:0.3")
+	optimizeCmd.Flags().StringVarP(&crossover, "crossover", "", CrossoverNone, "Crossover operator in GA, none, ox for order, pmx for partially mapped or er for edge recombination")
+	optimizeCmd.Flags().Float64VarP(&cxpb, "cxpb", "", 0, "Crossover prob in GA with --crossover, 0 uses 0.7")
+	optimizeCmd.Flags().StringVarP(&selection, "selection", "", SelectionTournament, "Selection of the parents in GA, tournament of --tournamentSize tours or roulette by fitness")
+	optimizeCmd.Flags().IntVarP(&tournamentSize, "tournamentSize", "", TournamentSize, "Number of tours competing for each parent with --selection tournament, at least 2 and under --npop")
+	optimizeCmd.Flags().IntVarP(&elite, "elite", "", 0, "Number of best tours of each GA population copied unchanged to the next generation, under --npop")
+	optimizeCmd.Flags().BoolVarP(&debugPrune, "debugPrune", "", false, "Write per-contig delta scores of tour pruning to <prefix>.prune_deltas.tsv, with --stopAfter prune")
+	optimizeCmd.Flags().IntVarP(&checkpointEvery, "checkpoint", "", CheckpointGenerations, "Save the state of the GA to <prefix>.ga.checkpoint every this many generations, 0 never does")
+	optimizeCmd.Flags().DurationVarP(&timeLimit, "timeLimit", "", 0, "Stop the GA after the generation that reaches this wall-clock time, e.g. 20h, writing the best tour and the checkpoint, 0 never stops")
+	optimizeCmd.Flags().BoolVarP(&resumeCheckpoint, "resumeCheckpoint", "", false, "Pick the GA up from <prefix>.ga.checkpoint, rerun with the options of the run that wrote it")
+	optimizeCmd.Flags().BoolVarP(&jointOrient, "jointOrient", "", false, "Optimize the orientations along with the ordering in the GA, scoring nearby contigs by their oriented links")
+	optimizeCmd.Flags().BoolVarP(&fixOrientation, "fixOrientation", "", false, "Only optimize the ordering, keeping the orientations of --startTour or --resume, + otherwise, without any flip")
+	optimizeCmd.Flags().BoolVarP(&orientOnly, "orientOnly", "", false, "Only optimize the orientations of the contigs of --startTour, keeping its order, without the GA")
+	optimizeCmd.Flags().StringVarP(&orientInit, "orientInit", "", OrientInitSpectral, "Orientation initialization, spectral for the eigenvector of the strandedness matrix or greedy along the strongest links")
+	optimizeCmd.Flags().StringVarP(&score, "score", "", ScoreDefault, "Ordering score, default, endWeighted to weight links by the fraction near the joining ends, or likelihood of the links under the link size distribution")
+	optimizeCmd.Flags().StringVarP(&normalize, "normalize", "", NormalizeNone, "Normalize the links of each contig pair in the ordering score, none, re by the product of their RE counts or length by the product of their lengths")
+	optimizeCmd.Flags().StringVarP(&recounts, "REcounts", "", "", "RE counts of the contigs for --normalize re, as the counts_RE file of extract, or the effective lengths of its omnic mode, default is counts_RE.txt")
+	optimizeCmd.Flags().StringVarP(&distFile, "dist", "", "", "Link size distribution written by extract, default is prefix.distribution.txt next to the clmfile")
+	optimizeCmd.Flags().BoolVarP(&strict, "strict", "", false, "Abort on the first malformed clm row instead of skipping it")
+	optimizeCmd.Flags().StringVarP(&outPrefix, "outPrefix", "o", "", "Write the outputs to <outPrefix>.tour and the like, creating its directory, default is the name of the counts_RE.txt in the working directory; one group only")
+	optimizeCmd.Flags().IntVarP(&minSize, "minSize", "", 0, "Inactivate tigs shorter than this, 0 keeps all tigs")
+	optimizeCmd.Flags().Float64VarP(&minDensity, "minDensity", "", 0, "Inactivate tigs under 100 kb with fewer links per bp than this, 0 keeps all tigs")
+	optimizeCmd.Flags().BoolVarP(&noPruneSize, "noPruneSize", "", false, "Keep the tigs shorter than --minSize")
+	optimizeCmd.Flags().BoolVarP(&noPruneDensity, "noPruneDensity", "", false, "Keep the tigs under --minDensity")
+	optimizeCmd.Flags().BoolVarP(&noPruneTour, "noPruneTour", "", false, "Keep the tigs that do not add to the tour score with --stopAfter=prune")
+	optimizeCmd.Flags().IntVarP(&minPairLinks, "minLinks", "", 1, "Drop the contig pairs with fewer links than this in all orientations")
+	optimizeCmd.Flags().IntVarP(&distLB, "distLB", "", 0, "Link distance at the center of the first golden array bin, 0 uses 5778 (phi^18)")
+	optimizeCmd.Flags().IntVarP(&distUB, "distUB", "", 0, "Link distance at the center of the last golden array bin, 0 uses 1149851 (phi^29)")
+	optimizeCmd.Flags().IntVarP(&distBins, "distBins", "", 0, "Number of golden array bins between --distLB and --distUB, 0 uses 12")
+	optimizeCmd.Flags().BoolVarP(&activeClm, "activeClm", "", false, "Also write the clm rows between active tigs to <prefix>.active.clm")
+	optimizeCmd.Flags().Float64VarP(&minOrientDelta, "minOrientDelta", "", MinOrientationDelta, "Flag the tigs in <prefix>.orientation.tsv whose score drops by less than this when flipped")
+	optimizeCmd.Flags().StringVarP(&aliasFile, "aliases", "", "", "Two-column file mapping the contig names in the inputs to canonical names")
+	optimizeCmd.Flags().StringVarP(&dumpMatrix, "dumpMatrix", "", "", "Write the strandedness matrix O and contact matrix M of the active tigs to <dumpMatrix>.O.tsv and <dumpMatrix>.M.tsv")
+	optimizeCmd.Flags().BoolVarP(&useCache, "useCache", "", false, "Keep the parsed clm in <prefix>.clm.cache and reuse it while newer than the clm and ids files")
+	optimizeCmd.Flags().StringVarP(&stopAfter, "stopAfter", "", "", "Write <prefix>.active.json and stop after this stage, activate or prune (which also writes <prefix>.prune.json)")
+	optimizeCmd.Flags().StringVarP(&startFrom, "startFrom", "", "", "Start from this stage, ga, with the state written by --stopAfter")
+	optimizeCmd.Flags().IntVarP(&threads, "threads", "", runtime.NumCPU(), "Number of threads used to parse large clmfiles, score contig deletions when pruning and score the GA population")
+	optimizeCmd.Flags().IntVarP(&endDist, "endDist", "", 0, "Distance below which a link is near the ends for --score=endWeighted, 0 uses P90 of the extract distribution")
 
 	buildCmd := &cobra.Command{
 		Use:   "build tourfile1 tourfile2 ... contigs.fasta asm.chr.fasta",
@@ -210,10 +436,14 @@ into a FASTA genome release.
 			outfastafile := args[len(args)-1]
 			p := Builder{Tourfiles: tourfiles,
 				Fastafile:    fastafile,
-				OutFastafile: outfastafile}
+				OutFastafile: outfastafile,
+				Threads:      threads,
+				AliasFile:    aliasFile}
 			p.Run()
 		},
 	}
+	buildCmd.Flags().IntVarP(&threads, "threads", "", runtime.NumCPU(), "Number of threads used to build scaffold sequences")
+	buildCmd.Flags().StringVarP(&aliasFile, "aliases", "", "", "Two-column file mapping the contig names in the inputs to canonical names")
 
 	plotCmd := &cobra.Command{
 		Use:   "plot bamfile tourfile",
@@ -233,6 +463,162 @@ Given a bamfile, we extract matrix of link counts and plot heatmap.
 		},
 	}
 
+	var memLimit, idsfile string
+	anchorCmd := &cobra.Command{
+		Use:   "anchor bamfile",
+		Short: "Merge contigs into paths based on Hi-C links",
+		Long: `
+Anchor function:
+Given a bamfile, we iteratively merge contigs into paths using a graph of
+Hi-C links between path ends. With --memLimit, the links are binned and kept
+in a temporary file that is re-read in each round, so that memory use is
+capped at contig-scale structures.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			bamfile := args[0]
+			p := Anchorer{Bamfile: bamfile, Excludefile: excludefile, Idsfile: idsfile,
+				MinOverlap: minOverlap, Force: force}
+			if memLimit != "" {
+				limit, err := ParseByteSize(memLimit)
+				ErrorAbort(err)
+				p.MemLimit = limit
+			}
+			p.Run()
+		},
+	}
+	anchorCmd.Flags().StringVarP(&memLimit, "memLimit", "", "", "Run in two-pass mode, holding at most this much binned links in memory, e.g. 64G")
+	anchorCmd.Flags().StringVarP(&excludefile, "exclude", "", "", "Contigs whose links are left out of the merging, e.g. the repeats.txt from extract")
+	anchorCmd.Flags().StringVarP(&idsfile, "ids", "", "", "Contig sizes (ids file or FASTA index) to check the bam header against")
+	anchorCmd.Flags().Float64VarP(&minOverlap, "minOverlap", "", MinRefOverlap, "Abort when fewer sequences than this fraction match between the bam header and --ids")
+	anchorCmd.Flags().BoolVarP(&force, "force", "", false, "Carry on when the bam header does not match --ids")
+
+	groupqcCmd := &cobra.Command{
+		Use:   "groupqc clusters.txt alleles.table",
+		Short: "Check the partition against the allelic contigs",
+		Long: `
+Groupqc function:
+Given the clusters from "partition" and the allele table used by "prune",
+count for each allele group how many of its contigs landed in the same
+cluster. Allelic contigs should end up in different haplotypes, so allelic
+pairs within a cluster are conflicts that flag failed pruning or clustering.
+Writes the allelic pairs between each pair of clusters to clusters.groupqc.txt
+and the per allele group counts to clusters.groupqc.alleles.txt.
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := GroupQCer{Clustersfile: args[0], AllelesFile: args[1]}
+			p.Run()
+		},
+	}
+
+	statsCmd := &cobra.Command{
+		Use:   "stats counts_RE.txt clmfile",
+		Short: "Summarize the links of each contig in a clmfile",
+		Long: `
+Stats function:
+For each contig in counts_RE.txt, report its size, the number of partner
+contigs, the total inter-contig links in the clmfile and the link density
+per bp, as well as whether the --minSize and --minDensity cutoffs of
+"optimize" would inactivate it. Writes clmfile.stats.txt, in the order of
+counts_RE.txt, and logs the active count, total length and median density.
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := Statser{REfile: args[0], Clmfile: args[1],
+				MinContigSize: minSize, DensityLowerBound: minDensity}
+			p.Run()
+		},
+	}
+	statsCmd.Flags().IntVarP(&minSize, "minSize", "", 0, "Inactivate tigs shorter than this, 0 keeps all tigs")
+	statsCmd.Flags().Float64VarP(&minDensity, "minDensity", "", 0, "Inactivate tigs under 100 kb with fewer links per bp than this, 0 keeps all tigs")
+
+	splitclmCmd := &cobra.Command{
+		Use:   "splitclm counts_RE.txt clmfile groups.txt",
+		Short: "Split a clmfile into one clmfile per group of contigs",
+		Long: `
+Splitclm function:
+Given groups.txt, with one contig and its group per line, write for every
+group the rows of the clmfile where both contigs are in that group to
+clmfile.group.clm, and the lines of counts_RE.txt for its contigs to
+clmfile.group.ids, in the current directory. Each pair can then be given to "optimize". Contigs in
+groups.txt that are not in counts_RE.txt are reported at the end.
+`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := CLMSplitter{REfile: args[0], Clmfile: args[1], Groupsfile: args[2]}
+			p.Run()
+		},
+	}
+
+	tourscoreCmd := &cobra.Command{
+		Use:   "tourscore counts_RE.txt clmfile tourfile",
+		Short: "Score every tour in a tour file",
+		Long: `
+Tourscore function:
+Re-evaluate each tour in the tourfile, e.g. as written by "optimize", against
+the links in the clmfile, and print one line per tour with its label, the
+ordering score (as in the score= of the tour headers) and the score with the
+orientations. Tours from runs with different parameters can thus be compared.
+`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := TourScorer{REfile: args[0], Clmfile: args[1], Tourfile: args[2]}
+			p.Run()
+		},
+	}
+
+	var dumpFormat string
+	var matrixMinLinks int
+	dumpmatrixCmd := &cobra.Command{
+		Use:   "dumpmatrix counts_RE.txt clmfile out.tsv",
+		Short: "Write the contact matrix of a group for plotting",
+		Long: `
+Dumpmatrix function:
+Write the number of links between every two contigs in the clmfile, after
+the --minLinks, --minSize and --minDensity filters of "optimize", so that
+the matrix is the one the optimizer sees. Only the contigs that are still
+active are written. The format is tsv, with the contig names along the
+first row and column and gzip compressed when out.tsv ends with .gz, or
+npy, with the contig names in out.npy.names. It is guessed from the
+extension of the output file unless given with --format.
+`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := MatrixDumper{REfile: args[0], Clmfile: args[1], Outfile: args[2],
+				Format: dumpFormat, MinLinks: matrixMinLinks,
+				MinContigSize: minSize, DensityLowerBound: minDensity}
+			p.Run()
+		},
+	}
+	dumpmatrixCmd.Flags().StringVarP(&dumpFormat, "format", "", "", "Output format, tsv or npy, empty guesses it from the output file")
+	dumpmatrixCmd.Flags().IntVarP(&matrixMinLinks, "minLinks", "", 1, "Drop the contig pairs with fewer links than this in all orientations")
+	dumpmatrixCmd.Flags().IntVarP(&minSize, "minSize", "", 0, "Inactivate tigs shorter than this, 0 keeps all tigs")
+	dumpmatrixCmd.Flags().Float64VarP(&minDensity, "minDensity", "", 0, "Inactivate tigs under 100 kb with fewer links per bp than this, 0 keeps all tigs")
+
+	var idsfiles []string
+	mergeclmCmd := &cobra.Command{
+		Use:   "mergeclm out.clm in1.clm in2.clm ...",
+		Short: "Merge the clmfiles of several Hi-C libraries",
+		Long: `
+Mergeclm function:
+Given the clmfiles extracted separately from several Hi-C libraries of the
+same contigs, with their ids files in the same order in --ids, write one
+clmfile with a row per oriented contig pair holding the links of all the
+libraries, and out.ids with the union of the contigs. The contig sizes must
+agree between the ids files.
+`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			p := CLMMerger{OutClmfile: args[0], Clmfiles: args[1:], REfiles: idsfiles,
+				Strict: strict}
+			p.Run()
+		},
+	}
+	mergeclmCmd.Flags().StringSliceVarP(&idsfiles, "ids", "", nil, "Comma-separated ids or counts_RE files, one per input clmfile")
+	mergeclmCmd.Flags().BoolVarP(&strict, "strict", "", false, "Abort on the first malformed clm row instead of skipping it")
+	_ = mergeclmCmd.MarkFlagRequired("ids")
+
 	assessCmd := &cobra.Command{
 		Use:   "assess bamfile bedfile chr1",
 		Short: "Assess the orientations of contigs",
@@ -246,10 +632,14 @@ as a quality assessment step.
 			bamfile := args[0]
 			bedfile := args[1]
 			seqid := args[2]
-			p := Assesser{Bamfile: bamfile, Bedfile: bedfile, Seqid: seqid}
+			p := Assesser{Bamfile: bamfile, Bedfile: bedfile, Seqid: seqid,
+				MinOverlap: minOverlap, Force: force, DistLowerBound: distLowerBound}
 			p.Run()
 		},
 	}
+	assessCmd.Flags().Float64VarP(&minOverlap, "minOverlap", "", MinRefOverlap, "Abort when fewer bed sequences than this fraction fit in the bam header")
+	assessCmd.Flags().BoolVarP(&force, "force", "", false, "Carry on when the bam header does not match the bedfile")
+	assessCmd.Flags().IntVarP(&distLowerBound, "distLowerBound", "", DistLowerBound, "Leave the intra-contig links shorter than this out of the distribution")
 
 	pipelineCmd := &cobra.Command{
 		Use:   "pipeline bamfile fastafile k",
@@ -270,14 +660,21 @@ A convenience driver function. Chain the following steps sequentially.
 			k, _ := strconv.Atoi(args[2])
 
 			// Extract the contig pairs, count RE sites
-			banner(fmt.Sprintf("Extractor started (RE = %s)", RE))
-			extractor := Extracter{Bamfile: bamfile, Fastafile: fastafile, RE: RE}
-			extractor.Run()
+			if mode == ModeOmniC {
+				banner(fmt.Sprintf("Extractor started (mode = %s)", mode))
+			} else {
+				banner(fmt.Sprintf("Extractor started (RE = %s)", RE))
+			}
+			extractor := Extracter{Bamfile: bamfile, Fastafile: fastafile, RE: RE, Mode: mode,
+				MinMapq: minMapq, KeepSecondary: keepSecondary, KeepSupplementary: keepSupplementary,
+				KeepQCFail: keepQCFail, Threads: threads, MinOverlap: minOverlap, Force: force,
+				OutPrefix: outPrefix}
+			ErrorAbort(extractor.Run())
 
 			// Partition into k groups
 			banner(fmt.Sprintf("Partition into %d groups", k))
 			partitioner := Partitioner{Contigsfile: extractor.OutContigsfile,
-				PairsFile: extractor.OutPairsfile, K: k}
+				PairsFile: extractor.OutPairsfile, K: k, OutPrefix: outPrefix}
 			partitioner.Run()
 
 			// Optimize the k groups separately
@@ -287,8 +684,13 @@ A convenience driver function. Chain the following steps sequentially.
 				optimizer := Optimizer{REfile: refile,
 					Clmfile: extractor.OutClmfile,
 					RunGA:   !skipGA, Resume: resume,
-					Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb}
-				optimizer.Run()
+					Seed: seed, NPop: npop, NGen: ngen, MutProb: mutpb,
+					Threads: threads, MinOrientationDelta: MinOrientationDelta}
+				if outPrefix != "" {
+					// Next to the groups rather than in the working directory
+					optimizer.OutPrefix = RemoveExt(refile)
+				}
+				ErrorAbort(optimizer.Run())
 				tourfiles = append(tourfiles, optimizer.OutTourFile)
 			}
 
@@ -298,12 +700,22 @@ A convenience driver function. Chain the following steps sequentially.
 				fmt.Sprintf("asm-g%d.chr.fasta", k))
 			builder := Builder{Tourfiles: tourfiles,
 				Fastafile:    fastafile,
-				OutFastafile: outfastafile}
+				OutFastafile: outfastafile,
+				Threads:      threads,
+				AliasFile:    aliasFile}
 			builder.Run()
 		},
 	}
 	pipelineCmd.Flags().StringVarP(&RE, "RE", "", DefaultRE, "Restriction site pattern, use comma to separate multiple patterns (N is considered as [ACGT]), e.g. 'GATCGATC,GANTGATC,GANTANTC,GATCANTC'")
+	pipelineCmd.Flags().StringVarP(&mode, "mode", "", ModeRE, "Counts of the contigs, re for the sites of --RE or omnic for their lengths less the Ns, for Omni-C and other enzyme-free libraries")
 	pipelineCmd.Flags().IntVarP(&minLinks, "minLinks", "", MinLinks, "Minimum number of links for contig pair")
+	pipelineCmd.Flags().IntVarP(&minMapq, "minMapq", "", 0, "Skip the reads with a lower MAPQ, or whose mate has one by its MQ tag, 0 only skips MAPQ 0")
+	pipelineCmd.Flags().BoolVarP(&keepSecondary, "keepSecondary", "", false, "Use the secondary alignments (flag 0x100), skipped by default")
+	pipelineCmd.Flags().BoolVarP(&keepSupplementary, "keepSupplementary", "", false, "Use the supplementary alignments (flag 0x800), skipped by default")
+	pipelineCmd.Flags().BoolVarP(&keepQCFail, "keepQCFail", "", false, "Use the reads failing the quality checks (flag 0x200), skipped by default")
+	pipelineCmd.Flags().Float64VarP(&minOverlap, "minOverlap", "", MinRefOverlap, "Abort when fewer sequences than this fraction match between the bam header and the FASTA")
+	pipelineCmd.Flags().BoolVarP(&force, "force", "", false, "Carry on when the bam header does not match the FASTA")
+	pipelineCmd.Flags().StringVarP(&outPrefix, "outPrefix", "o", "", "Write the outputs of all the steps to <outPrefix>.*, creating its directory, default is after the bamfile")
 
 	pipelineCmd.Flags().IntVarP(&minREs, "minREs", "", MinREs, "Minimum number of RE sites in a contig to be clustered (CLUSTER_MIN_RE_SITES in LACHESIS)")
 	pipelineCmd.Flags().IntVarP(&maxLinkDensity, "maxLinkDensity", "", MaxLinkDensity, "Density threshold before marking contig as repetive (CLUSTER_MAX_LINK_DENSITY in LACHESIS)")
@@ -315,6 +727,8 @@ A convenience driver function. Chain the following steps sequentially.
 	pipelineCmd.Flags().IntVarP(&npop, "npop", "", Npop, "Population size")
 	pipelineCmd.Flags().IntVarP(&ngen, "ngen", "", Ngen, "Number of generations for convergence")
 	pipelineCmd.Flags().Float64VarP(&mutpb, "mutapb", "", MutaProb, "Mutation prob in GA")
+	pipelineCmd.Flags().IntVarP(&threads, "threads", "", runtime.NumCPU(), "Number of threads used to decode the bamfile, parse large clmfiles, prune and optimize tours and build scaffold sequences")
 
-	rootCmd.AddCommand(extractCmd, allelesCmd, pruneCmd, partitionCmd, optimizeCmd, buildCmd, plotCmd, assessCmd, pipelineCmd)
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Hide the progress messages while reading large files")
+	rootCmd.AddCommand(extractCmd, allelesCmd, pruneCmd, partitionCmd, groupqcCmd, optimizeCmd, statsCmd, splitclmCmd, mergeclmCmd, dumpmatrixCmd, tourscoreCmd, buildCmd, plotCmd, anchorCmd, assessCmd, pipelineCmd)
 }
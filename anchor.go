@@ -19,7 +19,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/biogo/hts/bam"
 	"github.com/kshedden/gonpy"
 )
 
@@ -27,9 +26,15 @@ import (
 type Anchorer struct {
 	Bamfile      string
 	Tourfile     string
+	MemLimit     int64  // When > 0, links are binned and kept on disk rather than in memory
+	Excludefile  string // Contigs listed here are left out of the merging
+	Idsfile      string // When set, the bam header is checked against these sizes
+	MinOverlap   float64
+	Force        bool
 	contigs      []*Contig
 	nameToContig map[string]*Contig
 	path         *Path
+	bins         *binnedLinks
 }
 
 // AnchorerJSON keeps a succinct subset of all fields in Anchorer
@@ -44,6 +49,7 @@ type AnchorerJSON struct {
 
 // Contig stores the name and length of each contig
 type Contig struct {
+	idx         int
 	name        string
 	length      int64
 	links       []*Link
@@ -94,6 +100,9 @@ func (r *Anchorer) Run() {
 	// Prepare the paths to run
 	nIterations := 1
 	r.ExtractInterContigLinks()
+	if r.bins != nil {
+		defer r.bins.remove()
+	}
 	flanksize := int64(LIMIT)
 	paths := r.makeTrivialPaths(r.contigs, flanksize)
 	for i := 0; i < nIterations; i++ {
@@ -211,17 +220,33 @@ func (r *Anchorer) ExtractInterContigLinks() {
 	idsfile := prefix + ".ids"
 
 	log.Noticef("Parse bamfile `%s`", r.Bamfile)
-	br, _ := bam.NewReader(fh, 0)
+	br, err := newBAMRecordReader(fh, 0)
+	if err != nil {
+		log.Errorf("Cannot open bamfile `%s` (%s)", r.Bamfile, err)
+		os.Exit(1)
+	}
 
-	fdis, _ := os.Create(disfile)
+	fdis := mustCreateAtomic(disfile)
 	wdis := bufio.NewWriter(fdis)
-	fids, _ := os.Create(idsfile)
+	fids := mustCreateAtomic(idsfile)
 	wids := bufio.NewWriter(fids)
 
+	if r.MemLimit > 0 {
+		r.bins = newBinnedLinks(r.MemLimit)
+	}
+
 	r.nameToContig = make(map[string]*Contig)
 	refs := br.Header().Refs()
+	if r.Idsfile != "" {
+		sizes, ok := readSizes(r.Idsfile)
+		if !ok {
+			ErrorAbort(fmt.Errorf("cannot read the sizes in `%s`", r.Idsfile))
+		}
+		RefCheck{MinOverlap: r.MinOverlap, Force: r.Force}.Sizes(refs, sizes, r.Idsfile)
+	}
 	for _, ref := range refs {
 		contig := Contig{
+			idx:    len(r.contigs),
 			name:   ref.Name(),
 			length: int64(ref.Len()),
 		}
@@ -229,40 +254,59 @@ func (r *Anchorer) ExtractInterContigLinks() {
 		r.nameToContig[contig.name] = &contig
 		_, _ = fmt.Fprintf(wids, "%s\t%d\n", ref.Name(), ref.Len())
 	}
-	_ = wids.Flush()
+	ErrorAbort(wids.Flush())
+	ErrorAbort(fids.Close())
 	log.Noticef("Extracted %d contigs to `%s`", len(r.contigs), idsfile)
 
+	filter := NewContigFilter("", r.Excludefile)
+	filter.WarnUnknown(func(name string) bool { return r.nameToContig[name] != nil }, r.Bamfile)
+
 	// Import links into pairs of contigs
-	intraTotal, interTotal := 0, 0
+	intraTotal, interTotal, excludedTotal := 0, 0, 0
 	intraLinks := make(map[string][]int)
+	var rec bamRecord
 	for {
-		rec, err := br.Read()
-		if err != nil {
+		if err := br.Read(&rec); err != nil {
 			if err != io.EOF {
 				log.Error(err)
 			}
 			break
 		}
 
-		at, bt := rec.Ref.Name(), rec.MateRef.Name()
-		a, b := r.nameToContig[at], r.nameToContig[bt]
-		apos, bpos := rec.Pos, rec.MatePos
+		// Contigs are indexed in header order, so reference IDs index them
+		if rec.RefID < 0 || int(rec.RefID) >= len(r.contigs) ||
+			rec.MateRefID < 0 || int(rec.MateRefID) >= len(r.contigs) {
+			continue
+		}
+		a, b := r.contigs[rec.RefID], r.contigs[rec.MateRefID]
+		apos, bpos := int(rec.Pos), int(rec.MatePos)
 
 		// An intra-contig link
 		if a == b {
 			if link := abs(apos - bpos); link >= MinLinkDist {
-				intraLinks[at] = append(intraLinks[at], link)
+				intraLinks[a.name] = append(intraLinks[a.name], link)
 			}
 			intraTotal++
 			continue
 		}
 
 		// An inter-contig link
-		a.links = append(a.links, &Link{
-			a: a, b: b, apos: int64(apos), bpos: int64(bpos),
-		})
+		if !filter.Keep(a.name) || !filter.Keep(b.name) {
+			excludedTotal++
+			continue
+		}
+		if r.bins != nil {
+			r.bins.add(a, b, int64(apos), int64(bpos))
+		} else {
+			a.links = append(a.links, &Link{
+				a: a, b: b, apos: int64(apos), bpos: int64(bpos),
+			})
+		}
 		interTotal++
 	}
+	if r.bins != nil {
+		r.bins.close()
+	}
 
 	for _, contig := range r.contigs {
 		sort.Slice(contig.links, func(i, j int) bool {
@@ -275,12 +319,36 @@ func (r *Anchorer) ExtractInterContigLinks() {
 		links = unique(links)
 		_, _ = fmt.Fprintf(wdis, "%s\t%s\n", contig, arrayToString(links, ","))
 	}
-	_ = wdis.Flush()
+	ErrorAbort(wdis.Flush())
+	ErrorAbort(fdis.Close())
 	log.Noticef("Extracted %d intra-contig and %d inter-contig links",
 		intraTotal, interTotal)
+	if filter != nil {
+		log.Noticef("Ignored %d inter-contig links to excluded contigs", excludedTotal)
+	}
 	_ = br.Close()
 }
 
+// forEachLink calls f on every inter-contig link, either held in memory or
+// streamed from the binned links on disk, where n is the multiplicity
+func (r *Anchorer) forEachLink(f func(link *Link, n int64)) {
+	if r.bins == nil {
+		for _, contig := range r.contigs {
+			for _, link := range contig.links {
+				f(link, 1)
+			}
+		}
+		return
+	}
+	var link Link
+	r.bins.forEach(func(ai, bi int, apos, bpos, n int64) {
+		a, b := r.contigs[ai], r.contigs[bi]
+		link = Link{a: a, b: b,
+			apos: minInt64(apos, a.length-1), bpos: minInt64(bpos, b.length-1)}
+		f(&link, n)
+	})
+}
+
 // reverse reverses the orientations of all components
 func (r *Path) reverse() {
 	c := r.contigs
@@ -323,12 +391,12 @@ func (r *Anchorer) linkToNodes(link *Link) (*Node, *Node) {
 	return a, b
 }
 
-// insertEdge adds just one link to the graph
-func (r *Anchorer) insertEdge(G Graph, a, b *Node) {
+// insertEdge adds n links to the graph
+func (r *Anchorer) insertEdge(G Graph, a, b *Node, n int64) {
 	if _, aok := G[a]; aok {
-		G[a][b]++
+		G[a][b] += n
 	} else {
-		G[a] = map[*Node]int64{b: 1}
+		G[a] = map[*Node]int64{b: n}
 	}
 }
 
@@ -579,36 +647,39 @@ func (r *Anchorer) serialize(res int64, jsonfile, npyfile string) {
 	A.TotalBins = m
 	// Initialize the count matrix
 	C := make([]int32, m*m)
+	inPath := make(map[*Contig]bool)
 	for _, contig := range r.path.contigs {
 		A.Starts[contig.name] = contig.start / res
 		A.Sizes[contig.name] = contig.length / res
-		for _, link := range contig.links {
-			// The link need to be within the path!
-			if link.a.path != link.b.path {
-				continue
-			}
-			a := findBin(link.a, link.apos, res)
-			b := findBin(link.b, link.bpos, res)
-			C[a*m+b]++
-			C[b*m+a]++
-		}
+		inPath[contig] = true
 	}
+	r.forEachLink(func(link *Link, n int64) {
+		// The link need to be within the path!
+		if !inPath[link.a] || link.a.path != link.b.path {
+			return
+		}
+		a := findBin(link.a, link.apos, res)
+		b := findBin(link.b, link.bpos, res)
+		C[a*m+b] += int32(n)
+		C[b*m+a] += int32(n)
+	})
 
 	// Serialize the contig size stats to JSON file
 	s, _ := json.MarshalIndent(A, "", "\t")
-	f, _ := os.Create(jsonfile)
+	f := mustCreateAtomic(jsonfile)
 	jw := bufio.NewWriter(f)
 	_, _ = jw.WriteString(string(s))
-	_ = jw.Flush()
+	ErrorAbort(jw.Flush())
+	ErrorAbort(f.Close())
 	log.Noticef("Contig stats (N=%d Length=%d) written to `%s`",
 		m, r.path.length, jsonfile)
 
-	// Serialize the pixelated matrix to NPY file
-	w, _ := gonpy.NewFileWriter(npyfile)
+	// Serialize the pixelated matrix to NPY file, WriteInt32 closes it
+	w, err := gonpy.NewWriter(mustCreateAtomic(npyfile))
+	ErrorAbort(err)
 	w.Shape = []int{m, m}
-	_ = w.WriteInt32(C)
+	ErrorAbort(w.WriteInt32(C))
 	log.Noticef("Matrix (resolution=%d) written to `%s`", res, npyfile)
-	_ = f.Close()
 }
 
 // getL50 computes the L50 of all component contigs within a path
@@ -706,29 +777,27 @@ func (r *Edge) isSister() bool {
 // makeGraph makes a contig linkage graph
 func (r *Anchorer) makeGraph() Graph {
 	G := Graph{}
-	nIntra := 0    // becomes an intra-path link
-	nInternal := 0 // internal to another path, too far away from the edge
-	nUsed := 0
+	nIntra := int64(0)    // becomes an intra-path link
+	nInternal := int64(0) // internal to another path, too far away from the edge
+	nUsed := int64(0)
 	// Go through the links for each node and compile edges
-	for _, contig := range r.contigs {
-		if contig.path == nil {
-			continue
+	r.forEachLink(func(link *Link, n int64) {
+		if link.a.path == nil {
+			return
 		}
-		for _, link := range contig.links {
-			a, b := r.linkToNodes(link)
-			if a == nil || b == nil {
-				nInternal++
-				continue
-			}
-			if a == b || a.sister == b { // These links have now become intra, discard
-				nIntra++
-				continue
-			}
-			nUsed++
-			r.insertEdge(G, a, b)
-			r.insertEdge(G, b, a)
+		a, b := r.linkToNodes(link)
+		if a == nil || b == nil {
+			nInternal += n
+			return
 		}
-	}
+		if a == b || a.sister == b { // These links have now become intra, discard
+			nIntra += n
+			return
+		}
+		nUsed += n
+		r.insertEdge(G, a, b, n)
+		r.insertEdge(G, b, a, n)
+	})
 
 	// Normalize against the product of lengths of two paths
 	for a, nb := range G {
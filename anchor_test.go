@@ -0,0 +1,60 @@
+/*
+ *  anchor_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// runAnchorer runs the Anchorer on the test bamfile and returns the genome.json
+func runAnchorer(t *testing.T, memLimit int64) string {
+	bamfile, err := filepath.Abs(filepath.Join("tests", "test.bam"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var genome []byte
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		p := allhic.Anchorer{Bamfile: "test.bam", MemLimit: memLimit}
+		p.Run()
+		if genome, err = ioutil.ReadFile("genome.json"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return string(genome)
+}
+
+func TestAnchorerMemLimit(t *testing.T) {
+	inMemory := runAnchorer(t, 0)
+	twoPass := runAnchorer(t, 1<<16) // Small enough to force many spills
+	if inMemory != twoPass {
+		t.Fatalf("Two-pass scaffolds differ from the in-memory scaffolds")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"1024": 1024, "64G": 64 << 30, "512m": 512 << 20, "1.5K": 1536, "2TB": 2 << 40,
+	} {
+		got, err := allhic.ParseByteSize(s)
+		if err != nil || got != expected {
+			t.Fatalf("ParseByteSize(%s) = %d (%v), expected %d", s, got, err, expected)
+		}
+	}
+	if _, err := allhic.ParseByteSize("lots"); err == nil {
+		t.Fatal("Expected an error for an invalid size")
+	}
+}
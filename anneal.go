@@ -0,0 +1,73 @@
+/*
+ *  anneal.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// SARun orders the tigs by simulated annealing, from the current tour. Each
+// iteration makes one move of Mutate, and keeps it when it does not lower
+// the score, and otherwise with probability exp(-delta/T). The temperature
+// T starts at tstart times the score of the tour, and is multiplied by
+// tfactor at each iteration. The best tour seen becomes the tour of the CLM.
+// The time limit of opt is checked with the reports of progress.
+func (r *CLM) SARun(fwtour io.Writer, opt *Optimizer) Tour {
+	tstart, tfactor, iterations := opt.annealing()
+	current := r.Tour.Clone().(Tour)
+	current.delta = new(deltaScore)
+	if current.jointOrient() {
+		r.carrySigns(current)
+	}
+	score, _ := current.Evaluate()
+	best, bestScore := current.Clone().(Tour), score
+	best.delta = nil // Scored in full when logged
+	candidate := current.Clone().(Tour)
+	temp := tstart
+	if score != 0 {
+		temp *= math.Abs(score)
+	}
+	log.Noticef("SA initialized (tstart: %g, tfactor: %g, iterations: %d, rng: %d, score: %s)",
+		tstart, tfactor, iterations, opt.Seed, r.Tour.ScoreName())
+
+	for it := 1; it <= iterations; it++ {
+		copy(candidate.Tigs, current.Tigs)
+		*candidate.delta = *current.delta
+		candidate.Mutate(opt.rng)
+		s, _ := candidate.Evaluate()
+		if s <= score || opt.rng.Float64() < math.Exp((score-s)/temp) {
+			current, candidate = candidate, current
+			score = s
+			if s < bestScore {
+				copy(best.Tigs, current.Tigs)
+				bestScore = s
+			}
+		}
+		temp *= tfactor
+		if it%SAReportEvery == 0 {
+			current.invalidate() // Rather than the sum of the changes
+			score, _ = current.Evaluate()
+			fmt.Fprintf(r.stdout(), "Current iteration SA-%d: max_score=%.5f (%s) temperature=%g\n",
+				it, -bestScore, r.Tour.ScoreName(), temp)
+			r.printTour(fwtour, best, fmt.Sprintf("SA-%d", it), fmt.Sprintf("iter=%d", it))
+			if opt.stopping() {
+				iterations = it
+				break
+			}
+		}
+	}
+
+	r.takeSigns(best)
+	r.Tour = best
+	score, _ = best.Evaluate()
+	log.Noticef("SA finished after %d iterations, the best score is %.5f", iterations, -score)
+	return r.Tour
+}
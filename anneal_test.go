@@ -0,0 +1,95 @@
+/*
+ *  anneal_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// finalOrder returns the contigs of the last tour of the tour file, without
+// their orientations
+func finalOrder(t *testing.T, tourfile string) []string {
+	s, err := ioutil.ReadFile(tourfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(s)), "\n")
+	atoms := strings.Fields(lines[len(lines)-1])
+	for i, atom := range atoms {
+		atoms[i] = strings.TrimRight(atom, "+-")
+	}
+	return atoms
+}
+
+// TestOptimizeSA anneals a synthetic group, where each contig links to its
+// next three, from a random order, and expects the true order back, as
+// the GA of the same length does not
+func TestOptimizeSA(t *testing.T) {
+	nTigs := 40
+	truth := make([]string, nTigs)
+	for i := range truth {
+		truth[i] = fmt.Sprintf("tig%07d", i)
+	}
+	reversed := make([]string, nTigs)
+	for i := range truth {
+		reversed[i] = truth[nTigs-1-i]
+	}
+	recovered := func(order []string) bool {
+		got := strings.Join(order, " ")
+		return got == strings.Join(truth, " ") || got == strings.Join(reversed, " ")
+	}
+
+	idsfile, clmfile := writeSyntheticCLM(t.TempDir(), nTigs, 3, 10)
+	opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true, Seed: 42,
+		NPop: 20, NGen: 50, MutProb: allhic.MutaProb, NoPolish: true, Stdout: ioutil.Discard}
+	sa := opt
+	sa.Method, sa.Iterations = allhic.MethodSA, 50000
+	for _, run := range []struct {
+		opt  allhic.Optimizer
+		want bool
+	}{{sa, true}, {opt, false}} {
+		inTempDir(t, func() {
+			run.opt.OutPrefix = "synthetic"
+			if err := run.opt.Run(); err != nil {
+				t.Fatal(err)
+			}
+			order := finalOrder(t, run.opt.OutTourFile)
+			if got := recovered(order); got != run.want {
+				t.Errorf("method %q: recovered the true order %t, want %t\n%s",
+					run.opt.Method, got, run.want, strings.Join(order, " "))
+			}
+			if run.opt.Method == allhic.MethodSA {
+				s, _ := ioutil.ReadFile(run.opt.OutTourFile)
+				if !strings.Contains(string(s), ">SA-50000 ") || !strings.Contains(string(s), "method=sa") {
+					t.Error("tour file lacks the labelled SA tours")
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizeSAErrors(t *testing.T) {
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"unknown method":             func(r *allhic.Optimizer) { r.Method = "tabu" },
+		"or cross the tours with sa": func(r *allhic.Optimizer) { r.Crossover = allhic.CrossoverER },
+		"cannot anneal":              func(r *allhic.Optimizer) { r.TFactor = 2 },
+	} {
+		opt := shortOptimizer(t, 42)
+		opt.Method = allhic.MethodSA
+		edit(&opt)
+		if err := opt.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
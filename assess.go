@@ -14,12 +14,9 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/biogo/hts/bam"
 )
 
 // probCutoff is the minimum level of prob required
@@ -35,15 +32,21 @@ const probCutoff = .95
 // Step 3. Normalize the likelihood to get the posterior probability (implicit assumption)
 //         of equal prior probability for each contig
 type Assesser struct {
-	Bamfile       string
-	Bedfile       string
-	Seqid         string
-	seq           *ContigInfo
-	model         *LinkDensityModel
-	contigs       []BedLine
-	interLinksFwd [][]int // Contig link sizes assuming same dir
-	interLinksRev [][]int // Contig link sizes assuming other dir
-	postprob      []float64
+	Bamfile    string
+	Bedfile    string
+	Seqid      string
+	MinOverlap float64 // Fraction of the bed sequences that must match the bam
+	Force      bool
+	// DistLowerBound is the shortest intra-contig link of the distribution,
+	// 0 for the DistLowerBound constant
+	DistLowerBound int
+	extents        map[string]int
+	seq            *ContigInfo
+	model          *LinkDensityModel
+	contigs        []BedLine
+	interLinksFwd  [][]int // Contig link sizes assuming same dir
+	interLinksRev  [][]int // Contig link sizes assuming other dir
+	postprob       []float64
 }
 
 // BedLine stores the information from each line in the bedfile
@@ -73,6 +76,7 @@ func (r *Assesser) makeModel(outfile string) {
 		contigSizes = append(contigSizes, contig.size)
 	}
 	m := NewLinkDensityModel()
+	m.lowerBound = r.distLowerBound()
 	m.makeBins()
 	m.makeNorms(contigSizes)
 	m.countBinDensities([]*ContigInfo{r.seq})
@@ -80,9 +84,17 @@ func (r *Assesser) makeModel(outfile string) {
 	r.model = m
 }
 
+// distLowerBound returns DistLowerBound, the DistLowerBound constant when 0
+func (r *Assesser) distLowerBound() int {
+	if r.DistLowerBound > 0 {
+		return r.DistLowerBound
+	}
+	return DistLowerBound
+}
+
 // writePostProb writes the final posterior probability to file
 func (r *Assesser) writePostProb(outfile string) {
-	f, _ := os.Create(outfile)
+	f := mustCreateAtomic(outfile)
 	w := bufio.NewWriter(f)
 
 	_, _ = fmt.Fprintf(w, PostProbHeader)
@@ -91,9 +103,9 @@ func (r *Assesser) writePostProb(outfile string) {
 			contig.seqid, contig.start, contig.end, contig.name, r.postprob[i])
 	}
 
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
 	log.Noticef("Posterior probability written to `%s`", outfile)
-	_ = f.Close()
 }
 
 // readBed parses the bedfile to extract the start and stop for all the contigs
@@ -102,6 +114,7 @@ func (r *Assesser) readBed() {
 	log.Noticef("Parse bedfile `%s`", r.Bedfile)
 	reader := bufio.NewReader(fh)
 
+	r.extents = make(map[string]int)
 	for {
 		row, err := reader.ReadString('\n')
 		row = strings.TrimSpace(row)
@@ -110,12 +123,15 @@ func (r *Assesser) readBed() {
 		}
 		words := strings.Split(row, "\t")
 		seqid := words[0]
-		if seqid != r.Seqid {
-			continue
-		}
 		start, _ := strconv.Atoi(words[1])
 		// start-- // To handle sometimes 1-based offset
 		end, _ := strconv.Atoi(words[2])
+		if end > r.extents[seqid] {
+			r.extents[seqid] = end
+		}
+		if seqid != r.Seqid {
+			continue
+		}
 		r.contigs = append(r.contigs, BedLine{
 			seqid: seqid,
 			start: start,
@@ -140,13 +156,19 @@ func checkInRange(pos, start, end int) bool {
 func (r *Assesser) extractContigLinks() {
 	fh := mustOpen(r.Bamfile)
 	log.Noticef("Parse bamfile `%s`", r.Bamfile)
-	br, _ := bam.NewReader(fh, 0)
+	br, err := newBAMRecordReader(fh, 0)
+	if err != nil {
+		log.Fatalf("Cannot open bamfile `%s` (%s)", r.Bamfile, err)
+	}
 
 	// We need the size of the SeqId to compute expected number of links
 	var s *ContigInfo
+	seqID := int32(-1)
 	refs := br.Header().Refs()
-	for _, ref := range refs {
+	RefCheck{MinOverlap: r.MinOverlap, Force: r.Force}.Extents(refs, r.extents, r.Bedfile)
+	for i, ref := range refs {
 		if ref.Name() == r.Seqid {
+			seqID = int32(i)
 			s = &ContigInfo{
 				name:   ref.Name(),
 				length: ref.Len(),
@@ -157,7 +179,7 @@ func (r *Assesser) extractContigLinks() {
 		}
 	}
 	if s == nil {
-		log.Fatalf("Seq not found: %f", r.Seqid)
+		log.Fatalf("Seq not found: %s", r.Seqid)
 		return
 	}
 	log.Noticef("Seq `%s` has size %d", s.name, s.length)
@@ -165,14 +187,14 @@ func (r *Assesser) extractContigLinks() {
 	// Import links into pairs of contigs
 	r.interLinksFwd = make([][]int, len(r.contigs))
 	r.interLinksRev = make([][]int, len(r.contigs))
+	var rec bamRecord
 	var a, b int
 	nIntraLinks := 0
 	nInterLinks := 0
 	nSkippedTooShort := 0
 	ci := 0 // Use this to index into r.contigs, the current contig under consideration
 	for {
-		rec, err := br.Read()
-		if err != nil {
+		if err := br.Read(&rec); err != nil {
 			if err != io.EOF {
 				log.Error(err)
 			}
@@ -180,8 +202,7 @@ func (r *Assesser) extractContigLinks() {
 		}
 
 		// Restrict the links to be within the current chromosome
-		at, bt := rec.Ref.Name(), rec.MateRef.Name()
-		if at != r.Seqid || bt != r.Seqid {
+		if rec.RefID != seqID || rec.MateRefID != seqID {
 			continue
 		}
 
@@ -189,7 +210,7 @@ func (r *Assesser) extractContigLinks() {
 		//     ---a-- X|----- dist = a2 ----|         |--- dist = b ---|X ------ b2 ------
 		//     ==============================         ====================================
 		//             C1 (length L1)       |----D----|         C2 (length L2)
-		a, b = rec.Pos, rec.MatePos
+		a, b = int(rec.Pos), int(rec.MatePos)
 		if a < r.contigs[ci].start {
 			continue
 		}
@@ -211,7 +232,9 @@ func (r *Assesser) extractContigLinks() {
 		// For intra-contig link it's easy, just store the distance between two ends
 		// An intra-contig link
 		if checkInRange(b, r.contigs[ci].start, r.contigs[ci].end) {
-			r.seq.links = append(r.seq.links, link)
+			if link >= r.distLowerBound() {
+				r.seq.links = append(r.seq.links, link)
+			}
 			nIntraLinks++
 			continue
 		}
@@ -0,0 +1,79 @@
+/*
+ *  atomic.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written as <name>.tmp in the same directory and renamed to
+// name on Close, so that a crash never leaves a truncated file under name
+type AtomicFile struct {
+	*os.File
+	name   string
+	closed bool
+}
+
+// CreateAtomic creates the temporary file that Close puts in place of name
+func CreateAtomic(name string) (*AtomicFile, error) {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: f, name: name}, nil
+}
+
+// mustCreateAtomic wraps CreateAtomic but aborts if the file cannot be created
+func mustCreateAtomic(name string) *AtomicFile {
+	f, err := CreateAtomic(name)
+	ErrorAbort(err)
+	return f
+}
+
+// Close syncs the temporary file to disk and renames it to the final name.
+// The temporary file is removed if any step fails.
+func (r *AtomicFile) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	tmp := r.File.Name()
+	err := r.File.Sync()
+	if e := r.File.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, r.name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(r.name))
+	return nil
+}
+
+// Abort discards the temporary file, leaving any file under name untouched
+func (r *AtomicFile) Abort() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	_ = r.File.Close()
+	return os.Remove(r.File.Name())
+}
+
+// syncDir makes a rename in the directory durable, where the platform allows
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
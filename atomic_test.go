@@ -0,0 +1,101 @@
+/*
+ *  atomic_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// readString reads the whole file, or "" when it does not exist
+func readString(t *testing.T, filename string) string {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestAtomicFileInterrupted leaves a write unfinished, as a crash would, and
+// checks that the previous file is still intact
+func TestAtomicFileInterrupted(t *testing.T) {
+	inTempDir(t, func() {
+		if err := ioutil.WriteFile("out.agp", []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := allhic.CreateAtomic("out.agp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.WriteString("new, but cut")
+		if got := readString(t, "out.agp"); got != "old\n" {
+			t.Fatalf("unfinished write is visible: %q", got)
+		}
+		if err := f.Abort(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readString(t, "out.agp"); got != "old\n" {
+			t.Fatalf("aborted write replaced the file: %q", got)
+		}
+		if _, err := os.Stat("out.agp.tmp"); !os.IsNotExist(err) {
+			t.Fatal("temporary file left behind")
+		}
+
+		f, _ = allhic.CreateAtomic("out.agp")
+		_, _ = f.WriteString("new\n")
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readString(t, "out.agp"); got != "new\n" {
+			t.Fatalf("got %q after Close", got)
+		}
+	})
+}
+
+// TestTourFileInterrupted cuts the last block of a tour file at every byte
+// and checks that the reader falls back to the previous block
+func TestTourFileInterrupted(t *testing.T) {
+	complete := ">INIT\nt1+ t2+ t3+\n>GA1-0-1.00000\nt3- t1+ t2+\n"
+	last := ">GA1-500-2.00000\nt2+ t3+ t1-\n"
+	inTempDir(t, func() {
+		for cut := 0; cut < len(last); cut++ {
+			if err := ioutil.WriteFile("g1.tour", []byte(complete+last[:cut]), 0644); err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Split("t3- t1+ t2+", " ")
+			if got := allhic.ParseTourWords("g1.tour"); !reflect.DeepEqual(got, want) {
+				t.Fatalf("cut at %d: got %v, want %v", cut, got, want)
+			}
+			allhic.RepairTourFile("g1.tour")
+			if got := readString(t, "g1.tour"); got != complete {
+				t.Fatalf("cut at %d: repaired file is %q", cut, got)
+			}
+		}
+
+		// A complete file is left alone
+		if err := ioutil.WriteFile("g1.tour", []byte(complete+last), 0644); err != nil {
+			t.Fatal(err)
+		}
+		allhic.RepairTourFile("g1.tour")
+		if got := allhic.ParseTourWords("g1.tour"); strings.Join(got, " ") != "t2+ t3+ t1-" {
+			t.Fatalf("got %v from the complete file", got)
+		}
+		if got := readString(t, "g1.tour"); got != complete+last {
+			t.Fatalf("complete file was modified: %q", got)
+		}
+	})
+}
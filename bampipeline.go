@@ -0,0 +1,122 @@
+/*
+ *  bampipeline.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// bamBatchRecords is the number of records in a batch of the pipeline
+const bamBatchRecords = 4096
+
+// bamBatch is a run of consecutive BAM records, as their bytes, and the
+// links made of them, in the order of the records
+type bamBatch struct {
+	seq    int
+	data   []byte
+	ends   []int
+	links  []LinkRecord
+	counts readCounts
+}
+
+// extractParallel streams the BAM through a pipeline of Threads goroutines:
+// one decoder reads the records into batches, the workers filter them into
+// links and their own coverage tracks, and the links are added back in the
+// order of the batches, so that the outputs are those of the serial read.
+// The batches are recycled, which bounds the records in flight.
+func (r *Extracter) extractParallel(br *bamRecordReader, refToIdx []int, coverage *CoverageTrack,
+	progress *Progress, add func(LinkRecord)) readCounts {
+	workers := r.Threads - 1
+	free := make(chan *bamBatch, 4*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- &bamBatch{}
+	}
+	batches := make(chan *bamBatch, cap(free))
+	done := make(chan *bamBatch, cap(free))
+
+	// Decoder
+	go func() {
+		defer close(batches)
+		var rec bamRecord
+		nrecords, seq := 1, 0
+		for eof := false; !eof; seq++ {
+			batch := <-free
+			batch.seq, batch.data, batch.ends = seq, batch.data[:0], batch.ends[:0]
+			for len(batch.ends) < bamBatchRecords {
+				if progress.Tick() {
+					progress.Report(fmt.Sprintf("%d records", nrecords))
+				}
+				b, err := br.readRaw(&rec)
+				if err != nil {
+					if err != io.EOF {
+						log.Error(err)
+					}
+					eof = true
+					break
+				}
+				batch.data = append(batch.data, b...)
+				batch.ends = append(batch.ends, len(batch.data))
+				nrecords++
+			}
+			batches <- batch
+		}
+	}()
+
+	// Workers
+	tracks := make([]*CoverageTrack, workers)
+	var wg sync.WaitGroup
+	for i := range tracks {
+		tracks[i] = NewCoverageTrack(coverage.contigs, coverage.Window)
+		wg.Add(1)
+		go func(track *CoverageTrack) {
+			defer wg.Done()
+			var rec bamRecord
+			for batch := range batches {
+				batch.links, batch.counts = batch.links[:0], readCounts{}
+				start := 0
+				for _, end := range batch.ends {
+					// The decoder checked the record
+					_ = decodeBAMRecord(batch.data[start:end], &rec)
+					if link, ok := r.linkOf(&rec, refToIdx, track, &batch.counts); ok {
+						batch.links = append(batch.links, link)
+					}
+					start = end
+				}
+				done <- batch
+			}
+		}(tracks[i])
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// Aggregator
+	var counts readCounts
+	pending := make(map[int]*bamBatch)
+	next := 0
+	for batch := range done {
+		pending[batch.seq] = batch
+		for batch, ok := pending[next]; ok; batch, ok = pending[next] {
+			delete(pending, next)
+			for _, link := range batch.links {
+				add(link)
+			}
+			counts.add(batch.counts)
+			free <- batch
+			next++
+		}
+	}
+	for _, track := range tracks {
+		coverage.merge(track)
+	}
+	return counts
+}
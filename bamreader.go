@@ -0,0 +1,213 @@
+/*
+ *  bamreader.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/biogo/hts/bgzf"
+	"github.com/biogo/hts/sam"
+)
+
+// bamFixedSize is the size of the fixed-length part of a BAM record,
+// excluding the leading block size
+const bamFixedSize = 32
+
+// bamRecord holds the fields of a BAM alignment that link extraction needs.
+// Name and Aux point into the reader's buffer and are only valid until the
+// next Read. The positions are widened to int64, past the 2^29 of the BAI
+// and of the bin field, which the reader ignores.
+type bamRecord struct {
+	RefID     int32
+	Pos       int64
+	MapQ      uint8
+	Flags     uint16
+	MateRefID int32
+	MatePos   int64
+	Name      []byte
+	Aux       []byte
+}
+
+// bamRecordReader decodes BAM records straight from the BGZF stream into a
+// single reused buffer, instead of building a sam.Record per alignment
+type bamRecordReader struct {
+	bg     *bgzf.Reader
+	header *sam.Header
+	size   [4]byte
+	buf    []byte
+}
+
+// newBAMRecordReader reads the BAM header and prepares to stream records,
+// with rd BGZF decompressors, 0 for GOMAXPROCS
+func newBAMRecordReader(r io.Reader, rd int) (*bamRecordReader, error) {
+	bg, err := bgzf.NewReader(r, rd)
+	if err != nil {
+		return nil, err
+	}
+	h, _ := sam.NewHeader(nil, nil)
+	if err := h.DecodeBinary(bg); err != nil {
+		return nil, err
+	}
+	return &bamRecordReader{bg: bg, header: h}, nil
+}
+
+// Header returns the header of the BAM file
+func (r *bamRecordReader) Header() *sam.Header {
+	return r.header
+}
+
+// Read decodes the next record into rec, returning io.EOF at the end
+func (r *bamRecordReader) Read(rec *bamRecord) error {
+	_, err := r.readRaw(rec)
+	return err
+}
+
+// readRaw decodes the next record into rec as Read, and returns its bytes
+// for decodeBAMRecord, valid until the next read
+func (r *bamRecordReader) readRaw(rec *bamRecord) ([]byte, error) {
+	if _, err := io.ReadFull(r.bg, r.size[:]); err != nil {
+		return nil, err
+	}
+	n := int(int32(binary.LittleEndian.Uint32(r.size[:])))
+	if n < bamFixedSize {
+		return nil, fmt.Errorf("bam: invalid record size: %d", n)
+	}
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	b := r.buf[:n]
+	if _, err := io.ReadFull(r.bg, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, decodeBAMRecord(b, rec)
+}
+
+// decodeBAMRecord decodes the bytes of a record, without its block size,
+// into rec, which points into them
+func decodeBAMRecord(b []byte, rec *bamRecord) error {
+	n := len(b)
+	nLen := int(b[8])
+	if nLen < 1 || bamFixedSize+nLen > n {
+		return fmt.Errorf("bam: invalid read name length: %d", nLen)
+	}
+	rec.RefID = int32(binary.LittleEndian.Uint32(b[0:]))
+	rec.Pos = int64(int32(binary.LittleEndian.Uint32(b[4:])))
+	rec.MapQ = b[9]
+	rec.Flags = binary.LittleEndian.Uint16(b[14:])
+	rec.MateRefID = int32(binary.LittleEndian.Uint32(b[20:]))
+	rec.MatePos = int64(int32(binary.LittleEndian.Uint32(b[24:])))
+	rec.Name = b[bamFixedSize : bamFixedSize+nLen-1]
+	nCigar := int(binary.LittleEndian.Uint16(b[12:]))
+	lSeq := int(int32(binary.LittleEndian.Uint32(b[16:])))
+	aux := bamFixedSize + nLen + nCigar*4 + (lSeq+1)/2 + lSeq
+	if lSeq < 0 || aux > n {
+		return fmt.Errorf("bam: invalid cigar and sequence lengths: %d, %d", nCigar, lSeq)
+	}
+	rec.Aux = b[aux:]
+	return nil
+}
+
+// MateMapQ returns the MAPQ of the mate from the MQ tag, as written by
+// samtools fixmate, or -1 without the tag
+func (r *bamRecord) MateMapQ() int {
+	aux := r.Aux
+	for len(aux) >= 4 {
+		tag, typ := string(aux[:2]), aux[2]
+		size := 0
+		switch typ {
+		case 'A', 'c', 'C':
+			size = 1
+		case 's', 'S':
+			size = 2
+		case 'i', 'I', 'f':
+			size = 4
+		case 'Z', 'H':
+			for size < len(aux)-3 && aux[3+size] != 0 {
+				size++
+			}
+			size++
+		case 'B':
+			if len(aux) < 8 {
+				return -1
+			}
+			count := int(binary.LittleEndian.Uint32(aux[4:]))
+			switch aux[3] {
+			case 'c', 'C':
+				size = 5 + count
+			case 's', 'S':
+				size = 5 + count*2
+			default:
+				size = 5 + count*4
+			}
+		default:
+			return -1
+		}
+		if 3+size > len(aux) {
+			return -1
+		}
+		if tag == "MQ" {
+			value := aux[3 : 3+size]
+			switch typ {
+			case 'c':
+				return int(int8(value[0]))
+			case 'C':
+				return int(value[0])
+			case 's':
+				return int(int16(binary.LittleEndian.Uint16(value)))
+			case 'S':
+				return int(binary.LittleEndian.Uint16(value))
+			case 'i':
+				return int(int32(binary.LittleEndian.Uint32(value)))
+			case 'I':
+				return int(binary.LittleEndian.Uint32(value))
+			}
+			return -1
+		}
+		aux = aux[3+size:]
+	}
+	return -1
+}
+
+// Close releases the BGZF decompressors
+func (r *bamRecordReader) Close() error {
+	return r.bg.Close()
+}
+
+// refExcluded marks the references of a refTable left out on purpose, the
+// reads on them being skipped rather than missing
+const refExcluded = -2
+
+// refTable maps each reference ID in the header to an index through idx,
+// or -1 when the reference is not in idx
+func (r *bamRecordReader) refTable(idx map[string]int) []int {
+	refs := r.header.Refs()
+	table := make([]int, len(refs))
+	for i, ref := range refs {
+		if j, ok := idx[ref.Name()]; ok {
+			table[i] = j
+		} else {
+			table[i] = -1
+		}
+	}
+	return table
+}
+
+// refIndex returns the entry of the table for a reference ID, -1 for
+// unmapped or out of range IDs
+func refIndex(table []int, refID int32) int {
+	if refID < 0 || int(refID) >= len(table) {
+		return -1
+	}
+	return table[refID]
+}
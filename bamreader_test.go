@@ -0,0 +1,230 @@
+/*
+ *  bamreader_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+	"github.com/tanghaibao/allhic"
+)
+
+const testBAM = "tests/test.bam"
+
+// TestBAMRecordReaderMatchesBiogo compares every decoded field with biogo
+func TestBAMRecordReaderMatchesBiogo(t *testing.T) {
+	fa, err := os.Open(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fa.Close()
+	fb, err := os.Open(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fb.Close()
+
+	br, err := bam.NewReader(fa, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+	rr, err := allhic.NewBAMRecordReader(fb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+
+	var rec allhic.BAMRecord
+	n := 0
+	for {
+		want, werr := br.Read()
+		gerr := rr.Read(&rec)
+		if werr == io.EOF || gerr == io.EOF {
+			if werr != gerr {
+				t.Fatalf("record %d: EOF mismatch (biogo: %v, reader: %v)", n, werr, gerr)
+			}
+			break
+		}
+		if werr != nil || gerr != nil {
+			t.Fatalf("record %d: biogo: %v, reader: %v", n, werr, gerr)
+		}
+		if int(rec.RefID) != want.Ref.ID() || int(rec.Pos) != want.Pos ||
+			int(rec.MateRefID) != want.MateRef.ID() || int(rec.MatePos) != want.MatePos ||
+			rec.MapQ != want.MapQ || rec.Flags != uint16(want.Flags) ||
+			string(rec.Name) != want.Name {
+			t.Fatalf("record %d: got %+v, want %v", n, rec, want)
+		}
+		n++
+	}
+	if n == 0 {
+		t.Fatal("no records read")
+	}
+}
+
+// linksSink keeps the links of each oriented contig pair on top of the
+// MemorySink
+type linksSink struct {
+	*allhic.MemorySink
+	links map[string][]int
+}
+
+func (r *linksSink) ContigLinks(at, bt string, ao, bo byte, links []int) {
+	r.MemorySink.ContigLinks(at, bt, ao, bo, links)
+	r.links[at+string(ao)+bt+string(bo)] = links
+}
+
+// TestLargeContig runs the steps that read a BAM on a contig of 1.5 Gb,
+// past the 512 Mb of the BAI, which none of them needs
+func TestLargeContig(t *testing.T) {
+	const big = 1500000000
+	pairs := []mapqPair{
+		{0, 100000000, 60, 0, 100010000, 60},
+		{0, 700000000, 60, 0, 1300000000, 60},
+		{0, 900000000, 60, 0, 900050000, 60},
+		{0, 1200000000, 60, 0, 1200100000, 60},
+		{0, 1400000000, 60, 1, 5000, 60},
+	}
+	inTempDir(t, func() {
+		writeMapqBAMOf(t, "large.bam", map[string]int{"ctgBig": big, "ctgSmall": 60000}, pairs, false)
+
+		f, err := os.Open("large.bam")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr, err := allhic.NewBAMRecordReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec allhic.BAMRecord
+		var links []allhic.LinkRecord
+		for n := 0; rr.Read(&rec) == nil; n++ {
+			p := pairs[n/2]
+			want := [2]int{p.posA, p.posB}
+			if n%2 == 1 {
+				want = [2]int{p.posB, p.posA}
+			}
+			if rec.Pos != int64(want[0]) || rec.MatePos != int64(want[1]) {
+				t.Fatalf("record %d at %d, mate at %d, want %v", n, rec.Pos, rec.MatePos, want)
+			}
+			links = append(links, allhic.LinkRecord{ContigA: int(rec.RefID), PosA: int(rec.Pos),
+				ContigB: int(rec.MateRefID), PosB: int(rec.MatePos)})
+		}
+		_ = rr.Close()
+		_ = f.Close()
+		if len(links) != 2*len(pairs) {
+			t.Fatalf("read %d records, want %d", len(links), 2*len(pairs))
+		}
+
+		// The links of extract go through the dedup, on disk, and the
+		// aggregator
+		contigs := []*allhic.ContigInfo{allhic.NewContigInfo("ctgBig", 1, big),
+			allhic.NewContigInfo("ctgSmall", 1, 60000)}
+		agg := allhic.NewLinkAggregator(contigs, 1)
+		dedup := allhic.NewLinkDedup(1<<10, "")
+		for _, link := range append(links, links...) {
+			dedup.Add(link)
+		}
+		if duplicates := dedup.Finish(agg, 1<<10); duplicates != len(links) {
+			t.Errorf("%d duplicate links, want %d", duplicates, len(links))
+		}
+		sink := &linksSink{MemorySink: &allhic.MemorySink{}, links: map[string][]int{}}
+		if err := agg.Finish(sink); err != nil {
+			t.Fatal(err)
+		}
+		// One link for each mate of the pair
+		if got := sink.links["ctgBig-ctgSmall+"]; !reflect.DeepEqual(got, []int{1400005000, 1400005000}) {
+			t.Errorf("links of ctgBig- ctgSmall+ are %v, want 1400005000 twice", got)
+		}
+
+		p := allhic.Anchorer{Bamfile: "large.bam"}
+		p.Run()
+		ids, err := ioutil.ReadFile("large.ids")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(ids), "ctgBig\t1500000000\n") {
+			t.Errorf("large.ids starts with %q", ids)
+		}
+
+		writeFiles(t, map[string]string{"large.bed": "ctgBig\t0\t800000000\tc1\n" +
+			"ctgBig\t800000000\t1500000000\tc2\n"})
+		a := allhic.Assesser{Bamfile: "large.bam", Bedfile: "large.bed", Seqid: "ctgBig"}
+		a.Run()
+		rows, err := ioutil.ReadFile("ctgBig.postprob.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(rows), "\tc"); n != 2 {
+			t.Errorf("posterior probabilities of %d contigs, want 2", n)
+		}
+	})
+}
+
+// streamBiogo reads all records with the biogo BAM reader
+func streamBiogo(b *testing.B) int {
+	f, err := os.Open(testBAM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	br, err := bam.NewReader(f, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer br.Close()
+	n := 0
+	for {
+		if _, err := br.Read(); err != nil {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// streamRecords reads all records with the reused-buffer reader
+func streamRecords(b *testing.B) int {
+	f, err := os.Open(testBAM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	rr, err := allhic.NewBAMRecordReader(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rr.Close()
+	var rec allhic.BAMRecord
+	n := 0
+	for rr.Read(&rec) == nil {
+		n++
+	}
+	return n
+}
+
+func BenchmarkStreamBAM(b *testing.B) {
+	b.Run("biogo", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			streamBiogo(b)
+		}
+	})
+	b.Run("records", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			streamRecords(b)
+		}
+	})
+}
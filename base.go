@@ -11,6 +11,7 @@ package allhic
 
 import (
 	"bufio"
+	"compress/gzip"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/op/go-logging"
@@ -36,6 +38,9 @@ const (
 	PHI = 0.4812118250596684 // math.Log(1.61803398875)
 	// OUTLIERTHRESHOLD is how many deviation from MAD
 	OUTLIERTHRESHOLD = 3.5
+	// MinOutlierTigs is the fewest active tigs for which OutlierCutoff is
+	// trusted to prune them
+	MinOutlierTigs = 10
 	// MINSIZE is the minimum size cutoff for tig to be considered
 	MINSIZE = 10000
 	// GeometricBinSize is the max/min ratio for each bin
@@ -49,6 +54,44 @@ const (
 	DefaultRE = "GATC"
 	// MinLinks is the minimum number of links between contig pair to consider
 	MinLinks = 3
+	// DistLowerBound is the shortest intra-contig link of the distribution,
+	// over the religated and uncut fragments of a few hundred bp
+	DistLowerBound = MinLinkDist
+	// CoverageWindow is the size of the windows of the coverage track
+	CoverageWindow = 10000
+	// RepeatRatio is the coverage over the median that flags a collapsed repeat
+	RepeatRatio = 2.0
+	// LowCisTransFactor is how many times below the median of the contigs of
+	// similar length the cis/trans ratio of a contig flags it as chimeric or
+	// a contaminant, among CisTransNeighbors contigs nearest in length
+	LowCisTransFactor = 4.0
+	CisTransNeighbors = 20
+	// DedupMemory is the memory budget in bytes of each sort of the links
+	// in extract --dedup and --lowmem, over which they spill to temporary
+	// files
+	DedupMemory = 1 << 30
+	// QCLongCis and QCVeryLongCis are the distances of the long intra-contig
+	// pairs of the library QC of extract
+	QCLongCis     = 10000
+	QCVeryLongCis = 1000000
+	// QCMinMapped, QCMaxDuplicates, QCMinLongCis, QCMaxReligation and
+	// QCMaxSelfCircle are the fractions over or under which the library QC
+	// warns, see QCThresholds
+	QCMinMapped     = 0.5
+	QCMaxDuplicates = 0.3
+	QCMinLongCis    = 0.15
+	QCMaxReligation = 0.1
+	QCMaxSelfCircle = 0.1
+	// MinRefOverlap is the fraction of sequences that must match between the
+	// BAM header and the companion input
+	MinRefOverlap = 0.95
+
+	// StdinFile is the input file name that reads from stdin
+	StdinFile = "-"
+
+	// MaxLineSize is the longest line read from the clm, ids and tour files,
+	// a tour of 100k contigs or a pair with 100k links is over 1 MB
+	MaxLineSize = 1 << 30
 
 	// MaxLinkDist is the maximum link distance we care about
 	MaxLinkDist = 1 << 27
@@ -69,6 +112,171 @@ const (
 	Ngen = 5000
 	// MutaProb is the mutation probability in GA
 	MutaProb = 0.2
+	// MethodGA and MethodSA order the tigs by the genetic algorithm or by
+	// simulated annealing
+	MethodGA = "ga"
+	MethodSA = "sa"
+	// SATStart is the starting temperature of SA, relative to the score of
+	// the initial tour
+	SATStart = 0.01
+	// SATFactor multiplies the temperature of SA at each iteration
+	SATFactor = 0.99995
+	// SAIterations is the number of moves that SA tries
+	SAIterations = 200000
+	// SAReportEvery is how many SA iterations apart the best tour is logged
+	SAReportEvery = 10000
+	// ScoreDefault scores the ordering by all the links between contigs
+	ScoreDefault = "default"
+	// ScoreEndWeighted weights the links by the fraction near the joining ends
+	ScoreEndWeighted = "endWeighted"
+	// ScoreLikelihood scores the links against those expected from the link
+	// size distribution, see LikelihoodScorer
+	ScoreLikelihood = "likelihood"
+	// OrientInitSpectral initializes the orientations by the leading
+	// eigenvector of the strandedness matrix
+	OrientInitSpectral = "spectral"
+	// OrientInitGreedy initializes the orientations along the strongest links
+	OrientInitGreedy = "greedy"
+	// NormalizeNone, NormalizeRE and NormalizeLength scale the links of each
+	// pair of tigs in the ordering score by none, the product of their RE
+	// counts or of their lengths, see CLM.Normalize
+	NormalizeNone   = "none"
+	NormalizeRE     = "re"
+	NormalizeLength = "length"
+	// ModeRE and ModeOmniC are the modes of extract, which counts the
+	// restriction sites of the RE, or the effective lengths of the contigs,
+	// less their Ns, for the enzyme-free Omni-C
+	ModeRE    = "re"
+	ModeOmniC = "omnic"
+	// FormatBAM and FormatValidPairs are the formats of the read pairs of
+	// extract, BAM or the validPairs of HiC-Pro
+	FormatBAM        = "bam"
+	FormatValidPairs = "validpairs"
+	// ScoreJointOrient scores the orientations along with the order, see
+	// JointScorer
+	ScoreJointOrient = "jointOrient"
+	// JointOrientWindow is how many positions apart in the tour two tigs
+	// score their oriented links with JointScorer
+	JointOrientWindow = 2
+	// JointFlipProb is the probability that a GA move flips one tig, with
+	// JointScorer
+	JointFlipProb = 0.2
+	// MoveSwap, MoveSplice, MoveInsert, MoveReverse and MoveTranslocate name
+	// the moves of Mutate in --mutWeights
+	MoveSwap        = "swap"
+	MoveSplice      = "splice"
+	MoveInsert      = "insert"
+	MoveReverse     = "reverse"
+	MoveTranslocate = "translocate"
+	// CrossoverNone leaves the tours of the GA to the mutations alone
+	CrossoverNone = "none"
+	// CrossoverOX is the order crossover, see NewCrossoverOperator
+	CrossoverOX = "ox"
+	// CrossoverPMX is the partially mapped crossover
+	CrossoverPMX = "pmx"
+	// CrossoverER is the edge recombination crossover
+	CrossoverER = "er"
+	// CrossoverProb is the crossover probability in GA with an operator
+	CrossoverProb = 0.7
+	// PolishWindow is how many positions apart the moves of Polish are
+	PolishWindow = 10
+	// PolishBudget is how many moves Polish tries at most
+	PolishBudget = 1000000
+	// PolishMinGain is the smallest improvement of the score, relative to
+	// it, for Polish to keep a move
+	PolishMinGain = 1e-9
+	// MigrationInterval is how many GA generations apart the islands
+	// exchange their best tours
+	MigrationInterval = 50
+	// IslandMigrants is how many of its best tours an island sends to the
+	// next one
+	IslandMigrants = 2
+	// SelectionTournament and SelectionRoulette pick the parents of the GA
+	// offsprings by tournaments of TournamentSize tours, or with chances
+	// by fitness
+	SelectionTournament = "tournament"
+	SelectionRoulette   = "roulette"
+	// TournamentSize is how many tours compete for each parent
+	TournamentSize = 3
+	// ConstraintFixed, ConstraintLeft and ConstraintRight are the kinds of
+	// constraints in the constraints file, see ReadConstraints
+	ConstraintFixed = "fixed"
+	ConstraintLeft  = "left"
+	ConstraintRight = "right"
+	// ConstraintEndFraction is the fraction of the tour at either end that
+	// holds the left and the right contigs
+	ConstraintEndFraction = 0.1
+	// GFAWeight is the bonus of the adjacent contigs joined as in the
+	// assembly graph, relative to the score of a contig next to its
+	// best-linked partner, see ReadGFA
+	GFAWeight = 1.0
+	// StartFraction is the fraction of the first GA population seeded from
+	// the start tour, the rest being shuffled
+	StartFraction = 0.5
+	// StartMutations is how many moves of Mutate perturb each copy of the
+	// start tour in the GA population
+	StartMutations = 3
+	// TourInterval is how many GA generations apart the best tour is
+	// appended to the tour file
+	TourInterval = 500
+	// ExitInterrupted is the exit status of an optimize stopped by its time
+	// limit or a signal, whose tour and checkpoint are usable, as EX_TEMPFAIL
+	ExitInterrupted = 75
+	// DiversityThreshold is the mean Kendall tau distance between the tours
+	// of a GA population, from 0 for copies to 1, under which it stagnates
+	DiversityThreshold = 0.05
+	// DiversitySample is how many tours of a population are compared for
+	// its diversity
+	DiversitySample = 10
+	// InjectStall is how many generations in a row a GA population stays
+	// under DiversityThreshold before its worst tours are replaced
+	InjectStall = 50
+	// InjectFraction is the fraction of the worst tours of a stagnant GA
+	// population replaced by shuffled ones
+	InjectFraction = 0.3
+	// CheckpointGenerations is how many GA generations apart the state of
+	// the GA is saved to <prefix>.ga.checkpoint
+	CheckpointGenerations = 1000
+	// EndDistQuantile is the quantile of the intra-contig link distances
+	// below which a link counts as near the joining ends
+	EndDistQuantile = 0.9
+	// EndDist is the near-end threshold used without a distribution file
+	EndDist = 1000000
+	// DenseMaxCells is the largest contact matrix M that is always dense
+	DenseMaxCells = 1 << 24
+	// SparseMaxDensity is the fraction of nonzero cells under which a
+	// larger M is sparse
+	SparseMaxDensity = 0.05
+	// RecoveredPenalty raises the log10 cutoffs of pruning for the contigs
+	// marked 'recover' in the ids file, i.e. they need twice the link
+	// density or delta score to stay active
+	RecoveredPenalty = 0.30103 // math.Log10(2)
+	// PrunedSize marks the tigs inactivated by MinContigSize
+	PrunedSize = "size"
+	// PrunedDensity marks the tigs inactivated for their link density
+	PrunedDensity = "density"
+	// PrunedTour marks the tigs inactivated for their delta score in the tour
+	PrunedTour = "tourDelta"
+	// PrunedNotListed marks the tigs left out of a resumed tour or cluster
+	PrunedNotListed = "notListed"
+	// MinOrientationDelta is the drop in score on flipping a contig under
+	// which its orientation is flagged as low confidence
+	MinOrientationDelta = 1.0
+	// OrientationOK, OrientationLow and OrientationNoData flag the contigs
+	// in the orientation.tsv file
+	OrientationOK     = "ok"
+	OrientationLow    = "low"
+	OrientationNoData = "noData"
+	// StageActivate selects the active tigs and their initial signs
+	StageActivate = "activate"
+	// StagePrune drops the tigs that do not add to the tour score
+	StagePrune = "prune"
+	// StageGA orders and orients the tigs
+	StageGA = "ga"
+	// PhasePolish and PhaseOrient are the phases of optimize after the GA,
+	// see Optimizer.OnPhase
+	PhasePolish = "polish"
+	PhaseOrient = "orient"
 
 	// *** The following parameters are modeled after LACHESIS ***
 
@@ -83,19 +291,53 @@ const (
 
 	// REHeader is the first line in the RE counts file
 	REHeader = "#Contig\tRECounts\tLength\n"
+	// OmniCHeader is the first line in the counts file of the omnic mode
+	OmniCHeader = "#Contig\tEffectiveLength\tLength\n"
 
 	// PairsFileHeader is the first line in the pairs.txt file
 	PairsFileHeader = "#X\tY\tContig1\tContig2\tRE1\tRE2\tObservedLinks\tExpectedLinksIfAdjacent\tLabel\n"
 
 	// DistributionHeader is the first line in the distribution.txt file
-	DistributionHeader = "#Bin\tBinStart\tBinSize\tNumLinks\tTotalSize\tLinkDensity\n"
+	DistributionHeader = "#Bin\tBinStart\tBinSize\tNumLinks\tTotalSize\tLinkDensity\tBinEnd\n"
+	// DistributionTSVHeader is the first line in the distribution.tsv file
+	DistributionTSVHeader = "#BinStart\tBinEnd\tLinks\tDensity\tModelDensity\n"
+
+	// CoverageHeader is the first line in the coverage.txt file
+	CoverageHeader = "#Contig\tLength\tWindows\tReads\tMedianCoverage\tRatio\n"
+
+	// ContigLinksHeader is the first line in the contig_links.tsv file
+	ContigLinksHeader = "#Contig\tLength\tIntraLinks\tInterLinks\tPartners\tCisTrans\tFlag\n"
+
+	// QCHeader is the first line in the qc.tsv file
+	QCHeader = "#Metric\tCount\tOf\tFraction\tStatus\n"
+
+	// RepeatsHeader is the first line in the repeats.txt file
+	RepeatsHeader = "#Contig\tRatio\n"
+
+	// GroupQCHeader is the first line in the groupqc.txt file
+	GroupQCHeader = "#Group1\tGroup2\tAllelicPairs\tConflict\n"
+
+	// GroupQCAllelesHeader is the first line in the groupqc.alleles.txt file
+	GroupQCAllelesHeader = "#Contigs\tClustered\tClusters\tConflicts\n"
+
+	// ActiveIdsHeader is the first line in the active.ids file
+	ActiveIdsHeader = "#Contig\tSize\tStatus\tReason\tRECounts\n"
+
+	// OrientationHeader is the first line in the orientation.tsv file
+	OrientationHeader = "#Contig\tSign\tDeltaScore\tConfidence\n"
+
+	// TourScoreHeader is the first line in the output of tourscore
+	TourScoreHeader = "#Tour\tScore\tScoreQ\n"
+
+	// StatsHeader is the first line in the stats.txt file
+	StatsHeader = "#Contig\tIndex\tSize\tPartners\tLinks\tDensity\tRecovered\tInactivated\n"
 
 	// PostProbHeader is the first line in the postprob file
 	PostProbHeader = "#SeqID\tStart\tEnd\tContig\tPostProb\n"
 )
 
-// GArray contains golden array of size BB
-type GArray [BB]int
+// GArray contains golden array of size BB, counts saturate at math.MaxUint16
+type GArray [BB]uint16
 
 // GR is a precomputed list of exponents of golden ratio phi
 var GR = [...]int{5778, 9349, 15127, 24476,
@@ -126,6 +368,38 @@ func RemoveExt(filename string) string {
 	return strings.TrimSuffix(filename, path.Ext(filename))
 }
 
+// mkdirPrefix creates the directory of an output prefix, as out in
+// out/sample, when missing
+func mkdirPrefix(prefix string) error {
+	return os.MkdirAll(path.Dir(prefix), 0755)
+}
+
+// ParseByteSize converts a human readable size such as 512M or 64G into bytes
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+	size, err := strconv.ParseFloat(s, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size `%s`", s)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
 // Round makes a round number
 func Round(input float64) float64 {
 	if input < 0 {
@@ -154,18 +428,135 @@ func SumLog(a []int) float64 {
 // discussion here:
 // <https://www.johndcook.com/blog/2017/03/22/golden-powers-are-nearly-integers/>
 func GoldenArray(a []int) (counts GArray) {
+	counts, _ = DefaultGoldenScale.goldenArray(a)
+	return
+}
+
+// GoldenScale is the binning of link distances into a GArray. Bin k holds the
+// distances closest, on a log scale, to exp((LB + k) * Step). The default is
+// the powers of phi between LB and UB.
+type GoldenScale struct {
+	LB      float64 // Exponent of the first bin, in units of Step
+	Step    float64 // Natural log of the ratio between two bins
+	Bins    int     // Number of bins used, at most BB
+	bounds  [BB - 1]int
+	centers [BB]int
+}
+
+// DefaultGoldenScale bins the distances by the powers of phi from LB to UB
+var DefaultGoldenScale = newGoldenScale(LB, PHI, BB)
+
+// NewGoldenScale spreads bins over a log scale with the first bin centered
+// at minDist and the last one at maxDist. Zeros take the default for that
+// parameter, the distances of the first and the last powers of phi.
+func NewGoldenScale(minDist, maxDist, bins int) (*GoldenScale, error) {
+	if minDist == 0 && maxDist == 0 && bins == 0 {
+		return DefaultGoldenScale, nil
+	}
+	if minDist == 0 {
+		minDist = DefaultGoldenScale.centers[0]
+	}
+	if maxDist == 0 {
+		maxDist = DefaultGoldenScale.centers[BB-1]
+	}
+	if bins == 0 {
+		bins = BB
+	}
+	if bins < 2 || bins > BB {
+		return nil, fmt.Errorf("number of golden array bins %d is not within [2, %d]", bins, BB)
+	}
+	if minDist < 1 || maxDist <= minDist {
+		return nil, fmt.Errorf("golden array bounds [%d, %d] are not increasing", minDist, maxDist)
+	}
+	step := math.Log(float64(maxDist)/float64(minDist)) / float64(bins-1)
+	return newGoldenScale(math.Log(float64(minDist))/step, step, bins), nil
+}
+
+// newGoldenScale precomputes the bin boundaries and centers, so that binning
+// does not need to take any logarithms
+func newGoldenScale(lb, step float64, bins int) *GoldenScale {
+	r := &GoldenScale{LB: lb, Step: step, Bins: bins}
+	for k := 0; k < bins-1; k++ {
+		r.bounds[k] = r.findBound(k + 1)
+	}
+	for k := 0; k < bins; k++ {
+		r.centers[k] = int(Round(math.Exp((lb + float64(k)) * step)))
+	}
+	return r
+}
+
+// exponent is the reference binning rule, the bin whose center is closest to
+// x, before clamping
+func (r *GoldenScale) exponent(x int) int {
+	return int(Round(math.Log(float64(x))/r.Step - r.LB))
+}
+
+// findBound finds by binary search on exponent the smallest distance in bin
+// k, which guarantees that bin agrees with the reference rule everywhere
+func (r *GoldenScale) findBound(k int) int {
+	lo, hi := 1, math.MaxInt32
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if r.exponent(mid) >= k {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+// Bounds returns the smallest distance that falls into each bin after the first
+func (r *GoldenScale) Bounds() []int {
+	return append([]int(nil), r.bounds[:r.Bins-1]...)
+}
+
+// Centers returns the distance at the center of each bin
+func (r *GoldenScale) Centers() []int {
+	return append([]int(nil), r.centers[:r.Bins]...)
+}
+
+// Equal tells whether two scales bin the distances the same way
+func (r *GoldenScale) Equal(s *GoldenScale) bool {
+	return r.Bins == s.Bins && r.bounds == s.bounds
+}
+
+// GoldenArray bins the distances on the scale
+func (r *GoldenScale) GoldenArray(a []int) (counts GArray) {
+	counts, _ = r.goldenArray(a)
+	return
+}
+
+// goldenArray computes the GoldenArray and reports false if any of the bins
+// had to be saturated at math.MaxUint16
+func (r *GoldenScale) goldenArray(a []int) (counts GArray, ok bool) {
+	ok = true
 	for _, x := range a {
-		c := int(Round(math.Log(float64(x)) / PHI))
-		if c < LB {
-			c = LB
-		} else if c > UB {
-			c = UB
+		c := r.bin(x)
+		if counts[c] == math.MaxUint16 {
+			ok = false
+			continue
 		}
-		counts[c-LB]++
+		counts[c]++
 	}
 	return
 }
 
+// bin returns the index into GArray for a link distance, i.e. the number
+// of boundaries that are <= x
+func (r *GoldenScale) bin(x int) int {
+	lo, hi := 0, r.Bins-1
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if x >= r.bounds[mid] {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
 // abs gets the absolute value of an int
 func abs(x int) int {
 	if x < 0 {
@@ -198,6 +589,15 @@ func max(x, y int) int {
 	return y
 }
 
+// sumInts gets the sum for an int slice
+func sumInts(a []int) int {
+	ans := 0
+	for _, x := range a {
+		ans += x
+	}
+	return ans
+}
+
 // sumf gets the sum for an int slice
 func sumf(a []float64) float64 {
 	ans := 0.0
@@ -360,3 +760,61 @@ func mustOpen(filename string) *os.File {
 	}
 	return f
 }
+
+// newLineScanner returns a scanner that accepts lines up to MaxLineSize,
+// rather than failing on lines over 64 KB
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	return scanner
+}
+
+// gzipFile reads the decompressed content of a gzip file
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+// Close closes both the gzip stream and the file
+func (r *gzipFile) Close() error {
+	err := r.Reader.Close()
+	if e := r.f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// bufferedFile is a plain file read through the buffer used for sniffing
+type bufferedFile struct {
+	*bufio.Reader
+	f *os.File
+}
+
+// Close closes the file
+func (r *bufferedFile) Close() error {
+	return r.f.Close()
+}
+
+// openReader opens the file for reading, or stdin for StdinFile, and
+// decompresses it on the fly when it starts with the gzip magic bytes,
+// whatever its suffix
+func openReader(filename string) (io.ReadCloser, error) {
+	f := os.Stdin
+	if filename != StdinFile {
+		var err error
+		if f, err = os.Open(filename); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return &bufferedFile{Reader: br, f: f}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		_ = f.Close()
+		return nil, &os.PathError{Op: "gunzip", Path: filename, Err: err}
+	}
+	return &gzipFile{Reader: gz, f: f}, nil
+}
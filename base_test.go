@@ -0,0 +1,140 @@
+/*
+ *  base_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// referenceGoldenArray is the original implementation that takes one
+// logarithm per link
+func referenceGoldenArray(a []int) (counts allhic.GArray) {
+	for _, x := range a {
+		c := int(allhic.Round(math.Log(float64(x)) / allhic.PHI))
+		if c < allhic.LB {
+			c = allhic.LB
+		} else if c > allhic.UB {
+			c = allhic.UB
+		}
+		counts[c-allhic.LB]++
+	}
+	return
+}
+
+func TestGoldenArrayMatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	dists := make([]int, 0, 100000)
+	// Random distances over the full span of the histogram and beyond
+	for i := 0; i < 100000; i++ {
+		dists = append(dists, int(math.Exp(rng.Float64()*16)))
+	}
+	// Distances right around every bin boundary
+	for c := allhic.LB; c <= allhic.UB+1; c++ {
+		x := int(math.Exp((float64(c) - .5) * allhic.PHI))
+		for d := x - 3; d <= x+3; d++ {
+			if d > 0 {
+				dists = append(dists, d)
+			}
+		}
+	}
+	for _, d := range dists {
+		a := []int{d}
+		if got, expected := allhic.GoldenArray(a), referenceGoldenArray(a); got != expected {
+			t.Fatalf("GoldenArray(%d) = %v, expected %v", d, got, expected)
+		}
+	}
+	if got, expected := allhic.GoldenArray(dists), referenceGoldenArray(dists); got != expected {
+		t.Fatalf("GoldenArray = %v, expected %v", got, expected)
+	}
+}
+
+func TestGoldenArraySaturates(t *testing.T) {
+	links := make([]int, math.MaxUint16+10)
+	for i := range links {
+		links[i] = 5778
+	}
+	got := allhic.GoldenArray(links)
+	if got[0] != math.MaxUint16 {
+		t.Fatalf("Expected first bin to saturate at %d, got %d", math.MaxUint16, got[0])
+	}
+}
+
+// randomLinks returns n link distances similar to those seen in a clm file
+func randomLinks(n int) []int {
+	rng := rand.New(rand.NewSource(42))
+	links := make([]int, n)
+	for i := range links {
+		links[i] = 1000 + rng.Intn(1000000)
+	}
+	return links
+}
+
+func BenchmarkGoldenArray(b *testing.B) {
+	links := randomLinks(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allhic.GoldenArray(links)
+	}
+}
+
+func BenchmarkGoldenArrayReference(b *testing.B) {
+	links := randomLinks(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		referenceGoldenArray(links)
+	}
+}
+
+func TestGoldenScaleBounds(t *testing.T) {
+	if s, err := allhic.NewGoldenScale(0, 0, 0); err != nil || s != allhic.DefaultGoldenScale {
+		t.Errorf("zeros do not give the default scale")
+	}
+	if s, _ := allhic.NewGoldenScale(5778, 1149851, allhic.BB); !s.Equal(allhic.DefaultGoldenScale) {
+		t.Errorf("powers of phi bin differently from the default: %v", s.Bounds())
+	}
+
+	tests := []struct {
+		minDist, maxDist, bins int
+		centers, bounds        []int
+	}{
+		{1000, 1000000, 4, []int{1000, 10000, 100000, 1000000}, []int{3163, 31623, 316228}},
+		// Twice the distances shift every boundary by a factor of 2
+		{2000, 2000000, 4, []int{2000, 20000, 200000, 2000000}, []int{6325, 63246, 632456}},
+		{1000, 100000, 3, []int{1000, 10000, 100000}, []int{3163, 31623}},
+	}
+	for _, test := range tests {
+		s, err := allhic.NewGoldenScale(test.minDist, test.maxDist, test.bins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Centers(); !reflect.DeepEqual(got, test.centers) {
+			t.Errorf("%v: centers %v, want %v", test, got, test.centers)
+		}
+		if got := s.Bounds(); !reflect.DeepEqual(got, test.bounds) {
+			t.Errorf("%v: bounds %v, want %v", test, got, test.bounds)
+		}
+		var want allhic.GArray
+		want[0], want[1], want[test.bins-1] = 1, 2, 1
+		got := s.GoldenArray([]int{test.bounds[0] - 1, test.bounds[0], test.bounds[1] - 1, 1 << 30})
+		if got != want {
+			t.Errorf("%v: golden array %v, want %v", test, got, want)
+		}
+	}
+
+	for _, test := range [][3]int{{1000, 1000, 4}, {1000, 100000, 1}, {1000, 100000, allhic.BB + 1}} {
+		if _, err := allhic.NewGoldenScale(test[0], test[1], test[2]); err == nil {
+			t.Errorf("%v: expected an error", test)
+		}
+	}
+}
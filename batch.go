@@ -0,0 +1,205 @@
+/*
+ *  batch.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupResult is the outcome of optimizing one group of OptimizeGroups
+type GroupResult struct {
+	REfile  string
+	Clmfile string
+	Tigs    int     // Active tigs in the final tour
+	Score   float64 // Score of the final tour
+	Runtime time.Duration
+	Err     error
+}
+
+// SplitGroupArgs sorts the arguments of optimize into the REfiles and the
+// clmfiles of the groups, the clmfiles ending in .clm or .clm.gz, or being
+// -. The patterns are expanded as globs. There is either one clmfile for all
+// the groups, or one for each of them, paired in order.
+func SplitGroupArgs(args []string) ([]string, []string, error) {
+	if len(args) == 2 {
+		// As before the batches, whatever the names
+		return args[:1], args[1:], nil
+	}
+	var refiles, clmfiles []string
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, nil, fmt.Errorf("bad pattern `%s`: %s", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, nil, fmt.Errorf("no file matches `%s`", arg)
+			}
+		}
+		for _, name := range matches {
+			if name == StdinFile || strings.HasSuffix(strings.TrimSuffix(name, ".gz"), ".clm") {
+				clmfiles = append(clmfiles, name)
+			} else {
+				refiles = append(refiles, name)
+			}
+		}
+	}
+	switch {
+	case len(refiles) == 0 || len(clmfiles) == 0:
+		return nil, nil, fmt.Errorf("expected counts_RE files and clmfiles, got %s", strings.Join(args, " "))
+	case len(clmfiles) != 1 && len(clmfiles) != len(refiles):
+		return nil, nil, fmt.Errorf("cannot pair %d counts_RE files with %d clmfiles", len(refiles), len(clmfiles))
+	}
+	return refiles, clmfiles, nil
+}
+
+// OptimizeGroups runs a copy of opt on each group, with the REfile of the
+// group and its clmfile, or the single clmfile shared by all. The groups
+// run in parallel on a pool of workers that share opt.Threads, and each
+// writes its files under its own prefix as a single run does. A group that
+// fails does not stop the others. The results come in the order of the
+// groups, along with an error naming the failed ones, or ErrInterrupted
+// when the others all succeeded or were interrupted. The OutPrefix of opt
+// names the files of a single group, and is refused for more.
+func OptimizeGroups(opt Optimizer, refiles, clmfiles []string) ([]GroupResult, error) {
+	if opt.OutPrefix != "" && len(refiles) > 1 {
+		return nil, fmt.Errorf("cannot write the %d groups to the one prefix %s, drop --outPrefix",
+			len(refiles), opt.OutPrefix)
+	}
+	results := make([]GroupResult, len(refiles))
+	prefixes := make(map[string]string)
+	for i, refile := range refiles {
+		results[i].REfile, results[i].Clmfile = refile, clmfiles[0]
+		if len(clmfiles) > 1 {
+			results[i].Clmfile = clmfiles[i]
+		}
+		if results[i].Clmfile == StdinFile && len(refiles) > 1 {
+			return nil, fmt.Errorf("cannot share the clm read from stdin by %d groups", len(refiles))
+		}
+		// The prefix of the copy of opt that runs the group
+		o := opt
+		o.REfile = refile
+		if other, ok := prefixes[o.prefix()]; ok {
+			return nil, fmt.Errorf("groups %s and %s would both write to prefix %s", other, refile, o.prefix())
+		}
+		prefixes[o.prefix()] = refile
+	}
+
+	threads := opt.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	workers := threads
+	if workers > len(refiles) {
+		workers = len(refiles)
+	}
+	opt.Threads = threads / workers
+	stdout := opt.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	opt.Stdout = &lockedWriter{w: stdout}
+	log.Noticef("Optimize %d groups, %d at a time with %d threads each", len(refiles), workers, opt.Threads)
+
+	groups := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range groups {
+				results[i].optimize(opt)
+			}
+		}()
+	}
+	for i := range refiles {
+		groups <- i
+	}
+	close(groups)
+	wg.Wait()
+
+	writeGroupSummary(stdout, results)
+	var failed []string
+	interrupted := false
+	for _, res := range results {
+		switch res.Err {
+		case nil:
+		case ErrInterrupted:
+			interrupted = true
+		default:
+			failed = append(failed, res.REfile)
+		}
+	}
+	switch {
+	case len(failed) > 0:
+		return results, fmt.Errorf("%d of %d groups failed: %s", len(failed), len(results),
+			strings.Join(failed, ", "))
+	case interrupted:
+		return results, ErrInterrupted
+	}
+	return results, nil
+}
+
+// optimize runs a copy of opt on the group, and keeps a panic of the run as
+// its error, so that the other groups carry on
+func (r *GroupResult) optimize(opt Optimizer) {
+	opt.REfile, opt.Clmfile = r.REfile, r.Clmfile
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			r.Err = fmt.Errorf("%v", p)
+		}
+		r.Runtime = time.Since(start)
+		if r.Err != nil {
+			log.Errorf("Group %s failed: %s", r.REfile, r.Err)
+		}
+	}()
+	log.Noticef("Optimize group %s with %s", r.REfile, r.Clmfile)
+	r.Err = opt.Run()
+	r.Tigs, r.Score = opt.OutTigs, opt.OutScore
+}
+
+// writeGroupSummary lists the contigs, the final score and the runtime of
+// each group
+func writeGroupSummary(w io.Writer, results []GroupResult) {
+	fmt.Fprintln(w, "#Group\tContigs\tScore\tRuntime\tStatus")
+	for _, res := range results {
+		status := "OK"
+		switch res.Err {
+		case nil:
+		case ErrInterrupted:
+			status = "INTERRUPTED"
+		default:
+			status = "FAILED: " + res.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.5f\t%s\t%s\n", res.REfile, res.Tigs, res.Score,
+			res.Runtime.Round(time.Millisecond), status)
+	}
+}
+
+// lockedWriter lets the groups echo their tours to the same writer
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// Write writes p in one piece
+func (r *lockedWriter) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	return r.w.Write(p)
+}
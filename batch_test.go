@@ -0,0 +1,127 @@
+/*
+ *  batch_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestSplitGroupArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args              []string
+		refiles, clmfiles string
+		err               string
+	}{
+		{[]string{"g1.txt", "x.tsv"}, "g1.txt", "x.tsv", ""},
+		{[]string{"g1.txt", "g2.txt", "s.clm"}, "g1.txt g2.txt", "s.clm", ""},
+		{[]string{"g1.txt", "g2.txt", "a.clm", "b.clm.gz"}, "g1.txt g2.txt", "a.clm b.clm.gz", ""},
+		{[]string{"g1.txt", "g2.txt", "g3.txt"}, "", "", "expected"},
+		{[]string{"g1.txt", "g2.txt", "g3.txt", "a.clm", "b.clm"}, "", "", "cannot pair"},
+		{[]string{"nothing*.txt", "s.clm", "t.clm"}, "", "", "no file matches"},
+	} {
+		refiles, clmfiles, err := allhic.SplitGroupArgs(tt.args)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: got error %v, want %q", tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %s", tt.args, err)
+			continue
+		}
+		if got := strings.Join(refiles, " "); got != tt.refiles {
+			t.Errorf("%v: got counts_RE files %q, want %q", tt.args, got, tt.refiles)
+		}
+		if got := strings.Join(clmfiles, " "); got != tt.clmfiles {
+			t.Errorf("%v: got clmfiles %q, want %q", tt.args, got, tt.clmfiles)
+		}
+	}
+}
+
+// TestOptimizeGroupsPrefix refuses the groups that would write to the same
+// prefix, whether given by --outPrefix or by the names of their REfiles,
+// before any of them runs
+func TestOptimizeGroupsPrefix(t *testing.T) {
+	_, clmfile := simulationFiles(t)
+	inTempDir(t, func() {
+		for _, tt := range []struct {
+			refiles   []string
+			outPrefix string
+			want      string
+		}{
+			{[]string{"g1.ids", "g2.ids"}, "out/same", "cannot write the 2 groups to the one prefix out/same"},
+			{[]string{"a/g.ids", "b/g.ids"}, "", "groups a/g.ids and b/g.ids would both write to prefix g"},
+		} {
+			opt := allhic.Optimizer{OutPrefix: tt.outPrefix}
+			results, err := allhic.OptimizeGroups(opt, tt.refiles, []string{clmfile})
+			if err == nil || !strings.Contains(err.Error(), tt.want) || results != nil {
+				t.Errorf("groups %v with prefix %q: got error %v, want %q", tt.refiles, tt.outPrefix, err, tt.want)
+			}
+		}
+		if _, err := os.Stat("out"); !os.IsNotExist(err) {
+			t.Errorf("the groups ran into out/, %v", err)
+		}
+	})
+}
+
+// TestOptimizeGroups optimizes two copies of the simulated group and a
+// missing one, and expects the copies to come out as a single run does,
+// despite the failed group
+func TestOptimizeGroups(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	want := runOptimizer(t, opt)
+	idsfile, clmfile := simulationFiles(t)
+	inTempDir(t, func() {
+		ids, err := ioutil.ReadFile(idsfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"g1.ids", "g2.ids"} {
+			if err := ioutil.WriteFile(name, ids, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		refiles, clmfiles, err := allhic.SplitGroupArgs([]string{"g*.ids", "missing.ids", clmfile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary bytes.Buffer
+		opt.Stdout = &summary
+		results, err := allhic.OptimizeGroups(opt, refiles, clmfiles)
+		if err == nil || !strings.Contains(err.Error(), "1 of 3 groups failed: missing.ids") {
+			t.Errorf("got error %v, want the missing group", err)
+		}
+		for _, res := range results[:2] {
+			if res.Err != nil || res.Tigs == 0 || res.Score <= 0 {
+				t.Errorf("group %s: %d contigs, score %g, error %v", res.REfile, res.Tigs, res.Score, res.Err)
+			}
+			s, err := ioutil.ReadFile(strings.TrimSuffix(res.REfile, ".ids") + ".tour")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tourTimes.ReplaceAllString(string(s), ""); got != want {
+				t.Errorf("group %s: got tours\n%s\nwant\n%s", res.REfile, got, want)
+			}
+		}
+		if results[2].Err == nil {
+			t.Error("the missing group did not fail")
+		}
+		if !strings.Contains(summary.String(), "#Group\tContigs\tScore\tRuntime\tStatus") ||
+			!strings.Contains(summary.String(), "missing.ids\t0\t") {
+			t.Errorf("bad summary:\n%s", summary.String())
+		}
+	})
+}
@@ -0,0 +1,132 @@
+/*
+ *  besttours.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// bestTour is a tour kept by bestTours, with where the GA found it
+type bestTour struct {
+	tour  Tour
+	key   string
+	score float64
+	phase int
+	gen   uint
+}
+
+// bestTours keeps the n highest-scoring distinct tours that the GA has seen,
+// where a tour and its exact reverse are the same solution
+type bestTours struct {
+	n     int
+	tours []bestTour // Best first
+	dirty bool       // Changed since written
+}
+
+// newBestTours keeps the n best tours, nil when n is 0
+func newBestTours(n int) *bestTours {
+	if n <= 0 {
+		return nil
+	}
+	return &bestTours{n: n}
+}
+
+// offer considers the best tours of each population of the GA in phase
+func (r *bestTours) offer(ga *eaopt.GA, phase int) {
+	if r == nil {
+		return
+	}
+	for _, pop := range ga.Populations {
+		// The populations are sorted, best first
+		for i := 0; i < r.n && i < len(pop.Individuals); i++ {
+			indi := pop.Individuals[i]
+			if !r.add(indi.Genome.(Tour), -indi.Fitness, phase, ga.Generations) {
+				break
+			}
+		}
+	}
+}
+
+// add keeps a copy of the tour if it is among the n best, and returns
+// whether its score is high enough to be
+func (r *bestTours) add(tour Tour, score float64, phase int, gen uint) bool {
+	if len(r.tours) == r.n && score <= r.tours[r.n-1].score {
+		return false
+	}
+	key := tourKey(tour)
+	for _, t := range r.tours {
+		if t.key == key {
+			return true
+		}
+	}
+	kept := tour.Clone().(Tour)
+	kept.delta, kept.counts = nil, nil
+	i := len(r.tours)
+	for i > 0 && r.tours[i-1].score < score {
+		i--
+	}
+	r.tours = append(r.tours, bestTour{})
+	copy(r.tours[i+1:], r.tours[i:])
+	r.tours[i] = bestTour{tour: kept, key: key, score: score, phase: phase, gen: gen}
+	if len(r.tours) > r.n {
+		r.tours = r.tours[:r.n]
+	}
+	r.dirty = true
+	return true
+}
+
+// tourKey identifies the order of the tigs, and their orientations when the
+// tour carries them, the same for the tour read backwards
+func tourKey(tour Tour) string {
+	forward := make([]byte, 0, 8*tour.Len())
+	backward := make([]byte, 0, 8*tour.Len())
+	for i := range tour.Tigs {
+		tig := tour.Tigs[i]
+		forward = strconv.AppendInt(forward, int64(tig.Idx), 10)
+		if tig.Sign != 0 {
+			forward = append(forward, tig.Sign)
+		}
+		forward = append(forward, ',')
+		tig = tour.Tigs[tour.Len()-1-i]
+		backward = strconv.AppendInt(backward, int64(tig.Idx), 10)
+		if tig.Sign != 0 {
+			backward = append(backward, rr(tig.Sign))
+		}
+		backward = append(backward, ',')
+	}
+	if string(backward) < string(forward) {
+		return string(backward)
+	}
+	return string(forward)
+}
+
+// write replaces filename with the kept tours when they changed, the best
+// one last, so that it is the one that build uses
+func (r *bestTours) write(clm *CLM, filename string) error {
+	if r == nil || !r.dirty {
+		return nil
+	}
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return fmt.Errorf("cannot create best tours %s: %s", filename, err)
+	}
+	for i := len(r.tours) - 1; i >= 0; i-- {
+		t := r.tours[i]
+		clm.printTour(f, t.tour, fmt.Sprintf("BEST%d", i+1),
+			fmt.Sprintf("phase=%d gen=%d", t.phase, t.gen))
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	r.dirty = false
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ *  besttours_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestTourKey tells a tour apart from the others, but not from its reverse,
+// whose tigs flip their orientations
+func TestTourKey(t *testing.T) {
+	tour := func(tigs ...allhic.Tig) allhic.Tour { return allhic.Tour{Tigs: tigs} }
+	a, b, c := allhic.Tig{Idx: 1}, allhic.Tig{Idx: 2}, allhic.Tig{Idx: 3}
+	if allhic.TourKey(tour(a, b, c)) != allhic.TourKey(tour(c, b, a)) {
+		t.Error("a tour and its reverse have different keys")
+	}
+	if allhic.TourKey(tour(a, b, c)) == allhic.TourKey(tour(b, a, c)) {
+		t.Error("different tours have the same key")
+	}
+	a.Sign, b.Sign, c.Sign = '+', '+', '-'
+	ra, rb, rc := a, b, c
+	ra.Sign, rb.Sign, rc.Sign = '-', '-', '+'
+	if allhic.TourKey(tour(a, b, c)) != allhic.TourKey(tour(rc, rb, ra)) {
+		t.Error("a joint tour and its reverse have different keys")
+	}
+	if allhic.TourKey(tour(a, b, c)) == allhic.TourKey(tour(c, b, a)) {
+		t.Error("a joint tour and its reverse with unflipped signs have the same key")
+	}
+}
+
+// TestOptimizeKeepBest writes the best tour at the interval, and keeps the
+// best distinct tours, the best one last
+func TestOptimizeKeepBest(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.TourInterval, opt.KeepBest = 10, 3
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile(opt.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range []string{">GA1-10 ", ">GA1-20 ", ">GA2-10 "} {
+			if !strings.Contains(string(s), label) {
+				t.Errorf("tour file lacks %s", label)
+			}
+		}
+		if s, err = ioutil.ReadFile("test.best3.tour"); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if len(lines) != 6 {
+			t.Fatalf("best tours file has %d lines, want 3 tours", len(lines))
+		}
+		score := regexp.MustCompile(`score=(\S+)`)
+		seen := map[string]bool{}
+		last := 0.0
+		for i := 0; i < len(lines); i += 2 {
+			if want := ">BEST" + strconv.Itoa(3-i/2) + " "; !strings.HasPrefix(lines[i], want) {
+				t.Errorf("tour %d is %s, want %s", i/2, lines[i], want)
+			}
+			v, _ := strconv.ParseFloat(score.FindStringSubmatch(lines[i])[1], 64)
+			if i > 0 && v < last {
+				t.Errorf("tour %d scores %g, below the tour before it %g", i/2, v, last)
+			}
+			last = v
+			atoms := strings.Fields(lines[i+1])
+			for k := range atoms {
+				atoms[k] = strings.TrimRight(atoms[k], "+-")
+			}
+			reversed := make([]string, len(atoms))
+			for k := range atoms {
+				reversed[k] = atoms[len(atoms)-1-k]
+			}
+			forward, backward := strings.Join(atoms, " "), strings.Join(reversed, " ")
+			if seen[forward] || seen[backward] {
+				t.Errorf("tour %d is kept twice", i/2)
+			}
+			seen[forward] = true
+		}
+	})
+}
@@ -13,7 +13,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
+	"runtime"
 	"strings"
 
 	"github.com/shenwei356/bio/seq"
@@ -24,6 +24,11 @@ import (
 type Builder struct {
 	Tourfiles []string
 	Fastafile string
+	// Number of workers assembling scaffold sequences
+	Threads int
+	// AliasFile maps the names in the FASTA file and the tours to the
+	// canonical names, see ReadAliasFile
+	AliasFile string
 	// Output file
 	OutAGPfile   string
 	OutFastafile string
@@ -41,21 +46,26 @@ type OOLine struct {
 type OO struct {
 	seqs    map[string]*seq.Seq
 	entries []OOLine
+	aliases AliasMap
 }
 
-// getFastaSizes returns a dictionary of contig sizes
+// getFastaSizes returns a dictionary of contig sizes, by canonical name
 func (r *OO) getFastaSizes(fastafile string) {
 	log.Noticef("Parse FASTA file `%s`", fastafile)
 
 	reader, _ := fastx.NewDefaultReader(fastafile)
 	seq.ValidateSeq = false
 	r.seqs = map[string]*seq.Seq{}
+	names := newAliasedNames(r.aliases)
 	for {
 		rec, err := reader.Read()
 		if err == io.EOF || rec == nil {
 			break
 		}
-		name := string(rec.Name)
+		name, err := names.canonical(string(rec.Name))
+		if err != nil {
+			ErrorAbort(fmt.Errorf("%s in %s", err, fastafile))
+		}
 		r.seqs[name] = rec.Seq.Clone()
 	}
 }
@@ -77,7 +87,7 @@ func (r *Builder) writeAGP(oo *OO, gapSize int) {
 	objectEnd := 1
 	partNumber := 0
 	componentType := 'W'
-	f, _ := os.Create(r.OutAGPfile)
+	f := mustCreateAtomic(r.OutAGPfile)
 	w := bufio.NewWriter(f)
 	components := 0
 
@@ -109,19 +119,28 @@ func (r *Builder) writeAGP(oo *OO, gapSize int) {
 		objectBeg += line.componentSize
 		components++
 	}
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
 	log.Noticef("A total of %d tigs written to `%s`", components, r.OutAGPfile)
-	_ = f.Close()
 }
 
 // Run kicks off the Build and constructs molecule using component FASTA sequence
 func (r *Builder) Run() {
 	oo := new(OO)
+	if r.AliasFile != "" {
+		aliases, err := ReadAliasFile(r.AliasFile)
+		ErrorAbort(err)
+		oo.aliases = aliases
+	}
 	oo.getFastaSizes(r.Fastafile)
 	// oo.parseLastTour(r.Tourfile)
 	oo.mergeTours(r.Tourfiles)
 	r.writeAGP(oo, 100)
-	buildFasta(r.OutAGPfile, oo.seqs)
+	threads := r.Threads
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+	buildFasta(r.OutAGPfile, oo.seqs, threads)
 	log.Notice("Success")
 }
 
@@ -150,26 +169,32 @@ func (r *OO) parseLastTour(tourfile string, seqid string) {
 		} else {
 			strand = '?'
 		}
+		tig = r.aliases.Name(tig)
 		r.Add(seqid, tig, r.seqs[tig].Length(), strand)
 	}
 }
 
 // ParseAllTours reads tour from file
 //
-// A tour file has the following format:
-// > name
+// A tour file has the following format, where the key=value fields after
+// the name are ignored:
+// > name score=123.45678 seed=42
 // contig1+ contig2- contig3?
 func (r *OO) ParseAllTours(tourfile string) {
 	log.Noticef("Parse tourfile `%s`", tourfile)
 
 	file := mustOpen(tourfile)
-	scanner := bufio.NewScanner(file)
+	defer file.Close()
+	scanner := newLineScanner(file)
 	var (
 		name   string
 		strand byte
 	)
 	for scanner.Scan() {
 		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
 		if words[0][0] == '>' {
 			name = words[0][1:]
 			continue
@@ -181,7 +206,11 @@ func (r *OO) ParseAllTours(tourfile string) {
 			} else {
 				strand = '?'
 			}
+			tig = r.aliases.Name(tig)
 			r.Add(name, tig, r.seqs[tig].Length(), strand)
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		ErrorAbort(fmt.Errorf("cannot read tourfile %s: %s", tourfile, err))
+	}
 }
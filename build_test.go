@@ -0,0 +1,75 @@
+/*
+ *  build_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeSyntheticAssembly writes random contigs and a few tours over them
+func writeSyntheticAssembly(t testing.TB, nTigs, nTours int) (fastafile string, tourfiles []string) {
+	rng := rand.New(rand.NewSource(42))
+	var fasta bytes.Buffer
+	tours := make([][]string, nTours)
+	for i := 0; i < nTigs; i++ {
+		name := fmt.Sprintf("tig%04d", i)
+		s := make([]byte, 100+rng.Intn(20000))
+		for j := range s {
+			s[j] = "ACGT"[rng.Intn(4)]
+		}
+		fmt.Fprintf(&fasta, ">%s\n%s\n", name, s)
+		k := rng.Intn(nTours)
+		tours[k] = append(tours[k], name+string("+-?"[rng.Intn(3)]))
+	}
+	fastafile = "contigs.fasta"
+	if err := ioutil.WriteFile(fastafile, fasta.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, tour := range tours {
+		tourfile := fmt.Sprintf("g%d.tour", i+1)
+		row := ">g\n" + strings.Join(tour, " ") + "\n"
+		if err := ioutil.WriteFile(tourfile, []byte(row), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tourfiles = append(tourfiles, tourfile)
+	}
+	return
+}
+
+// TestBuildParallelMatchesSerial checks that threads do not change the output
+func TestBuildParallelMatchesSerial(t *testing.T) {
+	inTempDir(t, func() {
+		fastafile, tourfiles := writeSyntheticAssembly(t, 200, 12)
+		var outputs [][]byte
+		for _, threads := range []int{1, 4} {
+			outfile := fmt.Sprintf("asm-t%d.fasta", threads)
+			b := allhic.Builder{Tourfiles: tourfiles, Fastafile: fastafile,
+				OutFastafile: outfile, Threads: threads}
+			b.Run()
+			out, err := ioutil.ReadFile(outfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Count(out, []byte(">")) != len(tourfiles) {
+				t.Fatalf("threads=%d: expected %d records", threads, len(tourfiles))
+			}
+			outputs = append(outputs, out)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Error("parallel build differs from serial build")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ *  callback_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestOptimizeCallbacks follows a run by its callbacks, which see each
+// generation of the GA and each phase, and do not change the tours
+func TestOptimizeCallbacks(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	want := runOptimizer(t, opt)
+
+	var phases []string
+	gens, next, last := 0, 0, 0.0
+	opt.OnGeneration = func(gen int, best float64, tour allhic.Tour) error {
+		if gen != next && gen != 0 {
+			t.Errorf("got generation %d, want %d", gen, next)
+		}
+		if best < last && gen > 0 {
+			t.Errorf("generation %d: best score dropped from %g to %g", gen, last, best)
+		}
+		if tour.Len() == 0 {
+			t.Errorf("generation %d: empty tour", gen)
+		}
+		gens, next, last = gens+1, gen+1, best
+		return nil
+	}
+	opt.OnPhase = func(phase string, tour allhic.Tour) error {
+		phases = append(phases, phase)
+		return nil
+	}
+	if got := runOptimizer(t, opt); got != want {
+		t.Error("callbacks changed the tours")
+	}
+	if gens == 0 {
+		t.Error("OnGeneration was never called")
+	}
+	wantPhases := []string{allhic.StageActivate, "ga1", "ga2", allhic.PhasePolish, allhic.PhaseOrient}
+	if !reflect.DeepEqual(phases, wantPhases) {
+		t.Errorf("got phases %v, want %v", phases, wantPhases)
+	}
+}
+
+// TestOptimizeCallbackAbort stops runs from the callbacks, in the GA and
+// after it, and checks that they fail with the error of the callback and
+// leave a tour of all the contigs
+func TestOptimizeCallbackAbort(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	var nTigs int
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		nTigs = len(allhic.ParseTourWords(opt.OutTourFile))
+	})
+
+	errStop := errors.New("stop")
+	for name, edit := range map[string]func(*allhic.Optimizer){
+		"generation": func(r *allhic.Optimizer) {
+			r.OnGeneration = func(gen int, best float64, tour allhic.Tour) error {
+				if gen == 10 {
+					return errStop
+				}
+				return nil
+			}
+		},
+		"polish": func(r *allhic.Optimizer) {
+			r.OnPhase = func(phase string, tour allhic.Tour) error {
+				if phase == allhic.PhasePolish {
+					return errStop
+				}
+				return nil
+			}
+		},
+	} {
+		stopped := opt
+		edit(&stopped)
+		inTempDir(t, func() {
+			if err := stopped.Run(); err != errStop {
+				t.Fatalf("%s: got error %v, want %v", name, err, errStop)
+			}
+			if got := len(allhic.ParseTourWords(stopped.OutTourFile)); got != nTigs {
+				t.Errorf("%s: last tour has %d contigs, want %d", name, got, nTigs)
+			}
+			if !stopped.Summary.Interrupted || stopped.OutTigs != nTigs {
+				t.Errorf("%s: summary %+v of %d contigs, want an interrupted run of %d",
+					name, stopped.Summary, stopped.OutTigs, nTigs)
+			}
+		})
+	}
+}
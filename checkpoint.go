@@ -0,0 +1,279 @@
+/*
+ *  checkpoint.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// CheckpointVersion is the version of the GA checkpoints written, those of
+// another version cannot be resumed from
+const CheckpointVersion = 1
+
+// maxInitDraws bounds the draws of the population while eaopt initializes it
+const maxInitDraws = 1 << 24
+
+// errHalted stops the run after a checkpoint, as if the job were killed
+var errHalted = errors.New("halted after the GA checkpoint")
+
+// ErrInterrupted is the error of a run stopped by its time limit or its
+// context, which leaves the best tour so far and the GA checkpoint
+var ErrInterrupted = errors.New("optimization interrupted")
+
+// GACheckpoint is the state of the GA after a generation, which a later run
+// with the same seed picks up to carry on as if it had never stopped
+type GACheckpoint struct {
+	Version    int     `json:"version"`
+	Seed       int64   `json:"seed"`
+	Phase      int     `json:"phase"`
+	Generation uint    `json:"generation"`
+	Updated    uint    `json:"updated"` // Last generation that improved the best score
+	Best       float64 `json:"best"`
+	// State of the random stream of the run, and the seed and the draws of
+	// that of the population
+	RNG        uint64             `json:"rng"`
+	PopSeed    int64              `json:"pop_seed"`
+	PopDraws   uint64             `json:"pop_draws"`
+	Population []CheckpointGenome `json:"population"`
+	HallOfFame []CheckpointGenome `json:"hall_of_fame"`
+	// Islands are the populations after the first, with Optimizer.Islands
+	Islands []CheckpointIsland `json:"islands,omitempty"`
+	// Restart is the GA in progress of Optimizer.Restarts, after those in
+	// Restarts, by their best tours
+	Restart  int                `json:"restart,omitempty"`
+	Restarts []CheckpointGenome `json:"restarts,omitempty"`
+}
+
+// CheckpointIsland is the population of an island of the GA, with the seed
+// and the draws of its random stream
+type CheckpointIsland struct {
+	PopSeed    int64              `json:"pop_seed"`
+	PopDraws   uint64             `json:"pop_draws"`
+	Population []CheckpointGenome `json:"population"`
+}
+
+// CheckpointGenome is a tour of the GA with its fitness, and the score that
+// Mutate keeps up to date
+type CheckpointGenome struct {
+	Tigs    []string `json:"tigs"`
+	Signs   string   `json:"signs,omitempty"` // Carried with JointScorer
+	Fitness float64  `json:"fitness"`
+	Score   float64  `json:"score"`
+	ScoreOK bool     `json:"score_ok"`
+}
+
+// gaState is a checkpoint with the tours on the tigs of the CLM
+type gaState struct {
+	*GACheckpoint
+	populations []eaopt.Individuals // By island
+	hallOfFame  eaopt.Individuals
+	restarts    eaopt.Individuals
+}
+
+// writeCheckpoint saves the state of the GA in phase of the run of opt into
+// filename, with the random streams of its populations
+func (r *CLM) writeCheckpoint(filename string, ga *eaopt.GA, phase int, opt *Optimizer,
+	best float64, updated uint, popRNGs []*replaySource) error {
+	c := GACheckpoint{Version: CheckpointVersion, Seed: opt.Seed, Phase: phase,
+		Generation: ga.Generations, Updated: updated, Best: best, RNG: opt.src.state,
+		Restart: opt.restart}
+	for _, done := range opt.restarted {
+		c.Restarts = append(c.Restarts, r.checkpointGenome(eaopt.Individual{Genome: done.tour, Fitness: done.score}))
+	}
+	for i, pop := range ga.Populations {
+		island := CheckpointIsland{PopSeed: popRNGs[i].seed, PopDraws: popRNGs[i].draws}
+		for _, indi := range pop.Individuals {
+			island.Population = append(island.Population, r.checkpointGenome(indi))
+		}
+		if i == 0 {
+			c.PopSeed, c.PopDraws, c.Population = island.PopSeed, island.PopDraws, island.Population
+		} else {
+			c.Islands = append(c.Islands, island)
+		}
+	}
+	for _, indi := range ga.HallOfFame {
+		c.HallOfFame = append(c.HallOfFame, r.checkpointGenome(indi))
+	}
+	s, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(s); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	return f.Close()
+}
+
+// checkpointGenome names the tigs of a tour of the GA
+func (r *CLM) checkpointGenome(indi eaopt.Individual) CheckpointGenome {
+	tour := indi.Genome.(Tour)
+	g := CheckpointGenome{Tigs: make([]string, tour.Len()), Fitness: indi.Fitness}
+	signs := make([]byte, 0)
+	for i, tig := range tour.Tigs {
+		g.Tigs[i] = r.Tigs[tig.Idx].Name
+		if tig.Sign != 0 {
+			signs = append(signs, tig.Sign)
+		}
+	}
+	g.Signs = string(signs)
+	if tour.delta != nil {
+		g.Score, g.ScoreOK = tour.delta.score, tour.delta.ok
+	}
+	return g
+}
+
+// readCheckpoint reads the GA checkpoint in filename and rebuilds its tours
+// on the tigs of the CLM. The checkpoint must be of this version and from a
+// run with the same seed, population size, islands and restarts.
+func (r *CLM) readCheckpoint(filename string, seed int64, npop, islands, restarts int) (*gaState, error) {
+	s, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read GA checkpoint %s: %s", filename, err)
+	}
+	var version struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(s, &version); err != nil {
+		return nil, fmt.Errorf("malformed GA checkpoint %s: %s", filename, err)
+	}
+	if version.Version != CheckpointVersion {
+		return nil, fmt.Errorf("GA checkpoint %s has version %d, but this allhic reads version %d",
+			filename, version.Version, CheckpointVersion)
+	}
+	c := new(GACheckpoint)
+	if err := json.Unmarshal(s, c); err != nil {
+		return nil, fmt.Errorf("malformed GA checkpoint %s: %s", filename, err)
+	}
+	switch {
+	case c.Seed != seed:
+		return nil, fmt.Errorf("GA checkpoint %s is from a run with seed %d, not %d",
+			filename, c.Seed, seed)
+	case len(c.Population) != npop:
+		return nil, fmt.Errorf("GA checkpoint %s has %d tours, not npop %d",
+			filename, len(c.Population), npop)
+	case len(c.Islands)+1 != islands:
+		return nil, fmt.Errorf("GA checkpoint %s has %d islands, not %d",
+			filename, len(c.Islands)+1, islands)
+	case len(c.HallOfFame) == 0:
+		return nil, fmt.Errorf("GA checkpoint %s has no best tour", filename)
+	case c.Restart >= restarts || len(c.Restarts) != c.Restart:
+		return nil, fmt.Errorf("GA checkpoint %s is at restart %d after %d finished ones, but the run has %d restarts",
+			filename, c.Restart+1, len(c.Restarts), restarts)
+	}
+	genomes := [][]CheckpointGenome{c.HallOfFame, c.Restarts, c.Population}
+	for _, island := range c.Islands {
+		if len(island.Population) != npop {
+			return nil, fmt.Errorf("GA checkpoint %s has an island of %d tours, not npop %d",
+				filename, len(island.Population), npop)
+		}
+		genomes = append(genomes, island.Population)
+	}
+	state := &gaState{GACheckpoint: c}
+	for i, from := range genomes {
+		var indis eaopt.Individuals
+		for _, g := range from {
+			indi, err := r.restoreGenome(g)
+			if err != nil {
+				return nil, fmt.Errorf("GA checkpoint %s: %s", filename, err)
+			}
+			indis = append(indis, indi)
+		}
+		switch i {
+		case 0:
+			state.hallOfFame = indis
+		case 1:
+			state.restarts = indis
+		default:
+			state.populations = append(state.populations, indis)
+		}
+	}
+	return state, nil
+}
+
+// restoreGenome rebuilds a tour of the GA on the tigs of the CLM, with the
+// matrix and the scorer of the current tour
+func (r *CLM) restoreGenome(g CheckpointGenome) (eaopt.Individual, error) {
+	if g.Signs != "" && len(g.Signs) != len(g.Tigs) {
+		return eaopt.Individual{}, fmt.Errorf("tour has %d tigs but %d signs", len(g.Tigs), len(g.Signs))
+	}
+	tour := Tour{Tigs: make([]Tig, len(g.Tigs)), M: r.Tour.M, Scorer: r.Tour.Scorer,
+		Cross: r.Tour.Cross, Moves: r.Tour.Moves, Pins: r.Tour.Pins, Graph: r.Tour.Graph, counts: r.Tour.counts, delta: &deltaScore{score: g.Score, ok: g.ScoreOK}}
+	for i, name := range g.Tigs {
+		idx, ok := r.tigToIdx[name]
+		if !ok {
+			return eaopt.Individual{}, fmt.Errorf("contig %s not found in `%s`", name, r.REfile)
+		}
+		tour.Tigs[i] = Tig{Idx: idx, Size: r.Tigs[idx].Size}
+		if g.Signs != "" {
+			tour.Tigs[i].Sign = g.Signs[i]
+		}
+	}
+	return eaopt.Individual{Genome: tour, Fitness: g.Fitness, Evaluated: true}, nil
+}
+
+// restore puts the populations, the best tours and the random streams of the
+// checkpoint in place of those of the GA just initialized, and returns the
+// streams of the populations
+func (r *gaState) restore(ga *eaopt.GA, rng *splitMix64) []*replaySource {
+	popRNGs := []*replaySource{newReplaySource(r.PopSeed, r.PopDraws)}
+	for _, island := range r.Islands {
+		popRNGs = append(popRNGs, newReplaySource(island.PopSeed, island.PopDraws))
+	}
+	for i := range ga.Populations {
+		pop := &ga.Populations[i]
+		pop.Individuals = r.populations[i]
+		pop.Generations = r.Generation
+		pop.RNG = rand.New(popRNGs[i])
+	}
+	ga.HallOfFame = r.hallOfFame
+	ga.Generations = r.Generation
+	rng.state = r.RNG
+	return popRNGs
+}
+
+// replayPopulationRNGs returns the streams that carry on those of the
+// populations just initialized, and can be checkpointed. eaopt seeds each
+// population, in turn, with the next draw of the GA stream, at state gaRNG
+// before the initialization, so that the stream of an island derives from
+// the seed and the index of the island. The draws since are found by the
+// next value of each stream.
+func replayPopulationRNGs(pops eaopt.Populations, gaRNG splitMix64) ([]*replaySource, error) {
+	popRNGs := make([]*replaySource, len(pops))
+	for i := range pops {
+		var err error
+		if popRNGs[i], err = replayPopulationRNG(&pops[i], gaRNG.Int63()); err != nil {
+			return nil, err
+		}
+		pops[i].RNG = rand.New(popRNGs[i])
+	}
+	return popRNGs, nil
+}
+
+// replayPopulationRNG returns the stream of the population seeded with seed
+func replayPopulationRNG(pop *eaopt.Population, seed int64) (*replaySource, error) {
+	next := pop.RNG.Int63()
+	probe := newReplaySource(seed, 0)
+	for probe.draws < maxInitDraws {
+		if probe.Int63() == next {
+			return newReplaySource(seed, probe.draws), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot replay the random stream of the GA population")
+}
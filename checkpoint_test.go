@@ -0,0 +1,112 @@
+/*
+ *  checkpoint_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// lastTour returns the header, without the time, and the atoms of the last
+// tour in the tour file of the run
+func lastTour(t *testing.T, opt allhic.Optimizer) string {
+	s, err := ioutil.ReadFile(opt.OutTourFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(tourTimes.ReplaceAllString(string(s), "")), "\n")
+	return strings.Join(lines[len(lines)-2:], "\n")
+}
+
+// TestResumeCheckpoint halts runs after their first checkpoint in either GA
+// phase, and checks that resuming them ends on the tour and the score of the
+// runs that never stopped
+func TestResumeCheckpoint(t *testing.T) {
+	for _, run := range []struct {
+		phase   int
+		joint   bool
+		islands int
+	}{{1, false, 1}, {1, true, 1}, {2, false, 1}, {2, true, 1}, {1, false, 3}} {
+		opt := shortOptimizer(t, 42)
+		opt.CheckpointEvery, opt.JointOrient, opt.Islands = 10, run.joint, run.islands
+		opt.MigrationInterval = 4 // Across the checkpoint
+		var want string
+		inTempDir(t, func() {
+			if err := opt.Run(); err != nil {
+				t.Fatal(err)
+			}
+			want = lastTour(t, opt)
+			if _, err := os.Stat("test.ga.checkpoint"); err == nil {
+				t.Error("checkpoint left behind by a run that finished")
+			}
+		})
+
+		halted, resumed := opt, opt
+		halted.HaltAfterCheckpoint(run.phase)
+		resumed.ResumeCheckpoint = true
+		inTempDir(t, func() {
+			if err := halted.Run(); err == nil {
+				t.Fatalf("%+v: run was not halted", run)
+			}
+			if _, err := os.Stat("test.ga.checkpoint"); err != nil {
+				t.Fatal(err)
+			}
+			if err := resumed.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := lastTour(t, resumed); got != want {
+				t.Errorf("%+v: resumed run ends on\n%s\nwant\n%s", run, got, want)
+			}
+		})
+	}
+}
+
+// TestCheckpointErrors resumes from checkpoints that do not fit the run
+func TestCheckpointErrors(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.CheckpointEvery = 10
+	inTempDir(t, func() {
+		halted := opt
+		halted.HaltAfterCheckpoint(1)
+		if err := halted.Run(); err == nil {
+			t.Fatal("run was not halted")
+		}
+		checkpoint, err := ioutil.ReadFile("test.ga.checkpoint")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for want, edit := range map[string]func(r *allhic.Optimizer){
+			"from a run with seed 42, not 7": func(r *allhic.Optimizer) { r.Seed = 7 },
+			"has 20 tours, not npop 30":      func(r *allhic.Optimizer) { r.NPop = 30 },
+			"has 1 islands, not 3":           func(r *allhic.Optimizer) { r.Islands = 3 },
+		} {
+			resumed := opt
+			resumed.ResumeCheckpoint = true
+			edit(&resumed)
+			if err := resumed.Run(); err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v, want %q", err, want)
+			}
+		}
+
+		future := strings.Replace(string(checkpoint), `"version":1`, `"version":99`, 1)
+		if err := ioutil.WriteFile("test.ga.checkpoint", []byte(future), 0644); err != nil {
+			t.Fatal(err)
+		}
+		resumed := opt
+		resumed.ResumeCheckpoint = true
+		want := "has version 99, but this allhic reads version 1"
+		if err := resumed.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	})
+}
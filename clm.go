@@ -11,9 +11,13 @@ package allhic
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,9 +39,37 @@ type CLM struct {
 	Tigs             []*TigF
 	Tour             Tour
 	Signs            []byte
-	tigToIdx         map[string]int          // From name of the tig to the idx of the Tigs array
-	contacts         map[Pair]Contact        // (tigA, tigB) => {strandedness, nlinks, meanDist}
-	orientedContacts map[OrientedPair]GArray // (tigA, tigB, oriA, oriB) => golden array i.e. exponential histogram
+	tigToIdx         map[string]int         // From name of the tig to the idx of the Tigs array
+	contacts         map[Pair]Contact       // (tigA, tigB) => {strandedness, nlinks, meanDist, support}
+	orientedContacts map[OrientedPair]int32 // (tigA, tigB, oriA, oriB) => index into gdists
+	gdists           []GArray               // golden arrays i.e. exponential histograms, shared by both orientations
+	golden           *GoldenScale           // binning of the distances into gdists
+	opts             CLMOptions
+
+	// Cutoffs applied by Activate, tigs shorter than MinContigSize and with
+	// fewer links per bp than DensityLowerBound are inactivated. The zero
+	// values keep all tigs.
+	MinContigSize     int
+	DensityLowerBound float64
+	// OrientInit is how Activate initializes the orientations, either
+	// OrientInitSpectral, the default, or OrientInitGreedy
+	OrientInit string
+	// FixOrientation keeps the orientations of the tour the tigs are
+	// activated from, '+' otherwise, rather than initializing them
+	FixOrientation bool
+	// strands are the orientations imposed on the tigs, by index, 0 when
+	// free, see ReadStrands
+	strands []byte
+	// linkScale scales the links of each tig in M, by index, nil when they
+	// are not normalized, see Normalize
+	linkScale []float64
+
+	// TourInfo is added to the header of every tour written, e.g. the
+	// parameters of the run
+	TourInfo string
+	// Stdout echoes the initial and the final tours and the progress of
+	// the GA, nil is os.Stdout
+	Stdout io.Writer
 }
 
 // CLMLine stores the data structure of the CLM file
@@ -49,25 +81,73 @@ type CLMLine struct {
 	links []int
 }
 
-// Pair contains two contigs in contact
-type Pair struct {
-	ai int
-	bi int
+// Pair contains two contigs in contact, packed into a single word so that
+// the maps keyed by it take the fast path for 64-bit keys
+type Pair uint64
+
+// newPair packs the indices of two contigs into a Pair
+func newPair(ai, bi int) Pair {
+	return Pair(uint64(uint32(ai))<<32 | uint64(uint32(bi)))
+}
+
+// a returns the index of the first contig
+func (r Pair) a() int {
+	return int(r >> 32)
 }
 
-// OrientedPair contains two contigs and their orientations
-type OrientedPair struct {
-	ai int
-	bi int
-	ao byte
-	bo byte
+// b returns the index of the second contig
+func (r Pair) b() int {
+	return int(uint32(r))
 }
 
-// Contact stores how many links between two contigs
+// OrientedPair contains two contigs and their orientations, packed into a
+// single word as 31 bits per contig and two bits of orientations (see
+// packOrientations). Only the canonical key with a <= b is stored, the
+// reverse (tigB, tigA, -oriB, -oriA) maps onto it.
+type OrientedPair uint64
+
+// Contact stores how many links between two contigs. The strandedness is
+// that of the closest CLM row, while same and opposite sum the links over
+// all rows with the same and with opposite orientations.
 type Contact struct {
-	strandedness int
-	nlinks       int
+	strandedness int8
+	nlinks       int32
 	meanDist     float64
+	same         int32
+	opposite     int32
+}
+
+// newContact builds the contact of a single CLM row
+func newContact(strandedness int8, nlinks int32, meanDist float64) Contact {
+	c := Contact{strandedness: strandedness, nlinks: nlinks, meanDist: meanDist}
+	if strandedness < 0 {
+		c.opposite = nlinks
+	} else {
+		c.same = nlinks
+	}
+	return c
+}
+
+// consensus returns the strandedness supported by the majority of links, or
+// that of the closest row when the support is tied
+func (c Contact) consensus() int8 {
+	switch {
+	case c.same > c.opposite:
+		return 1
+	case c.opposite > c.same:
+		return -1
+	}
+	return c.strandedness
+}
+
+// OrientationSupport returns the number of links supporting the two contigs
+// being on the same strand and on opposite strands
+func (r *CLM) OrientationSupport(ai, bi int) (same, opposite int) {
+	c, ok := r.contacts[newPair(ai, bi)]
+	if !ok {
+		c = r.contacts[newPair(bi, ai)]
+	}
+	return int(c.same), int(c.opposite)
 }
 
 // TigF stores the index to activeTigs and size of the tig
@@ -76,18 +156,130 @@ type TigF struct {
 	Name     string
 	Size     int
 	IsActive bool
+	// Recovered is set by the 'recover' keyword in the ids file for the
+	// less confident contigs, which are pruned more aggressively
+	Recovered bool
+	// Pruned is why an inactive tig was dropped, e.g. PrunedDensity
+	Pruned string
+	// RECounts are the RE sites of the counts_RE file given as the ids
+	// file, 0 when it has no such column
+	RECounts int
 }
 
 // Tig removes some unnecessary entries in the TigF
 type Tig struct {
 	Idx  int
 	Size int
+	Sign byte // Orientation carried by the tour with JointScorer, 0 otherwise
 }
 
 // Tour stores a number of tigs along with 2D matrices for evaluation
 type Tour struct {
 	Tigs []Tig
-	M    [][]int
+	M    Matrix // Shared by the clones of the tour, never written after Activate
+	// Scorer, when set, replaces the default score of Evaluate
+	Scorer Scorer
+	// Cross, when set, recombines the tours in the GA, see Crossover
+	Cross CrossoverOperator
+	// Moves weighs the moves of Mutate, nil uses swap:0.2,splice:0.2,
+	// insert:0.3,reverse:0.3
+	Moves *MutWeights
+	// Pins, when set, constrain the positions of tigs, which Mutate and
+	// Crossover repair after each move
+	Pins *Constraints
+	// Graph, when set, adds the edges of the assembly graph to the score,
+	// see GraphPrior
+	Graph  *GraphPrior
+	delta  *deltaScore // Score kept up to date by Mutate in the GA
+	counts *moveCounts // Moves made in the GA, for its log
+}
+
+// Matrix is a square contact matrix stored row by row in one flat slice. W
+// optionally holds weighted links, which Evaluate then uses instead of Data.
+// A sparse matrix leaves Data nil and keeps only the nonzero cells of row i,
+// by column, in Cols and Vals (and W) from RowStart[i] to RowStart[i+1].
+type Matrix struct {
+	N    int
+	Data []int
+	W    []float64
+	// Sparse storage, see NewSparseMatrix
+	RowStart []int
+	Cols     []int32
+	Vals     []int
+}
+
+// NewMatrix allocates an N x N matrix of zeros
+func NewMatrix(N int) Matrix {
+	return Matrix{N: N, Data: make([]int, N*N)}
+}
+
+// NewSparseMatrix packs the nonzero cells of rows into a sparse Matrix
+func NewSparseMatrix(rows SparseMatrix) Matrix {
+	N := len(rows)
+	m := Matrix{N: N, RowStart: make([]int, N+1)}
+	for i, row := range rows {
+		m.RowStart[i+1] = m.RowStart[i] + len(row)
+	}
+	m.Cols = make([]int32, 0, m.RowStart[N])
+	m.Vals = make([]int, 0, m.RowStart[N])
+	cols := make([]int, 0)
+	for _, row := range rows {
+		cols = cols[:0]
+		for j := range row {
+			cols = append(cols, j)
+		}
+		sort.Ints(cols)
+		for _, j := range cols {
+			m.Cols = append(m.Cols, int32(j))
+			m.Vals = append(m.Vals, row[j])
+		}
+	}
+	return m
+}
+
+// Sparse tells if the matrix only stores its nonzero cells
+func (m Matrix) Sparse() bool {
+	return m.RowStart != nil
+}
+
+// index returns where the cell at row i, column j is in Data (or Vals) and
+// W, or -1 for a cell that a sparse matrix does not store
+func (m Matrix) index(i, j int) int {
+	if !m.Sparse() {
+		return i*m.N + j
+	}
+	start, end := m.RowStart[i], m.RowStart[i+1]
+	k := start + sort.Search(end-start, func(k int) bool { return int(m.Cols[start+k]) >= j })
+	if k < end && int(m.Cols[k]) == j {
+		return k
+	}
+	return -1
+}
+
+// At returns the cell at row i, column j
+func (m Matrix) At(i, j int) int {
+	if !m.Sparse() {
+		return m.Data[i*m.N+j]
+	}
+	if k := m.index(i, j); k >= 0 {
+		return m.Vals[k]
+	}
+	return 0
+}
+
+// Set assigns the cell at row i, column j of a dense matrix
+func (m Matrix) Set(i, j, v int) {
+	m.Data[i*m.N+j] = v
+}
+
+// Row returns row i of a dense matrix as a slice into the matrix
+func (m Matrix) Row(i int) []int {
+	return m.Data[i*m.N : (i+1)*m.N]
+}
+
+// WeightedRow returns row i of the weighted links of a dense matrix
+func (m Matrix) WeightedRow(i int) []float64 {
+	return m.W[i*m.N : (i+1)*m.N]
 }
 
 // RECountsRecord contains a line in the RE file
@@ -117,43 +309,193 @@ func (r *RECountsFile) ParseRecords() {
 	}
 }
 
-// NewCLM is the constructor for CLM
-func NewCLM(Clmfile, REfile string) *CLM {
+// CLMOptions controls how the clmfile is parsed
+type CLMOptions struct {
+	Strict bool // Fail on the first malformed row rather than skip it
+	// Cachefile, when set, is loaded instead of the files if it is newer
+	// than both, and is otherwise written after parsing
+	Cachefile string
+	// MinLinks drops the contig pairs with fewer links, summed over all
+	// orientations. The cache keeps all pairs.
+	MinLinks int
+	// Golden bins the distances into the golden arrays, nil is the
+	// DefaultGoldenScale
+	Golden *GoldenScale
+	// Aliases renames the contigs of the ids and clm files and the tours
+	// to their canonical names. The cache is not used with aliases.
+	Aliases AliasMap
+	// Threads parses large clmfiles in chunks, 0 uses all CPUs
+	Threads int
+}
+
+// NewCLM is the constructor for CLM, it fails when either file cannot be
+// read or the ids file has a malformed size
+func NewCLM(Clmfile, REfile string) (*CLM, error) {
+	return NewCLMWithOptions(Clmfile, REfile, CLMOptions{})
+}
+
+// NewCLMWithOptions is the constructor for CLM with the parsing options
+func NewCLMWithOptions(Clmfile, REfile string, opts CLMOptions) (*CLM, error) {
+	if Clmfile == StdinFile && opts.Cachefile != "" {
+		return nil, fmt.Errorf("cannot cache the clm read from stdin")
+	}
+	if opts.Cachefile != "" && opts.Aliases != nil {
+		log.Warningf("The clm cache is not used with contig aliases")
+		opts.Cachefile = ""
+	}
+	if opts.Cachefile != "" && cacheIsFresh(opts.Cachefile, Clmfile, REfile) {
+		p := newCLM()
+		p.REfile, p.Clmfile, p.opts = REfile, Clmfile, opts
+		p.setGolden()
+		err := p.LoadCache(opts.Cachefile)
+		if err == nil {
+			p.filterMinLinks()
+			return p, nil
+		}
+		log.Warningf("%s, parse the clmfile instead", err)
+	}
+
+	p := newCLM()
+	p.REfile, p.Clmfile, p.opts = REfile, Clmfile, opts
+	p.setGolden()
+	if err := p.readRE(); err != nil {
+		return nil, err
+	}
+	if err := p.readClm(); err != nil {
+		return nil, err
+	}
+	if opts.Cachefile != "" {
+		if err := p.SaveCache(opts.Cachefile); err != nil {
+			log.Warningf("Cannot write the cache: %s", err)
+		}
+	}
+	p.filterMinLinks()
+	return p, nil
+}
+
+// setGolden takes the binning of the distances from the options
+func (r *CLM) setGolden() {
+	if r.opts.Golden != nil {
+		r.golden = r.opts.Golden
+	}
+}
+
+// filterMinLinks drops the contacts, and all their orientations, of the
+// contig pairs with fewer than opts.MinLinks links
+func (r *CLM) filterMinLinks() {
+	if r.opts.MinLinks <= 1 {
+		return
+	}
+	filtered := 0
+	for pair, c := range r.contacts {
+		if int(c.same+c.opposite) >= r.opts.MinLinks {
+			continue
+		}
+		delete(r.contacts, pair)
+		ai, bi := pair.a(), pair.b()
+		for _, ao := range []byte{'+', '-'} {
+			for _, bo := range []byte{'+', '-'} {
+				delete(r.orientedContacts, newOrientedPair(ai, bi, ao, bo))
+			}
+		}
+		filtered++
+	}
+	log.Noticef("Filtered %d of %d contig pairs with fewer than %d links",
+		filtered, filtered+len(r.contacts), r.opts.MinLinks)
+}
+
+// openError describes a file that cannot be opened, e.g.
+// "cannot open ids file test.ids: no such file or directory"
+func openError(kind, filename string, err error) error {
+	if e := errors.Unwrap(err); e != nil {
+		err = e
+	}
+	return fmt.Errorf("cannot open %s file %s: %s", kind, filename, err)
+}
+
+// newCLM allocates an empty CLM
+func newCLM() *CLM {
 	p := new(CLM)
-	p.REfile = REfile
-	p.Clmfile = Clmfile
 	p.tigToIdx = make(map[string]int)
 	p.contacts = make(map[Pair]Contact)
-	p.orientedContacts = make(map[OrientedPair]GArray)
-
-	p.readRE()
-	p.readClm()
-
+	p.orientedContacts = make(map[OrientedPair]int32)
+	p.golden = DefaultGoldenScale
 	return p
 }
 
+// addTig appends a contig to the list of contigs to be ordered
+func (r *CLM) addTig(name string, size int) *TigF {
+	idx := len(r.Tigs)
+	tig := &TigF{Idx: idx, Name: name, Size: size, IsActive: true}
+	r.Tigs = append(r.Tigs, tig)
+	r.tigToIdx[name] = idx
+	return tig
+}
+
 // readRE parses the idsfile into data stored in CLM.
 // IDS file has a list of contigs that need to be ordered. 'recover',
 // keyword, if available in the third column, is less confident.
 // tig00015093     46912
 // tig00035238     46779   recover
 // tig00030900     119291
-func (r *CLM) readRE() {
-	file := mustOpen(r.REfile)
-	log.Noticef("Parse REfile `%s`", r.REfile)
-	scanner := bufio.NewScanner(file)
-	idx := 0
-	for scanner.Scan() {
+func (r *CLM) readRE() error {
+	names := newAliasedNames(r.opts.Aliases)
+	var collision error
+	err := readREFile(r.REfile, func(line, name string, size int, recovered bool) {
+		name, err := names.canonical(name)
+		if err != nil && collision == nil {
+			collision = fmt.Errorf("%s in %s", err, r.REfile)
+		}
+		tig := r.addTig(name, size)
+		tig.Recovered = recovered
+		// The counts_RE file of extract has the RE counts before the size
+		if words := strings.Fields(line); len(words) == 3 && words[2] != "recover" {
+			tig.RECounts, _ = strconv.Atoi(words[1])
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return collision
+}
+
+// readREFile calls add with each line of the idsfile, its contig, size and
+// whether it is marked 'recover'. Empty lines and comments are skipped.
+func readREFile(refile string, add func(line, name string, size int, recovered bool)) error {
+	file, err := openReader(refile)
+	if err != nil {
+		return openError("ids", refile, err)
+	}
+	defer file.Close()
+	log.Noticef("Parse REfile `%s`", refile)
+	scanner := newLineScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
 		words := strings.Fields(scanner.Text())
-		tig := words[0]
-		if tig[0] == '#' {
+		if len(words) == 0 || words[0][0] == '#' {
 			continue
 		}
-		size, _ := strconv.Atoi(words[len(words)-1])
-		r.Tigs = append(r.Tigs, &TigF{idx, tig, size, true})
-		r.tigToIdx[tig] = idx
-		idx++
+		// The size is the last column, as in the counts_RE file, or the
+		// one before the 'recover' keyword
+		last := len(words) - 1
+		recovered := words[last] == "recover"
+		if recovered {
+			last--
+		}
+		if last < 1 {
+			return fmt.Errorf("missing size at line %d of %s: %s",
+				lineno, refile, scanner.Text())
+		}
+		size, err := strconv.Atoi(words[last])
+		if err != nil {
+			return fmt.Errorf("malformed size `%s` at line %d of %s",
+				words[last], lineno, refile)
+		}
+		add(scanner.Text(), words[0], size, recovered)
 	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read ids file %s: %s", refile, err)
+	}
+	return nil
 }
 
 // rr map orientations to bit ('+' => '-', '-' => '+')
@@ -164,48 +506,198 @@ func rr(b byte) byte {
 	return '-'
 }
 
-// readClmLines parses the clmfile into a slice of CLMLine
-func readClmLines(clmfile string) []CLMLine {
+// packOrientations stores a pair of orientations in a single byte, bit 1 is set
+// when ao is '-' and bit 0 is set when bo is '-'
+func packOrientations(ao, bo byte) byte {
+	var ori byte
+	if ao == '-' {
+		ori |= 2
+	}
+	if bo == '-' {
+		ori |= 1
+	}
+	return ori
+}
+
+// newOrientedPair builds the canonical key into orientedContacts, swapping
+// the contigs and flipping their orientations when ai > bi
+func newOrientedPair(ai, bi int, ao, bo byte) OrientedPair {
+	if ai > bi {
+		ai, bi, ao, bo = bi, ai, rr(bo), rr(ao)
+	}
+	return OrientedPair(uint64(ai)<<33 | uint64(bi)<<2 | uint64(packOrientations(ao, bo)))
+}
+
+// a returns the index of the first contig
+func (r OrientedPair) a() int {
+	return int(r >> 33)
+}
+
+// b returns the index of the second contig
+func (r OrientedPair) b() int {
+	return int(r>>2) & (1<<31 - 1)
+}
+
+// orientations unpacks the orientations of the two contigs
+func (r OrientedPair) orientations() (ao, bo byte) {
+	ao, bo = '+', '+'
+	if r&2 != 0 {
+		ao = '-'
+	}
+	if r&1 != 0 {
+		bo = '-'
+	}
+	return
+}
+
+// readClmLines parses the clmfile into a slice of CLMLine. Malformed rows
+// are skipped with a warning, or fail the parse when strict. Large plain
+// clmfiles are parsed in chunks by threads workers, 0 uses all CPUs.
+func readClmLines(clmfile string, strict bool, threads int) ([]CLMLine, error) {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	if size := plainFileSize(clmfile); threads > 1 && size >= ParallelClmMinSize {
+		return readClmChunks(clmfile, size, strict, threads)
+	}
 	log.Noticef("Parse clmfile `%s`", clmfile)
-	file := mustOpen(clmfile)
+	file, err := openReader(clmfile)
+	if err != nil {
+		return nil, openError("clm", clmfile, err)
+	}
+	defer file.Close()
 	reader := bufio.NewReader(file)
+	progress := NewProgress("Parse clmfile", clmfile, func() int64 { return fileOffset(file) })
+	chunk := parseClmRows(reader, -1, strict, func(c *clmChunk) {
+		if progress.Tick() {
+			progress.Report(fmt.Sprintf("%d lines, %d contig pairs", c.rows+1, len(c.lines)))
+		}
+	})
+	return joinClmChunks(clmfile, []clmChunk{chunk})
+}
 
-	var lines []CLMLine
+// scanClmRows calls f with each row of the clm, ending with a newline, and
+// the names of its two contigs. Rows without two contigs are skipped.
+func scanClmRows(clm io.Reader, f func(row, at, bt string)) error {
+	reader := bufio.NewReader(clm)
 	for {
 		row, err := reader.ReadString('\n')
-		row = strings.TrimSpace(row)
-		if row == "" && err == io.EOF {
-			break
+		if err != nil && err != io.EOF {
+			return err
 		}
-		words := strings.Split(row, "\t")
-		abtig := strings.Split(words[0], " ")
-		atig, btig := abtig[0], abtig[1]
-		at, ao := atig[:len(atig)-1], atig[len(atig)-1]
-		bt, bo := btig[:len(btig)-1], btig[len(btig)-1]
-
-		nlinks, _ := strconv.Atoi(words[1])
-		// Convert all distances to int
-		var dists []int
-		for _, dist := range strings.Split(words[2], " ") {
-			d, _ := strconv.Atoi(dist)
-			dists = append(dists, d)
+		if tigs := strings.Fields(strings.SplitN(row, "\t", 2)[0]); len(tigs) == 2 {
+			f(strings.TrimRight(row, "\n")+"\n", tigs[0][:len(tigs[0])-1], tigs[1][:len(tigs[1])-1])
 		}
-		if nlinks != len(dists) {
-			log.Errorf("Malformed line: %v", row)
+		if err == io.EOF {
+			return nil
 		}
-		lines = append(lines, CLMLine{at, bt, ao, bo, dists})
+	}
+}
 
-		if err != nil {
-			break
+// parseClmRow parses one row of the clmfile, which has three tab-separated
+// fields: the oriented contig pair, the link count and the distances
+func parseClmRow(row string) (CLMLine, error) {
+	var line CLMLine
+	words := strings.Split(row, "\t")
+	if len(words) != 3 {
+		return line, fmt.Errorf("expected 3 tab-separated fields, got %d", len(words))
+	}
+	abtig := strings.Fields(words[0])
+	if len(abtig) != 2 {
+		return line, fmt.Errorf("expected 2 contigs, got %d", len(abtig))
+	}
+	for _, tig := range abtig {
+		if o := tig[len(tig)-1]; len(tig) < 2 || (o != '+' && o != '-') {
+			return line, fmt.Errorf("contig `%s` does not end with + or -", tig)
+		}
+	}
+	atig, btig := abtig[0], abtig[1]
+	line.at, line.ao = atig[:len(atig)-1], atig[len(atig)-1]
+	line.bt, line.bo = btig[:len(btig)-1], btig[len(btig)-1]
+
+	nlinks, err := strconv.Atoi(strings.TrimSpace(words[1]))
+	if err != nil {
+		return line, fmt.Errorf("malformed link count `%s`", words[1])
+	}
+	// Convert all distances to int
+	dists := strings.Fields(words[2])
+	if nlinks != len(dists) {
+		return line, fmt.Errorf("%d links but %d distances", nlinks, len(dists))
+	}
+	line.links = make([]int, len(dists))
+	for i, dist := range dists {
+		if line.links[i], err = strconv.Atoi(dist); err != nil {
+			return line, fmt.Errorf("malformed distance `%s`", dist)
 		}
 	}
-	_ = file.Close()
-	return lines
+	return line, nil
 }
 
 // readClm parses the clmfile into data stored in CLM.
-func (r *CLM) readClm() {
-	lines := readClmLines(r.Clmfile)
+func (r *CLM) readClm() error {
+	lines, err := readClmLines(r.Clmfile, r.opts.Strict, r.opts.Threads)
+	if err != nil {
+		return err
+	}
+	if r.opts.Aliases != nil {
+		for i := range lines {
+			lines[i].at = r.opts.Aliases.Name(lines[i].at)
+			lines[i].bt = r.opts.Aliases.Name(lines[i].bt)
+		}
+	}
+	r.addClmLines(lines)
+	return nil
+}
+
+// addClmLines stores the contacts of the CLM lines between known contigs.
+// Rows for the same oriented pair, e.g. from clm files concatenated across
+// lanes, are merged into one with all their links.
+func (r *CLM) addClmLines(lines []CLMLine) {
+	merged, duplicates := r.mergeClmLines(lines)
+	if duplicates > 0 {
+		log.Noticef("Merged %d duplicate rows of oriented contig pairs", duplicates)
+	}
+
+	saturated := 0
+	for _, line := range merged {
+		ai, bi := line.ai, line.bi
+		ao, bo := line.ao, line.bo
+
+		// Store all these info in contacts
+		gdists, ok := r.golden.goldenArray(line.links)
+		if !ok {
+			saturated++
+		}
+		meanDist := SumLog(line.links)
+		strandedness := int8(1)
+		if line.ao != line.bo {
+			strandedness = -1
+		}
+		pair := newPair(ai, bi)
+		c := newContact(strandedness, int32(len(line.links)), meanDist)
+		if p, ok := r.contacts[pair]; ok {
+			c = keepClosestContact(p, c)
+		}
+		r.contacts[pair] = c
+		r.setOrientedContact(ai, bi, ao, bo, gdists)
+	}
+	if saturated > 0 {
+		log.Warningf("%d oriented contig pairs have more than %d links in a single bin (saturated)",
+			saturated, math.MaxUint16)
+	}
+}
+
+// indexedClmLine is a CLMLine with the contigs resolved to their indices
+type indexedClmLine struct {
+	CLMLine
+	ai, bi int
+}
+
+// mergeClmLines resolves the contigs of the lines, drops the lines with
+// contigs not in the ids file, and concatenates the links of the lines for
+// the same oriented pair, in either direction, in the order of first sight
+func (r *CLM) mergeClmLines(lines []CLMLine) (merged []indexedClmLine, duplicates int) {
+	seen := make(map[OrientedPair]int)
 	for _, line := range lines {
 		// Make sure both contigs are in the ids file
 		ai, aok := r.tigToIdx[line.at]
@@ -216,53 +708,44 @@ func (r *CLM) readClm() {
 		if !bok {
 			continue
 		}
-		ao, bo := line.ao, line.bo
-
-		// Store all these info in contacts
-		gdists := GoldenArray(line.links)
-		meanDist := SumLog(line.links)
-		strandedness := 1
-		if line.ao != line.bo {
-			strandedness = -1
-		}
-		pair := Pair{ai, bi}
-		c := Contact{strandedness, len(line.links), meanDist}
-		if p, ok := r.contacts[pair]; ok {
-			if meanDist < p.meanDist {
-				r.contacts[pair] = c
-			}
-		} else {
-			r.contacts[pair] = c
+		key := newOrientedPair(ai, bi, line.ao, line.bo)
+		if i, ok := seen[key]; ok {
+			m := &merged[i]
+			// Copy on the first merge so that the parsed line is left as is
+			m.links = append(m.links[:len(m.links):len(m.links)], line.links...)
+			duplicates++
+			continue
 		}
-		r.orientedContacts[OrientedPair{ai, bi, ao, bo}] = gdists
-		r.orientedContacts[OrientedPair{bi, ai, rr(bo), rr(ao)}] = gdists
+		seen[key] = len(merged)
+		merged = append(merged, indexedClmLine{line, ai, bi})
 	}
+	return
+}
+
+// setOrientedContact stores the golden array under the canonical key of the
+// orientation, which also serves its reverse (tigB, tigA, -oriB, -oriA)
+func (r *CLM) setOrientedContact(ai, bi int, ao, bo byte, gdists GArray) {
+	key := newOrientedPair(ai, bi, ao, bo)
+	if gi, ok := r.orientedContacts[key]; ok {
+		r.gdists[gi] = gdists
+		return
+	}
+	r.orientedContacts[key] = int32(len(r.gdists))
+	r.gdists = append(r.gdists, gdists)
 }
 
 // calculateDensities calculated the density of inter-contig links per base.
 // Strong contigs are considered to have high level of inter-contig links in the current
 // partition.
 func (r *CLM) calculateDensities() ([]float64, []int) {
-	N := len(r.Tigs)
-	densities := make([]int, N)
-	for pair, contact := range r.contacts {
-		ai := pair.ai
-		bi := pair.bi
-		if r.Tigs[ai].IsActive && r.Tigs[bi].IsActive {
-			densities[ai] += contact.nlinks
-			densities[bi] += contact.nlinks
-		}
-	}
-
+	links, _ := r.activeLinks()
 	activeCounts, _ := r.reportActive(false)
 	logdensities := make([]float64, activeCounts)
 	active := make([]int, activeCounts)
 	idx := 0
 	for i, tig := range r.Tigs {
 		if tig.IsActive {
-			d := float64(densities[i])
-			s := float64(min(tig.Size, 500000))
-			logdensities[idx] = math.Log10(d / s)
+			logdensities[idx] = math.Log10(linkDensity(links[i], tig.Size))
 			active[idx] = tig.Idx
 			idx++
 		}
@@ -270,17 +753,56 @@ func (r *CLM) calculateDensities() ([]float64, []int) {
 	return logdensities, active
 }
 
-// pruneByDensity selects active contigs based on logdensities
+// activeLinks counts the inter-contig links and the partner contigs of each
+// contig, over the pairs where both contigs are active
+func (r *CLM) activeLinks() (links, partners []int) {
+	N := len(r.Tigs)
+	links = make([]int, N)
+	partners = make([]int, N)
+	for pair, contact := range r.contacts {
+		ai := pair.a()
+		bi := pair.b()
+		if r.Tigs[ai].IsActive && r.Tigs[bi].IsActive {
+			links[ai] += int(contact.nlinks)
+			links[bi] += int(contact.nlinks)
+			partners[ai]++
+			partners[bi]++
+		}
+	}
+	return
+}
+
+// linkDensity is the number of links per bp, with the size capped at 500 kb
+func linkDensity(links, size int) float64 {
+	return float64(links) / float64(min(size, 500000))
+}
+
+// pruneByDensity selects active contigs based on logdensities. The lower
+// bound is DensityLowerBound when set, and the OutlierCutoff otherwise.
 func (r *CLM) pruneByDensity() {
 	for {
 		logdensities, active := r.calculateDensities()
-		lb, ub := OutlierCutoff(logdensities)
-		log.Noticef("Log10(link_densities) ~ [%.5f, %.5f]", lb, ub)
+		var lb float64
+		if r.DensityLowerBound > 0 {
+			lb = math.Log10(r.DensityLowerBound)
+			log.Noticef("Log10(link_densities) >= %.5f (DensityLowerBound = %g)",
+				lb, r.DensityLowerBound)
+		} else {
+			if len(active) < MinOutlierTigs {
+				log.Noticef("Skip pruning by density with only %d active tigs (< %d)",
+					len(active), MinOutlierTigs)
+				break
+			}
+			var ub float64
+			lb, ub = OutlierCutoff(logdensities)
+			log.Noticef("Log10(link_densities) ~ [%.5f, %.5f]", lb, ub)
+		}
 		invalid := 0
 		for i, idx := range active {
 			tig := r.Tigs[idx]
-			if logdensities[i] < lb && tig.Size < MINSIZE*10 {
+			if logdensities[i] < r.pruneCutoff(idx, lb) && tig.Size < MINSIZE*10 {
 				r.Tigs[idx].IsActive = false
+				r.Tigs[idx].Pruned = PrunedDensity
 				invalid++
 			}
 		}
@@ -293,70 +815,106 @@ func (r *CLM) pruneByDensity() {
 	}
 }
 
-// pruneBySize selects active contigs based on size
+// pruneActive applies the cutoffs on size and density that are set
+func (r *CLM) pruneActive() {
+	if r.MinContigSize > 0 {
+		r.pruneBySize()
+	}
+	if r.DensityLowerBound > 0 {
+		r.pruneByDensity()
+	}
+}
+
+// pruneCutoff is the log10 cutoff lb of pruning, raised by RecoveredPenalty
+// for the recovered contigs
+func (r *CLM) pruneCutoff(idx int, lb float64) float64 {
+	if r.Tigs[idx].Recovered {
+		return lb + RecoveredPenalty
+	}
+	return lb
+}
+
+// pruneBySize selects active contigs of at least MinContigSize
 func (r *CLM) pruneBySize() {
 	invalid := 0
 	for i, tig := range r.Tigs {
-		if tig.Size < MINSIZE {
+		if tig.IsActive && tig.Size < r.MinContigSize {
 			r.Tigs[i].IsActive = false
+			r.Tigs[i].Pruned = PrunedSize
 			invalid++
 		}
 	}
 	if invalid > 0 {
 		log.Noticef("Inactivated %d tigs with size < %d",
-			invalid, MINSIZE)
+			invalid, r.MinContigSize)
 	}
 }
 
-// pruneTour test deleting each contig and check the delta_score
-func (r *CLM) pruneTour() {
+// PruneTour test deleting each contig and check the delta_score. When
+// debugfile is given, the delta scores of every round are written there.
+// The deletions are scored by a pool of threads workers.
+func (r *CLM) PruneTour(debugfile string, threads int) {
 	var (
-		wg            sync.WaitGroup
-		tour, newTour Tour
+		tour   Tour
+		wdebug *bufio.Writer
 	)
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+	if debugfile != "" {
+		f := mustCreateAtomic(debugfile)
+		wdebug = bufio.NewWriter(f)
+		defer func() {
+			ErrorAbort(wdebug.Flush())
+			ErrorAbort(f.Close())
+		}()
+		_, _ = fmt.Fprintf(wdebug, "#Round\tContig\tIndex\tDeltaScore\tLog10Delta\tInactivated\n")
+		log.Noticef("Pruning delta scores written to `%s`", debugfile)
+	}
 
-	for {
+	for round := 1; ; round++ {
 		tour = r.Tour
+		if tour.Len() < MinOutlierTigs {
+			log.Noticef("Skip pruning the tour with only %d tigs (< %d)",
+				tour.Len(), MinOutlierTigs)
+			break
+		}
 		tourScore, _ := tour.Evaluate()
 		tourScore = -tourScore
 		log.Noticef("Starting score: %.5f", tourScore)
+		deltas := make([]float64, tour.Len())
 		log10ds := make([]float64, tour.Len()) // Each entry is the log10 of diff
-
-		for i := 0; i < tour.Len(); i++ {
-			newTour = tour.Clone().(Tour)
-			copy(newTour.Tigs[i:], newTour.Tigs[i+1:]) // Delete element at i
-			newTour.Tigs = newTour.Tigs[:newTour.Len()-1]
-
-			wg.Add(1)
-			go func(idx int, newTour Tour) {
-				defer wg.Done()
-				newTourScore, _ := newTour.Evaluate()
-				newTourScore = -newTourScore
-				deltaScore := tourScore - newTourScore
-				// log.Noticef("In goroutine %v, newTour = %v, newTourScore = %v, deltaScore = %v",
-				// 	idx, newTour.Tigs, newTourScore, deltaScore)
-				if deltaScore > 1e-9 {
-					log10ds[idx] = math.Log10(deltaScore)
-				} else {
-					log10ds[idx] = -9.0
-				}
-			}(i, newTour)
-		}
-		// Wait for all workers to finish
-		wg.Wait()
-		//fmt.Println(log10ds)
+		tour.scoreDeletions(tourScore, deltas, log10ds, threads)
 
 		// Identify outliers
 		lb, ub := OutlierCutoff(log10ds)
 		log.Noticef("Log10(delta_score) ~ [%.5f, %.5f]", lb, ub)
 
+		inactivated := make([]bool, tour.Len())
 		invalid := 0
 		for i, tig := range tour.Tigs {
-			if log10ds[i] < lb {
-				r.Tigs[tig.Idx].IsActive = false
+			if log10ds[i] < r.pruneCutoff(tig.Idx, lb) {
+				inactivated[i] = true
 				invalid++
 			}
 		}
+		// Keep the tour whole rather than leave fewer than 2 tigs
+		if tour.Len()-invalid < 2 {
+			log.Warningf("Skip inactivating %d of %d tigs, which would leave fewer than 2",
+				invalid, tour.Len())
+			invalid = 0
+			inactivated = make([]bool, tour.Len())
+		}
+		for i, tig := range tour.Tigs {
+			if inactivated[i] {
+				r.Tigs[tig.Idx].IsActive = false
+				r.Tigs[tig.Idx].Pruned = PrunedTour
+			}
+			if wdebug != nil {
+				_, _ = fmt.Fprintf(wdebug, "%d\t%s\t%d\t%g\t%.5f\t%t\n",
+					round, r.Tigs[tig.Idx].Name, tig.Idx, deltas[i], log10ds[i], inactivated[i])
+			}
+		}
 
 		if invalid == 0 {
 			break
@@ -366,6 +924,7 @@ func (r *CLM) pruneTour() {
 		}
 
 		activeCounts, _ := r.reportActive(true)
+		newTour := tour
 		newTour.Tigs = make([]Tig, activeCounts)
 		idx := 0
 		for _, tig := range tour.Tigs {
@@ -378,47 +937,160 @@ func (r *CLM) pruneTour() {
 	}
 }
 
+// scoreDeletions scores the tour with each tig deleted in turn. The indices
+// are pulled from a channel by threads workers, each with its own scratch
+// tour, and every worker only writes its own entries of deltas and log10ds.
+func (r Tour) scoreDeletions(tourScore float64, deltas, log10ds []float64, threads int) {
+	if r.Len() == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	indices := make(chan int, threads)
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scratch := Tour{Tigs: make([]Tig, r.Len()-1), M: r.M, Scorer: r.Scorer}
+			for idx := range indices {
+				copy(scratch.Tigs[:idx], r.Tigs[:idx]) // Delete element at idx
+				copy(scratch.Tigs[idx:], r.Tigs[idx+1:])
+				newTourScore, _ := scratch.Evaluate()
+				newTourScore = -newTourScore
+				deltaScore := tourScore - newTourScore
+				deltas[idx] = deltaScore
+				if deltaScore > 1e-9 {
+					log10ds[idx] = math.Log10(deltaScore)
+				} else {
+					log10ds[idx] = -9.0
+				}
+			}
+		}()
+	}
+	for i := 0; i < r.Len(); i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
 // Activate selects active contigs in the current partition. This is the setup phase of the
 // algorithm, and supports two modes:
-// - "de novo": This is useful at the start of a new run where no tours are
-//    available. We select the strong contigs that have significant number
-//    of links to other contigs in the partition. We build a histogram of
-//    link density (# links per bp) and remove the contigs that appear to be
-//    outliers. The orientations are derived from the matrix decomposition
-//    of the pairwise strandedness matrix O.
-// - "hotstart": This is useful when there was a past run, with a given
-//    tourfile. In this case, the active contig list and orientations are
-//    derived from the last tour in the file.
+//   - "de novo": This is useful at the start of a new run where no tours are
+//     available. We select the strong contigs that have significant number
+//     of links to other contigs in the partition. We build a histogram of
+//     link density (# links per bp) and remove the contigs that appear to be
+//     outliers. The orientations are derived from the matrix decomposition
+//     of the pairwise strandedness matrix O.
+//   - "hotstart": This is useful when there was a past run, with a given
+//     tourfile. In this case, the active contig list and orientations are
+//     derived from the last tour in the file, see ActivateFromTour. With
+//     resume, the tour is expected to be parsed already.
 func (r *CLM) Activate(resume bool, rng *rand.Rand) {
 	// hotstart
 	if resume {
 		r.Tour.M = r.M()
-	// de novo
+		// de novo
 	} else {
-		N := len(r.Tigs)
-		// r.reportActive(true)
-		// r.pruneByDensity()
-        activeCounts, _ := r.reportActive(true)
-		r.Tour.Tigs = make([]Tig, activeCounts)
-		idx := 0
-		for _, tig := range r.Tigs {
-			if tig.IsActive {
-				r.Tour.Tigs[idx] = Tig{tig.Idx, tig.Size}
-				idx++
-			}
+		r.activateAll()
+		r.Tour.Shuffle(rng)
+		r.initSigns()
+	}
+}
+
+// activateAll prunes the tigs and makes the tour of the active ones, in the
+// order of the ids file
+func (r *CLM) activateAll() {
+	r.pruneActive()
+	activeCounts, _ := r.reportActive(true)
+	r.Tour.Tigs = make([]Tig, activeCounts)
+	idx := 0
+	for _, tig := range r.Tigs {
+		if tig.IsActive {
+			r.Tour.Tigs[idx] = Tig{Idx: tig.Idx, Size: tig.Size}
+			idx++
 		}
+	}
+	r.Tour.M = r.M()
+}
 
-		r.Tour.M = r.M()
+// initSigns initializes the signs of the tigs from their links, unless
+// the orientations are fixed
+func (r *CLM) initSigns() {
+	r.Signs = make([]byte, len(r.Tigs))
+	for i := range r.Signs {
+		r.Signs[i] = '+'
+	}
+	if !r.FixOrientation {
+		r.flipAll()
+	}
+}
 
-		r.Tour.Shuffle(rng)
-		r.Signs = make([]byte, N)
-		for i := 0; i < N; i++ {
-			r.Signs[i] = '+'
+// ActivateWithTour is Activate, but the active tigs are ordered as in the
+// last tour of tourfile, with the signs of their +/- suffixes, rather than
+// shuffled. The tigs of the tour that are not active are dropped, and the
+// active tigs missing from it are appended in the order of the ids file.
+func (r *CLM) ActivateWithTour(tourfile string) error {
+	words, err := readTourWords(tourfile)
+	if err != nil {
+		return err
+	}
+	r.activateAll()
+	r.initSigns() // For the tigs missing from the tour
+	pos := make(map[int]int, len(r.Tour.Tigs))
+	for i, tig := range r.Tour.Tigs {
+		pos[tig.Idx] = i
+	}
+	tigs := make([]Tig, 0, len(r.Tour.Tigs))
+	seen := make(map[int]bool)
+	for _, word := range words {
+		tigName, tigOrientation := r.opts.Aliases.Name(word[:len(word)-1]), word[len(word)-1]
+		idx, ok := r.tigToIdx[tigName]
+		if !ok {
+			log.Warningf("Contig %s not found in `%s`, skipped", tigName, r.REfile)
+			continue
+		}
+		i, ok := pos[idx]
+		switch {
+		case seen[idx]:
+			log.Warningf("Contig %s appears more than once in the start tour, skipped", tigName)
+			continue
+		case !ok:
+			log.Warningf("Contig %s of the start tour is pruned (%s), dropped", tigName, r.Tigs[idx].Pruned)
+			continue
 		}
-		r.flipAll() // Initialize with the signs of the tigs
+		seen[idx] = true
+		tigs = append(tigs, r.Tour.Tigs[i])
+		r.Signs[idx] = tigOrientation
 	}
+	r.reportImposed()
+	missing := 0
+	for _, tig := range r.Tour.Tigs {
+		if !seen[tig.Idx] {
+			tigs = append(tigs, tig)
+			missing++
+		}
+	}
+	if missing > 0 {
+		log.Warningf("%d active contigs missing from the start tour `%s`, appended at the end",
+			missing, tourfile)
+	}
+	r.Tour.Tigs = tigs
+	return nil
 }
 
+// ActivateFromTour is the "hotstart" mode of Activate. Only the contigs in
+// the last tour of tourfile are active, in that order and with the signs of
+// their +/- suffixes. Contigs missing from the ids file are skipped.
+func (r *CLM) ActivateFromTour(tourfile string) error {
+	words, err := readTourWords(tourfile)
+	if err != nil {
+		return err
+	}
+	r.setTour(words)
+	r.reportActive(true)
+	r.Activate(true, nil)
+	return nil
+}
 
 // reportActive prints number and total length of active contigs
 func (r *CLM) reportActive(verbose bool) (activeCounts, sumLength int) {
@@ -430,21 +1102,101 @@ func (r *CLM) reportActive(verbose bool) (activeCounts, sumLength int) {
 	}
 
 	if verbose {
-		log.Noticef("Active tigs: %d (length=%d)", activeCounts, sumLength)
+		log.Noticef("Active tigs: %d (length=%d, minSize=%d, minDensity=%g)",
+			activeCounts, sumLength, r.MinContigSize, r.DensityLowerBound)
 	}
 	return
 }
 
+// reportRecovered prints how many of the recovered contigs are in the tour
+func (r *CLM) reportRecovered() (inTour, total int) {
+	for _, tig := range r.Tigs {
+		if tig.Recovered {
+			total++
+		}
+	}
+	for _, tig := range r.Tour.Tigs {
+		if r.Tigs[tig.Idx].Recovered {
+			inTour++
+		}
+	}
+	if total > 0 {
+		log.Noticef("Recovered tigs in the tour: %d of %d", inTour, total)
+	}
+	return
+}
+
+// EndWeightedM yields M along with the links weighted by how far they
+// are from the joining ends. Each pair is weighted by the largest fraction,
+// over its orientations, of links shorter than maxDist. The fraction is read
+// off the golden arrays, counting the whole bin that holds maxDist.
+func (r *CLM) EndWeightedM(maxDist int) Matrix {
+	maxBin := r.golden.bin(maxDist)
+	weights := make(map[Pair]float64)
+	for key, gi := range r.orientedContacts {
+		total, near := 0, 0
+		for k, c := range r.gdists[gi] {
+			total += int(c)
+			if k <= maxBin {
+				near += int(c)
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		pair := newPair(key.a(), key.b())
+		if w := float64(near) / float64(total); w > weights[pair] {
+			weights[pair] = w
+		}
+	}
+
+	P := r.M()
+	if P.Sparse() {
+		P.W = make([]float64, len(P.Vals))
+	} else {
+		P.W = make([]float64, len(P.Data))
+	}
+	for pair, contact := range r.contacts {
+		ai, bi := pair.a(), pair.b()
+		key := newPair(min(ai, bi), max(ai, bi))
+		w := float64(contact.nlinks) * r.scale(ai, bi) * weights[key]
+		P.W[P.index(ai, bi)] = w
+		P.W[P.index(bi, ai)] = w
+	}
+	return P
+}
+
+// sparse tells whether the contact matrix is over DenseMaxCells and has
+// fewer than SparseMaxDensity of its cells nonzero
+func (r *CLM) sparse() bool {
+	cells := float64(len(r.Tigs)) * float64(len(r.Tigs))
+	return cells > DenseMaxCells && float64(2*len(r.contacts)) < SparseMaxDensity*cells
+}
+
 // M yields a contact frequency matrix, where each cell contains how many
-// links between i-th and j-th contig
-func (r *CLM) M() [][]int {
+// links between i-th and j-th contig. The matrix is sparse when it is over
+// DenseMaxCells and has fewer than SparseMaxDensity of its cells nonzero.
+func (r *CLM) M() Matrix {
 	N := len(r.Tigs)
-	P := Make2DSlice(N, N)
+	if r.sparse() {
+		rows := make(SparseMatrix, N)
+		for i := range rows {
+			rows[i] = make(map[int]int)
+		}
+		for pair, contact := range r.contacts {
+			ai, bi := pair.a(), pair.b()
+			rows[ai][bi] = r.links(ai, bi, contact.nlinks)
+			rows[bi][ai] = rows[ai][bi]
+		}
+		return NewSparseMatrix(rows)
+	}
+
+	P := NewMatrix(N)
 	for pair, contact := range r.contacts {
-		ai := pair.ai
-		bi := pair.bi
-		P[ai][bi] = contact.nlinks
-		P[bi][ai] = contact.nlinks
+		ai := pair.a()
+		bi := pair.b()
+		P.Set(ai, bi, r.links(ai, bi, contact.nlinks))
+		P.Set(bi, ai, r.links(ai, bi, contact.nlinks))
 	}
 	return P
 }
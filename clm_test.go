@@ -9,12 +9,31 @@
 package allhic_test
 
 import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
 	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/tanghaibao/allhic"
 )
 
+// mustNewCLM parses the clm and ids files, failing the test on errors
+func mustNewCLM(t testing.TB, clmfile, idsfile string) *allhic.CLM {
+	clm, err := allhic.NewCLM(clmfile, idsfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clm
+}
+
 func TestParseRECountsFile(t *testing.T) {
 	reCountsFile := allhic.RECountsFile{
 		Filename: path.Join("tests", "test.counts_RE.txt"),
@@ -25,3 +44,700 @@ func TestParseRECountsFile(t *testing.T) {
 		t.Fatalf("Expected %d records, got %d records", expectedNumRecords, len(reCountsFile.Records))
 	}
 }
+
+// TestOrientationSupport parses a pair seen in all four orientations with
+// conflicting counts, and a pair where the support is tied
+func TestOrientationSupport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "support.ids")
+	clmfile := path.Join(dir, "support.clm")
+	ids := "t0\t5000\nt1\t5000\nt2\t5000\nt3\t5000\n"
+	clm := "t0+ t1+\t5\t1000 2000 3000 4000 5000\n" +
+		"t0- t1-\t4\t1000 2000 3000 4000\n" +
+		"t0+ t1-\t1\t100\n" + // closest, but outvoted
+		"t0- t1+\t2\t1000 2000\n" +
+		"t2+ t3+\t2\t1000 2000\n" +
+		"t2+ t3-\t2\t100 200\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	for _, p := range [][2]int{{0, 1}, {1, 0}} {
+		if same, opposite := r.OrientationSupport(p[0], p[1]); same != 9 || opposite != 3 {
+			t.Errorf("OrientationSupport(%d, %d) = (%d, %d), want (9, 3)", p[0], p[1], same, opposite)
+		}
+	}
+	if s := r.Consensus(0, 1); s != 1 {
+		t.Errorf("expected the majority to be on the same strand, got %d", s)
+	}
+	if same, opposite := r.OrientationSupport(2, 3); same != 2 || opposite != 2 {
+		t.Errorf("OrientationSupport(2, 3) = (%d, %d), want (2, 2)", same, opposite)
+	}
+	if s := r.Consensus(2, 3); s != -1 {
+		t.Errorf("expected a tie to follow the closest row, got %d", s)
+	}
+}
+
+// TestEndWeightedM weights a pair with half of its links near the ends, and
+// a pair with none of them
+func TestEndWeightedM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "weights.ids")
+	clmfile := path.Join(dir, "weights.clm")
+	ids := "t0\t5000000\nt1\t5000000\nt2\t5000000\nt3\t5000000\n"
+	clm := "t0+ t1+\t4\t10000 20000 3000000 4000000\n" +
+		"t0- t1-\t4\t3000000 3000000 4000000 4000000\n" +
+		"t2+ t3+\t2\t5000000 5000000\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	M := r.EndWeightedM(30000)
+	for _, c := range []struct {
+		a, b int
+		want float64
+	}{{0, 1, 2}, {1, 0, 2}, {2, 3, 0}, {3, 2, 0}, {0, 2, 0}} {
+		if got := M.WeightedRow(c.a)[c.b]; got != c.want {
+			t.Errorf("weighted links of (%d, %d) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+	all := r.EndWeightedM(math.MaxInt32)
+	for i, n := range all.Data {
+		if all.W[i] != float64(n) {
+			t.Fatalf("cell %d: weighted %v, want all %d links", i, all.W[i], n)
+		}
+	}
+}
+
+// writeSyntheticCLM writes an ids file with nTigs contigs and a clm file where
+// each contig is linked to its next nPartners contigs in all four orientations
+func writeSyntheticCLM(dir string, nTigs, nPartners, nLinks int) (idsfile, clmfile string) {
+	idsfile = path.Join(dir, "synthetic.ids")
+	clmfile = path.Join(dir, "synthetic.clm")
+	fids, _ := os.Create(idsfile)
+	wids := bufio.NewWriter(fids)
+	for i := 0; i < nTigs; i++ {
+		_, _ = fmt.Fprintf(wids, "tig%07d\t%d\n", i, 50000+i%1000)
+	}
+	_ = wids.Flush()
+	_ = fids.Close()
+
+	fclm, _ := os.Create(clmfile)
+	wclm := bufio.NewWriter(fclm)
+	tags := []string{"++", "+-", "-+", "--"}
+	for i := 0; i < nTigs; i++ {
+		for k := 1; k <= nPartners && i+k < nTigs; k++ {
+			for o, tag := range tags {
+				_, _ = fmt.Fprintf(wclm, "tig%07d%c tig%07d%c\t%d\t", i, tag[0], i+k, tag[1], nLinks)
+				for l := 0; l < nLinks; l++ {
+					if l > 0 {
+						_, _ = wclm.WriteString(" ")
+					}
+					_, _ = fmt.Fprintf(wclm, "%d", 10000*(o+1)+l*997+k)
+				}
+				_, _ = wclm.WriteString("\n")
+			}
+		}
+	}
+	_ = wclm.Flush()
+	_ = fclm.Close()
+	return
+}
+
+// clmContig is a contig of writeCLMFixture, with its size
+type clmContig struct {
+	name string
+	size int
+}
+
+// clmLink is a link at the positions x and y on the + strands of two
+// contigs
+type clmLink struct{ x, y int }
+
+// clmPair is the links of contig a, laid out before contig b
+type clmPair struct {
+	a, b  string
+	links []clmLink
+}
+
+// writeCLMFixture writes the ids file of the contigs and a clm of the links
+// of each pair in its four orientations, the distance of a link being those
+// of its positions to the facing ends of the contigs, as extract has them.
+// It panics on errors, as it takes no testing.T.
+func writeCLMFixture(dir, name string, contigs []clmContig, pairs []clmPair) (idsfile, clmfile string) {
+	var ids, clm strings.Builder
+	sizes := make(map[string]int)
+	for _, contig := range contigs {
+		fmt.Fprintf(&ids, "%s\t%d\n", contig.name, contig.size)
+		sizes[contig.name] = contig.size
+	}
+	for _, pair := range pairs {
+		for _, ao := range "+-" {
+			for _, bo := range "+-" {
+				dists := make([]string, len(pair.links))
+				for i, l := range pair.links {
+					da, db := sizes[pair.a]-l.x, l.y
+					if ao == '-' {
+						da = l.x
+					}
+					if bo == '-' {
+						db = sizes[pair.b] - l.y
+					}
+					dists[i] = fmt.Sprint(da + db)
+				}
+				fmt.Fprintf(&clm, "%s%c %s%c\t%d\t%s\n", pair.a, ao, pair.b, bo, len(dists),
+					strings.Join(dists, " "))
+			}
+		}
+	}
+	idsfile, clmfile = path.Join(dir, name+".ids"), path.Join(dir, name+".clm")
+	for filename, s := range map[string]string{idsfile: ids.String(), clmfile: clm.String()} {
+		if err := ioutil.WriteFile(filename, []byte(s), 0644); err != nil {
+			panic(err)
+		}
+	}
+	return
+}
+
+// heapInUse returns the live heap after a full garbage collection
+func heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkCLMMemory reports the resident bytes per contig pair held by a
+// CLM built from a synthetic 1M-pair dataset
+func BenchmarkCLMMemory(b *testing.B) {
+	nTigs, nPartners := 100000, 10
+	idsfile, clmfile := writeSyntheticCLM(b.TempDir(), nTigs, nPartners, 3)
+	nPairs := float64(nTigs * nPartners)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		before := heapInUse()
+		clm := mustNewCLM(b, clmfile, idsfile)
+		after := heapInUse()
+		runtime.KeepAlive(clm)
+		b.ReportMetric(float64(after-before)/nPairs, "B/pair")
+	}
+}
+
+// BenchmarkParseCLM measures the time to parse a synthetic clm file
+func BenchmarkParseCLM(b *testing.B) {
+	idsfile, clmfile := writeSyntheticCLM(b.TempDir(), 10000, 10, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mustNewCLM(b, clmfile, idsfile)
+	}
+}
+
+// TestReadClmChunks parses a clm with blank lines and malformed rows in
+// chunks, which gives the lines of the parse in one pass for any number of
+// workers, and the same first malformed row when strict
+func TestReadClmChunks(t *testing.T) {
+	dir := t.TempDir()
+	_, synthetic := writeSyntheticCLM(dir, 50, 3, 5)
+	data, err := ioutil.ReadFile(synthetic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var b strings.Builder
+	for i, row := range rows {
+		switch i % 37 {
+		case 5:
+			b.WriteString("\n")
+		case 11:
+			b.WriteString("tig0000001+ tig0000002+\tx\t1\n")
+		}
+		b.WriteString(row)
+		if i < len(rows)-1 {
+			b.WriteString("\n") // No newline after the last row
+		}
+	}
+	clmfile := path.Join(dir, "messy.clm")
+	if err := ioutil.WriteFile(clmfile, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := allhic.ReadClmLines(clmfile, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(rows) {
+		t.Fatalf("parsed %d lines, want %d", len(want), len(rows))
+	}
+	_, wantErr := allhic.ReadClmLines(clmfile, true, 1)
+	if wantErr == nil {
+		t.Fatal("expected the strict parse to fail")
+	}
+	for _, threads := range []int{1, 2, 3, 8, 64} {
+		got, err := allhic.ReadClmChunks(clmfile, false, threads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("threads=%d: chunks parse %d lines, not those of one pass", threads, len(got))
+		}
+		if _, err := allhic.ReadClmChunks(clmfile, true, threads); err == nil || err.Error() != wantErr.Error() {
+			t.Errorf("threads=%d: strict error %v, want %v", threads, err, wantErr)
+		}
+	}
+}
+
+// BenchmarkReadClmLines measures the time to parse a synthetic clm file in
+// chunks by a growing number of workers
+func BenchmarkReadClmLines(b *testing.B) {
+	_, clmfile := writeSyntheticCLM(b.TempDir(), 10000, 10, 20)
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := allhic.ReadClmChunks(clmfile, false, threads); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// gzipFile writes a gzipped copy of src to dst
+func gzipFile(t *testing.T, src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := gzip.NewWriter(f)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestParseGzipCLM parses gzipped copies of the simulated ids and clm files,
+// the clm without a .gz suffix so that it is found by its magic bytes
+func TestParseGzipCLM(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gzidsfile := path.Join(dir, "test.ids.gz")
+	gzclmfile := path.Join(dir, "test.clm")
+	gzipFile(t, idsfile, gzidsfile)
+	gzipFile(t, clmfile, gzclmfile)
+
+	plain := mustNewCLM(t, clmfile, idsfile)
+	gz := mustNewCLM(t, gzclmfile, gzidsfile)
+	if len(gz.Tigs) == 0 || !reflect.DeepEqual(plain.Tigs, gz.Tigs) {
+		t.Fatalf("got %d tigs from the gzipped ids, want %d", len(gz.Tigs), len(plain.Tigs))
+	}
+	if !reflect.DeepEqual(plain.M(), gz.M()) {
+		t.Error("contact matrices differ between the plain and gzipped clm")
+	}
+}
+
+// TestNewCLMErrors checks that missing files and malformed sizes are
+// reported with the file name and the line number
+func TestNewCLMErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	badidsfile := path.Join(dir, "bad.ids")
+	clmfile := path.Join(dir, "test.clm")
+	files := map[string]string{
+		idsfile:    "t0\t5000\nt1\t5000\trecover\n",
+		badidsfile: "t0\t5000\nt1\t5kb\n",
+		clmfile:    "t0+ t1+\t2\t1000 2000\n",
+	}
+	for filename, content := range files {
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := allhic.NewCLM(clmfile, idsfile); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clmfile, idsfile, want string
+	}{
+		{clmfile, path.Join(dir, "missing.ids"),
+			"cannot open ids file " + path.Join(dir, "missing.ids") + ": no such file or directory"},
+		{path.Join(dir, "missing.clm"), idsfile,
+			"cannot open clm file " + path.Join(dir, "missing.clm") + ": no such file or directory"},
+		{clmfile, badidsfile, "malformed size `5kb` at line 2 of " + badidsfile},
+	}
+	for _, test := range tests {
+		_, err := allhic.NewCLM(test.clmfile, test.idsfile)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("NewCLM(%s, %s) = %v, want %s", test.clmfile, test.idsfile, err, test.want)
+		}
+	}
+}
+
+// TestMalformedClmRows parses truncated rows, extra whitespace and link
+// counts that do not match the distances, leniently and strictly
+func TestMalformedClmRows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	ids := "t0\t5000\nt1\t5000\nt2\t5000\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, row string
+		ok        bool
+	}{
+		{"whitespace", "t0+  t1+\t 2\t1000  2000 ", true},
+		{"truncated", "t0+ t1+\t2", false},
+		{"missing tig", "t0+\t1\t1000", false},
+		{"orientation", "t0+ t1\t1\t1000", false},
+		{"mismatch", "t0+ t1+\t3\t1000 2000", false},
+		{"count", "t0+ t1+\ttwo\t1000 2000", false},
+		{"distance", "t0+ t1+\t2\t1000 2kb", false},
+	}
+	for i, test := range tests {
+		clmfile := path.Join(dir, fmt.Sprintf("test%d.clm", i))
+		// The row under test is the second of two, next to a valid one
+		clm := "t1+ t2+\t1\t500\n" + test.row + "\n"
+		if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := allhic.NewCLM(clmfile, idsfile)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		wantLinks := 0
+		if test.ok {
+			wantLinks = 2
+		}
+		if got := r.M().At(0, 1); got != wantLinks {
+			t.Errorf("%s: got %d links between t0 and t1, want %d", test.name, got, wantLinks)
+		}
+		if got := r.M().At(1, 2); got != 1 {
+			t.Errorf("%s: the valid row was not kept", test.name)
+		}
+
+		_, err = allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{Strict: true})
+		if test.ok != (err == nil) {
+			t.Errorf("%s: strict parse returned %v", test.name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%s: error does not name the line: %v", test.name, err)
+		}
+	}
+}
+
+// TestLongClmRow parses a pair with over 1 MB of distances on one line
+func TestLongClmRow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	if err := ioutil.WriteFile(idsfile, []byte("t0\t5000000\nt1\t5000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nlinks := 150000
+	dists := make([]string, nlinks)
+	for i := range dists {
+		dists[i] = strconv.Itoa(1000000 + i)
+	}
+	clm := fmt.Sprintf("t0+ t1+\t%d\t%s\nt0- t1-\t1\t1000\n", nlinks, strings.Join(dists, " "))
+	if len(clm) < 1<<20 {
+		t.Fatalf("row is only %d bytes", len(clm))
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := r.OrientationSupport(0, 1); same != nlinks+1 {
+		t.Errorf("got %d links on the same strand, want %d", same, nlinks+1)
+	}
+}
+
+// TestDuplicateClmRows merges the rows of two lanes for the same oriented
+// pairs, one of them written in the reverse direction, as from concatenated
+// clm files
+func TestDuplicateClmRows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	ids := "t0\t5000\nt1\t5000\n"
+	clm := "t0+ t1+\t2\t10000 20000\n" +
+		"t0+ t1-\t2\t30000 40000\n" +
+		"t1- t0-\t3\t15000 25000 35000\n" +
+		"t0+ t1-\t3\t50000 60000 70000\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	if got := r.M().At(0, 1); got != 5 {
+		t.Errorf("got %d links between t0 and t1, want the 5 of both lanes", got)
+	}
+	if same, opposite := r.OrientationSupport(0, 1); same != 5 || opposite != 5 {
+		t.Errorf("OrientationSupport(0, 1) = (%d, %d), want (5, 5)", same, opposite)
+	}
+	r.Signs = []byte{'+', '+'}
+	want := allhic.GoldenArray([]int{10000, 20000, 15000, 25000, 35000})
+	if got := r.Q()[0][1]; got == nil || *got != want {
+		t.Errorf("got golden array %v, want %v", got, want)
+	}
+}
+
+// TestOrientedContactReverse looks up a single oriented row from both
+// directions, only the canonical key is stored
+func TestOrientedContactReverse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	if err := ioutil.WriteFile(idsfile, []byte("t0\t5000\nt1\t5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte("t1+ t0-\t2\t10000 20000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	tests := []struct {
+		signs  string
+		ai, bi int
+	}{
+		{"-+", 1, 0}, // As written, t1+ t0-
+		{"+-", 0, 1}, // The reverse, t0+ t1-
+	}
+	want := allhic.GoldenArray([]int{10000, 20000})
+	for _, test := range tests {
+		r.Signs = []byte(test.signs)
+		Q := r.Q()
+		if got := Q[test.ai][test.bi]; got == nil || *got != want {
+			t.Errorf("signs %s: Q[%d][%d] = %v, want %v", test.signs, test.ai, test.bi, got, want)
+		}
+		if got := Q[test.bi][test.ai]; got != nil {
+			t.Errorf("signs %s: Q[%d][%d] = %v, want nil", test.signs, test.bi, test.ai, got)
+		}
+	}
+}
+
+// TestActivateCutoffs inactivates the short tig with MinContigSize and the
+// sparse tig with a DensityLowerBound, the zero values keep all tigs
+func TestActivateCutoffs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	ids := "t0\t50000\nt1\t50000\nt2\t2000\nt3\t50000\n"
+	clm := "t0+ t1+\t10\t1000 2000 3000 4000 5000 6000 7000 8000 9000 10000\n" +
+		"t1+ t2+\t4\t1000 2000 3000 4000\n" +
+		"t0+ t2+\t4\t1000 2000 3000 4000\nt1+ t3+\t1\t1000\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		minSize    int
+		minDensity float64
+		want       []int
+	}{
+		{0, 0, []int{0, 1, 2, 3}},
+		{10000, 0, []int{0, 1, 3}},
+		{0, 1e-4, []int{0, 1, 2}},
+		{10000, 1e-4, []int{0, 1}},
+	}
+	for _, test := range tests {
+		r := mustNewCLM(t, clmfile, idsfile)
+		r.MinContigSize = test.minSize
+		r.DensityLowerBound = test.minDensity
+		r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+		var got []int
+		for _, tig := range r.Tigs {
+			if tig.IsActive {
+				got = append(got, tig.Idx)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("minSize=%d minDensity=%g: active tigs %v, want %v",
+				test.minSize, test.minDensity, got, test.want)
+		}
+		if len(r.Tour.Tigs) != len(test.want) {
+			t.Errorf("minSize=%d minDensity=%g: tour has %d tigs, want %d",
+				test.minSize, test.minDensity, len(r.Tour.Tigs), len(test.want))
+		}
+	}
+}
+
+// TestRecoveredDensity holds the contigs marked 'recover' in the ids file to
+// twice the density cutoff, so only the recovered one of two contigs with
+// the same density is inactivated
+func TestRecoveredDensity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	ids := "#Contig\tRECounts\tLength\nt0\t10\t50000\nt1\t10\t50000\n" +
+		"t2\t10\t50000\trecover\nt3\t10\t50000\n"
+	links := func(n int) string {
+		dists := make([]string, n)
+		for i := range dists {
+			dists[i] = strconv.Itoa(1000 * (i + 1))
+		}
+		return fmt.Sprintf("%d\t%s", n, strings.Join(dists, " "))
+	}
+	clm := "t0+ t1+\t" + links(20) + "\nt0+ t2+\t" + links(6) + "\nt1+ t3+\t" + links(6) + "\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	for i, want := range []bool{false, false, true, false} {
+		if r.Tigs[i].Recovered != want {
+			t.Errorf("tig %s: Recovered = %t, want %t", r.Tigs[i].Name, r.Tigs[i].Recovered, want)
+		}
+	}
+	r.DensityLowerBound = 1e-4
+	r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+	var got []string
+	for _, tig := range r.Tigs {
+		if tig.IsActive {
+			got = append(got, tig.Name)
+		}
+	}
+	if want := []string{"t0", "t1", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("active tigs %v, want %v", got, want)
+	}
+}
+
+// TestMinLinks drops the pair with a single link but keeps the pair with one
+// link in each of two orientations
+func TestMinLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	ids := "t0\t5000\nt1\t5000\nt2\t5000\n"
+	clm := "t0+ t1+\t1\t1000\nt1+ t2+\t1\t2000\nt1+ t2-\t1\t3000\nt0+ t2+\t3\t1000 2000 3000\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{MinLinks: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	M := r.M()
+	for _, test := range []struct{ ai, bi, want int }{{0, 1, 0}, {1, 2, 1}, {0, 2, 3}} {
+		if got := M.At(test.ai, test.bi); got != test.want {
+			t.Errorf("M[%d][%d] = %d, want %d", test.ai, test.bi, got, test.want)
+		}
+	}
+	for _, signs := range []string{"+++", "+-+", "-++", "--+"} {
+		r.Signs = []byte(signs)
+		if q := r.Q()[0][1]; q != nil {
+			t.Errorf("signs %s: golden array %v left for the dropped pair", signs, q)
+		}
+	}
+	r.Signs = []byte("+++")
+	if q := r.Q()[1][2]; q == nil {
+		t.Error("golden array dropped for the kept pair")
+	}
+}
+
+// TestPruneFewTigs prunes groups of 1, 2 and 5 tigs with uneven links, which
+// are too few for OutlierCutoff, and expects every tig to stay in the tour
+func TestPruneFewTigs(t *testing.T) {
+	for _, n := range []int{1, 2, 5} {
+		inTempDir(t, func() {
+			var ids, clm strings.Builder
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&ids, "t%d\t10\t%d\n", i, 5000*(i+1))
+				if i > 0 {
+					fmt.Fprintf(&clm, "t%d+ t%d+\t%d\t%s\n", i-1, i,
+						i*i, strings.TrimSpace(strings.Repeat("1000 ", i*i)))
+				}
+			}
+			writeFiles(t, map[string]string{"test.ids": ids.String(), "test.clm": clm.String()})
+			r := mustNewCLM(t, "test.clm", "test.ids")
+			r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+			r.PruneByDensity()
+			r.PruneTour("", 2)
+			if r.Tour.Len() != n {
+				t.Errorf("%d tigs: got %d in the tour", n, r.Tour.Len())
+			}
+			for _, tig := range r.Tigs {
+				if !tig.IsActive {
+					t.Errorf("%d tigs: %s pruned by %s", n, tig.Name, tig.Pruned)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+/*
+ *  clmcache.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// clmCacheMagic starts every cache file, the last byte is the version
+const clmCacheMagic = "ALLHiCC\x04"
+
+const (
+	// contactBytes is the size of a cached contact record
+	contactBytes = 8 + 1 + 4 + 8 + 4 + 4
+	// orientedContactBytes is the size of a cached oriented contact record
+	orientedContactBytes = 8 + 4
+	// gArrayBytes is the size of a cached golden array
+	gArrayBytes = 2 * BB
+)
+
+// SaveCache writes the parsed contigs and contacts to a compact binary file,
+// which LoadCache reads back much faster than parsing the clmfile
+func (r *CLM) SaveCache(filename string) error {
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := r.writeCache(w); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Noticef("Cached %d tigs and %d contacts to `%s`", len(r.Tigs), len(r.contacts), filename)
+	return nil
+}
+
+// writeCache writes the header, the tigs, the contacts, the oriented
+// contacts and the golden arrays, all little endian
+func (r *CLM) writeCache(w *bufio.Writer) error {
+	if _, err := w.WriteString(clmCacheMagic); err != nil {
+		return err
+	}
+	buf := make([]byte, contactBytes)
+	le := binary.LittleEndian
+
+	// The golden arrays are only valid for the same binning
+	le.PutUint64(buf, math.Float64bits(r.golden.LB))
+	le.PutUint64(buf[8:], math.Float64bits(r.golden.Step))
+	le.PutUint64(buf[16:], uint64(r.golden.Bins))
+	_, _ = w.Write(buf[:24])
+
+	le.PutUint64(buf, uint64(len(r.Tigs)))
+	_, _ = w.Write(buf[:8])
+	for _, tig := range r.Tigs {
+		le.PutUint32(buf, uint32(len(tig.Name)))
+		le.PutUint64(buf[4:], uint64(tig.Size))
+		buf[12] = 0
+		if tig.IsActive {
+			buf[12] |= 1
+		}
+		if tig.Recovered {
+			buf[12] |= 2
+		}
+		le.PutUint32(buf[13:], uint32(tig.RECounts))
+		_, _ = w.Write(buf[:17])
+		_, _ = w.WriteString(tig.Name)
+	}
+
+	le.PutUint64(buf, uint64(len(r.contacts)))
+	_, _ = w.Write(buf[:8])
+	for pair, c := range r.contacts {
+		le.PutUint64(buf, uint64(pair))
+		buf[8] = byte(c.strandedness)
+		le.PutUint32(buf[9:], uint32(c.nlinks))
+		le.PutUint64(buf[13:], math.Float64bits(c.meanDist))
+		le.PutUint32(buf[21:], uint32(c.same))
+		le.PutUint32(buf[25:], uint32(c.opposite))
+		_, _ = w.Write(buf[:contactBytes])
+	}
+
+	le.PutUint64(buf, uint64(len(r.orientedContacts)))
+	_, _ = w.Write(buf[:8])
+	for key, gi := range r.orientedContacts {
+		le.PutUint64(buf, uint64(key))
+		le.PutUint32(buf[8:], uint32(gi))
+		_, _ = w.Write(buf[:orientedContactBytes])
+	}
+
+	le.PutUint64(buf, uint64(len(r.gdists)))
+	_, _ = w.Write(buf[:8])
+	gbuf := make([]byte, gArrayBytes)
+	for _, g := range r.gdists {
+		for k, c := range g {
+			le.PutUint16(gbuf[2*k:], c)
+		}
+		if _, err := w.Write(gbuf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadCache replaces the contigs and contacts with those in a file written
+// by SaveCache
+func (r *CLM) LoadCache(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return openError("cache", filename, err)
+	}
+	defer f.Close()
+	if err := r.readCache(bufio.NewReader(f)); err != nil {
+		return fmt.Errorf("cannot read cache file %s: %s", filename, err)
+	}
+	log.Noticef("Loaded %d tigs and %d contacts from `%s`", len(r.Tigs), len(r.contacts), filename)
+	return nil
+}
+
+// readCache reads the layout written by writeCache
+func (r *CLM) readCache(rd *bufio.Reader) error {
+	buf := make([]byte, gArrayBytes+contactBytes)
+	le := binary.LittleEndian
+	if _, err := io.ReadFull(rd, buf[:len(clmCacheMagic)]); err != nil {
+		return err
+	}
+	if string(buf[:len(clmCacheMagic)]) != clmCacheMagic {
+		return fmt.Errorf("not an ALLHiC clm cache or an older version")
+	}
+	if _, err := io.ReadFull(rd, buf[:24]); err != nil {
+		return err
+	}
+	bins := int(le.Uint64(buf[16:]))
+	if bins < 2 || bins > BB {
+		return fmt.Errorf("malformed number of golden array bins %d", bins)
+	}
+	golden := newGoldenScale(math.Float64frombits(le.Uint64(buf)),
+		math.Float64frombits(le.Uint64(buf[8:])), bins)
+	if !golden.Equal(r.golden) {
+		return fmt.Errorf("the golden arrays were binned with other bounds")
+	}
+	count := func() (int, error) {
+		if _, err := io.ReadFull(rd, buf[:8]); err != nil {
+			return 0, err
+		}
+		return int(le.Uint64(buf)), nil
+	}
+
+	nTigs, err := count()
+	if err != nil {
+		return err
+	}
+	r.Tigs = make([]*TigF, 0, nTigs)
+	r.tigToIdx = make(map[string]int, nTigs)
+	for i := 0; i < nTigs; i++ {
+		if _, err := io.ReadFull(rd, buf[:17]); err != nil {
+			return err
+		}
+		name := make([]byte, le.Uint32(buf))
+		size, flags := int(le.Uint64(buf[4:])), buf[12]
+		if _, err := io.ReadFull(rd, name); err != nil {
+			return err
+		}
+		tig := r.addTig(string(name), size)
+		tig.IsActive = flags&1 != 0
+		tig.Recovered = flags&2 != 0
+		tig.RECounts = int(le.Uint32(buf[13:]))
+	}
+
+	nContacts, err := count()
+	if err != nil {
+		return err
+	}
+	r.contacts = make(map[Pair]Contact, nContacts)
+	for i := 0; i < nContacts; i++ {
+		if _, err := io.ReadFull(rd, buf[:contactBytes]); err != nil {
+			return err
+		}
+		r.contacts[Pair(le.Uint64(buf))] = Contact{
+			strandedness: int8(buf[8]),
+			nlinks:       int32(le.Uint32(buf[9:])),
+			meanDist:     math.Float64frombits(le.Uint64(buf[13:])),
+			same:         int32(le.Uint32(buf[21:])),
+			opposite:     int32(le.Uint32(buf[25:])),
+		}
+	}
+
+	nOriented, err := count()
+	if err != nil {
+		return err
+	}
+	r.orientedContacts = make(map[OrientedPair]int32, nOriented)
+	for i := 0; i < nOriented; i++ {
+		if _, err := io.ReadFull(rd, buf[:orientedContactBytes]); err != nil {
+			return err
+		}
+		r.orientedContacts[OrientedPair(le.Uint64(buf))] = int32(le.Uint32(buf[8:]))
+	}
+
+	nGdists, err := count()
+	if err != nil {
+		return err
+	}
+	r.gdists = make([]GArray, nGdists)
+	for i := range r.gdists {
+		if _, err := io.ReadFull(rd, buf[:gArrayBytes]); err != nil {
+			return err
+		}
+		for k := range r.gdists[i] {
+			r.gdists[i][k] = le.Uint16(buf[2*k:])
+		}
+	}
+	for _, gi := range r.orientedContacts {
+		if int(gi) >= nGdists {
+			return fmt.Errorf("golden array %d out of range", gi)
+		}
+	}
+	return nil
+}
+
+// cacheIsFresh tells whether the cache file exists and is newer than all the
+// inputs it was made from
+func cacheIsFresh(cachefile string, inputs ...string) bool {
+	cache, err := os.Stat(cachefile)
+	if err != nil {
+		return false
+	}
+	for _, input := range inputs {
+		fi, err := os.Stat(input)
+		if err != nil || !fi.ModTime().Before(cache.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+/*
+ *  clmcache_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestCLMCacheRoundTrip saves the simulated group to a cache and checks that
+// the loaded CLM has the same contigs and contacts
+func TestCLMCacheRoundTrip(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cachefile := path.Join(dir, "test.clm.cache")
+
+	parsed := mustNewCLM(t, clmfile, idsfile)
+	if err := parsed.SaveCache(cachefile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{Cachefile: cachefile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Tigs, loaded.Tigs) {
+		t.Fatal("tigs differ after the round trip")
+	}
+	if !reflect.DeepEqual(parsed.M(), loaded.M()) {
+		t.Fatal("contact matrices differ after the round trip")
+	}
+	signs := make([]byte, len(parsed.Tigs))
+	for i := range signs {
+		signs[i] = "+-"[i%2]
+	}
+	parsed.Signs, loaded.Signs = signs, signs
+	if !reflect.DeepEqual(parsed.Q(), loaded.Q()) {
+		t.Fatal("golden arrays differ after the round trip")
+	}
+	for i := 0; i+1 < len(parsed.Tigs); i++ {
+		s1, o1 := parsed.OrientationSupport(i, i+1)
+		s2, o2 := loaded.OrientationSupport(i, i+1)
+		if s1 != s2 || o1 != o2 {
+			t.Fatalf("orientation support of (%d, %d) differs", i, i+1)
+		}
+	}
+}
+
+// TestCLMCacheStale changes the clm after the cache was written, which must
+// be parsed again
+func TestCLMCacheStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	cachefile := path.Join(dir, "test.clm.cache")
+	if err := ioutil.WriteFile(idsfile, []byte("t0\t5000\nt1\t5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := allhic.CLMOptions{Cachefile: cachefile}
+	for _, test := range []struct {
+		clm   string
+		links int
+	}{
+		{"t0+ t1+\t1\t10000\n", 1},
+		{"t0+ t1+\t2\t10000 20000\n", 2},
+	} {
+		if err := ioutil.WriteFile(clmfile, []byte(test.clm), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Make the clm newer than any cache written before
+		future := time.Now().Add(time.Duration(test.links) * time.Minute)
+		if err := os.Chtimes(clmfile, future, future); err != nil {
+			t.Fatal(err)
+		}
+		r, err := allhic.NewCLMWithOptions(clmfile, idsfile, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.M().At(0, 1); got != test.links {
+			t.Errorf("got %d links, want %d", got, test.links)
+		}
+	}
+	if _, err := os.Stat(cachefile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCLMCacheGoldenScale bins the distances on another scale than the one
+// of the cache, which must be parsed again
+func TestCLMCacheGoldenScale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := path.Join(dir, "test.ids")
+	clmfile := path.Join(dir, "test.clm")
+	cachefile := path.Join(dir, "test.clm.cache")
+	if err := ioutil.WriteFile(idsfile, []byte("t0\t5000\nt1\t5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte("t0+ t1+\t2\t1000 5000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make the cache newer than the inputs
+	past := time.Now().Add(-time.Minute)
+	for _, f := range []string{idsfile, clmfile} {
+		if err := os.Chtimes(f, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{Cachefile: cachefile}); err != nil {
+		t.Fatal(err)
+	}
+
+	golden, err := allhic.NewGoldenScale(1000, 1000000, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := allhic.NewCLMWithOptions(clmfile, idsfile, allhic.CLMOptions{Cachefile: cachefile, Golden: golden})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Signs = []byte("++")
+	if got, want := *r.Q()[0][1], (allhic.GArray{1, 1}); got != want {
+		t.Errorf("got golden array %v, want %v", got, want)
+	}
+}
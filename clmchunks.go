@@ -0,0 +1,201 @@
+/*
+ *  clmchunks.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ParallelClmMinSize is the size of the smallest clmfile that is parsed by
+// several workers, smaller files are parsed in one pass
+const ParallelClmMinSize = 64 << 20
+
+// clmChunk holds the rows of the clmfile parsed from one byte range
+type clmChunk struct {
+	lines        []CLMLine
+	rows         int // Lines that start in the range, blank ones included
+	skipped      int
+	firstSkipped int // Line of the first malformed row, within the range
+	// First malformed row when strict, or the read error
+	err     error
+	errLine int
+	errRow  string
+	readErr error
+}
+
+// parseClmRows parses the rows of reader until EOF or, when limit >= 0, up
+// to the last row that starts within limit bytes. tick is called before
+// each row.
+func parseClmRows(reader *bufio.Reader, limit int64, strict bool, tick func(c *clmChunk)) (c clmChunk) {
+	var read int64
+	for lineno := 1; limit < 0 || read < limit; lineno++ {
+		if tick != nil {
+			tick(&c)
+		}
+		row, err := reader.ReadString('\n')
+		read += int64(len(row))
+		if err != nil && err != io.EOF {
+			c.readErr = err
+			return
+		}
+		row = strings.TrimSpace(row)
+		if row == "" && err == io.EOF {
+			break
+		}
+		c.rows = lineno
+		if row == "" {
+			continue
+		}
+		line, perr := parseClmRow(row)
+		if perr != nil {
+			if strict {
+				c.err, c.errLine, c.errRow = perr, lineno, row
+				return
+			}
+			if c.skipped == 0 {
+				c.firstSkipped = lineno
+			}
+			c.skipped++
+		} else {
+			c.lines = append(c.lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return
+}
+
+// joinClmChunks concatenates the lines of the chunks in file order, so the
+// result is that of parsing the whole file in one pass. The first error in
+// file order fails the parse, with its line in the whole file.
+func joinClmChunks(clmfile string, chunks []clmChunk) ([]CLMLine, error) {
+	offset, total := 0, 0
+	skipped, firstSkipped := 0, 0
+	for _, c := range chunks {
+		if c.readErr != nil {
+			return nil, fmt.Errorf("cannot read clm file %s: %s", clmfile, c.readErr)
+		}
+		if c.err != nil {
+			return nil, fmt.Errorf("malformed row at line %d of %s (%s): %s",
+				offset+c.errLine, clmfile, c.err, c.errRow)
+		}
+		if c.skipped > 0 && skipped == 0 {
+			firstSkipped = offset + c.firstSkipped
+		}
+		skipped += c.skipped
+		total += len(c.lines)
+		offset += c.rows
+	}
+	if skipped > 0 {
+		log.Warningf("Skipped %d malformed rows in `%s`, first at line %d",
+			skipped, clmfile, firstSkipped)
+	}
+	if len(chunks) == 1 {
+		return chunks[0].lines, nil
+	}
+	lines := make([]CLMLine, 0, total)
+	for _, c := range chunks {
+		lines = append(lines, c.lines...)
+	}
+	return lines, nil
+}
+
+// readClmChunks parses the clmfile of size bytes in byte ranges by threads
+// workers. Each range holds the rows that start in it.
+func readClmChunks(clmfile string, size int64, strict bool, threads int) ([]CLMLine, error) {
+	nChunks := 4 * threads
+	chunkSize := (size + int64(nChunks) - 1) / int64(nChunks)
+	log.Noticef("Parse clmfile `%s` in %d chunks of %s by %d workers",
+		clmfile, nChunks, humanizeBytes(chunkSize), threads)
+
+	chunks := make([]clmChunk, nChunks)
+	indices := make(chan int, nChunks)
+	for i := range chunks {
+		indices <- i
+	}
+	close(indices)
+	var wg sync.WaitGroup
+	for w := 0; w < threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				start := int64(i) * chunkSize
+				end := start + chunkSize
+				if end > size {
+					end = size
+				}
+				chunks[i] = readClmChunk(clmfile, start, end, strict)
+			}
+		}()
+	}
+	wg.Wait()
+	return joinClmChunks(clmfile, chunks)
+}
+
+// readClmChunk parses the rows of the clmfile that start between byte start
+// and byte end
+func readClmChunk(clmfile string, start, end int64, strict bool) clmChunk {
+	if start >= end {
+		return clmChunk{}
+	}
+	f, err := os.Open(clmfile)
+	if err != nil {
+		return clmChunk{readErr: err}
+	}
+	defer f.Close()
+	pos := start
+	if start > 0 {
+		// Skip the rest of the row before start, which is the previous chunk's
+		pos = start - 1
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return clmChunk{readErr: err}
+		}
+	}
+	reader := bufio.NewReaderSize(f, 1<<20)
+	if start > 0 {
+		rest, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return clmChunk{readErr: err}
+		}
+		pos += int64(len(rest))
+	}
+	if pos >= end {
+		return clmChunk{}
+	}
+	return parseClmRows(reader, end-pos, strict, nil)
+}
+
+// plainFileSize returns the size of filename if it is a regular file that
+// is not compressed, and 0 otherwise
+func plainFileSize(filename string) int64 {
+	if filename == StdinFile {
+		return 0
+	}
+	fi, err := os.Stat(filename)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	if n, _ := io.ReadFull(f, magic); n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return 0
+	}
+	return fi.Size()
+}
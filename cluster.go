@@ -12,7 +12,6 @@ package allhic
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 )
@@ -327,8 +326,12 @@ func (r *Partitioner) sortClusters() {
 
 // printClusters shows the contents of the clusters
 func (r *Partitioner) printClusters() {
-	clusterfile := RemoveExt(RemoveExt(r.PairsFile)) + ".clusters.txt"
-	f, _ := os.Create(clusterfile)
+	prefix := r.OutPrefix
+	if prefix == "" {
+		prefix = RemoveExt(RemoveExt(r.PairsFile))
+	}
+	clusterfile := prefix + ".clusters.txt"
+	f := mustCreateAtomic(clusterfile)
 	w := bufio.NewWriter(f)
 
 	_, _ = fmt.Fprintf(w, "#Group\tnContigs\tContigs\n")
@@ -341,8 +344,8 @@ func (r *Partitioner) printClusters() {
 		sort.Strings(names)
 		_, _ = fmt.Fprintf(w, "%dg%d\t%d\t%s\n", r.K, j+1, len(names), strings.Join(names, " "))
 	}
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
 
 	log.Noticef("Write %d partitions to `%s`", len(r.clusters), clusterfile)
-	_ = f.Close()
 }
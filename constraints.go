@@ -0,0 +1,267 @@
+/*
+ *  constraints.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kinds of the constraints on a tig
+const (
+	pinFixed byte = iota + 1
+	pinLeft
+	pinRight
+)
+
+// Constraints pin tigs of the tour, where they belong by markers such as
+// telomeres or centromeres. A fixed tig stays at its position, and a left or
+// right tig within the first or the last ConstraintEndFraction of the tour.
+// The moves of the GA are repaired to meet them, see repair.
+type Constraints struct {
+	kinds []byte // By tig index, 0 when the tig is free
+	pos   []int  // Position of the fixed tigs, by tig index
+	count [pinRight + 1]int
+}
+
+// newConstraints makes room for the constraints on nTigs tigs
+func newConstraints(nTigs int) *Constraints {
+	return &Constraints{kinds: make([]byte, nTigs), pos: make([]int, nTigs)}
+}
+
+// add pins the tig idx, at the 0-based pos when fixed
+func (r *Constraints) add(idx int, kind byte, pos int) {
+	if old := r.kinds[idx]; old != 0 {
+		r.count[old]--
+	}
+	r.kinds[idx], r.pos[idx] = kind, pos
+	r.count[kind]++
+}
+
+// zone returns how many positions at either end of a tour of n tigs hold the
+// left and the right tigs, which never overlap
+func (r *Constraints) zone(n int) int {
+	zone := int(math.Ceil(ConstraintEndFraction * float64(n)))
+	if zone > n/2 {
+		zone = n / 2
+	}
+	return zone
+}
+
+// check tells whether the constraints can all be met by a tour of n tigs
+func (r *Constraints) check(n int) error {
+	zone := r.zone(n)
+	pinned := make(map[int]bool)
+	left, right := zone, zone // Free positions at the ends
+	for idx, kind := range r.kinds {
+		if kind != pinFixed {
+			continue
+		}
+		pos := r.pos[idx]
+		switch {
+		case pos >= n:
+			return fmt.Errorf("cannot fix a contig at position %d of a tour of %d contigs", pos+1, n)
+		case pinned[pos]:
+			return fmt.Errorf("cannot fix two contigs at position %d", pos+1)
+		}
+		pinned[pos] = true
+		if pos < zone {
+			left--
+		}
+		if pos >= n-zone {
+			right--
+		}
+	}
+	if r.count[pinLeft] > left || r.count[pinRight] > right {
+		return fmt.Errorf("cannot keep %d left and %d right contigs in the %d free positions at either end of the tour",
+			r.count[pinLeft], r.count[pinRight], zone)
+	}
+	return nil
+}
+
+// valid tells whether the tigs between positions p and q meet the
+// constraints
+func (r *Constraints) valid(tigs []Tig, p, q int) bool {
+	if r == nil {
+		return true
+	}
+	n := len(tigs)
+	zone := r.zone(n)
+	for i := p; i <= q; i++ {
+		idx := tigs[i].Idx
+		switch r.kinds[idx] {
+		case pinFixed:
+			if r.pos[idx] != i {
+				return false
+			}
+		case pinLeft:
+			if i >= zone {
+				return false
+			}
+		case pinRight:
+			if i < n-zone {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// repair moves the tigs that break the constraints, and returns whether it
+// did. The fixed tigs go back to their positions, and the others fill the
+// rest in order, except for the left (right) tigs out of their zone, which
+// take the places of the last (first) other tigs in it.
+func (r *Constraints) repair(tigs []Tig) bool {
+	if r.valid(tigs, 0, len(tigs)-1) {
+		return false
+	}
+	n := len(tigs)
+	zone := r.zone(n)
+	pinned := make([]bool, n)
+	free := make([]Tig, 0, n)
+	fixed := make([]Tig, 0, r.count[pinFixed])
+	for _, tig := range tigs {
+		if r.kinds[tig.Idx] == pinFixed {
+			pinned[r.pos[tig.Idx]] = true
+			fixed = append(fixed, tig)
+		} else {
+			free = append(free, tig)
+		}
+	}
+	left, right := 0, 0
+	for i := range pinned {
+		if !pinned[i] && i < zone {
+			left++
+		}
+		if !pinned[i] && i >= n-zone {
+			right++
+		}
+	}
+	free = r.pullFront(free, left, pinLeft)
+	reverseTigs(free)
+	free = r.pullFront(free, right, pinRight)
+	reverseTigs(free)
+	k := 0
+	for i := range tigs {
+		if !pinned[i] {
+			tigs[i] = free[k]
+			k++
+		}
+	}
+	for _, tig := range fixed {
+		tigs[r.pos[tig.Idx]] = tig
+	}
+	return true
+}
+
+// pullFront moves the tigs of kind after the first k into them, in place of
+// the last tigs of other kinds there, which go right after
+func (r *Constraints) pullFront(tigs []Tig, k int, kind byte) []Tig {
+	var pulled, rest []Tig
+	for _, tig := range tigs[k:] {
+		if r.kinds[tig.Idx] == kind {
+			pulled = append(pulled, tig)
+		} else {
+			rest = append(rest, tig)
+		}
+	}
+	if len(pulled) == 0 {
+		return tigs
+	}
+	pushed := make([]bool, k)
+	for i, m := k-1, 0; m < len(pulled); i-- {
+		if r.kinds[tigs[i].Idx] != kind {
+			pushed[i] = true
+			m++
+		}
+	}
+	out := make([]Tig, 0, len(tigs))
+	for i, tig := range tigs[:k] {
+		if !pushed[i] {
+			out = append(out, tig)
+		}
+	}
+	out = append(out, pulled...)
+	for i, tig := range tigs[:k] {
+		if pushed[i] {
+			out = append(out, tig)
+		}
+	}
+	return append(out, rest...)
+}
+
+// reverseTigs turns the tigs around in place
+func reverseTigs(tigs []Tig) {
+	for i, j := 0, len(tigs)-1; i < j; i, j = i+1, j-1 {
+		tigs[i], tigs[j] = tigs[j], tigs[i]
+	}
+}
+
+// ReadConstraints reads the constraints on the active tigs from a file of
+// rows `contig position fixed|left|right`, where position is the 1-based
+// position in the tour of a fixed contig, and is ignored for left and right
+// ones. The contigs that are unknown or not active are skipped.
+func (r *CLM) ReadConstraints(filename string) (*Constraints, error) {
+	f, err := openReader(filename)
+	if err != nil {
+		return nil, openError("constraints", filename, err)
+	}
+	defer f.Close()
+
+	active := make(map[int]bool, r.Tour.Len())
+	for _, tig := range r.Tour.Tigs {
+		active[tig.Idx] = true
+	}
+	pins := newConstraints(len(r.Tigs))
+	kinds := map[string]byte{ConstraintFixed: pinFixed, ConstraintLeft: pinLeft, ConstraintRight: pinRight}
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) != 3 {
+			return nil, fmt.Errorf("expected 3 columns at line %d of %s: %s",
+				lineno, filename, scanner.Text())
+		}
+		kind, ok := kinds[words[2]]
+		if !ok {
+			return nil, fmt.Errorf("unknown constraint `%s` at line %d of %s, use %s, %s or %s",
+				words[2], lineno, filename, ConstraintFixed, ConstraintLeft, ConstraintRight)
+		}
+		pos := 0
+		if kind == pinFixed {
+			if pos, err = strconv.Atoi(words[1]); err != nil || pos < 1 {
+				return nil, fmt.Errorf("bad position `%s` at line %d of %s", words[1], lineno, filename)
+			}
+		}
+		name := r.opts.Aliases.Name(words[0])
+		idx, ok := r.tigToIdx[name]
+		switch {
+		case !ok:
+			log.Warningf("Contig %s not found in `%s`, constraint skipped", name, r.REfile)
+			continue
+		case !active[idx]:
+			log.Warningf("Contig %s is not active, constraint skipped", name)
+			continue
+		}
+		pins.add(idx, kind, pos-1) // Unused unless fixed
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read constraints file %s: %s", filename, err)
+	}
+	if err := pins.check(r.Tour.Len()); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	log.Noticef("Loaded %d fixed, %d left and %d right contigs from `%s`",
+		pins.count[pinFixed], pins.count[pinLeft], pins.count[pinRight], filename)
+	return pins, nil
+}
@@ -0,0 +1,181 @@
+/*
+ *  constraints_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// randomPins draws constraints that a tour of n tigs can meet, with the
+// tigs numbered 0 to n-1
+func randomPins(rng *rand.Rand, n int) *allhic.Constraints {
+	for {
+		idxs := rng.Perm(n)
+		fixed := map[int]int{}
+		positions := rng.Perm(n)
+		nFixed, nLeft, nRight := rng.Intn(n/4+1), rng.Intn(n/10+2), rng.Intn(n/10+2)
+		if nFixed+nLeft+nRight > n {
+			continue
+		}
+		for i := 0; i < nFixed; i++ {
+			fixed[idxs[i]] = positions[i]
+		}
+		left := idxs[nFixed : nFixed+nLeft]
+		right := idxs[nFixed+nLeft : nFixed+nLeft+nRight]
+		pins := allhic.MakeConstraints(n, fixed, left, right)
+		if pins.Check(n) == nil {
+			return pins
+		}
+	}
+}
+
+// shuffledTigs returns the tigs 0 to n-1 in random order
+func shuffledTigs(rng *rand.Rand, n int) []allhic.Tig {
+	tigs := make([]allhic.Tig, n)
+	for i, idx := range rng.Perm(n) {
+		tigs[i] = allhic.Tig{Idx: idx, Size: 1000 + idx}
+	}
+	return tigs
+}
+
+// TestConstraintsRepair repairs random tours under random constraints, which
+// they then meet with the same tigs, and leaves the valid tours alone
+func TestConstraintsRepair(t *testing.T) {
+	repaired := func(seed int64, size uint8) bool {
+		rng := rand.New(rand.NewSource(seed))
+		n := int(size)%80 + 1
+		pins := randomPins(rng, n)
+		tigs := shuffledTigs(rng, n)
+		before := tigIdxs(allhic.Tour{Tigs: tigs})
+		valid := pins.Valid(tigs)
+		if pins.Repair(tigs) == valid || !pins.Valid(tigs) {
+			return false
+		}
+		return !pins.Repair(tigs) && reflect.DeepEqual(tigIdxs(allhic.Tour{Tigs: tigs}), before)
+	}
+	if err := quick.Check(repaired, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestConstraintsMoves mutates and crosses constrained tours, which meet
+// the constraints after every move
+func TestConstraintsMoves(t *testing.T) {
+	cross, _ := allhic.NewCrossoverOperator(allhic.CrossoverPMX)
+	moves := mustParseMutWeights(t, "swap:1,splice:1,insert:1,reverse:1,translocate:1")
+	met := func(seed int64, size uint8) bool {
+		rng := rand.New(rand.NewSource(seed))
+		n := int(size)%60 + 2
+		pins := randomPins(rng, n)
+		a := allhic.Tour{Tigs: shuffledTigs(rng, n), Cross: cross, Moves: moves, Pins: pins}
+		b := allhic.Tour{Tigs: shuffledTigs(rng, n), Cross: cross, Moves: moves, Pins: pins}
+		pins.Repair(a.Tigs)
+		pins.Repair(b.Tigs)
+		for i := 0; i < 50; i++ {
+			a.Mutate(rng)
+			b.Mutate(rng)
+			if i%10 == 0 {
+				a.Crossover(b, rng)
+			}
+			if !pins.Valid(a.Tigs) || !pins.Valid(b.Tigs) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(met, &quick.Config{MaxCount: 300}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestReadConstraints rejects the constraints that no tour can meet
+func TestReadConstraints(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, 20, 3, 10)
+	for _, c := range []struct{ rows, want string }{
+		{"tig0000003 5 fixed\ntig0000007 . left\nnope 1 right\n", ""},
+		{"# comment\ntig0000001 . left\ntig0000002 . right\n", ""},
+		{"tig0000003 5 middle\n", "unknown constraint"},
+		{"tig0000003 0 fixed\n", "bad position"},
+		{"tig0000003 fixed\n", "expected 3 columns"},
+		{"tig0000003 21 fixed\n", "position 21"},
+		{"tig0000003 5 fixed\ntig0000004 5 fixed\n", "two contigs"},
+		{"tig0000001 . left\ntig0000002 . left\ntig0000003 . left\n", "3 left and 0 right"},
+		{"tig0000001 1 fixed\ntig0000002 . left\ntig0000003 . left\n", "2 left and 0 right"},
+	} {
+		filename := path.Join(dir, "pins.txt")
+		if err := ioutil.WriteFile(filename, []byte(c.rows), 0644); err != nil {
+			t.Fatal(err)
+		}
+		clm := mustNewCLM(t, clmfile, idsfile)
+		clm.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+		_, err := clm.ReadConstraints(filename)
+		switch {
+		case c.want == "":
+			if err != nil {
+				t.Errorf("%q: %v", c.rows, err)
+			}
+		case err == nil || !strings.Contains(err.Error(), c.want):
+			t.Errorf("%q: got error %v, want %q", c.rows, err, c.want)
+		}
+	}
+}
+
+// TestOptimizeConstraints runs the GA, with and without a start tour, under
+// constraints that the final tour meets
+func TestOptimizeConstraints(t *testing.T) {
+	nTigs := 40
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, nTigs, 3, 10)
+	pinsfile := path.Join(dir, "pins.txt")
+	rows := "tig0000010 1 fixed\ntig0000020 . left\ntig0000025 . right\ntig0000030 20 fixed\n"
+	if err := ioutil.WriteFile(pinsfile, []byte(rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	truth := make([]string, nTigs)
+	for i := range truth {
+		truth[i] = fmt.Sprintf("tig%07d+", i)
+	}
+	tourfile := path.Join(dir, "start.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(strings.Join(truth, " ")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, start := range []string{"", tourfile} {
+		opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true, Seed: 42,
+			NPop: 20, NGen: 50, MutProb: allhic.MutaProb, StartTour: start,
+			ConstraintsFile: pinsfile, Stdout: ioutil.Discard}
+		inTempDir(t, func() {
+			opt.OutPrefix = "synthetic"
+			if err := opt.Run(); err != nil {
+				t.Fatal(err)
+			}
+			order := finalOrder(t, opt.OutTourFile)
+			pos := map[string]int{}
+			for i, name := range order {
+				pos[name] = i
+			}
+			if pos["tig0000010"] != 0 || pos["tig0000030"] != 19 ||
+				pos["tig0000020"] >= 4 || pos["tig0000025"] < nTigs-4 {
+				t.Errorf("start tour %q: final tour breaks the constraints: %v", start, order)
+			}
+			if len(pos) != nTigs {
+				t.Errorf("final tour has %d distinct tigs, want %d", len(pos), nTigs)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ *  contigfilter.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"strings"
+)
+
+// ContigFilter keeps the contigs of an include list, or all of them without
+// one, less those of an exclude list, e.g. to leave the organelles and the
+// contaminants out of extract and anchor. A nil filter keeps all contigs.
+type ContigFilter struct {
+	Includefile string
+	Excludefile string
+	include     map[string]bool
+	exclude     map[string]bool
+}
+
+// NewContigFilter reads the lists of contigs, nil without either
+func NewContigFilter(includefile, excludefile string) *ContigFilter {
+	if includefile == "" && excludefile == "" {
+		return nil
+	}
+	r := &ContigFilter{Includefile: includefile, Excludefile: excludefile}
+	if includefile != "" {
+		r.include = readContigList(includefile, "include")
+	}
+	if excludefile != "" {
+		r.exclude = readContigList(excludefile, "exclude")
+	}
+	return r
+}
+
+// Keep returns whether the contig passes the filter
+func (r *ContigFilter) Keep(name string) bool {
+	if r == nil {
+		return true
+	}
+	if r.include != nil && !r.include[name] {
+		return false
+	}
+	return !r.exclude[name]
+}
+
+// WarnUnknown warns of the contigs of the lists that are not among the
+// contigs of source
+func (r *ContigFilter) WarnUnknown(known func(name string) bool, source string) {
+	if r == nil {
+		return
+	}
+	for _, list := range []struct {
+		filename string
+		names    map[string]bool
+	}{{r.Includefile, r.include}, {r.Excludefile, r.exclude}} {
+		nUnknown := 0
+		for name := range list.names {
+			if !known(name) {
+				nUnknown++
+			}
+		}
+		if nUnknown > 0 {
+			log.Warningf("%d of the %d contigs in `%s` are not in `%s`",
+				nUnknown, len(list.names), list.filename, source)
+		}
+	}
+}
+
+// readContigList reads the contig names in the first column of a file, such
+// as the candidate repeats written by extract, to include or to exclude
+func readContigList(filename, what string) map[string]bool {
+	f := mustOpen(filename)
+	defer f.Close()
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		names[words[0]] = true
+	}
+	ErrorAbort(scanner.Err())
+	log.Noticef("Read %d contigs to %s from `%s`", len(names), what, filename)
+	return names
+}
+
+// readExcludeFile reads the contigs to exclude
+func readExcludeFile(filename string) map[string]bool {
+	return readContigList(filename, "exclude")
+}
@@ -0,0 +1,117 @@
+/*
+ *  contiglinks.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+)
+
+// FlagLowCisTrans marks the contigs whose cis/trans ratio is low for their
+// length, likely chimeric or contaminants
+const FlagLowCisTrans = "low_cis_trans"
+
+// ContigLinkStats are the links of a contig, within it and to the others,
+// written to prefix.contig_links.tsv
+type ContigLinkStats struct {
+	Name       string
+	Length     int
+	IntraLinks int
+	InterLinks int
+	// Partners are the distinct contigs with links to this one
+	Partners int
+	// CisTrans is IntraLinks over InterLinks, +Inf without inter-links
+	CisTrans float64
+	// Flag is FlagLowCisTrans or empty
+	Flag string
+}
+
+// String outputs the string representation of ContigLinkStats
+func (r ContigLinkStats) String() string {
+	flag := r.Flag
+	if flag == "" {
+		flag = "-"
+	}
+	return fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%.4g\t%s",
+		r.Name, r.Length, r.IntraLinks, r.InterLinks, r.Partners, r.CisTrans, flag)
+}
+
+// contigLinkStats counts the links of each contig, and flags those of a low
+// cis/trans ratio
+func (r *LinkAggregator) contigLinkStats() []ContigLinkStats {
+	partners := make([]int, len(r.contigs))
+	for _, p := range r.pairs {
+		partners[p.pair[0]]++
+		partners[p.pair[1]]++
+	}
+	stats := make([]ContigLinkStats, len(r.contigs))
+	for i, contig := range r.contigs {
+		stats[i] = ContigLinkStats{Name: contig.name, Length: contig.length,
+			IntraLinks: contig.intraPairs, InterLinks: contig.interPairs, Partners: partners[i],
+			CisTrans: float64(contig.intraPairs) / float64(contig.interPairs)}
+	}
+	flagLowCisTrans(stats, CisTransNeighbors, LowCisTransFactor)
+	return stats
+}
+
+// flagLowCisTrans flags the contigs whose cis/trans ratio is factor times
+// below the median of the neighbors contigs nearest in length, themselves
+// included. The ratios are taken with a pseudocount of one link each, so
+// that the contigs without links compare.
+func flagLowCisTrans(stats []ContigLinkStats, neighbors int, factor float64) {
+	if len(stats) < neighbors {
+		neighbors = len(stats)
+	}
+	if neighbors < 3 {
+		return
+	}
+	byLength := make([]int, len(stats))
+	for i := range byLength {
+		byLength[i] = i
+	}
+	sort.SliceStable(byLength, func(i, j int) bool {
+		return stats[byLength[i]].Length < stats[byLength[j]].Length
+	})
+	ratio := func(s ContigLinkStats) float64 {
+		return float64(s.IntraLinks+1) / float64(s.InterLinks+1)
+	}
+	window := make([]float64, neighbors)
+	nFlagged := 0
+	for rank, i := range byLength {
+		start := rank - neighbors/2
+		if start < 0 {
+			start = 0
+		}
+		if start+neighbors > len(stats) {
+			start = len(stats) - neighbors
+		}
+		for j := range window {
+			window[j] = ratio(stats[byLength[start+j]])
+		}
+		if ratio(stats[i])*factor < median(window) {
+			stats[i].Flag = FlagLowCisTrans
+			nFlagged++
+		}
+	}
+	log.Noticef("%d contigs of a cis/trans ratio %.0fx below those of similar length", nFlagged, factor)
+}
+
+// writeContigLinks writes the links of each contig
+func writeContigLinks(outfile string, stats []ContigLinkStats) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, ContigLinksHeader)
+	for _, s := range stats {
+		_, _ = fmt.Fprintln(w, s)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Links of %d contigs written to `%s`", len(stats), outfile)
+}
@@ -0,0 +1,167 @@
+/*
+ *  coverage.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// CoverageTrack counts the Hi-C reads in fixed-size windows along each
+// contig. Collapsed repeats stand out with several times the coverage of
+// the rest of the assembly.
+type CoverageTrack struct {
+	Window  int
+	contigs []*ContigInfo
+	counts  [][]int32
+}
+
+// ContigCoverage summarizes the coverage of a contig, in reads per kb
+type ContigCoverage struct {
+	Name    string
+	Length  int
+	Windows int
+	Reads   int
+	Median  float64
+	Ratio   float64 // Median over the assembly-wide median
+}
+
+// String outputs the string representation of ContigCoverage
+func (r ContigCoverage) String() string {
+	return fmt.Sprintf("%s\t%d\t%d\t%d\t%.4g\t%.3f",
+		r.Name, r.Length, r.Windows, r.Reads, r.Median, r.Ratio)
+}
+
+// NewCoverageTrack is the constructor for CoverageTrack
+func NewCoverageTrack(contigs []*ContigInfo, window int) *CoverageTrack {
+	if window < 1 {
+		window = CoverageWindow
+	}
+	counts := make([][]int32, len(contigs))
+	for i, contig := range contigs {
+		counts[i] = make([]int32, (contig.length+window-1)/window)
+	}
+	return &CoverageTrack{Window: window, contigs: contigs, counts: counts}
+}
+
+// Add counts a read starting at pos on the contig, 0-based, and drops the
+// reads past its end, which would land in its last, shorter window
+func (r *CoverageTrack) Add(contig, pos int) {
+	if pos < 0 || pos >= r.contigs[contig].length {
+		return
+	}
+	r.counts[contig][pos/r.Window]++
+}
+
+// merge adds the counts of other, a track of the same contigs and windows
+func (r *CoverageTrack) merge(other *CoverageTrack) {
+	for i, counts := range other.counts {
+		for w, n := range counts {
+			r.counts[i][w] += n
+		}
+	}
+}
+
+// density returns the reads per kb in window w of the contig, the last
+// window of a contig is usually shorter than the others
+func (r *CoverageTrack) density(contig, w int) float64 {
+	start := w * r.Window
+	end := min(start+r.Window, r.contigs[contig].length)
+	return float64(r.counts[contig][w]) * 1000 / float64(end-start)
+}
+
+// Summary computes the median coverage of each contig and its ratio to the
+// median over all windows of the assembly
+func (r *CoverageTrack) Summary() []ContigCoverage {
+	summary := make([]ContigCoverage, len(r.contigs))
+	var all []float64
+	for i, contig := range r.contigs {
+		densities := make([]float64, len(r.counts[i]))
+		reads := 0
+		for w, n := range r.counts[i] {
+			densities[w] = r.density(i, w)
+			reads += int(n)
+		}
+		all = append(all, densities...)
+		summary[i] = ContigCoverage{Name: contig.name, Length: contig.length,
+			Windows: len(densities), Reads: reads}
+		if len(densities) > 0 {
+			summary[i].Median = median(densities)
+		}
+	}
+	if len(all) == 0 {
+		return summary
+	}
+	genomeMedian := median(all)
+	if genomeMedian == 0 {
+		log.Warningf("Median coverage is zero, too few reads to compare the contigs")
+		return summary
+	}
+	for i := range summary {
+		summary[i].Ratio = summary[i].Median / genomeMedian
+	}
+	return summary
+}
+
+// writeBedGraph writes the coverage of every window, in reads per kb
+func (r *CoverageTrack) writeBedGraph(outfile string) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	r.bedGraph(w)
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Coverage in %d bp windows written to `%s`", r.Window, outfile)
+}
+
+// bedGraph writes the windows, 0-based and half-open, the last one of each
+// contig ending with it
+func (r *CoverageTrack) bedGraph(w io.Writer) {
+	for i, contig := range r.contigs {
+		for j := range r.counts[i] {
+			start := j * r.Window
+			end := min(start+r.Window, contig.length)
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%.4g\n", contig.name, start, end, r.density(i, j))
+		}
+	}
+}
+
+// writeCoverageSummary writes the per-contig coverage summary
+func writeCoverageSummary(outfile string, summary []ContigCoverage) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, CoverageHeader)
+	for _, c := range summary {
+		_, _ = fmt.Fprintln(w, c)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Contig coverage summary written to `%s`", outfile)
+}
+
+// writeRepeats writes the contigs with at least ratio times the median
+// coverage, as candidate collapsed repeats
+func writeRepeats(outfile string, summary []ContigCoverage, ratio float64) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, RepeatsHeader)
+	nRepeats, repeatsLength := 0, 0
+	for _, c := range summary {
+		if c.Ratio < ratio {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%.3f\n", c.Name, c.Ratio)
+		nRepeats++
+		repeatsLength += c.Length
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("%d candidate repeats (total length %d, coverage >= %.1fx median) written to `%s`",
+		nRepeats, repeatsLength, ratio, outfile)
+}
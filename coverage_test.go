@@ -0,0 +1,72 @@
+/*
+ *  coverage_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestCoverageSummary builds a track where one contig has three times the
+// coverage of the others
+func TestCoverageSummary(t *testing.T) {
+	contigs := []*allhic.ContigInfo{
+		allhic.NewContigInfo("a", 1, 40000),
+		allhic.NewContigInfo("b", 1, 25000),
+		allhic.NewContigInfo("repeat", 1, 20000),
+	}
+	track := allhic.NewCoverageTrack(contigs, 10000)
+	// Reads past the end of a contig are dropped, and the last window of b
+	// is half the size with the same number of reads
+	for contig, reads := range []int{10, 10, 30} {
+		for pos := 0; pos < 40000; pos += 10000 {
+			for n := 0; n < reads; n++ {
+				track.Add(contig, pos+n)
+			}
+		}
+	}
+	summary := track.Summary()
+	want := []struct {
+		windows, reads int
+		median, ratio  float64
+	}{{4, 40, 1, 1}, {3, 30, 1, 1}, {2, 60, 3, 3}}
+	for i, w := range want {
+		c := summary[i]
+		if c.Windows != w.windows || c.Reads != w.reads || c.Median != w.median || c.Ratio != w.ratio {
+			t.Errorf("contig %s: got %d windows, %d reads, median %v, ratio %v, want %v",
+				c.Name, c.Windows, c.Reads, c.Median, c.Ratio, w)
+		}
+	}
+}
+
+// TestCoverageWindowEnds counts the reads at the ends of the windows and of
+// the contigs, one of which is a multiple of the window size
+func TestCoverageWindowEnds(t *testing.T) {
+	contigs := []*allhic.ContigInfo{
+		allhic.NewContigInfo("a", 1, 25000),
+		allhic.NewContigInfo("b", 1, 20000),
+	}
+	track := allhic.NewCoverageTrack(contigs, 10000)
+	for _, pos := range []int{-1, 0, 9999, 10000, 19999, 20000, 24999, 25000, 29999} {
+		track.Add(0, pos)
+	}
+	for _, pos := range []int{0, 9999, 10000, 19999, 20000} {
+		track.Add(1, pos)
+	}
+	summary := track.Summary()
+	if summary[0].Windows != 3 || summary[0].Reads != 6 || summary[1].Windows != 2 || summary[1].Reads != 4 {
+		t.Errorf("got %+v, want 3 windows of 6 reads on a, and 2 windows of 4 reads on b", summary)
+	}
+	want := "a\t0\t10000\t0.2\na\t10000\t20000\t0.2\na\t20000\t25000\t0.4\n" +
+		"b\t0\t10000\t0.2\nb\t10000\t20000\t0.2\n"
+	if got := allhic.BedGraph(track); got != want {
+		t.Errorf("got bedGraph\n%s\nwant\n%s", got, want)
+	}
+}
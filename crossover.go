@@ -0,0 +1,248 @@
+/*
+ *  crossover.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// CrossoverOperator recombines the tigs of two parent tours of the GA into
+// two offspring, written over the parents. Both parents hold the same tigs,
+// and so does each offspring, exactly once. A tig keeps the sign it has in
+// the parent it is taken from.
+type CrossoverOperator interface {
+	// Name is the --crossover of the operator
+	Name() string
+	Cross(p1, p2 []Tig, rng *rand.Rand)
+}
+
+// NewCrossoverOperator returns the operator of name, which is CrossoverOX,
+// CrossoverPMX or CrossoverER. CrossoverNone, or no name, returns nil.
+func NewCrossoverOperator(name string) (CrossoverOperator, error) {
+	switch name {
+	case "", CrossoverNone:
+		return nil, nil
+	case CrossoverOX:
+		return orderCrossover{}, nil
+	case CrossoverPMX:
+		return pmxCrossover{}, nil
+	case CrossoverER:
+		return edgeCrossover{}, nil
+	}
+	return nil, fmt.Errorf("unknown crossover `%s`", name)
+}
+
+// tigIndex returns the position of each tig of tigs by its Idx, -1 for the
+// indices of the tigs absent
+func tigIndex(tigs []Tig) []int {
+	n := 0
+	for _, t := range tigs {
+		if t.Idx >= n {
+			n = t.Idx + 1
+		}
+	}
+	pos := make([]int, n)
+	for i := range pos {
+		pos[i] = -1
+	}
+	for i, t := range tigs {
+		pos[t.Idx] = i
+	}
+	return pos
+}
+
+// crossSegment draws the segment [a, b) that the offspring take from one
+// parent, with a < b
+func crossSegment(n int, rng *rand.Rand) (int, int) {
+	a, b := rng.Intn(n), rng.Intn(n)
+	if a > b {
+		a, b = b, a
+	}
+	return a, b + 1
+}
+
+// orderCrossover (OX) copies a segment of one parent, and fills the other
+// positions, from the end of the segment on, with the remaining tigs in the
+// order of the other parent
+type orderCrossover struct{}
+
+// Name returns CrossoverOX
+func (r orderCrossover) Name() string {
+	return CrossoverOX
+}
+
+// Cross recombines the parents over a random segment
+func (r orderCrossover) Cross(p1, p2 []Tig, rng *rand.Rand) {
+	if len(p1) < 2 {
+		return
+	}
+	a, b := crossSegment(len(p1), rng)
+	c1, c2 := orderChild(p1, p2, a, b), orderChild(p2, p1, a, b)
+	copy(p1, c1)
+	copy(p2, c2)
+}
+
+// orderChild is the OX offspring with the segment [a, b) of p1
+func orderChild(p1, p2 []Tig, a, b int) []Tig {
+	n := len(p1)
+	child := make([]Tig, n)
+	inSegment := make([]bool, len(tigIndex(p1)))
+	for i := a; i < b; i++ {
+		child[i] = p1[i]
+		inSegment[p1[i].Idx] = true
+	}
+	k := b % n
+	for i := 0; i < n; i++ {
+		t := p2[(b+i)%n]
+		if inSegment[t.Idx] {
+			continue
+		}
+		child[k] = t
+		k = (k + 1) % n
+	}
+	return child
+}
+
+// pmxCrossover (PMX) copies a segment of one parent into the other, and
+// moves the tigs displaced to where the tigs of the segment were
+type pmxCrossover struct{}
+
+// Name returns CrossoverPMX
+func (r pmxCrossover) Name() string {
+	return CrossoverPMX
+}
+
+// Cross recombines the parents over a random segment
+func (r pmxCrossover) Cross(p1, p2 []Tig, rng *rand.Rand) {
+	if len(p1) < 2 {
+		return
+	}
+	a, b := crossSegment(len(p1), rng)
+	c1, c2 := pmxChild(p1, p2, a, b), pmxChild(p2, p1, a, b)
+	copy(p1, c1)
+	copy(p2, c2)
+}
+
+// pmxChild is the PMX offspring of p2 with the segment [a, b) of p1
+func pmxChild(p1, p2 []Tig, a, b int) []Tig {
+	child := make([]Tig, len(p2))
+	copy(child, p2)
+	pos := tigIndex(child)
+	for i := a; i < b; i++ {
+		j := pos[p1[i].Idx]
+		child[i], child[j] = child[j], child[i]
+		pos[child[i].Idx], pos[child[j].Idx] = i, j
+		child[i] = p1[i]
+	}
+	return child
+}
+
+// edgeCrossover (ER) builds each offspring from the adjacencies of both
+// parents: from the first tig of a parent, it steps to the neighbor with the
+// fewest neighbors left, and to a random tig left when there is none. The
+// offspring keep most of the joins that the parents agree on, which suits
+// the ordering problems better than the position based operators.
+type edgeCrossover struct{}
+
+// Name returns CrossoverER
+func (r edgeCrossover) Name() string {
+	return CrossoverER
+}
+
+// Cross recombines the parents, the first offspring starts from the tig at
+// the start of p1 and the second from that of p2
+func (r edgeCrossover) Cross(p1, p2 []Tig, rng *rand.Rand) {
+	if len(p1) < 2 {
+		return
+	}
+	c1, c2 := edgeChild(p1, p2, rng), edgeChild(p2, p1, rng)
+	copy(p1, c1)
+	copy(p2, c2)
+}
+
+// edgeTable holds the neighbors of each tig in either parent, by Idx
+type edgeTable struct {
+	adj [][4]int
+	deg []int
+}
+
+// add joins tigs i and j, unless they are joined already
+func (r *edgeTable) add(i, j int) {
+	for _, k := range r.adj[i][:r.deg[i]] {
+		if k == j {
+			return
+		}
+	}
+	r.adj[i][r.deg[i]] = j
+	r.deg[i]++
+}
+
+// remove drops j from the neighbors of i
+func (r *edgeTable) remove(i, j int) {
+	for k := 0; k < r.deg[i]; k++ {
+		if r.adj[i][k] == j {
+			r.deg[i]--
+			r.adj[i][k] = r.adj[i][r.deg[i]]
+			return
+		}
+	}
+}
+
+// edgeChild is the ER offspring that starts from the first tig of p1, with
+// the tigs of p1
+func edgeChild(p1, p2 []Tig, rng *rand.Rand) []Tig {
+	n := len(p1)
+	pos := tigIndex(p1)
+	edges := edgeTable{adj: make([][4]int, len(pos)), deg: make([]int, len(pos))}
+	for _, p := range [][]Tig{p1, p2} {
+		for i := 1; i < n; i++ {
+			edges.add(p[i-1].Idx, p[i].Idx)
+			edges.add(p[i].Idx, p[i-1].Idx)
+		}
+	}
+	// The tigs left, by position in p1, for the random steps
+	left := make([]int, n)
+	leftAt := make([]int, n)
+	for i := range left {
+		left[i], leftAt[i] = i, i
+	}
+	child := make([]Tig, 0, n)
+	cur := p1[0].Idx
+	for {
+		child = append(child, p1[pos[cur]])
+		last := left[len(left)-1]
+		at := leftAt[pos[cur]]
+		left[at], leftAt[last] = last, at
+		left = left[:len(left)-1]
+		if len(left) == 0 {
+			return child
+		}
+		for _, k := range edges.adj[cur][:edges.deg[cur]] {
+			edges.remove(k, cur)
+		}
+		if edges.deg[cur] == 0 {
+			cur = p1[left[rng.Intn(len(left))]].Idx
+			continue
+		}
+		next, ties := -1, 0
+		for _, k := range edges.adj[cur][:edges.deg[cur]] {
+			switch {
+			case next < 0 || edges.deg[k] < edges.deg[next]:
+				next, ties = k, 1
+			case edges.deg[k] == edges.deg[next]:
+				ties++
+				if rng.Intn(ties) == 0 {
+					next = k
+				}
+			}
+		}
+		cur = next
+	}
+}
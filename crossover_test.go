@@ -0,0 +1,105 @@
+/*
+ *  crossover_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// crossParents returns two shuffles of n tigs, with gaps in their indices
+// and random signs, as the tigs of a group with inactive ones
+func crossParents(rng *rand.Rand, n int) (p1, p2 []allhic.Tig) {
+	p1 = make([]allhic.Tig, n)
+	for i := range p1 {
+		p1[i] = allhic.Tig{Idx: 3*i + rng.Intn(3), Size: 1000 + i, Sign: "+-"[rng.Intn(2)]}
+	}
+	p2 = make([]allhic.Tig, n)
+	copy(p2, p1)
+	for i := range p2 {
+		p2[i].Sign = "+-"[rng.Intn(2)]
+	}
+	rng.Shuffle(n, func(i, j int) { p1[i], p1[j] = p1[j], p1[i] })
+	rng.Shuffle(n, func(i, j int) { p2[i], p2[j] = p2[j], p2[i] })
+	return p1, p2
+}
+
+// TestCrossoverPermutation crosses random parents, and checks that each
+// offspring holds every tig of the parents exactly once, as it is in either
+// parent
+func TestCrossoverPermutation(t *testing.T) {
+	for _, name := range []string{allhic.CrossoverOX, allhic.CrossoverPMX, allhic.CrossoverER} {
+		cross, err := allhic.NewCrossoverOperator(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid := func(seed int64, size uint8) bool {
+			rng := rand.New(rand.NewSource(seed))
+			p1, p2 := crossParents(rng, int(size)+1)
+			inParents := map[allhic.Tig]bool{}
+			for i := range p1 {
+				inParents[p1[i]], inParents[p2[i]] = true, true
+			}
+			c1, c2 := append([]allhic.Tig{}, p1...), append([]allhic.Tig{}, p2...)
+			cross.Cross(c1, c2, rng)
+			for _, child := range [][]allhic.Tig{c1, c2} {
+				seen := map[int]bool{}
+				for _, tig := range child {
+					if seen[tig.Idx] || !inParents[tig] {
+						return false
+					}
+					seen[tig.Idx] = true
+				}
+				if len(seen) != len(p1) {
+					return false
+				}
+			}
+			return true
+		}
+		if err := quick.Check(valid, &quick.Config{MaxCount: 500}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestCrossoverNone keeps the built-in behaviour, and rejects the unknown
+// operators
+func TestCrossoverNone(t *testing.T) {
+	for _, name := range []string{"", allhic.CrossoverNone} {
+		if cross, err := allhic.NewCrossoverOperator(name); cross != nil || err != nil {
+			t.Errorf("%q: got %v, %v, want no operator", name, cross, err)
+		}
+	}
+	if _, err := allhic.NewCrossoverOperator("cx"); err == nil {
+		t.Error("unknown crossover cx accepted")
+	}
+}
+
+// TestOptimizeCrossover runs the GA with each operator, which labels the
+// tours and reproduces them from the seed
+func TestOptimizeCrossover(t *testing.T) {
+	for _, name := range []string{allhic.CrossoverOX, allhic.CrossoverPMX, allhic.CrossoverER} {
+		for _, joint := range []bool{false, true} {
+			opt := shortOptimizer(t, 42)
+			opt.Crossover, opt.JointOrient = name, joint
+			opt.NoPolish = true // Leave the tours of the GA as they are
+			a, b := runOptimizer(t, opt), runOptimizer(t, opt)
+			if a != b {
+				t.Errorf("%s, joint=%t: two runs with the same seed produced different tours", name, joint)
+			}
+			if want := "cxpb=0.7 crossover=" + name; !strings.Contains(a, want) {
+				t.Errorf("%s, joint=%t: tours are not labelled with %s", name, joint, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ *  decay.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// DistributionVersion is the schema_version of the distribution.json files
+const DistributionVersion = 1
+
+// DecayFit is a decay of the link density Y with the link size X, fitted by
+// least squares on log Y, as Y = Scale * X ^ Exponent for the power law and
+// Y = Scale * exp(Exponent * X) for the exponential
+type DecayFit struct {
+	Scale    float64 `json:"scale"`
+	Exponent float64 `json:"exponent"`
+	// RSquared is the goodness of fit of log Y
+	RSquared float64 `json:"r_squared"`
+}
+
+// DistributionFits are the decays fitted to the bins of the link size
+// distribution, written to prefix.distribution.json
+type DistributionFits struct {
+	SchemaVersion int `json:"schema_version"`
+	// Mode is that of extract, ModeRE or ModeOmniC
+	Mode string `json:"mode"`
+	// DistLowerBound is the shortest intra-contig link counted
+	DistLowerBound int `json:"dist_lower_bound"`
+	Bins           int `json:"bins"`
+	Links          int `json:"links"`
+	// FittedBins are the bins with links, short of the sparse tail, that
+	// the decays are fitted to
+	FittedBins  int      `json:"fitted_bins"`
+	PowerLaw    DecayFit `json:"power_law"`
+	Exponential DecayFit `json:"exponential"`
+	// Best is DecayPowerLaw or DecayExponential, whichever fits better
+	Best string `json:"best"`
+}
+
+// DecayPowerLaw and DecayExponential name the fitted decays
+const (
+	DecayPowerLaw    = "power_law"
+	DecayExponential = "exponential"
+)
+
+// fitDecays fits the power law and the exponential decays to the densities
+// Ys of the bins starting at Xs
+func (r *LinkDensityModel) fitDecays(Xs []int, Ys []float64) {
+	logXs, fXs, logYs := make([]float64, len(Xs)), make([]float64, len(Xs)), make([]float64, len(Xs))
+	for i := range Xs {
+		logXs[i], fXs[i], logYs[i] = math.Log(float64(Xs[i])), float64(Xs[i]), math.Log(Ys[i])
+	}
+	fits := &DistributionFits{SchemaVersion: DistributionVersion, Mode: r.Mode(),
+		DistLowerBound: r.DistLowerBound(), Bins: len(r.nLinks), FittedBins: len(Xs)}
+	for _, n := range r.nLinks {
+		fits.Links += n
+	}
+	fits.PowerLaw = fitLogLinear(logXs, logYs)
+	fits.Exponential = fitLogLinear(fXs, logYs)
+	fits.Best = DecayPowerLaw
+	if fits.Exponential.RSquared > fits.PowerLaw.RSquared {
+		fits.Best = DecayExponential
+	}
+	r.fits = fits
+	log.Noticef("Decay fits R^2 %.4f for the power law and %.4f for the exponential",
+		fits.PowerLaw.RSquared, fits.Exponential.RSquared)
+}
+
+// fitLogLinear fits logYs = log(Scale) + Exponent * xs by least squares,
+// zeros with fewer than two distinct xs
+func fitLogLinear(xs, logYs []float64) DecayFit {
+	n := float64(len(xs))
+	if len(xs) < 2 || xs[0] == xs[len(xs)-1] {
+		return DecayFit{}
+	}
+	sumX, sumY, sumXX, sumXY := 0.0, 0.0, 0.0, 0.0
+	for i, x := range xs {
+		sumX += x
+		sumY += logYs[i]
+		sumXX += x * x
+		sumXY += x * logYs[i]
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	ssRes, ssTot := 0.0, 0.0
+	for i, x := range xs {
+		res, dev := logYs[i]-(intercept+slope*x), logYs[i]-sumY/n
+		ssRes += res * res
+		ssTot += dev * dev
+	}
+	fit := DecayFit{Scale: math.Exp(intercept), Exponent: slope}
+	if ssTot > 0 {
+		fit.RSquared = 1 - ssRes/ssTot
+	}
+	return fit
+}
+
+// Fits returns the decays fitted by extract, nil for a distribution read
+// back from its file
+func (r *LinkDensityModel) Fits() *DistributionFits {
+	return r.fits
+}
+
+// writeDistributionTSV writes the bins of the distribution, those without
+// links included, with the observed density and that of the model, which
+// extrapolates the empty bins and the tail by the power law
+func (r *LinkDensityModel) writeDistributionTSV(outfile string) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, DistributionTSVHeader)
+	for i := range r.nLinks {
+		observed := 0.0
+		if r.binNorms[i] > 0 {
+			observed = float64(r.nLinks[i]) / float64(r.binNorms[i]) / float64(r.BinSize(i))
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%.4g\t%.4g\n",
+			r.binStarts[i], r.binStarts[i+1], r.nLinks[i], observed, r.linkDensity[i])
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Link size distribution of %d bins written to `%s`", len(r.nLinks), outfile)
+}
+
+// writeDistributionJSON writes the fitted decays
+func (r *LinkDensityModel) writeDistributionJSON(outfile string) {
+	s, err := json.MarshalIndent(r.fits, "", "\t")
+	ErrorAbort(err)
+	f := mustCreateAtomic(outfile)
+	if _, err := f.Write(append(s, '\n')); err != nil {
+		_ = f.Abort()
+		ErrorAbort(err)
+	}
+	ErrorAbort(f.Close())
+	log.Noticef("Decays fitted to the link size distribution written to `%s`", outfile)
+}
@@ -0,0 +1,133 @@
+/*
+ *  dedup.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// linkBytes is the size of a link on disk, see linkCodec
+const linkBytes = 4 + 8 + 1 + 4 + 8 + 1 + 8
+
+// seqLink is a link with its rank in the BAM files
+type seqLink struct {
+	LinkRecord
+	seq uint64
+}
+
+// linkCodec sorts the links by their contigs, positions and strands, or
+// by their rank with bySeq
+type linkCodec struct {
+	bySeq bool
+}
+
+func (c linkCodec) Encode(w *bufio.Writer, rec interface{}) error {
+	var buf [linkBytes]byte
+	r := rec.(seqLink)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(r.ContigA))
+	binary.LittleEndian.PutUint64(buf[4:], uint64(r.PosA))
+	buf[12] = r.StrandA
+	binary.LittleEndian.PutUint32(buf[13:], uint32(r.ContigB))
+	binary.LittleEndian.PutUint64(buf[17:], uint64(r.PosB))
+	buf[25] = r.StrandB
+	binary.LittleEndian.PutUint64(buf[26:], r.seq)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func (c linkCodec) Decode(r *bufio.Reader) (interface{}, error) {
+	var buf [linkBytes]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	return seqLink{
+		LinkRecord: LinkRecord{
+			ContigA: int(binary.LittleEndian.Uint32(buf[0:])),
+			PosA:    int(binary.LittleEndian.Uint64(buf[4:])),
+			StrandA: buf[12],
+			ContigB: int(binary.LittleEndian.Uint32(buf[13:])),
+			PosB:    int(binary.LittleEndian.Uint64(buf[17:])),
+			StrandB: buf[25],
+		},
+		seq: binary.LittleEndian.Uint64(buf[26:]),
+	}, nil
+}
+
+func (c linkCodec) Less(a, b interface{}) bool {
+	x, y := a.(seqLink), b.(seqLink)
+	if c.bySeq {
+		return x.seq < y.seq
+	}
+	switch {
+	case x.ContigA != y.ContigA:
+		return x.ContigA < y.ContigA
+	case x.PosA != y.PosA:
+		return x.PosA < y.PosA
+	case x.StrandA != y.StrandA:
+		return x.StrandA < y.StrandA
+	case x.ContigB != y.ContigB:
+		return x.ContigB < y.ContigB
+	case x.PosB != y.PosB:
+		return x.PosB < y.PosB
+	}
+	return x.StrandB < y.StrandB
+}
+
+func (c linkCodec) Size(rec interface{}) int {
+	return linkBytes
+}
+
+// linkDedup drops the duplicate links, of the same contigs, positions and
+// strands, within the memory budget of its sorters. The links are sorted
+// by their contigs, positions and strands to keep the first of each, which
+// are then sorted back into the order of the BAM files.
+type linkDedup struct {
+	byKey   *ExternalSorter
+	seq     uint64
+	tempDir string
+}
+
+// newLinkDedup is the constructor for linkDedup, its runs under tempDir or
+// the system default when empty
+func newLinkDedup(memLimit int64, tempDir string) *linkDedup {
+	return &linkDedup{byKey: NewExternalSorter(linkCodec{}, memLimit, tempDir), tempDir: tempDir}
+}
+
+// Add keeps a link for the dedup
+func (r *linkDedup) Add(rec LinkRecord) {
+	ErrorAbort(r.byKey.Add(seqLink{LinkRecord: rec, seq: r.seq}))
+	r.seq++
+}
+
+// Finish adds the first link of each of the same contigs, positions and
+// strands to agg, in their order, and returns the number of duplicates
+func (r *linkDedup) Finish(agg *LinkAggregator, memLimit int64) int {
+	bySeq := NewExternalSorter(linkCodec{bySeq: true}, memLimit, r.tempDir)
+	defer func() { ErrorAbort(bySeq.Close()) }()
+	defer func() { ErrorAbort(r.byKey.Close()) }()
+
+	var last seqLink
+	first, duplicates := true, 0
+	ErrorAbort(r.byKey.Each(func(rec interface{}) error {
+		link := rec.(seqLink)
+		if !first && link.LinkRecord == last.LinkRecord {
+			duplicates++
+			return nil
+		}
+		first, last = false, link
+		return bySeq.Add(link)
+	}))
+	ErrorAbort(bySeq.Each(func(rec interface{}) error {
+		agg.Add(rec.(seqLink).LinkRecord)
+		return nil
+	}))
+	return duplicates
+}
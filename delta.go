@@ -0,0 +1,125 @@
+/*
+ *  delta.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+// deltaScore is the score of a tour in the GA. The moves of Mutate only
+// change the order of the tigs between two positions p and q, so rather than
+// scoring the whole tour again, Mutate adds the change of the pairs that the
+// move may separate differently:
+//   - the pairs across either end of the segment, within LIMIT
+//   - the pairs of the tigs that the move takes out of order, e.g. the two
+//     swapped tigs, with the other tigs of the segment
+//
+// The other pairs of the segment keep their distance, and so do the pairs
+// of two tigs outside the segment as it keeps its length. A splice of the
+// tour only changes the pairs across the split.
+type deltaScore struct {
+	score float64
+	ok    bool // False until Evaluate scores the whole tour
+}
+
+// move applies a move of the tigs between positions p and q, where the tigs
+// at the positions moved are taken out of order, and updates the score
+func (r Tour) move(p, q int, moved []int, apply func()) {
+	if !r.deltaOK() {
+		apply()
+		r.invalidate()
+		return
+	}
+	movedIdx := make(map[int]bool, len(moved))
+	for _, k := range moved {
+		movedIdx[r.Tigs[k].Idx] = true
+	}
+	before := r.segmentScore(p, q, movedIdx) + r.Graph.span(r.Tigs, p-1, q)
+	apply()
+	r.delta.score += r.segmentScore(p, q, movedIdx) + r.Graph.span(r.Tigs, p-1, q) - before
+}
+
+// splice moves the first k tigs to the end of the tour, and updates the score
+func (r Tour) splice(k int) {
+	if !r.deltaOK() {
+		splice(r, k)
+		r.invalidate()
+		return
+	}
+	before := r.crossScore(k, r.midpoints()) + r.Graph.span(r.Tigs, k-1, k-1)
+	splice(r, k)
+	n := r.Len()
+	r.delta.score += r.crossScore(n-k, r.midpoints()) + r.Graph.span(r.Tigs, n-k-1, n-k-1) - before
+}
+
+// deltaOK tells if the moves can update the score kept by the tour
+func (r Tour) deltaOK() bool {
+	return r.delta != nil && r.delta.ok && r.Scorer == nil
+}
+
+// invalidate makes Evaluate score the whole tour again
+func (r Tour) invalidate() {
+	if r.delta != nil {
+		r.delta.ok = false
+	}
+}
+
+// segmentScore sums the scores of the pairs that a move between positions p
+// and q may change, as in Evaluate
+func (r Tour) segmentScore(p, q int, moved map[int]bool) float64 {
+	mid := r.midpoints()
+	score := r.crossScore(p, mid) + r.crossScore(q+1, mid)
+	// Pairs of the moved tigs within the segment, each pair once
+	tigs, M := r.Tigs, &r.M
+	for i := p; i <= q; i++ {
+		if !moved[tigs[i].Idx] {
+			continue
+		}
+		for j := p; j <= q; j++ {
+			if j == i || (moved[tigs[j].Idx] && j < i) {
+				continue
+			}
+			a, b := i, j
+			if a > b {
+				a, b = b, a
+			}
+			if dist := mid[b] - mid[a]; dist <= LIMIT {
+				score -= M.links(tigs[a].Idx, tigs[b].Idx) / dist
+			}
+		}
+	}
+	return score
+}
+
+// crossScore sums the scores of the pairs of tigs at positions i < k <= j,
+// within LIMIT, as in Evaluate
+func (r Tour) crossScore(k int, mid []float64) float64 {
+	tigs, M := r.Tigs, &r.M
+	score := 0.0
+	if k <= 0 || k >= len(tigs) {
+		return score
+	}
+	for j := k; j < len(tigs) && mid[j]-mid[k-1] <= LIMIT; j++ {
+		for i := k - 1; i >= 0 && mid[j]-mid[i] <= LIMIT; i-- {
+			score -= M.links(tigs[i].Idx, tigs[j].Idx) / (mid[j] - mid[i])
+		}
+	}
+	return score
+}
+
+// links returns the links, or the weighted links, at row i, column j
+func (m *Matrix) links(i, j int) float64 {
+	if m.W == nil && !m.Sparse() {
+		return float64(m.Data[i*m.N+j])
+	}
+	k := m.index(i, j)
+	switch {
+	case k < 0:
+		return 0
+	case m.W != nil:
+		return m.W[k]
+	}
+	return float64(m.Vals[k])
+}
@@ -0,0 +1,144 @@
+/*
+ *  diversity.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// diversity watches the spread of the tours of each population of the GA.
+// Once a population stays under the threshold for stall generations in a
+// row, its worst tours are replaced by shuffled ones, so that it can leave
+// the plateau where it collapsed.
+type diversity struct {
+	threshold float64
+	stall     int
+	fraction  float64
+	below     []int // Generations in a row under the threshold, by population
+}
+
+// newDiversity is the constructor for diversity
+func newDiversity(threshold float64, stall int, fraction float64) *diversity {
+	return &diversity{threshold: threshold, stall: stall, fraction: fraction}
+}
+
+// update measures the populations of the GA in phase after a generation,
+// and injects shuffled tours into the stagnant ones
+func (r *diversity) update(ga *eaopt.GA, phase int) {
+	if r == nil {
+		return
+	}
+	if r.below == nil {
+		r.below = make([]int, len(ga.Populations))
+	}
+	for i := range ga.Populations {
+		pop := &ga.Populations[i]
+		d := populationDiversity(pop.Individuals)
+		if d >= r.threshold {
+			r.below[i] = 0
+			continue
+		}
+		if r.below[i]++; r.below[i] < r.stall {
+			continue
+		}
+		r.below[i] = 0
+		n := r.inject(pop)
+		log.Noticef("GA%d-%d: diversity %.4f of population %d under %g for %d generations, %d of %d worst tours shuffled",
+			phase, ga.Generations, d, i+1, r.threshold, r.stall, n, len(pop.Individuals))
+	}
+}
+
+// inject replaces the worst tours of the population, which is sorted best
+// first, by shuffled ones, and returns how many
+func (r *diversity) inject(pop *eaopt.Population) int {
+	indis := pop.Individuals
+	n := int(math.Round(r.fraction * float64(len(indis))))
+	for i := len(indis) - n; i < len(indis); i++ {
+		c := indis[i].Genome.(Tour).Clone().(Tour)
+		c.Shuffle(pop.RNG)
+		c.Pins.repair(c.Tigs)
+		c.invalidate()
+		indis[i] = eaopt.NewIndividual(c, pop.RNG)
+		_ = indis[i].Evaluate()
+	}
+	indis.SortByFitness()
+	return n
+}
+
+// populationDiversity is the mean Kendall tau distance between the tours of
+// a sample of the population, see kendallDistance. The sample is spread
+// evenly over the population, best to worst.
+func populationDiversity(indis eaopt.Individuals) float64 {
+	n := len(indis)
+	if n > DiversitySample {
+		n = DiversitySample
+	}
+	if n < 2 {
+		return 0
+	}
+	sample := make([]Tour, n)
+	for i := range sample {
+		sample[i] = indis[i*(len(indis)-1)/(n-1)].Genome.(Tour)
+	}
+	sum := 0.0
+	for i := range sample {
+		for j := i + 1; j < n; j++ {
+			sum += kendallDistance(sample[i], sample[j])
+		}
+	}
+	return sum / float64(n*(n-1)/2)
+}
+
+// kendallDistance is the fraction of the pairs of tigs in a different order
+// in the two tours, which hold the same tigs. A tour being the same as its
+// reverse, the distance goes from 0 for the same orders to 1 for random ones.
+func kendallDistance(a, b Tour) float64 {
+	n := a.Len()
+	if n < 2 {
+		return 0
+	}
+	pos := make(map[int]int, n)
+	for i, tig := range a.Tigs {
+		pos[tig.Idx] = i
+	}
+	seq := make([]int, n)
+	for i, tig := range b.Tigs {
+		seq[i] = pos[tig.Idx]
+	}
+	d := float64(inversions(seq, make([]int, n))) / float64(n*(n-1)/2)
+	return 2 * math.Min(d, 1-d)
+}
+
+// inversions counts the pairs out of order in seq by merge sort, which
+// sorts seq, with buf as large as seq
+func inversions(seq, buf []int) int {
+	if len(seq) < 2 {
+		return 0
+	}
+	m := len(seq) / 2
+	count := inversions(seq[:m], buf[:m]) + inversions(seq[m:], buf[m:])
+	merged := buf[:0]
+	i, j := 0, m
+	for i < m && j < len(seq) {
+		if seq[i] <= seq[j] {
+			merged = append(merged, seq[i])
+			i++
+		} else {
+			merged = append(merged, seq[j])
+			count += m - i
+			j++
+		}
+	}
+	merged = append(merged, seq[i:m]...)
+	merged = append(merged, seq[j:]...)
+	copy(seq, merged)
+	return count
+}
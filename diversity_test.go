@@ -0,0 +1,94 @@
+/*
+ *  diversity_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestKendallDistance(t *testing.T) {
+	tour := func(idxs ...int) allhic.Tour {
+		tigs := make([]allhic.Tig, len(idxs))
+		for i, idx := range idxs {
+			tigs[i] = allhic.Tig{Idx: idx}
+		}
+		return allhic.Tour{Tigs: tigs}
+	}
+	a := tour(0, 1, 2, 3, 4, 5)
+	for _, tt := range []struct {
+		b    allhic.Tour
+		want float64
+	}{
+		{tour(0, 1, 2, 3, 4, 5), 0},
+		{tour(5, 4, 3, 2, 1, 0), 0},
+		{tour(1, 0, 2, 3, 4, 5), 2.0 / 15},
+		{tour(4, 5, 3, 2, 1, 0), 2.0 / 15},
+		{tour(3, 4, 5, 0, 1, 2), 0.8},
+	} {
+		if got := allhic.KendallDistance(a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("distance to %v: got %g, want %g", tt.b.Tigs, got, tt.want)
+		}
+	}
+}
+
+// trapScorer is a rigged landscape, where the tours score by how many tigs
+// are in their place in the decoy order, except near the target order, far
+// from the decoy, which scores much better than any. The GA climbs to the
+// decoy and collapses there.
+type trapScorer struct {
+	decoy, target []int
+}
+
+func (r trapScorer) Name() string {
+	return "trap"
+}
+
+func (r trapScorer) Score(tour allhic.Tour) float64 {
+	n := tour.Len()
+	forward, backward, decoy := 0, 0, 0
+	for i, tig := range tour.Tigs {
+		if tig.Idx == r.target[i] {
+			forward++
+		}
+		if tig.Idx == r.target[n-1-i] {
+			backward++
+		}
+		if tig.Idx == r.decoy[i] {
+			decoy++
+		}
+	}
+	if target := math.Max(float64(forward), float64(backward)); target >= float64(n-2) {
+		return -100 - target
+	}
+	return -float64(decoy)
+}
+
+// TestOptimizeInject runs the GA on the trap, where it stays on the decoy
+// plateau, unless the shuffled tours injected into the collapsed population
+// find the target
+func TestOptimizeInject(t *testing.T) {
+	idsfile, clmfile := writeSyntheticCLM(t.TempDir(), 6, 2, 10)
+	trap := trapScorer{decoy: []int{0, 1, 2, 3, 4, 5}, target: []int{1, 3, 5, 0, 2, 4}}
+	for _, inject := range []bool{false, true} {
+		clm := mustNewCLM(t, clmfile, idsfile)
+		clm.Stdout = ioutil.Discard
+		clm.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+		opt := allhic.Optimizer{Seed: 42, NPop: 20, NGen: 500, MutProb: allhic.MutaProb,
+			Inject: inject, InjectStall: 5, DiversityThreshold: 0.3}
+		tour := opt.RunGAPhase(clm, trap, 0)
+		score := trap.Score(tour)
+		if found := score == -106; found != inject {
+			t.Errorf("inject %t: found the target %t, want %t, best score %g", inject, found, inject, score)
+		}
+	}
+}
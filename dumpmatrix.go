@@ -0,0 +1,163 @@
+/*
+ *  dumpmatrix.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Formats of WriteM
+const (
+	MatrixTSV = "tsv"
+	MatrixNpy = "npy"
+)
+
+// MatrixDumper writes the contact matrix of a group as the optimizer sees
+// it, after the contig pair and contig filters of optimize
+type MatrixDumper struct {
+	REfile  string
+	Clmfile string
+	Outfile string
+	// Format is MatrixTSV or MatrixNpy, empty picks it from Outfile
+	Format string
+	// MinLinks, MinContigSize and DensityLowerBound are as in optimize
+	MinLinks          int
+	MinContigSize     int
+	DensityLowerBound float64
+}
+
+// Run is the main function body of dumpmatrix
+func (r *MatrixDumper) Run() {
+	format := r.Format
+	if format == "" {
+		format = matrixFormat(r.Outfile)
+	}
+	clm, err := NewCLMWithOptions(r.Clmfile, r.REfile, CLMOptions{MinLinks: r.MinLinks})
+	ErrorAbort(err)
+	clm.MinContigSize = r.MinContigSize
+	clm.DensityLowerBound = r.DensityLowerBound
+	clm.pruneActive()
+	clm.reportActive(true)
+	ErrorAbort(clm.WriteM(r.Outfile, format))
+	log.Notice("Success")
+}
+
+// matrixFormat guesses the format of WriteM from the extension of filename
+func matrixFormat(filename string) string {
+	if path.Ext(filename) == ".npy" {
+		return MatrixNpy
+	}
+	return MatrixTSV
+}
+
+// WriteM writes the contact matrix M between the active tigs to filename.
+// MatrixTSV has the tig names along the first row and column, and is gzip
+// compressed if filename ends with .gz. MatrixNpy is a numpy array of int32,
+// with the tig names written one per line to filename.names next to it.
+func (r *CLM) WriteM(filename, format string) error {
+	active := r.activeIdxs()
+	M := r.M()
+	switch format {
+	case MatrixTSV:
+		r.writeMatrix(filename, active, M.At)
+	case MatrixNpy:
+		r.writeNpy(filename, active, M.At)
+		r.writeNames(filename+".names", active)
+	default:
+		return fmt.Errorf("unknown matrix format `%s`, expect %s or %s",
+			format, MatrixTSV, MatrixNpy)
+	}
+	return nil
+}
+
+// activeIdxs returns the indices of the active tigs, in the order of Tigs
+func (r *CLM) activeIdxs() []int {
+	var active []int
+	for i, tig := range r.Tigs {
+		if tig.IsActive {
+			active = append(active, i)
+		}
+	}
+	return active
+}
+
+// writeMatrix writes the cells at(i, j) between the tigs in idxs as TSV,
+// gzip compressed if filename ends with .gz
+func (r *CLM) writeMatrix(filename string, idxs []int, at func(i, j int) int) {
+	f := mustCreateAtomic(filename)
+	var out io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(filename, ".gz") {
+		gz = gzip.NewWriter(f)
+		out = gz
+	}
+	w := bufio.NewWriter(out)
+	_, _ = w.WriteString("#Contig")
+	for _, i := range idxs {
+		_, _ = fmt.Fprintf(w, "\t%s", r.Tigs[i].Name)
+	}
+	_, _ = w.WriteString("\n")
+	for _, i := range idxs {
+		_, _ = w.WriteString(r.Tigs[i].Name)
+		for _, j := range idxs {
+			_, _ = fmt.Fprintf(w, "\t%d", at(i, j))
+		}
+		_, _ = w.WriteString("\n")
+	}
+	ErrorAbort(w.Flush())
+	if gz != nil {
+		ErrorAbort(gz.Close())
+	}
+	ErrorAbort(f.Close())
+	log.Noticef("Matrix of %d active tigs written to `%s`", len(idxs), filename)
+}
+
+// writeNpy writes the cells at(i, j) between the tigs in idxs as a numpy
+// .npy file (format version 1.0) of little-endian int32 in row-major order
+func (r *CLM) writeNpy(filename string, idxs []int, at func(i, j int) int) {
+	N := len(idxs)
+	header := fmt.Sprintf("{'descr': '<i4', 'fortran_order': False, 'shape': (%d, %d), }", N, N)
+	// The magic, version and header length take 10 bytes, and the header
+	// is padded with spaces to end on a multiple of 64 with a newline
+	padding := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", padding%64) + "\n"
+
+	f := mustCreateAtomic(filename)
+	w := bufio.NewWriter(f)
+	_, _ = w.WriteString("\x93NUMPY\x01\x00")
+	ErrorAbort(binary.Write(w, binary.LittleEndian, uint16(len(header))))
+	_, _ = w.WriteString(header)
+	row := make([]int32, N)
+	for _, i := range idxs {
+		for k, j := range idxs {
+			row[k] = int32(at(i, j))
+		}
+		ErrorAbort(binary.Write(w, binary.LittleEndian, row))
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Matrix of %d active tigs written to `%s`", N, filename)
+}
+
+// writeNames writes the names of the tigs in idxs, one per line
+func (r *CLM) writeNames(filename string, idxs []int) {
+	f := mustCreateAtomic(filename)
+	w := bufio.NewWriter(f)
+	for _, i := range idxs {
+		_, _ = fmt.Fprintln(w, r.Tigs[i].Name)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+}
@@ -0,0 +1,107 @@
+/*
+ *  dumpmatrix_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeDumpFiles writes three contigs, where (t0, t2) has a single link
+func writeDumpFiles(t *testing.T) {
+	writeFiles(t, map[string]string{
+		"test.ids": "t0\t10\t50000\nt1\t10\t60000\nt2\t10\t70000\nt3\t10\t2000\n",
+		"test.clm": "t0+ t1-\t2\t1000 2000\nt1+ t2+\t3\t1000 2000 3000\nt0+ t2+\t1\t4000\nt2+ t3+\t2\t10 20\n",
+	})
+}
+
+// TestDumpMatrixTSV checks that the pairs under --minLinks and the tigs
+// under --minSize are not in the matrix
+func TestDumpMatrixTSV(t *testing.T) {
+	inTempDir(t, func() {
+		writeDumpFiles(t)
+		want := "#Contig\tt0\tt1\tt2\nt0\t0\t2\t0\nt1\t2\t0\t3\nt2\t0\t3\t0\n"
+		for _, outfile := range []string{"out.tsv", "out.tsv.gz"} {
+			p := allhic.MatrixDumper{REfile: "test.ids", Clmfile: "test.clm",
+				Outfile: outfile, MinLinks: 2, MinContigSize: 10000}
+			p.Run()
+			s, err := ioutil.ReadFile(outfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(outfile, ".gz") {
+				gz, err := gzip.NewReader(bytes.NewReader(s))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s, err = ioutil.ReadAll(gz); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(s) != want {
+				t.Errorf("%s: got %q, want %q", outfile, s, want)
+			}
+		}
+	})
+}
+
+func TestDumpMatrixNpy(t *testing.T) {
+	inTempDir(t, func() {
+		writeDumpFiles(t)
+		r := mustNewCLM(t, "test.clm", "test.ids")
+		if err := r.WriteM("out.npy", allhic.MatrixNpy); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile("out.npy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(s, []byte("\x93NUMPY\x01\x00")) {
+			t.Fatalf("missing the npy magic: %q", s[:8])
+		}
+		headerLen := int(binary.LittleEndian.Uint16(s[8:10]))
+		if (10+headerLen)%64 != 0 {
+			t.Errorf("header ends at %d, not a multiple of 64", 10+headerLen)
+		}
+		header := string(s[10 : 10+headerLen])
+		if !strings.Contains(header, "'shape': (4, 4)") || !strings.HasSuffix(header, "\n") {
+			t.Errorf("unexpected header %q", header)
+		}
+		data := make([]int32, 16)
+		if err := binary.Read(bytes.NewReader(s[10+headerLen:]), binary.LittleEndian, data); err != nil {
+			t.Fatal(err)
+		}
+		want := []int32{0, 2, 1, 0, 2, 0, 3, 0, 1, 3, 0, 2, 0, 0, 2, 0}
+		if !reflect.DeepEqual(data, want) {
+			t.Errorf("got matrix %v, want %v", data, want)
+		}
+		names, err := ioutil.ReadFile("out.npy.names")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(names) != "t0\nt1\nt2\nt3\n" {
+			t.Errorf("got names %q", names)
+		}
+
+		if err := r.WriteM("out.txt", "csv"); err == nil {
+			t.Error("expected an error for an unknown format")
+		}
+		if _, err := os.Stat("out.txt"); !os.IsNotExist(err) {
+			t.Error("out.txt written for an unknown format")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+/*
+ *  evalpool.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// evalScratch holds the buffers that scoring a tour needs, so that a worker
+// reuses them from one tour to the next
+type evalScratch struct {
+	mid []float64
+	pos []int32 // Position in the tour of each tig of M, -1 when absent
+}
+
+// midpoints is Tour.midpoints into the buffer of s
+func (s *evalScratch) midpoints(tour Tour) []float64 {
+	if cap(s.mid) < tour.Len() {
+		s.mid = make([]float64, tour.Len())
+	}
+	mid := s.mid[:tour.Len()]
+	cumSum := 0.0
+	for i, t := range tour.Tigs {
+		tsize := float64(t.Size)
+		mid[i] = cumSum + tsize/2
+		cumSum += tsize
+	}
+	return mid
+}
+
+// positions returns the position of each tig of M in the tour, until
+// clearPositions
+func (s *evalScratch) positions(tour Tour) []int32 {
+	if len(s.pos) != tour.M.N {
+		s.pos = make([]int32, tour.M.N)
+		for i := range s.pos {
+			s.pos[i] = -1
+		}
+	}
+	for i, t := range tour.Tigs {
+		s.pos[t.Idx] = int32(i)
+	}
+	return s.pos
+}
+
+// clearPositions resets the positions of the tigs of the tour
+func (s *evalScratch) clearPositions(tour Tour) {
+	for _, t := range tour.Tigs {
+		s.pos[t.Idx] = -1
+	}
+}
+
+// evalPool scores the tours of the GA populations with a pool of workers,
+// each with its own buffers. The islands of the GA share the workers, which
+// take the buffers in turn.
+type evalPool struct {
+	scratch chan *evalScratch
+}
+
+// newEvalPool is the constructor for evalPool, 0 threads uses all CPUs
+func newEvalPool(threads int) *evalPool {
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+	r := &evalPool{scratch: make(chan *evalScratch, threads)}
+	for i := 0; i < threads; i++ {
+		r.scratch <- new(evalScratch)
+	}
+	return r
+}
+
+// evaluate scores the individuals that are not evaluated yet. Each fitness
+// is written in place, so the population keeps its order, and the selection
+// that follows does not depend on the number of workers.
+func (r *evalPool) evaluate(indis eaopt.Individuals) {
+	indices := make(chan int, len(indis))
+	for i := range indis {
+		if !indis[i].Evaluated {
+			indices <- i
+		}
+	}
+	close(indices)
+	var wg sync.WaitGroup
+	for k := 0; k < cap(r.scratch); k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := <-r.scratch
+			defer func() { r.scratch <- s }()
+			for i := range indices {
+				indis[i].Fitness = indis[i].Genome.(Tour).evaluateWith(s)
+				indis[i].Evaluated = true
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// parallelModel applies the evolution model, and then scores the offsprings
+// with the pool rather than leave it to eaopt. The elite best tours of the
+// population carry over to the next generation, in place of the last
+// offsprings.
+type parallelModel struct {
+	eaopt.Model
+	pool  *evalPool
+	elite int
+}
+
+// Apply evolves the population and scores it. The population is sorted by
+// fitness after each generation, and the elites are clones, which the
+// moves of the offsprings cannot change.
+func (r parallelModel) Apply(pop *eaopt.Population) error {
+	var elites eaopt.Individuals
+	if r.elite > 0 {
+		elites = pop.Individuals[:r.elite].Clone(pop.RNG)
+	}
+	if err := r.Model.Apply(pop); err != nil {
+		return err
+	}
+	copy(pop.Individuals[len(pop.Individuals)-len(elites):], elites)
+	r.pool.evaluate(pop.Individuals)
+	return nil
+}
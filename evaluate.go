@@ -49,17 +49,17 @@ func (r Tour) Swap(i, j int) {
 
 // Slice method from Slice
 func (r Tour) Slice(a, b int) eaopt.Slice {
-	return Tour{r.Tigs[a:b], r.M}
+	return Tour{Tigs: r.Tigs[a:b], M: r.M, Scorer: r.Scorer}
 }
 
 // Split method from Slice
 func (r Tour) Split(k int) (eaopt.Slice, eaopt.Slice) {
-	return Tour{r.Tigs[:k], r.M}, Tour{r.Tigs[k:], r.M}
+	return Tour{Tigs: r.Tigs[:k], M: r.M, Scorer: r.Scorer}, Tour{Tigs: r.Tigs[k:], M: r.M, Scorer: r.Scorer}
 }
 
 // Append method from Slice
 func (r Tour) Append(q eaopt.Slice) eaopt.Slice {
-	return Tour{append(r.Tigs, q.(Tour).Tigs...), r.M}
+	return Tour{Tigs: append(r.Tigs, q.(Tour).Tigs...), M: r.M, Scorer: r.Scorer}
 }
 
 // Replace method from Slice
@@ -73,73 +73,194 @@ func (r Tour) Copy() eaopt.Slice {
 	clone.Tigs = make([]Tig, r.Len())
 	copy(clone.Tigs, r.Tigs)
 	clone.M = r.M
+	clone.Scorer = r.Scorer
+	clone.Cross = r.Cross
+	clone.Moves = r.Moves
+	clone.Pins = r.Pins
+	clone.Graph = r.Graph
 	return clone
 }
 
+// Scorer scores the ordering of a tour in place of Evaluate, the lower the
+// better. Scorers are shared by the tours evaluated in parallel by the GA.
+type Scorer interface {
+	// Name labels the scores in the logs, since the scores of different
+	// scorers are not comparable
+	Name() string
+	Score(tour Tour) float64
+}
+
+// ScoreName returns the name of the score that Evaluate computes
+func (r Tour) ScoreName() string {
+	switch {
+	case r.Scorer != nil:
+		return r.Scorer.Name()
+	case r.M.W != nil:
+		return ScoreEndWeighted
+	}
+	return ScoreDefault
+}
+
 // EvaluateSumLog calculates a score for the current tour
 func (r Tour) EvaluateSumLog() (float64, error) {
 	//func (r Tour) Evaluate() (float64, error) {
-	size := r.Len()
-	mid := make([]float64, size)
-	cumSum := 0.0
-	for i, t := range r.Tigs {
-		tsize := float64(t.Size)
-		mid[i] = cumSum + tsize/2
-		cumSum += tsize
+	mid := r.midpoints()
+	if r.M.Sparse() {
+		return r.evaluateSparse(mid, new(evalScratch), func(k int, d float64) float64 {
+			return -float64(r.M.Vals[k]) * (math.Log(d) - LimitLog)
+		}), nil
 	}
+	size := r.Len()
 
 	score := 0.0
-	// Now add up all the pairwise scores
+	// Now add up all the pairwise scores, walking the flat row of tig i. The
+	// window of tigs within LIMIT of tig i only ever moves right.
+	//
+	// Limiting the window serves two purposes:
+	// 1. Break earlier reduces the amount of calculation
+	// 2. Ignore distant links so that telomeric regions don't come
+	//    to be adjacent (based on Ler0 data)
+	end := 0
 	for i := 0; i < size; i++ {
-		a := r.Tigs[i].Idx
-		for j := i + 1; j < size; j++ {
-			b := r.Tigs[j].Idx
-			nlinks := r.M[a][b]
-			dist := mid[j] - mid[i]
-			// This serves two purposes:
-			// 1. Break earlier reduces the amount of calculation
-			// 2. Ignore distant links so that telomeric regions don't come
-			//    to be adjacent (based on Ler0 data)
-			if dist > LIMIT {
-				break
-			}
+		row := r.M.Row(r.Tigs[i].Idx)
+		midi := mid[i]
+		if end <= i {
+			end = i + 1
+		}
+		for end < size && mid[end]-midi <= LIMIT {
+			end++
+		}
+		for j, t := range r.Tigs[i+1 : end] {
 			// eaopt only looks at minimum =>
 			// everytime we have a small dist, we reduce the total score
 			// we are looking at the largest reductions from all links
-			score += float64(nlinks) * (math.Log(dist) - LimitLog)
+			score += float64(row[t.Idx]) * (math.Log(mid[i+1+j]-midi) - LimitLog)
 		}
 	}
 	return score, nil
 }
 
-// Evaluate calculates a score for the current tour
+// Evaluate calculates a score for the current tour. The tours of the GA keep
+// their score, which Mutate updates, see deltaScore.
 func (r Tour) Evaluate() (float64, error) {
+	return r.evaluateWith(new(evalScratch)), nil
+}
+
+// evaluateWith is Evaluate with the buffers of s
+func (r Tour) evaluateWith(s *evalScratch) float64 {
+	if r.delta == nil {
+		return r.score(s)
+	}
+	if !r.delta.ok {
+		r.delta.score, r.delta.ok = r.score(s), true
+	}
+	return r.delta.score
+}
+
+// evaluate scores the whole tour
+func (r Tour) evaluate() float64 {
+	return r.score(new(evalScratch))
+}
+
+// score scores the whole tour with the buffers of s
+func (r Tour) score(s *evalScratch) float64 {
+	return r.linkScore(s) + r.Graph.score(r, s)
+}
+
+// linkScore scores the links of the whole tour with the buffers of s
+func (r Tour) linkScore(s *evalScratch) float64 {
 	//func (r Tour) EvaluateSumRecip() (float64, error) {
+	if r.Scorer != nil {
+		return r.Scorer.Score(r)
+	}
+	mid := s.midpoints(r)
+	if r.M.Sparse() {
+		if r.M.W != nil {
+			return r.evaluateSparse(mid, s, func(k int, d float64) float64 { return r.M.W[k] / d })
+		}
+		return r.evaluateSparse(mid, s, func(k int, d float64) float64 { return float64(r.M.Vals[k]) / d })
+	}
+	if r.M.W != nil {
+		return r.evaluateWeighted(mid)
+	}
+	size := r.Len()
+
+	score := 0.0
+	// Now add up all the pairwise scores, walking the flat row of tig i. The
+	// window of tigs within LIMIT of tig i only ever moves right.
+	end := 0
+	for i := 0; i < size; i++ {
+		row := r.M.Row(r.Tigs[i].Idx)
+		midi := mid[i]
+		if end <= i {
+			end = i + 1
+		}
+		for end < size && mid[end]-midi <= LIMIT {
+			end++
+		}
+		for j, t := range r.Tigs[i+1 : end] {
+			// We are looking for maximum
+			score -= float64(row[t.Idx]) / (mid[i+1+j] - midi)
+		}
+	}
+	return score
+}
+
+// evaluateWeighted is Evaluate over the weighted links of the matrix
+func (r Tour) evaluateWeighted(mid []float64) float64 {
 	size := r.Len()
-	mid := make([]float64, size)
+
+	score := 0.0
+	end := 0
+	for i := 0; i < size; i++ {
+		row := r.M.WeightedRow(r.Tigs[i].Idx)
+		midi := mid[i]
+		if end <= i {
+			end = i + 1
+		}
+		for end < size && mid[end]-midi <= LIMIT {
+			end++
+		}
+		for j, t := range r.Tigs[i+1 : end] {
+			score -= row[t.Idx] / (mid[i+1+j] - midi)
+		}
+	}
+	return score
+}
+
+// midpoints returns the position of the middle of each tig along the tour
+func (r Tour) midpoints() []float64 {
+	mid := make([]float64, r.Len())
 	cumSum := 0.0
 	for i, t := range r.Tigs {
 		tsize := float64(t.Size)
 		mid[i] = cumSum + tsize/2
 		cumSum += tsize
 	}
+	return mid
+}
+
+// evaluateSparse subtracts gain(k, dist) for the cell k of every pair of
+// tigs within LIMIT, visiting only the cells stored in a sparse matrix
+// rather than every tig in the window
+func (r Tour) evaluateSparse(mid []float64, s *evalScratch, gain func(k int, dist float64) float64) float64 {
+	pos := s.positions(r)
+	defer s.clearPositions(r)
 
 	score := 0.0
-	// Now add up all the pairwise scores
-	for i := 0; i < size; i++ {
-		a := r.Tigs[i].Idx
-		for j := i + 1; j < size; j++ {
-			b := r.Tigs[j].Idx
-			nlinks := r.M[a][b]
-			dist := mid[j] - mid[i]
-			if dist > LIMIT {
-				break
+	for i, t := range r.Tigs {
+		midi := mid[i]
+		for k := r.M.RowStart[t.Idx]; k < r.M.RowStart[t.Idx+1]; k++ {
+			j := int(pos[r.M.Cols[k]])
+			if j <= i {
+				continue
+			}
+			if dist := mid[j] - midi; dist <= LIMIT {
+				score -= gain(k, dist)
 			}
-			// We are looking for maximum
-			score -= float64(nlinks) / dist
 		}
 	}
-	return score, nil
+	return score
 }
 
 // randomTwoInts is a faster version than randomInts above
@@ -155,29 +276,33 @@ func randomTwoInts(genome eaopt.Slice, rng *rand.Rand) (int, int) {
 
 // MutInversion applies inversion operation on the genome
 func MutInversion(genome eaopt.Slice, rng *rand.Rand) {
-	// log.Debugf("Before MutInversion: %v", genome)
 	// Choose two points on the genome
 	p, q := randomTwoInts(genome, rng)
-	if p == q {
-		return
-	}
+	invert(genome, p, q)
+}
+
+// invert reverses the genome between p and q
+func invert(genome eaopt.Slice, p, q int) {
 	// Swap within range
 	for i, j := p, q; i < j; i, j = i+1, j-1 {
 		genome.Swap(i, j)
 	}
-	// log.Debugf("After MutInversion: %v", genome)
 }
 
 // MutInsertion applies insertion operation on the genome
 func MutInsertion(genome eaopt.Slice, rng *rand.Rand) {
-	// log.Debugf("Before MutInsertion: %v", genome)
 	// Choose two points on the genome
 	p, q := randomTwoInts(genome, rng)
 	if p == q {
 		return
 	}
+	insert(genome, p, q, rng.Float64() < .5)
+}
 
-	if rng.Float64() < .5 {
+// insert moves the gene at q to p when toFront, and otherwise the gene at p
+// to q, shifting the genes between
+func insert(genome eaopt.Slice, p, q int, toFront bool) {
+	if toFront {
 		cq := genome.At(q) // Pop q and insert to p position
 		// Move cq to the front and push everyone right
 		for i := q; i > p; i-- {
@@ -192,8 +317,23 @@ func MutInsertion(genome eaopt.Slice, rng *rand.Rand) {
 		}
 		genome.Set(q, cp)
 	}
+}
+
+// MutTranslocation cuts a block of the genome and inserts it further along
+func MutTranslocation(genome eaopt.Slice, rng *rand.Rand) {
+	// Choose two points on the genome
+	p, q := randomTwoInts(genome, rng)
+	if p == q {
+		return
+	}
+	translocate(genome, p, p+1+rng.Intn(q-p), q)
+}
 
-	// log.Debugf("After MutInsertion: %v", genome)
+// translocate moves the genes from p up to k after the gene at q
+func translocate(genome eaopt.Slice, p, k, q int) {
+	invert(genome, p, k-1)
+	invert(genome, k, q)
+	invert(genome, p, q)
 }
 
 // MutPermute permutes two genes at random n times
@@ -210,37 +350,120 @@ func MutPermute(genome eaopt.Slice, rng *rand.Rand) {
 // MutSplice splits a genome in 2 and glues the pieces back together in reverse
 // order
 func MutSplice(genome eaopt.Slice, rng *rand.Rand) {
-	var (
-		k    = rng.Intn(genome.Len()-1) + 1
-		a, b = genome.Split(k)
-	)
+	splice(genome, rng.Intn(genome.Len()-1)+1)
+}
+
+// splice moves the first k genes to the end of the genome
+func splice(genome eaopt.Slice, k int) {
+	a, b := genome.Split(k)
 	genome.Replace(b.Append(a))
 }
 
-// Mutate a Tour by applying by inversion or insertion
+// Mutate a Tour by a move picked by the weights of the tour, see MutWeights.
+// The moves draw from rng as MutPermute, MutSplice, MutInsertion,
+// MutInversion and MutTranslocation do, and update the score kept by the
+// tour, see deltaScore. With JointScorer, a move may also flip one tig, and
+// an inversion flips the tigs it turns around.
 func (r Tour) Mutate(rng *rand.Rand) {
-	rd := rng.Float64()
-	if rd < 0.2 {
-		MutPermute(r, rng)
-	} else if rd < .4 {
-		MutSplice(r, rng)
-	} else if rd < .7 {
-		MutInsertion(r, rng)
-	} else {
-		MutInversion(r, rng)
+	r.counts.mutated()
+	joint := r.jointOrient()
+	if joint && rng.Float64() < JointFlipProb {
+		k := rng.Intn(r.Len())
+		r.flipSigns(k, k)
+		r.invalidate()
+		return
+	}
+	weights := r.Moves
+	if weights == nil {
+		weights = &defaultMutWeights
+	}
+	switch weights.pick(rng.Float64()) {
+	case mutSwap:
+		if r.Len() <= 1 {
+			return
+		}
+		p, q := randomTwoInts(r, rng)
+		r.move(p, q, []int{p, q}, func() { r.Swap(p, q) })
+	case mutSplice:
+		if r.Len() <= 1 {
+			return
+		}
+		r.splice(rng.Intn(r.Len()-1) + 1)
+	case mutInsert:
+		p, q := randomTwoInts(r, rng)
+		if p == q {
+			return
+		}
+		toFront := rng.Float64() < .5
+		moved := p
+		if toFront {
+			moved = q
+		}
+		r.move(p, q, []int{moved}, func() { insert(r, p, q, toFront) })
+	case mutReverse:
+		p, q := randomTwoInts(r, rng)
+		r.move(p, q, nil, func() {
+			invert(r, p, q)
+			if joint {
+				r.flipSigns(p, q) // As the segment is turned around
+			}
+		})
+	case mutTranslocate:
+		p, q := randomTwoInts(r, rng)
+		if p == q {
+			return
+		}
+		k := p + 1 + rng.Intn(q-p)
+		// The smaller part of the segment is taken out of order
+		moved := make([]int, 0, q-p)
+		if k-p <= q+1-k {
+			for i := p; i < k; i++ {
+				moved = append(moved, i)
+			}
+		} else {
+			for i := k; i <= q; i++ {
+				moved = append(moved, i)
+			}
+		}
+		r.move(p, q, moved, func() { translocate(r, p, k, q) })
+	}
+	if r.Pins.repair(r.Tigs) {
+		r.invalidate()
 	}
 }
 
-// Crossover a Tour with another Tour by using Partially Mixed Crossover (PMX).
-func (r Tour) Crossover(_ eaopt.Genome, _ *rand.Rand) {
+// Crossover a Tour with another Tour by using the operator of the tour, both
+// tours are then scored again. Without an operator, the tours are left as is.
+func (r Tour) Crossover(q eaopt.Genome, rng *rand.Rand) {
+	if r.Cross == nil {
+		return
+	}
+	mate := q.(Tour)
+	r.Cross.Cross(r.Tigs, mate.Tigs, rng)
+	r.Pins.repair(r.Tigs)
+	mate.Pins.repair(mate.Tigs)
+	r.counts.crossed()
+	r.invalidate()
+	mate.invalidate()
 }
 
-// Clone a Tour
+// Clone a Tour. The clone has its own tigs and score to mutate, and shares
+// the matrix, which is read-only once built.
 func (r Tour) Clone() eaopt.Genome {
 	var clone Tour
 	clone.Tigs = make([]Tig, r.Len())
 	copy(clone.Tigs, r.Tigs)
 	clone.M = r.M
+	clone.Scorer = r.Scorer
+	clone.Cross = r.Cross
+	clone.Moves = r.Moves
+	clone.Pins = r.Pins
+	clone.Graph = r.Graph
+	clone.counts = r.counts
+	if r.delta != nil {
+		delta := *r.delta
+		clone.delta = &delta
+	}
 	return clone
 }
 
@@ -254,10 +477,67 @@ func (r Tour) Shuffle(rng *rand.Rand) {
 	}
 }
 
+// convergence tells when the best score of the GA stops improving. Only the
+// improvements by more than minDelta, relative to the best score at the last
+// one, count, and the GA converges after patience generations without any.
+type convergence struct {
+	patience uint
+	minDelta float64
+	best     float64 // Best score at the last improvement
+	updated  uint    // Generation of the last improvement
+}
+
+// newConvergence is the constructor for convergence
+func newConvergence(patience int, minDelta float64) *convergence {
+	return &convergence{patience: uint(patience), minDelta: minDelta, best: -math.MaxFloat64}
+}
+
+// update takes the best score of the GA at generation gen
+func (r *convergence) update(gen uint, score float64) {
+	if r.best == -math.MaxFloat64 || score > r.best+r.minDelta*math.Abs(r.best) {
+		r.best = score
+		r.updated = gen
+	}
+}
+
+// converged tells if the GA stops at generation gen
+func (r *convergence) converged(gen uint) bool {
+	return gen-r.updated > r.patience
+}
+
 // GARun set up the Genetic Algorithm and run it
 func (r *CLM) GARun(fwtour *os.File, opt *Optimizer, phase int) Tour {
+	// The initial tours are all the tour of the CLM, scored once, and count
+	// their moves for the log. When starting from a tour, the first ones of
+	// each population are it and perturbed copies of it, the others shuffled.
+	r.Tour.counts = opt.progress.counter()
+	initial := new(deltaScore)
+	seeds, made := opt.startSeeds(phase), 0
+	var pop *rand.Rand
 	MakeTour := func(rng *rand.Rand) eaopt.Genome {
-		c := r.Tour.Clone()
+		c := r.Tour.Clone().(Tour)
+		if !initial.ok {
+			initial.score, initial.ok = c.evaluate(), true
+		}
+		delta := *initial
+		c.delta = &delta
+		if seeds == 0 {
+			return c
+		}
+		if rng != pop {
+			pop, made = rng, 0
+		}
+		made++
+		switch {
+		case made > seeds:
+			c.Shuffle(rng)
+			c.Pins.repair(c.Tigs)
+			c.invalidate()
+		case made > 1:
+			for i := 0; i < StartMutations; i++ {
+				c.Mutate(rng)
+			}
+		}
 		return c
 	}
 
@@ -266,50 +546,100 @@ func (r *CLM) GARun(fwtour *os.File, opt *Optimizer, phase int) Tour {
 		panic(err)
 	}
 
-	ga.NPops = 1
+	ga.NPops = uint(opt.islands())
+	if ga.NPops > 1 {
+		ga.Migrator = migrateBest{nMigrants: IslandMigrants}
+		ga.MigFrequency = uint(opt.migrationInterval())
+	}
 	ga.NGenerations = 1000000
 	ga.PopSize = uint(opt.NPop)
-	ga.Model = eaopt.ModGenerational{
-		Selector: eaopt.SelTournament{
-			NContestants: 3,
+	ga.Model = parallelModel{
+		Model: eaopt.ModGenerational{
+			Selector:  opt.selector(),
+			MutRate:   opt.MutProb,
+			CrossRate: opt.crossProb(),
 		},
-		MutRate: opt.MutProb,
+		pool:  newEvalPool(opt.Threads),
+		elite: opt.Elite,
 	}
 	ga.RNG = opt.rng
-	ga.ParallelEval = true
+	ga.ParallelEval = false // The model scores the population
 
-	best := new(float64)
-	updated := new(uint)
-	*best = -math.MaxFloat64 // Currently best score
-	*updated = 0             // Last updated generation
+	conv := newConvergence(opt.patience(), opt.MinDelta)
+	div := opt.diversity()
+	var popRNGs []*replaySource
+	gaRNG := *opt.src // Before eaopt seeds the populations
 
 	// Additional bookkeeping per generation
 	ga.Callback = func(ga *eaopt.GA) {
 		gen := ga.Generations
-		currentBest := -ga.HallOfFame[0].Fitness
-		if currentBest > *best {
-			*best = currentBest
-			*updated = gen
+		if gen == 0 {
+			// The populations draw from streams whose state is checkpointed
+			if state := opt.checkpoint; state != nil && state.Phase == phase {
+				log.Noticef("Resume GA%d from generation %d", phase, state.Generation)
+				popRNGs = state.restore(ga, opt.src)
+				conv.best, conv.updated = state.Best, state.Updated
+				opt.checkpoint = nil
+				return
+			}
+			var err error
+			popRNGs, err = replayPopulationRNGs(ga.Populations, gaRNG)
+			opt.fail(err)
 		}
-		if gen%500 == 0 {
-			fmt.Printf("Current iteration GA%d-%d: max_score=%.5f\n",
-				phase, gen, currentBest)
+		currentBest := -ga.HallOfFame[0].Fitness
+		conv.update(gen, currentBest)
+		div.update(ga, phase)
+		opt.fail(opt.progress.write(phase, ga))
+		opt.best.offer(ga, phase)
+		if gen%opt.tourInterval() == 0 {
+			fmt.Fprintf(r.stdout(), "Current iteration GA%d-%d: max_score=%.5f (%s)\n",
+				phase, gen, currentBest, r.Tour.ScoreName())
 			currentBestTour := ga.HallOfFame[0].Genome.(Tour)
-			r.printTour(fwtour, currentBestTour, fmt.Sprintf("GA%d-%d-%.5f",
-				phase, gen, currentBest))
+			r.printTour(fwtour, currentBestTour, fmt.Sprintf("GA%d-%d", phase, gen),
+				fmt.Sprintf("gen=%d", gen))
+			opt.fail(opt.best.write(r, opt.bestFile()))
+		}
+		if opt.OnGeneration != nil && !opt.interrupted {
+			opt.abort(opt.OnGeneration(int(gen), currentBest, ga.HallOfFame[0].Genome.(Tour)))
+		}
+		if opt.CheckpointEvery > 0 && gen > 0 && gen%uint(opt.CheckpointEvery) == 0 {
+			opt.fail(r.writeCheckpoint(opt.checkpointFile(), ga, phase, opt,
+				conv.best, conv.updated, popRNGs))
+			opt.halted = opt.haltPhase == phase && opt.haltRestart == opt.restart
 		}
 	}
 
 	// Convergence criteria
 	ga.EarlyStop = func(ga *eaopt.GA) bool {
-		return ga.Generations-*updated > uint(opt.NGen)
+		return opt.halted || opt.stopping() || conv.converged(ga.Generations)
 	}
 
-	log.Noticef("GA initialized (npop: %v, ngen: %v, mu: %.2f, rng: %d, break: %d)",
-		opt.NPop, opt.NGen, opt.MutProb, opt.Seed, LIMIT)
+	if r.Tour.jointOrient() {
+		r.carrySigns(r.Tour)
+	}
+	log.Noticef("GA initialized (npop: %v, islands: %d, ngen: %v, mu: %.2f, rng: %d, break: %d, score: %s)",
+		opt.NPop, ga.NPops, opt.NGen, opt.MutProb, opt.Seed, LIMIT, r.Tour.ScoreName())
 
 	_ = ga.Minimize(MakeTour)
+	opt.generations += int(ga.Generations)
+	if opt.interrupted {
+		// To carry on with --resumeCheckpoint
+		if err := r.writeCheckpoint(opt.checkpointFile(), ga, phase, opt,
+			conv.best, conv.updated, popRNGs); err != nil {
+			opt.fail(err)
+		} else {
+			log.Noticef("GA%d stopped at generation %d with the best score %.5f, checkpoint saved to `%s`",
+				phase, ga.Generations, conv.best, opt.checkpointFile())
+		}
+	} else if !opt.halted {
+		log.Noticef("GA%d converged at generation %d, the best score %.5f did not improve by more than %g%% in %d generations",
+			phase, ga.Generations, conv.best, conv.minDelta*100, conv.patience)
+	}
 
-	r.Tour = ga.HallOfFame[0].Genome.(Tour)
+	tour := ga.HallOfFame[0].Genome.(Tour)
+	tour.delta = nil // Callers may change the tigs of the tour
+	tour.counts = nil
+	r.takeSigns(tour)
+	r.Tour = tour
 	return r.Tour
 }
@@ -0,0 +1,409 @@
+/*
+ *  evaluate_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// syntheticTour builds a shuffled tour over N tigs with a random symmetric
+// matrix, along with the same matrix as [][]int
+func syntheticTour(N int) (allhic.Tour, [][]int) {
+	rng := rand.New(rand.NewSource(int64(N)))
+	tour := allhic.Tour{Tigs: make([]allhic.Tig, N), M: allhic.NewMatrix(N)}
+	ref := make([][]int, N)
+	for i := range ref {
+		ref[i] = make([]int, N)
+	}
+	for i := 0; i < N; i++ {
+		tour.Tigs[i] = allhic.Tig{Idx: i, Size: 1000 + rng.Intn(200000)}
+		for j := i + 1; j < N; j++ {
+			if rng.Intn(2) == 0 {
+				continue
+			}
+			n := rng.Intn(100)
+			tour.M.Set(i, j, n)
+			tour.M.Set(j, i, n)
+			ref[i][j], ref[j][i] = n, n
+		}
+	}
+	rng.Shuffle(N, func(i, j int) { tour.Tigs[i], tour.Tigs[j] = tour.Tigs[j], tour.Tigs[i] })
+	return tour, ref
+}
+
+// referenceEvaluate is the original Evaluate over a [][]int matrix
+func referenceEvaluate(tigs []allhic.Tig, M [][]int) float64 {
+	size := len(tigs)
+	mid := make([]float64, size)
+	cumSum := 0.0
+	for i, t := range tigs {
+		tsize := float64(t.Size)
+		mid[i] = cumSum + tsize/2
+		cumSum += tsize
+	}
+
+	score := 0.0
+	for i := 0; i < size; i++ {
+		a := tigs[i].Idx
+		for j := i + 1; j < size; j++ {
+			b := tigs[j].Idx
+			nlinks := M[a][b]
+			dist := mid[j] - mid[i]
+			if dist > allhic.LIMIT {
+				break
+			}
+			score -= float64(nlinks) / dist
+		}
+	}
+	return score
+}
+
+// TestEvaluateMatchesReference checks that the flat matrix gives identical scores
+func TestEvaluateMatchesReference(t *testing.T) {
+	for _, N := range []int{1, 2, 50, 500} {
+		tour, ref := syntheticTour(N)
+		got, _ := tour.Evaluate()
+		if want := referenceEvaluate(tour.Tigs, ref); got != want {
+			t.Errorf("N=%d: Evaluate() = %v, want %v", N, got, want)
+		}
+	}
+}
+
+// TestEvaluateWeighted checks that weighted links scale the score
+func TestEvaluateWeighted(t *testing.T) {
+	tour, _ := syntheticTour(200)
+	want, _ := tour.Evaluate()
+	tour.M.W = make([]float64, len(tour.M.Data))
+	for i, n := range tour.M.Data {
+		tour.M.W[i] = float64(n) / 2
+	}
+	got, _ := tour.Evaluate()
+	if math.Abs(got-want/2) > 1e-12*math.Abs(want) {
+		t.Errorf("Evaluate() with halved weights = %v, want %v", got, want/2)
+	}
+}
+
+// sparseTour returns the same tour with the matrix packed as sparse
+func sparseTour(tour allhic.Tour) allhic.Tour {
+	N := tour.M.N
+	rows := make(allhic.SparseMatrix, N)
+	for i := range rows {
+		rows[i] = make(map[int]int)
+		for j := 0; j < N; j++ {
+			if n := tour.M.At(i, j); n != 0 {
+				rows[i][j] = n
+			}
+		}
+	}
+	return allhic.Tour{Tigs: tour.Tigs, M: allhic.NewSparseMatrix(rows)}
+}
+
+// TestEvaluateSparse checks that the sparse matrix scores as the dense one,
+// up to the order in which the pairs are summed
+func TestEvaluateSparse(t *testing.T) {
+	for _, N := range []int{1, 2, 50, 500} {
+		dense, _ := syntheticTour(N)
+		sparse := sparseTour(dense)
+		if !sparse.M.Sparse() || dense.M.Sparse() {
+			t.Fatalf("N=%d: unexpected storage", N)
+		}
+		for i := 0; i < N; i++ {
+			for j := 0; j < N; j++ {
+				if sparse.M.At(i, j) != dense.M.At(i, j) {
+					t.Fatalf("N=%d: cell (%d, %d) differs", N, i, j)
+				}
+			}
+		}
+		want, _ := dense.Evaluate()
+		got, _ := sparse.Evaluate()
+		if math.Abs(got-want) > 1e-12*math.Abs(want) {
+			t.Errorf("N=%d: sparse Evaluate() = %v, want %v", N, got, want)
+		}
+		want, _ = dense.EvaluateSumLog()
+		got, _ = sparse.EvaluateSumLog()
+		if math.Abs(got-want) > 1e-12*math.Abs(want) {
+			t.Errorf("N=%d: sparse EvaluateSumLog() = %v, want %v", N, got, want)
+		}
+	}
+
+	dense, _ := syntheticTour(200)
+	sparse := sparseTour(dense)
+	want, _ := dense.Evaluate()
+	sparse.M.W = make([]float64, len(sparse.M.Vals))
+	for k, n := range sparse.M.Vals {
+		sparse.M.W[k] = float64(n) / 2
+	}
+	got, _ := sparse.Evaluate()
+	if math.Abs(got-want/2) > 1e-12*math.Abs(want) {
+		t.Errorf("sparse Evaluate() with halved weights = %v, want %v", got, want/2)
+	}
+}
+
+// TestSparseM checks that M() is sparse for a large group with few links
+func TestSparseM(t *testing.T) {
+	idsfile, clmfile := writeSyntheticCLM(t.TempDir(), 5000, 2, 1)
+	r := mustNewCLM(t, clmfile, idsfile)
+	M := r.M()
+	if !M.Sparse() {
+		t.Fatal("expected a sparse matrix")
+	}
+	if got := M.At(10, 12); got != 1 {
+		t.Errorf("got %d links between tig 10 and tig 12, want 1", got)
+	}
+	if got := M.At(12, 10); got != 1 {
+		t.Errorf("got %d links between tig 12 and tig 10, want 1", got)
+	}
+	if got := M.At(10, 13); got != 0 {
+		t.Errorf("got %d links between tig 10 and tig 13, want 0", got)
+	}
+	W := r.EndWeightedM(math.MaxInt32)
+	for k, n := range W.Vals {
+		if W.W[k] != float64(n) {
+			t.Fatalf("cell %d: weighted %v, want all %d links", k, W.W[k], n)
+		}
+	}
+}
+
+// bandedRows links every tig to its next 10 tigs, as in a sorted group
+func bandedRows(N int) allhic.SparseMatrix {
+	rng := rand.New(rand.NewSource(int64(N)))
+	rows := make(allhic.SparseMatrix, N)
+	for i := range rows {
+		rows[i] = make(map[int]int)
+	}
+	for i := 0; i < N; i++ {
+		for j := i + 1; j < N && j <= i+10; j++ {
+			n := 1 + rng.Intn(100)
+			rows[i][j], rows[j][i] = n, n
+		}
+	}
+	return rows
+}
+
+// BenchmarkEvaluateSparse compares the memory and the Evaluate throughput
+// of the dense and the sparse matrices, up to N=100k where only the sparse
+// matrix fits in memory
+func BenchmarkEvaluateSparse(b *testing.B) {
+	for _, N := range []int{1000, 10000, 100000} {
+		rows := bandedRows(N)
+		tigs := make([]allhic.Tig, N)
+		for i := range tigs {
+			tigs[i] = allhic.Tig{Idx: i, Size: 1000 + i%200000}
+		}
+		b.Run(fmt.Sprintf("N=%d/sparse", N), func(b *testing.B) {
+			tour := allhic.Tour{Tigs: tigs, M: allhic.NewSparseMatrix(rows)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = tour.Evaluate()
+			}
+			bytes := 8*len(tour.M.RowStart) + 4*len(tour.M.Cols) + 8*len(tour.M.Vals)
+			b.ReportMetric(float64(bytes), "B/matrix")
+		})
+		if N > 10000 {
+			continue
+		}
+		b.Run(fmt.Sprintf("N=%d/dense", N), func(b *testing.B) {
+			tour := allhic.Tour{Tigs: tigs, M: allhic.NewMatrix(N)}
+			for i, row := range rows {
+				for j, n := range row {
+					tour.M.Set(i, j, n)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = tour.Evaluate()
+			}
+			b.ReportMetric(float64(8*len(tour.M.Data)), "B/matrix")
+		})
+	}
+}
+
+// TestMutateDeltaScore checks the score that Mutate keeps up to date
+// against scoring the whole tour, over many random moves
+func TestMutateDeltaScore(t *testing.T) {
+	dense, _ := syntheticTour(200)
+	sparse := sparseTour(dense)
+	weighted := sparseTour(dense)
+	weighted.M.W = make([]float64, len(weighted.M.Vals))
+	for k, n := range weighted.M.Vals {
+		weighted.M.W[k] = float64(n) / 3
+	}
+	for name, tour := range map[string]allhic.Tour{"dense": dense, "sparse": sparse, "weighted": weighted} {
+		rng := rand.New(rand.NewSource(42))
+		tour = tour.Clone().(allhic.Tour).WithDeltaScore()
+		for i := 0; i < 2000; i++ {
+			tour.Mutate(rng)
+			got, _ := tour.Evaluate()
+			want, _ := allhic.Tour{Tigs: tour.Tigs, M: tour.M}.Evaluate()
+			if math.Abs(got-want) > 1e-9*math.Abs(want) {
+				t.Fatalf("%s: move %d: kept score %v, want %v", name, i, got, want)
+			}
+		}
+	}
+}
+
+// TestTourClone mutates clones of a tour, as the GA and the pruning workers
+// do, and checks that the parent keeps its tigs and its score
+func TestTourClone(t *testing.T) {
+	parent, _ := syntheticTour(50)
+	parent = parent.WithDeltaScore()
+	score, _ := parent.Evaluate()
+	tigs := append([]allhic.Tig(nil), parent.Tigs...)
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		clone := parent.Clone().(allhic.Tour)
+		clone.Mutate(rng)
+		clone.Swap(0, clone.Len()-1)
+		clone.Tigs[i%clone.Len()].Sign = '-'
+		clone.Evaluate()
+	}
+	if !reflect.DeepEqual(parent.Tigs, tigs) {
+		t.Error("mutating the clones changed the tigs of the parent")
+	}
+	if got, _ := parent.Evaluate(); got != score {
+		t.Errorf("parent scores %v after cloning, want %v", got, score)
+	}
+}
+
+// TestConvergence feeds the stopping rule of the GA with the best scores of
+// made-up runs, and checks the generation where it stops
+func TestConvergence(t *testing.T) {
+	// Scores go up by 1% for 10 generations, then by 0.1%
+	slowing := make([]float64, 100)
+	for gen := range slowing {
+		switch {
+		case gen == 0:
+			slowing[gen] = 1
+		case gen <= 10:
+			slowing[gen] = slowing[gen-1] * 1.01
+		default:
+			slowing[gen] = slowing[gen-1] * 1.001
+		}
+	}
+	flat := make([]float64, 100)
+	for gen := range flat {
+		flat[gen] = -0.5
+	}
+	for _, tc := range []struct {
+		name     string
+		scores   []float64
+		patience int
+		minDelta float64
+		want     int
+	}{
+		{"flat", flat, 5, 0, 6},
+		{"any improvement", slowing, 5, 0, -1},
+		{"above 0.9%", slowing, 5, 0.009, 16},
+		// The 0.1% steps add up to more than 0.5% every 5 generations
+		{"cumulative", slowing, 5, 0.005, -1},
+		{"above 5%", slowing, 3, 0.05, 4},
+	} {
+		conv := allhic.NewConvergence(tc.patience, tc.minDelta)
+		got := -1
+		for gen, score := range tc.scores {
+			conv.Update(uint(gen), score)
+			if conv.Converged(uint(gen)) {
+				got = gen
+				break
+			}
+		}
+		if got != tc.want {
+			t.Errorf("%s: converged at generation %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// shuffledTours returns n shuffles of the tour
+func shuffledTours(tour allhic.Tour, n int) []allhic.Tour {
+	rng := rand.New(rand.NewSource(42))
+	tours := make([]allhic.Tour, n)
+	for i := range tours {
+		tours[i] = tour.Clone().(allhic.Tour)
+		tours[i].Shuffle(rng)
+	}
+	return tours
+}
+
+// TestEvaluateTours scores a population with pools of workers of several
+// sizes, which all give the scores of Evaluate in the order of the tours
+func TestEvaluateTours(t *testing.T) {
+	dense, _ := syntheticTour(300)
+	for name, tour := range map[string]allhic.Tour{"dense": dense, "sparse": sparseTour(dense)} {
+		tours := shuffledTours(tour, 30)
+		want := make([]float64, len(tours))
+		for i, tour := range tours {
+			want[i], _ = tour.Evaluate()
+		}
+		for _, threads := range []int{1, 3, 8} {
+			if got := allhic.EvaluateTours(tours, threads); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, threads=%d: scores differ from Evaluate", name, threads)
+			}
+		}
+	}
+}
+
+// BenchmarkEvaluateTours scores a population of 100 tours of 5000 tigs with
+// a growing pool of workers
+func BenchmarkEvaluateTours(b *testing.B) {
+	tour, _ := syntheticTour(5000)
+	tours := shuffledTours(tour, 100)
+	for _, threads := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				allhic.EvaluateTours(tours, threads)
+			}
+		})
+	}
+}
+
+// BenchmarkMutate compares the moves of the GA with their score kept up to
+// date to scoring the whole tour after each move
+func BenchmarkMutate(b *testing.B) {
+	tour, _ := syntheticTour(5000)
+	b.Run("delta", func(b *testing.B) {
+		tour := tour.Clone().(allhic.Tour).WithDeltaScore()
+		rng := rand.New(rand.NewSource(42))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tour.Mutate(rng)
+			_, _ = tour.Evaluate()
+		}
+	})
+	b.Run("full", func(b *testing.B) {
+		tour := tour.Clone().(allhic.Tour)
+		rng := rand.New(rand.NewSource(42))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tour.Mutate(rng)
+			_, _ = tour.Evaluate()
+		}
+	})
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	for _, N := range []int{2000, 10000} {
+		tour, ref := syntheticTour(N)
+		b.Run(fmt.Sprintf("N=%d", N), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = tour.Evaluate()
+			}
+		})
+		b.Run(fmt.Sprintf("N=%d/reference", N), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				referenceEvaluate(tour.Tigs, ref)
+			}
+		})
+	}
+}
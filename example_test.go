@@ -0,0 +1,65 @@
+/*
+ *  example_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeToyGroup writes the ids and clm files of four 50kb contigs laid out
+// as ctg1+ ctg2+ ctg3+ ctg4+, with links between neighbors that are close
+// to their junction, and returns the paths of the two files
+func writeToyGroup(dir string) (idsfile, clmfile string) {
+	const size = 50000
+	var contigs []clmContig
+	var pairs []clmPair
+	for i := 1; i <= 4; i++ {
+		contigs = append(contigs, clmContig{fmt.Sprintf("ctg%d", i), size})
+	}
+	for i := 1; i < 4; i++ {
+		pair := clmPair{a: fmt.Sprintf("ctg%d", i), b: fmt.Sprintf("ctg%d", i+1)}
+		for k := 0; k < 20; k++ {
+			pair.links = append(pair.links, clmLink{size - 1000 - 1500*k, 1000 + 1500*k})
+		}
+		pairs = append(pairs, pair)
+	}
+	return writeCLMFixture(dir, "toy", contigs, pairs)
+}
+
+// Orders and orients the contigs of a group from a program, with the output
+// files in a directory of its own. The tour found reads the layout from the
+// other strand.
+func ExampleOptimizer() {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile, clmfile := writeToyGroup(dir)
+
+	opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile,
+		RunGA: true, Seed: 42, NPop: 20, NGen: 100, MutProb: allhic.MutaProb,
+		OutPrefix: filepath.Join(dir, "toy"), Stdout: ioutil.Discard}
+	if err := opt.Run(); err != nil {
+		panic(err)
+	}
+	tours, err := ioutil.ReadFile(opt.OutTourFile)
+	if err != nil {
+		panic(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(tours)), "\n")
+	fmt.Println(lines[len(lines)-1])
+	// Output: ctg4- ctg3- ctg2- ctg1-
+}
@@ -0,0 +1,279 @@
+/*
+ *  export_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// Hooks into unexported internals for the allhic_test package
+
+// KeepClosestContact exposes the CLM aggregation policy
+var KeepClosestContact = keepClosestContact
+
+// MakePair builds a Pair from two contig indices
+func MakePair(ai, bi int) Pair {
+	return newPair(ai, bi)
+}
+
+// MakeContact builds a Contact from its fields
+func MakeContact(strandedness int8, nlinks int, meanDist float64) Contact {
+	return newContact(strandedness, int32(nlinks), meanDist)
+}
+
+// BAMRecord exposes the fields decoded by the BAM record reader
+type BAMRecord = bamRecord
+
+// NewBAMRecordReader exposes the BAM record reader
+func NewBAMRecordReader(r io.Reader) (*bamRecordReader, error) {
+	return newBAMRecordReader(r, 0)
+}
+
+// CheckHeaders exposes checkHeaders
+func (r *Extracter) CheckHeaders() error {
+	return r.checkHeaders()
+}
+
+// SpectralSigns exposes spectralSigns
+func (r *CLM) SpectralSigns() ([]byte, bool) {
+	return r.spectralSigns()
+}
+
+// LanczosSigns exposes lanczosSigns
+func (r *CLM) LanczosSigns() ([]byte, bool) {
+	return r.lanczosSigns()
+}
+
+// FlipDelta exposes flipDelta for the contig at position i of the tour
+func (r *CLM) FlipDelta(i int) float64 {
+	cumsize, pos := r.tourOffsets()
+	return r.flipDelta(i, cumsize, pos, r.linkedTigs()[r.Tour.Tigs[i].Idx])
+}
+
+// FlipAll exposes flipAll
+func (r *CLM) FlipAll() string {
+	return r.flipAll()
+}
+
+// GreedySigns exposes greedySigns
+func (r *CLM) GreedySigns() []byte {
+	return r.greedySigns()
+}
+
+// WithDeltaScore makes the tour keep its score through Mutate, as in the GA
+func (r Tour) WithDeltaScore() Tour {
+	r.delta = new(deltaScore)
+	return r
+}
+
+// Consensus exposes the consensus strandedness of a pair
+func (r *CLM) Consensus(ai, bi int) int8 {
+	return r.contacts[newPair(ai, bi)].consensus()
+}
+
+// ParseTourFile exposes parseTourFile
+func (r *CLM) ParseTourFile(filename string) {
+	r.parseTourFile(filename)
+}
+
+// ParseTourWords exposes the tigs parsed from a tour file
+var ParseTourWords = parseTourFile
+
+// RepairTourFile exposes repairTourFile
+var RepairTourFile = repairTourFile
+
+// ReadSizes exposes readSizes
+var ReadSizes = readSizes
+
+// NewProgressOfSize exposes a Progress over size bytes with the interval
+func NewProgressOfSize(size int64, offset func() int64, interval time.Duration) *Progress {
+	return newProgress("Parse", size, offset, interval)
+}
+
+// Message exposes the report of counts at elapsed since the start
+func (p *Progress) Message(counts string, elapsed time.Duration) string {
+	return p.message(counts, p.start.Add(elapsed))
+}
+
+// FileOffset exposes fileOffset
+var FileOffset = fileOffset
+
+// OpenReader exposes openReader
+var OpenReader = openReader
+
+// CheckStdin exposes checkStdin
+func (r *Optimizer) CheckStdin() error {
+	return r.checkStdin()
+}
+
+// PruneByDensity exposes pruneByDensity
+func (r *CLM) PruneByDensity() {
+	r.pruneByDensity()
+}
+
+// ReadClmLines exposes readClmLines
+func ReadClmLines(clmfile string, strict bool, threads int) ([]CLMLine, error) {
+	return readClmLines(clmfile, strict, threads)
+}
+
+// ReadClmChunks parses the clmfile in chunks whatever its size
+func ReadClmChunks(clmfile string, strict bool, threads int) ([]CLMLine, error) {
+	return readClmChunks(clmfile, plainFileSize(clmfile), strict, threads)
+}
+
+// HaltAfterCheckpoint makes Run stop after the first checkpoint in the GA
+// phase, as if the job were killed
+func (r *Optimizer) HaltAfterCheckpoint(phase int) {
+	r.haltPhase = phase
+}
+
+// HaltAfterRestartCheckpoint makes Run stop after the first checkpoint in
+// the GA phase of the restart, counted from 0
+func (r *Optimizer) HaltAfterRestartCheckpoint(restart, phase int) {
+	r.haltRestart, r.haltPhase = restart, phase
+}
+
+// Convergence exposes the stopping rule of the GA
+type Convergence = convergence
+
+// NewConvergence exposes newConvergence
+var NewConvergence = newConvergence
+
+// Update exposes update
+func (r *convergence) Update(gen uint, score float64) {
+	r.update(gen, score)
+}
+
+// Converged exposes converged
+func (r *convergence) Converged(gen uint) bool {
+	return r.converged(gen)
+}
+
+// EvaluateTours scores the tours with the pool of threads workers of the GA
+func EvaluateTours(tours []Tour, threads int) []float64 {
+	indis := make(eaopt.Individuals, len(tours))
+	for i, tour := range tours {
+		indis[i] = eaopt.Individual{Genome: tour}
+	}
+	newEvalPool(threads).evaluate(indis)
+	scores := make([]float64, len(indis))
+	for i, indi := range indis {
+		scores[i] = indi.Fitness
+	}
+	return scores
+}
+
+// MigrateBest migrates the n best tours of each population to the next
+func MigrateBest(pops eaopt.Populations, n int) {
+	migrateBest{nMigrants: n}.Apply(pops, rand.New(rand.NewSource(1)))
+}
+
+// TourKey exposes the key under which the best tours are told apart
+var TourKey = tourKey
+
+// MakeConstraints pins the tigs, by index, at their 0-based positions when
+// fixed, and at the ends of the tour when left or right
+func MakeConstraints(nTigs int, fixed map[int]int, left, right []int) *Constraints {
+	pins := newConstraints(nTigs)
+	for idx, pos := range fixed {
+		pins.add(idx, pinFixed, pos)
+	}
+	for _, idx := range left {
+		pins.add(idx, pinLeft, 0)
+	}
+	for _, idx := range right {
+		pins.add(idx, pinRight, 0)
+	}
+	return pins
+}
+
+// Check exposes check
+func (r *Constraints) Check(n int) error {
+	return r.check(n)
+}
+
+// Valid tells whether the whole tour meets the constraints
+func (r *Constraints) Valid(tigs []Tig) bool {
+	return r.valid(tigs, 0, len(tigs)-1)
+}
+
+// Repair exposes repair
+func (r *Constraints) Repair(tigs []Tig) bool {
+	return r.repair(tigs)
+}
+
+// KendallDistance exposes kendallDistance
+var KendallDistance = kendallDistance
+
+// RunGAPhase runs the GA phase on the tour of the CLM, scored by scorer, as
+// Run does once the tigs are active
+func (r *Optimizer) RunGAPhase(clm *CLM, scorer Scorer, phase int) Tour {
+	r.streams = NewRNGStreams(r.Seed)
+	r.src = r.streams.source(0)
+	r.rng = rand.New(r.src)
+	clm.Tour.Scorer = scorer
+	fwtour, err := os.Create(os.DevNull)
+	if err != nil {
+		panic(err)
+	}
+	defer fwtour.Close()
+	return clm.GARun(fwtour, r, phase)
+}
+
+// EvolvePopulation applies a generation of the GA, as GARun does with the
+// default selection, and keeps the elite best tours
+func EvolvePopulation(pop *eaopt.Population, mutRate float64, elite int) error {
+	model := parallelModel{
+		Model: eaopt.ModGenerational{
+			Selector: eaopt.SelTournament{NContestants: TournamentSize},
+			MutRate:  mutRate,
+		},
+		pool:  newEvalPool(1),
+		elite: elite,
+	}
+	return model.Apply(pop)
+}
+
+// ReadLinkDistribution exposes the reader of the distribution files
+var ReadLinkDistribution = readLinkDistribution
+
+// NewSpacedModel exposes newSpacedModel
+var NewSpacedModel = newSpacedModel
+
+// BinStarts returns the starts of the bins, and the end of the last one
+func (r *LinkDensityModel) BinStarts() []int {
+	return r.binStarts
+}
+
+// NLinks returns the links in each bin
+func (r *LinkDensityModel) NLinks() []int {
+	return r.nLinks
+}
+
+// BedGraph returns the bedGraph of the coverage track
+func BedGraph(track *CoverageTrack) string {
+	var b strings.Builder
+	track.bedGraph(&b)
+	return b.String()
+}
+
+// PoreCContacts exposes poreCContacts
+var PoreCContacts = poreCContacts
+
+// PoreCLinks exposes poreCLinks
+var PoreCLinks = poreCLinks
+
+// NewLinkDedup exposes newLinkDedup
+var NewLinkDedup = newLinkDedup
@@ -20,7 +20,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/biogo/hts/bam"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 )
@@ -34,18 +33,187 @@ var nBins = int(math.Ceil(linkRange * 16))
 
 // Extracter processes the distribution step
 type Extracter struct {
-	Bamfile         string
-	Fastafile       string
-	RE              string
-	MinLinks        int
-	contigs         []*ContigInfo
-	contigToIdx     map[string]int
-	model           *LinkDensityModel
-	totalIntraLinks int
+	Bamfile string
+	// Bamfiles are read one after the other, as if they were one, e.g. the
+	// lanes of a library, empty reads the Bamfile. Their headers must list
+	// the same contigs, and the outputs go next to the first one.
+	Bamfiles []string
+	// Format of the Bamfiles, FormatBAM or FormatValidPairs for the text
+	// files of HiC-Pro, whose contigs are those of the Fastafile; empty
+	// tells them by their extension, see inputFormat
+	Format    string
+	Fastafile string
+	RE        string
+	// Mode is ModeRE, the default, or ModeOmniC, which writes the effective
+	// lengths of the contigs to the counts file in place of the RE counts
+	Mode     string
+	MinLinks int
+	// Bins of the link size distribution, spaced on the BinScale, log or
+	// linear; no Bins on the log scale are the bins of LACHESIS
+	Bins     int
+	BinScale string
+	// MinDist and MaxDist bound the intra-contig links of the distribution,
+	// and MinDist the inter-contig link sizes of the clm, 0 for no bounds
+	MinDist int
+	MaxDist int
+	// DistLowerBound leaves the shorter intra-contig links out of the
+	// distribution alone, the clm keeping them, 0 for the DistLowerBound
+	// constant
+	DistLowerBound int
+	// Includefile and Excludefile list the contigs to keep, all without an
+	// Includefile, and to leave out; the reads on the others, or whose mate
+	// is on one, are skipped
+	Includefile string
+	Excludefile string
+	// MinMapq skips the reads with a lower MAPQ, or whose mate has one by
+	// their MQ tag, for the links and the coverage alike, 0 only skips the
+	// reads of MAPQ 0
+	MinMapq int
+	// KeepSecondary, KeepSupplementary and KeepQCFail use the reads of
+	// these flags, which are skipped by default, as are the unmapped reads
+	// and the duplicates
+	KeepSecondary     bool
+	KeepSupplementary bool
+	KeepQCFail        bool
+	// Dedup keeps one of the links of the same contigs, positions and
+	// strands, sorted within DedupMemory, 0 uses the DedupMemory constant.
+	// The coverage counts all the reads.
+	Dedup       bool
+	DedupMemory int64
+	// LowMem sorts the inter-contig links on disk within DedupMemory, and
+	// merges them into the clm, in place of holding them all in memory,
+	// for the same outputs. The sorts of LowMem and Dedup spill under
+	// TempDir, the system default when empty, removed at the end of the
+	// run.
+	LowMem  bool
+	TempDir string
+	// Window is the size of the coverage windows, RepeatRatio the coverage
+	// over the median that makes a contig a candidate repeat
+	Window      int
+	RepeatRatio float64
+	// Threads decode the reads of the BAM files in parallel, into the same
+	// outputs, 0 or 1 reads them in one goroutine
+	Threads int
+	// Fraction of the BAM header that must match the FASTA, and whether to
+	// carry on regardless
+	MinOverlap float64
+	Force      bool
+	// Sink receives the results, nil writes the files to OutPrefix
+	Sink ExtractSink
+	// OutPrefix names the files, as in <OutPrefix>.clm, its directory
+	// created when missing; empty uses the first BAM file without .bam
+	OutPrefix string
 	// Output file
 	OutContigsfile string
 	OutPairsfile   string
 	OutClmfile     string
+	// Skipped counts the reads skipped for their flags or a MAPQ of 0, and
+	// SkippedMapq those skipped for MinMapq
+	Skipped     SkippedReads
+	SkippedMapq int
+	// SkippedContigs counts the reads skipped for the contigs left out
+	SkippedContigs int
+	// The links and link sizes left out for MinDist and MaxDist, see
+	// LinkAggregator
+	SkippedMinDist      int
+	SkippedMaxDist      int
+	SkippedInterMinDist int
+	// SkippedDistLowerBound counts the intra-contig links under the
+	// DistLowerBound, over the MinDist
+	SkippedDistLowerBound int
+	// BamStats are the reads of each BAM file, and those used for links
+	BamStats []BamStats
+	// Duplicates counts the links dropped by Dedup
+	Duplicates int
+	// PoreC reads the multiway contacts of Pore-C, the aligned segments of
+	// each read, grouped by name and the supplementary ones kept, as the
+	// links of all their pairs, which PoreCDownweight weighs by 2/(n-1) for
+	// a read of n segments. The BAMs of the Pore-C tools are told by their
+	// header without PoreC.
+	PoreC           bool
+	PoreCDownweight bool
+	// PoreCReads counts the Pore-C reads by the number of their segments
+	PoreCReads []int
+	// QCThresholds are the bounds of the library QC, and LibraryQC its rows,
+	// written to prefix.qc.tsv and prefix.summary.json, none for Pore-C
+	QCThresholds QCThresholds
+	LibraryQC    []QCMetric
+	dedup        *linkDedup
+	filter       *ContigFilter
+	porec        bool
+	qc           pairQC
+}
+
+// SkippedReads counts the reads skipped by extract by the first of their
+// reasons, in the order of the fields
+type SkippedReads struct {
+	Unmapped      int
+	Secondary     int
+	Supplementary int
+	QCFail        int
+	Duplicate     int
+	MapqZero      int
+}
+
+// BamStats counts the reads of a BAM file, and those of them that made a
+// link, within a contig or between two
+type BamStats struct {
+	Bamfile string
+	Reads   int
+	Used    int
+}
+
+// LinkRecord is a Hi-C read pair mapped onto two contigs, given as indices
+// into the contigs of a LinkAggregator. The strands are informational, the
+// CLM rows cover all four orientations from the positions alone.
+type LinkRecord struct {
+	ContigA, PosA int
+	StrandA       byte
+	ContigB, PosB int
+	StrandB       byte
+}
+
+// LinkAggregator is the aggregation core of extract, it collects the intra-
+// and inter-contig links and derives the link size distribution from them
+type LinkAggregator struct {
+	MinLinks int
+	// Mode of extract, recorded in the distribution, ModeRE when empty
+	Mode string
+	// Bins and BinScale space the bins of the distribution, see
+	// newSpacedModel
+	Bins     int
+	BinScale string
+	// MinDist and MaxDist bound the intra-contig links of the distribution,
+	// and MinDist the inter-contig link sizes of the clm, 0 for no bounds
+	MinDist int
+	MaxDist int
+	// DistLowerBound bounds the intra-contig links of the distribution
+	// alone, 0 for the DistLowerBound constant
+	DistLowerBound int
+	// The links and link sizes left out for MinDist, MaxDist and
+	// DistLowerBound
+	SkippedMinDist        int
+	SkippedMaxDist        int
+	SkippedInterMinDist   int
+	SkippedDistLowerBound int
+	contigs               []*ContigInfo
+	contigToIdx           map[string]int
+	contigPairs           map[[2]int][][4]int
+	// spill sorts the inter-contig links on disk in place of contigPairs,
+	// and binned tallies the intra-contig links of the distribution in
+	// place of the links of the contigs, see spillLinks
+	spill  *ExternalSorter
+	binned *LinkDensityModel
+	// pairs are the contig pairs with their inter-contig links, in order,
+	// set by Finish
+	pairs []linkedPair
+	model *LinkDensityModel
+}
+
+// linkedPair is a contig pair with the number of its inter-contig links
+type linkedPair struct {
+	pair   [2]int
+	nLinks int
 }
 
 // ContigInfo stores results calculated from f
@@ -54,6 +222,10 @@ type ContigInfo struct {
 	recounts       int
 	length         int
 	links          []int // only intra-links are included in this field
+	nBinned        int   // intra-links tallied into the bins in place of links
+	maxBinned      int   // the longest of them
+	intraPairs     int   // all the intra-links, short ones included
+	interPairs     int
 	nExpectedLinks float64
 	nObservedLinks int
 	skip           bool
@@ -141,53 +313,490 @@ func uintLog2Frac(x float64) uint {
 	return l
 }
 
-// Run calls the distribution steps
-func (r *Extracter) Run() {
-	r.readFastaAndWriteRE()
-	r.extractContigLinks()
-	r.makeModel(RemoveExt(r.Bamfile) + ".distribution.txt")
-	r.calcIntraContigs()
-	r.calcInterContigs()
+// Run calls the distribution steps, and returns an error on the options
+// or the contigs left
+func (r *Extracter) Run() error {
+	mode := r.mode()
+	if mode != ModeRE && mode != ModeOmniC {
+		return fmt.Errorf("unknown mode `%s`", r.Mode)
+	}
+	format, err := r.inputFormat()
+	if err != nil {
+		return err
+	}
+	if mode == ModeOmniC && r.RE != "" && r.RE != DefaultRE {
+		log.Warningf("RE %s ignored in the %s mode, which counts the effective lengths", r.RE, mode)
+	}
+	sink := r.Sink
+	if sink == nil {
+		prefix := r.OutPrefix
+		if prefix == "" {
+			prefix = RemoveExt(strings.TrimSuffix(r.bamfiles()[0], ".gz"))
+		}
+		ErrorAbort(mkdirPrefix(prefix))
+		counts := r.RE
+		if mode == ModeOmniC {
+			counts = ModeOmniC
+		}
+		fileSink := NewFileSink(prefix, counts)
+		r.OutContigsfile = fileSink.OutContigsfile
+		r.OutClmfile = fileSink.OutClmfile
+		r.OutPairsfile = fileSink.OutPairsfile
+		if r.RepeatRatio > 0 {
+			fileSink.RepeatRatio = r.RepeatRatio
+		}
+		sink = fileSink
+	}
+	if fileSink, ok := sink.(*FileSink); ok {
+		fileSink.Mode = mode
+	}
+	// Fail on the bins and the distances before the long read of the BAM
+	if _, err = newSpacedModel(r.Bins, r.BinScale); err != nil {
+		return err
+	}
+	if r.MinDist < 0 || r.MaxDist < 0 || r.MaxDist > 0 && r.MaxDist <= r.MinDist {
+		return fmt.Errorf("cannot keep the links from --minDist %d to --maxDist %d", r.MinDist, r.MaxDist)
+	}
+	if r.DistLowerBound != 0 && (r.DistLowerBound < MinLinkDist ||
+		r.MaxDist > 0 && r.MaxDist <= r.DistLowerBound) {
+		return fmt.Errorf("cannot fit the links from --distLowerBound %d, the bins span %d to --maxDist %d",
+			r.DistLowerBound, MinLinkDist, r.MaxDist)
+	}
+	r.porec = r.PoreC
+	if format == FormatBAM && !r.porec {
+		r.porec = isPoreCBAM(readBAMHeader(r.bamfiles()[0]))
+		if r.porec {
+			log.Noticef("Pore-C reads in `%s`, told by its header", r.bamfiles()[0])
+		}
+	}
+	if r.porec && format != FormatBAM {
+		return fmt.Errorf("cannot read the Pore-C reads from %s", format)
+	}
+	// The validPairs have no header, their contigs are those of the FASTA
+	checkRefs := format == FormatBAM
+	if checkRefs {
+		if err := r.checkHeaders(); err != nil {
+			return err
+		}
+	}
+	// Check the bam against the index first, which avoids reading the FASTA
+	faifile := r.Fastafile + ".fai"
+	sizes, indexed := readSizes(faifile)
+	if indexed && checkRefs {
+		r.checkRefs(sizes, faifile)
+	}
+	contigs := readContigs(r.Fastafile, r.RE, mode)
+	if !indexed {
+		sizes = make(map[string]int, len(contigs))
+		for _, contig := range contigs {
+			sizes[contig.name] = contig.length
+		}
+		if checkRefs {
+			r.checkRefs(sizes, r.Fastafile)
+		}
+	}
+	r.filter = NewContigFilter(r.Includefile, r.Excludefile)
+	if r.filter != nil {
+		r.filter.WarnUnknown(func(name string) bool { _, ok := sizes[name]; return ok }, r.Fastafile)
+		var kept []*ContigInfo
+		for _, contig := range contigs {
+			if r.filter.Keep(contig.name) {
+				kept = append(kept, contig)
+			}
+		}
+		log.Noticef("Kept %d of %d contigs", len(kept), len(contigs))
+		if len(kept) == 0 {
+			return fmt.Errorf("no contig of `%s` left by --include `%s` and --exclude `%s`",
+				r.Fastafile, r.Includefile, r.Excludefile)
+		}
+		contigs = kept
+	}
+	sink.Contigs(contigs)
+	agg := NewLinkAggregator(contigs, r.MinLinks)
+	agg.Bins, agg.BinScale = r.Bins, r.BinScale
+	agg.MinDist, agg.MaxDist, agg.DistLowerBound = r.MinDist, r.MaxDist, r.DistLowerBound
+	agg.Mode = mode
+	coverage := NewCoverageTrack(contigs, r.Window)
+	r.Skipped, r.SkippedMapq, r.SkippedContigs = SkippedReads{}, 0, 0
+	r.BamStats, r.Duplicates, r.dedup, r.PoreCReads = nil, 0, nil, nil
+	r.LibraryQC, r.qc = nil, pairQC{}
+	if r.Dedup || r.LowMem {
+		dir, remove, err := newScratchDir(r.TempDir)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		if r.Dedup {
+			r.dedup = newLinkDedup(r.dedupMemory(), dir)
+		}
+		if r.LowMem {
+			agg.spillLinks(r.dedupMemory(), dir)
+			log.Noticef("Inter-contig links sorted on disk under `%s`", dir)
+		}
+	}
+	for _, bamfile := range r.bamfiles() {
+		switch {
+		case format == FormatValidPairs:
+			r.extractValidPairs(bamfile, agg, coverage)
+		case r.porec:
+			r.extractPoreC(bamfile, agg, coverage)
+		default:
+			r.extractContigLinks(bamfile, agg, coverage)
+		}
+	}
+	if r.porec {
+		r.logPoreCReads()
+	}
+	if r.dedup != nil {
+		links := r.dedup.seq
+		r.Duplicates = r.dedup.Finish(agg, r.dedupMemory())
+		log.Noticef("Removed %d duplicate links of %d (%.1f%%)", r.Duplicates, links,
+			100*float64(r.Duplicates)/math.Max(float64(links), 1))
+	}
+	log.Noticef("Skipped %d unmapped, %d secondary, %d supplementary, %d QC-fail, %d duplicate and %d MAPQ 0 reads",
+		r.Skipped.Unmapped, r.Skipped.Secondary, r.Skipped.Supplementary, r.Skipped.QCFail,
+		r.Skipped.Duplicate, r.Skipped.MapqZero)
+	if r.filter != nil {
+		log.Noticef("Skipped %d reads on the contigs left out, or whose mate is", r.SkippedContigs)
+	}
+	if r.MinMapq > 0 {
+		log.Noticef("Skipped %d reads with their MAPQ or that of their mate below %d", r.SkippedMapq, r.MinMapq)
+	}
+	for _, stats := range r.BamStats {
+		log.Noticef("%d of %d reads in `%s` used for links (%.1f%%)", stats.Used, stats.Reads, stats.Bamfile,
+			100*float64(stats.Used)/math.Max(float64(stats.Reads), 1))
+	}
+	if !r.porec {
+		// Both reads of a pair make a link
+		r.LibraryQC = r.qc.libraryQC(r.Duplicates/2, r.QCThresholds)
+		logLibraryQC(r.LibraryQC)
+		sink.LibraryQC(r.LibraryQC)
+	}
+	if err := agg.Finish(sink); err != nil {
+		return err
+	}
+	r.SkippedMinDist, r.SkippedMaxDist, r.SkippedInterMinDist, r.SkippedDistLowerBound =
+		agg.SkippedMinDist, agg.SkippedMaxDist, agg.SkippedInterMinDist, agg.SkippedDistLowerBound
+	sink.Coverage(coverage)
+	if err := sink.Close(); err != nil {
+		return err
+	}
 	log.Notice("Success")
+	return nil
+}
+
+// mode returns Mode, ModeRE when empty
+func (r *Extracter) mode() string {
+	if r.Mode == "" {
+		return ModeRE
+	}
+	return r.Mode
+}
+
+// dedupMemory returns the memory budget of the sorts of Dedup
+func (r *Extracter) dedupMemory() int64 {
+	if r.DedupMemory > 0 {
+		return r.DedupMemory
+	}
+	return DedupMemory
+}
+
+// bamfiles returns the BAM files to read, the Bamfile without Bamfiles
+func (r *Extracter) bamfiles() []string {
+	if len(r.Bamfiles) > 0 {
+		return r.Bamfiles
+	}
+	return []string{r.Bamfile}
+}
+
+// checkRefs compares the bam header with the contig sizes
+func (r *Extracter) checkRefs(sizes map[string]int, source string) {
+	RefCheck{MinOverlap: r.MinOverlap, Force: r.Force}.Sizes(readBAMRefs(r.bamfiles()[0]), sizes, source)
+}
+
+// checkHeaders checks that the headers of the BAM files list the same
+// contigs with the same lengths, in any order
+func (r *Extracter) checkHeaders() error {
+	bamfiles := r.bamfiles()
+	if len(bamfiles) < 2 {
+		return nil
+	}
+	first := make(map[string]int)
+	for _, ref := range readBAMRefs(bamfiles[0]) {
+		first[ref.Name()] = ref.Len()
+	}
+	for _, bamfile := range bamfiles[1:] {
+		refs := readBAMRefs(bamfile)
+		for _, ref := range refs {
+			length, ok := first[ref.Name()]
+			if !ok {
+				return fmt.Errorf("contig %s of %s is not in %s", ref.Name(), bamfile, bamfiles[0])
+			}
+			if length != ref.Len() {
+				return fmt.Errorf("contig %s is %d bp in %s but %d bp in %s",
+					ref.Name(), ref.Len(), bamfile, length, bamfiles[0])
+			}
+		}
+		if len(refs) != len(first) {
+			return fmt.Errorf("%s has %d contigs but %s has %d", bamfile, len(refs), bamfiles[0], len(first))
+		}
+	}
+	return nil
+}
+
+// NewLinkAggregator is the constructor for LinkAggregator
+func NewLinkAggregator(contigs []*ContigInfo, minLinks int) *LinkAggregator {
+	contigToIdx := make(map[string]int, len(contigs))
+	for i, contig := range contigs {
+		contigToIdx[contig.name] = i
+	}
+	return &LinkAggregator{
+		MinLinks:    minLinks,
+		contigs:     contigs,
+		contigToIdx: contigToIdx,
+		contigPairs: make(map[[2]int][][4]int),
+	}
+}
+
+// Add records one link
+func (r *LinkAggregator) Add(rec LinkRecord) {
+	//         read1                                               read2
+	//     ---a-- X|----- dist = a2 ----|         |--- dist = b ---|X ------ b2 ------
+	//     ==============================         ====================================
+	//             C1 (length L1)       |----D----|         C2 (length L2)
+	ai, bi := rec.ContigA, rec.ContigB
+	apos, bpos := rec.PosA, rec.PosB
+	ca, cb := r.contigs[ai], r.contigs[bi]
+
+	// An intra-contig link
+	if ai == bi {
+		ca.intraPairs++
+		link := abs(apos - bpos)
+		switch {
+		case link < MinLinkDist:
+		case link < r.MinDist:
+			r.SkippedMinDist++
+		case link < r.distLowerBound():
+			r.SkippedDistLowerBound++
+		case r.MaxDist > 0 && link > r.MaxDist:
+			r.SkippedMaxDist++
+		case r.binned != nil:
+			r.binned.countLink(link)
+			ca.nBinned++
+			ca.maxBinned = max(ca.maxBinned, link)
+		default:
+			ca.links = append(ca.links, link)
+		}
+		return
+	}
+
+	// An inter-contig link
+	ca.interPairs++
+	cb.interPairs++
+	if ai > bi {
+		ai, bi = bi, ai
+		apos, bpos = bpos, apos
+		ca, cb = cb, ca
+	}
+
+	L1 := ca.length
+	L2 := cb.length
+	apos2, bpos2 := L1-apos, L2-bpos
+	ApBp := apos2 + bpos
+	ApBm := apos2 + bpos2
+	AmBp := apos + bpos
+	AmBm := apos + bpos2
+	pair := [2]int{ai, bi}
+	if r.spill != nil {
+		r.addSpilled(pair, [4]int{ApBp, ApBm, AmBp, AmBm})
+		return
+	}
+	r.contigPairs[pair] = append(r.contigPairs[pair], [4]int{ApBp, ApBm, AmBp, AmBm})
+}
+
+// Finish sends the aggregated links, the distribution and the contig pair
+// analyses to the sink, and returns an error when no intra-contig link is
+// left for the distribution
+func (r *LinkAggregator) Finish(sink ExtractSink) error {
+	intraGroups := 0
+	total := 0
+	for _, contig := range r.contigs {
+		if contig.nLinks() == 0 {
+			continue
+		}
+		intraGroups++
+		total += contig.nLinks()
+	}
+	log.Noticef("Extracted %d intra-contig link groups (total = %d)",
+		intraGroups, total)
+
+	// Inter-links go out in the order of the contig pairs
+	total = 0
+	maxLinks := 0
+	tags := []string{"++", "+-", "-+", "--"}
+	r.pairs = nil
+	contigLinks := func(pair [2]int, i int, links []int) {
+		// All the links of a pair are in each of its orientations
+		if i == 0 {
+			r.pairs = append(r.pairs, linkedPair{pair: pair, nLinks: len(links)})
+		}
+		linksWithDir := links[:0]
+		for _, link := range links {
+			if link < r.MinDist {
+				r.SkippedInterMinDist++
+				continue
+			}
+			linksWithDir = append(linksWithDir, link)
+		}
+		nLinks := len(linksWithDir)
+		if nLinks > maxLinks {
+			maxLinks = nLinks
+		}
+		if nLinks < r.MinLinks {
+			return
+		}
+		total += nLinks
+		at, bt := r.contigs[pair[0]].name, r.contigs[pair[1]].name
+		sink.ContigLinks(at, bt, tags[i][0], tags[i][1], linksWithDir)
+	}
+	if r.spill != nil {
+		r.eachSpilled(contigLinks)
+	}
+	for _, pair := range r.sortedPairs() {
+		links := r.contigPairs[pair]
+		for i := 0; i < 4; i++ {
+			linksWithDir := make([]int, len(links))
+			for j, link := range links {
+				linksWithDir[j] = link[i]
+			}
+			contigLinks(pair, i, linksWithDir)
+		}
+	}
+	log.Noticef("Extracted %d inter-contig groups (total = %d, maxLinks = %d, minLinks = %d)",
+		len(r.pairs), total, maxLinks, r.MinLinks)
+	if r.MinDist > 0 || r.MaxDist > 0 {
+		log.Noticef("Skipped %d intra-contig links below --minDist %d and %d above --maxDist %d, "+
+			"and %d inter-contig link sizes below --minDist",
+			r.SkippedMinDist, r.MinDist, r.SkippedMaxDist, r.MaxDist, r.SkippedInterMinDist)
+	}
+	if r.SkippedDistLowerBound > 0 {
+		log.Noticef("Skipped %d intra-contig links below --distLowerBound %d from the distribution",
+			r.SkippedDistLowerBound, r.distLowerBound())
+	}
+
+	if err := r.makeModel(); err != nil {
+		return err
+	}
+	sink.Distribution(r.model)
+	r.calcIntraContigs()
+	sink.Pairs(r.calcInterContigs())
+	sink.LinkStats(r.contigLinkStats())
+	return nil
+}
+
+// sortedPairs returns the contig pairs with inter-contig links in order
+func (r *LinkAggregator) sortedPairs() [][2]int {
+	pairs := make([][2]int, 0, len(r.contigPairs))
+	for pair := range r.contigPairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i][0] < pairs[j][0] ||
+			(pairs[i][0] == pairs[j][0] && pairs[i][1] < pairs[j][1])
+	})
+	return pairs
 }
 
 // makeModel computes the norms and bins separately to derive an empirical link size
 // distribution, then power law is inferred for extrapolating higher values
-func (r *Extracter) makeModel(outfile string) {
+func (r *LinkAggregator) makeModel() error {
 	contigSizes := make([]int, 0)
+	nLinks := 0
 	for _, contig := range r.contigs {
 		contigSizes = append(contigSizes, contig.length)
+		nLinks += contig.nLinks()
 	}
-	m := NewLinkDensityModel()
-	m.makeBins()
+	if nLinks == 0 {
+		return fmt.Errorf("no intra-contig link left for the distribution from --minDist %d "+
+			"and --distLowerBound %d to --maxDist %d, lower the bounds", r.MinDist, r.distLowerBound(), r.MaxDist)
+	}
+	m := r.binned
+	if m == nil {
+		var err error
+		if m, err = newSpacedModel(r.Bins, r.BinScale); err != nil {
+			return err
+		}
+	}
+	m.mode = r.Mode
+	m.lowerBound = max(r.MinDist, r.distLowerBound())
 	m.makeNorms(contigSizes)
 	m.countBinDensities(r.contigs)
-	m.writeDistribution(outfile)
 	r.model = m
+	return nil
 }
 
-// writeRE write a RE file and report statistics
-func writeRE(outfile string, contigs []*ContigInfo) {
-	f, err := os.Create(outfile)
-	ErrorAbort(err)
+// distLowerBound returns DistLowerBound, the DistLowerBound constant when 0
+func (r *LinkAggregator) distLowerBound() int {
+	if r.DistLowerBound > 0 {
+		return r.DistLowerBound
+	}
+	return DistLowerBound
+}
+
+// writeRE write a RE file and report statistics, the effective lengths in
+// place of the RE counts in ModeOmniC
+func writeRE(outfile, mode string, contigs []*ContigInfo) {
+	f := mustCreateAtomic(outfile)
 	w := bufio.NewWriter(f)
 	totalCounts := 0
 	totalBp := int64(0)
-	_, _ = fmt.Fprintf(w, REHeader)
+	header := REHeader
+	if mode == ModeOmniC {
+		header = OmniCHeader
+	}
+	_, _ = fmt.Fprintf(w, header)
 	for _, contig := range contigs {
 		totalCounts += contig.recounts
 		totalBp += int64(contig.length)
 		_, _ = fmt.Fprintf(w, "%s\n", contig)
 	}
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	if mode == ModeOmniC {
+		log.Noticef("Effective lengths of %d contigs (total: %d of %d bp) written to `%s`",
+			len(contigs), totalCounts, totalBp, outfile)
+		return
+	}
 	log.Noticef("RE counts in %d contigs (total: %d, avg 1 per %d bp) written to `%s`",
 		len(contigs), totalCounts, totalBp/int64(totalCounts), outfile)
-	_ = f.Close()
+}
+
+// readCountsMode returns ModeOmniC for a counts file of effective lengths,
+// by its header, and ModeRE otherwise
+func readCountsMode(filename string) string {
+	f, err := openReader(filename)
+	if err != nil {
+		return ModeRE
+	}
+	defer f.Close()
+	scanner := newLineScanner(f)
+	if scanner.Scan() && scanner.Text()+"\n" == OmniCHeader {
+		return ModeOmniC
+	}
+	return ModeRE
+}
+
+// iupacBases are the bases of the degenerate IUPAC codes in the RE patterns
+var iupacBases = map[rune]string{
+	'N': "[ACGT]", 'R': "[AG]", 'Y': "[CT]", 'S': "[CG]", 'W': "[AT]", 'K': "[GT]",
+	'M': "[AC]", 'B': "[CGT]", 'D': "[AGT]", 'H': "[ACT]", 'V': "[ACG]",
 }
 
 // MakePattern builds a regex-aware pattern that could be passed around and counted
-// Multiple patterns will be split at comma (,) and N is converted to [ACGT]
+// Multiple patterns will be split at comma (,) and the IUPAC codes are converted
+// to their bases, e.g. N to [ACGT]
 func MakePattern(s string) Pattern {
+	s = strings.ToUpper(s)
 	rePatternStr := s
 	isRegex := false
 	if strings.Contains(s, ",") {
@@ -200,8 +809,16 @@ func MakePattern(s string) Pattern {
 		}
 		isRegex = true
 	}
-	if strings.Contains(s, "N") {
-		rePatternStr = strings.ReplaceAll(rePatternStr, "N", "[ACGT]")
+	if strings.ContainsAny(s, "NRYSWKMBDHV") {
+		var b strings.Builder
+		for _, c := range rePatternStr {
+			if bases, ok := iupacBases[c]; ok {
+				b.WriteString(bases)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+		rePatternStr = b.String()
 		isRegex = true
 	}
 	rePattern := regexp.MustCompile(rePatternStr)
@@ -215,7 +832,7 @@ func MakePattern(s string) Pattern {
 	}
 }
 
-// CountPattern count how many times a pattern occurs in seq
+// CountPattern count how many times a pattern occurs in seq, in upper case
 func CountPattern(seq []byte, pattern Pattern) int {
 	if pattern.isRegex {
 		if all := pattern.rePattern.FindAllIndex(seq, -1); all != nil {
@@ -226,19 +843,15 @@ func CountPattern(seq []byte, pattern Pattern) int {
 	return bytes.Count(seq, pattern.pattern)
 }
 
-// readFastaAndWriteRE writes out the number of restriction fragments, one per line
-func (r *Extracter) readFastaAndWriteRE() {
-	outfile := RemoveExt(r.Bamfile) + ".counts_" + strings.ReplaceAll(r.RE, ",", "_") + ".txt"
-	r.OutContigsfile = outfile
-	mustExist(r.Fastafile)
-	reader, _ := fastx.NewDefaultReader(r.Fastafile)
+// readContigs counts the number of restriction fragments in each contig, or
+// its effective length, the bases other than N, in ModeOmniC
+func readContigs(fastafile, RE, mode string) []*ContigInfo {
+	mustExist(fastafile)
+	reader, _ := fastx.NewDefaultReader(fastafile)
 	seq.ValidateSeq = false // This flag makes parsing FASTA much faster
 
-	r.contigs = []*ContigInfo{}
-	r.contigToIdx = map[string]int{}
-	totalCounts := 0
-	totalBp := int64(0)
-	pattern := MakePattern(r.RE)
+	contigs := []*ContigInfo{}
+	pattern := MakePattern(RE)
 
 	for {
 		rec, err := reader.Read()
@@ -249,92 +862,96 @@ func (r *Extracter) readFastaAndWriteRE() {
 		name := string(rec.Name)
 		// Strip the sequence name to get the first part up to empty space
 		name = strings.Fields(name)[0]
-		// Add pseudo-count of 1 to prevent division by zero
-		count := CountPattern(rec.Seq.Seq, pattern) + 1
-		length := rec.Seq.Length()
-		totalCounts += count
-		totalBp += int64(length)
-		contig := &ContigInfo{
-			name:     name,
-			recounts: count, // To account for contigs with 0 RE sites
-			length:   length,
+		// Soft-masked bases count as any other, the lines of the FASTA
+		// are joined by the reader
+		upperBases(rec.Seq.Seq)
+		var count int
+		if mode == ModeOmniC {
+			// At least 1 for the contigs of Ns only
+			count = max(len(rec.Seq.Seq)-bytes.Count(rec.Seq.Seq, []byte{'N'}), 1)
+		} else {
+			// Add pseudo-count of 1 to prevent division by zero
+			count = CountPattern(rec.Seq.Seq, pattern) + 1
 		}
+		// To account for contigs with 0 RE sites
+		contigs = append(contigs, NewContigInfo(name, count, rec.Seq.Length()))
+	}
+	return contigs
+}
 
-		r.contigToIdx[name] = len(r.contigs)
-		r.contigs = append(r.contigs, contig)
+// upperBases turns the lower case bases of seq to upper case, in place
+func upperBases(seq []byte) {
+	for i, c := range seq {
+		if 'a' <= c && c <= 'z' {
+			seq[i] = c - 'a' + 'A'
+		}
 	}
-	writeRE(outfile, r.contigs)
+}
+
+// NewContigInfo is the constructor for ContigInfo
+func NewContigInfo(name string, recounts, length int) *ContigInfo {
+	return &ContigInfo{name: name, recounts: recounts, length: length}
+}
+
+// nLinks returns the intra-contig links of the distribution, kept or binned
+func (r *ContigInfo) nLinks() int {
+	return len(r.links) + r.nBinned
+}
+
+// maxLink returns the longest intra-contig link of the distribution,
+// math.MinInt32 without any
+func (r *ContigInfo) maxLink() int {
+	maxLink := math.MinInt32
+	if r.nBinned > 0 {
+		maxLink = r.maxBinned
+	}
+	for _, link := range r.links {
+		if link > maxLink {
+			maxLink = link
+		}
+	}
+	return maxLink
 }
 
 // calcIntraContigs determine the local enrichment of links on this contig.
-func (r *Extracter) calcIntraContigs() {
+func (r *LinkAggregator) calcIntraContigs() {
 	for _, contig := range r.contigs {
 		L := contig.length
-		links := contig.links
-		nObservedLinks := len(links)
+		nObservedLinks := contig.nLinks()
 		nExpectedLinks := r.findExpectedIntraContigLinks(L)
 		contig.nExpectedLinks = sumf(nExpectedLinks)
 		contig.nObservedLinks = nObservedLinks
 	}
 }
 
-// calcInterContigs calculates the MLE of distance between all contigs
-func (r *Extracter) calcInterContigs() {
-	clmfile := RemoveExt(r.Bamfile) + ".clm"
-	lines := readClmLines(clmfile)
-	contigPairs := make(map[[2]int]*ContigPair)
-
-	for i := 0; i < len(lines); i++ {
-		line := &lines[i]
-		at, bt := line.at, line.bt
-		ai, _ := r.contigToIdx[at]
-		bi, _ := r.contigToIdx[bt]
-
-		pair := [2]int{ai, bi}
-		cp, ok := contigPairs[pair]
-		if !ok {
-			ca, cb := r.contigs[ai], r.contigs[bi]
-			L1, L2 := ca.length, cb.length
-			cp = &ContigPair{ai: ai, bi: bi, at: at, bt: bt,
-				RE1: ca.recounts, RE2: cb.recounts,
-				L1: L1, L2: L2, label: "ok"}
-			cp.nExpectedLinks = sumf(r.findExpectedInterContigLinks(0, L1, L2))
-			cp.nObservedLinks = len(line.links)
-			contigPairs[pair] = cp
-		}
-	}
-
-	outfile := RemoveExt(r.Bamfile) + ".pairs.txt"
-	r.OutPairsfile = outfile
-	f, _ := os.Create(outfile)
-	w := bufio.NewWriter(f)
-	_ = f.Close()
-	_, _ = fmt.Fprintf(w, PairsFileHeader)
-
+// calcInterContigs calculates the MLE of distance between all contigs with
+// at least MinLinks links
+func (r *LinkAggregator) calcInterContigs() []*ContigPair {
 	allPairs := make([]*ContigPair, 0)
-	for _, c := range contigPairs {
-		allPairs = append(allPairs, c)
-	}
-	sort.Slice(allPairs, func(i, j int) bool {
-		return allPairs[i].ai < allPairs[j].ai ||
-			(allPairs[i].ai == allPairs[j].ai && allPairs[i].bi < allPairs[j].bi)
-	})
-	for _, c := range allPairs {
-		if c.nObservedLinks < r.MinLinks {
+	for _, p := range r.pairs {
+		nObservedLinks := p.nLinks
+		if nObservedLinks < r.MinLinks {
 			continue
 		}
-		_, _ = fmt.Fprintln(w, c)
+		ai, bi := p.pair[0], p.pair[1]
+		ca, cb := r.contigs[ai], r.contigs[bi]
+		L1, L2 := ca.length, cb.length
+		cp := &ContigPair{ai: ai, bi: bi, at: ca.name, bt: cb.name,
+			RE1: ca.recounts, RE2: cb.recounts,
+			L1: L1, L2: L2, label: "ok"}
+		cp.nExpectedLinks = sumf(r.findExpectedInterContigLinks(0, L1, L2))
+		cp.nObservedLinks = nObservedLinks
+		allPairs = append(allPairs, cp)
 	}
-	_ = w.Flush()
-	log.Noticef("Contig pair analyses written to `%s`", outfile)
+	return allPairs
 }
 
 // findExpectedIntraContigLinks calculates the expected number of links within a contig
-func (r *Extracter) findExpectedIntraContigLinks(L int) []float64 {
-	nExpectedLinks := make([]float64, nBins)
+func (r *LinkAggregator) findExpectedIntraContigLinks(L int) []float64 {
 	m := r.model
+	nExpectedLinks := make([]float64, len(m.nLinks))
 
-	for i := 0; i < nBins; i++ {
+	for i := range nExpectedLinks {
 		binStart := m.binStarts[i]
 		binStop := m.binStarts[i+1]
 
@@ -355,14 +972,14 @@ func (r *Extracter) findExpectedIntraContigLinks(L int) []float64 {
 }
 
 // findExpectedInterContigLinks calculates the expected number of links between two contigs
-func (r *Extracter) findExpectedInterContigLinks(D, L1, L2 int) []float64 {
+func (r *LinkAggregator) findExpectedInterContigLinks(D, L1, L2 int) []float64 {
 	if L1 > L2 {
 		L1, L2 = L2, L1
 	}
-	nExpectedLinks := make([]float64, nBins)
 	m := r.model
+	nExpectedLinks := make([]float64, len(m.nLinks))
 
-	for i := 0; i < nBins; i++ {
+	for i := range nExpectedLinks {
 		binStart := m.binStarts[i]
 		binStop := m.binStarts[i+1]
 
@@ -405,134 +1022,156 @@ func (r *Extracter) findExpectedInterContigLinks(D, L1, L2 int) []float64 {
 	return nExpectedLinks
 }
 
-// extractContigLinks converts the BAM file to .clm and .ids
-func (r *Extracter) extractContigLinks() {
-	fh := mustOpen(r.Bamfile)
-	prefix := RemoveExt(r.Bamfile)
-	clmfile := prefix + ".clm"
-	r.OutClmfile = clmfile
+// extractContigLinks streams the links in the BAM file into the aggregator,
+// and counts the reads along the contigs
+func (r *Extracter) extractContigLinks(bamfile string, agg *LinkAggregator, coverage *CoverageTrack) {
+	fh := mustOpen(bamfile)
+	defer fh.Close()
 
-	log.Noticef("Parse bamfile `%s`", r.Bamfile)
-	br, err := bam.NewReader(fh, 0)
+	log.Noticef("Parse bamfile `%s`", bamfile)
+	br, err := newBAMRecordReader(fh, r.Threads)
 	if br == nil {
-		log.Errorf("Cannot open bamfile `%s` (%s)", r.Bamfile, err)
+		log.Errorf("Cannot open bamfile `%s` (%s)", bamfile, err)
 		os.Exit(0)
 	}
 
-	fclm, _ := os.Create(clmfile)
-	wclm := bufio.NewWriter(fclm)
-
-	refs := br.Header().Refs()
-	for _, ref := range refs {
-		// Sanity check to see if the contig length match up between the bam and fasta
-		contig := r.contigs[r.contigToIdx[ref.Name()]]
-		if contig.length != ref.Len() {
-			log.Errorf("Length mismatch: %s (fasta: %d bam:%d)",
-				ref.Name(), contig.length, ref.Len())
-		}
+	refToIdx := r.refTable(br, agg)
+	progress := NewProgress("Parse bamfile", bamfile, func() int64 { return fileOffset(fh) })
+	add := agg.Add
+	if r.dedup != nil {
+		add = r.dedup.Add
 	}
-
-	// Import links into pairs of contigs
-	contigPairs := make(map[[2]int][][4]int)
-	for {
-		rec, err := br.Read()
-		if err != nil {
-			if err != io.EOF {
-				log.Error(err)
+	var counts readCounts
+	if r.Threads > 1 {
+		counts = r.extractParallel(br, refToIdx, coverage, progress, add)
+	} else {
+		var rec bamRecord
+		for nrecords := 1; ; nrecords++ {
+			if progress.Tick() {
+				progress.Report(fmt.Sprintf("%d records", nrecords))
+			}
+			if err := br.Read(&rec); err != nil {
+				if err != io.EOF {
+					log.Error(err)
+				}
+				break
+			}
+			if link, ok := r.linkOf(&rec, refToIdx, coverage, &counts); ok {
+				add(link)
 			}
-			break
-		}
-		// Filtering: Unmapped | Secondary | QCFail | Duplicate | Supplementary
-		if rec.MapQ == 0 || rec.Flags&3844 != 0 {
-			continue
 		}
+	}
+	_ = br.Close()
+	r.Skipped.add(counts.skipped)
+	r.SkippedMapq += counts.skippedMapq
+	r.SkippedContigs += counts.skippedContigs
+	r.qc.add(counts.qc)
+	r.BamStats = append(r.BamStats, BamStats{Bamfile: bamfile, Reads: counts.reads, Used: counts.used})
+}
 
-		// Make sure we have these contig ids
-		at, bt := rec.Ref.Name(), rec.MateRef.Name()
-		ai, ok := r.contigToIdx[at]
-		if !ok {
-			continue
-		}
-		bi, ok := r.contigToIdx[bt]
-		if !ok {
-			continue
+// refTable maps the references of the BAM to the contigs of agg, those left
+// out by the filter to refExcluded
+func (r *Extracter) refTable(br *bamRecordReader, agg *LinkAggregator) []int {
+	// The header was checked against the contigs in Run
+	refToIdx := br.refTable(agg.contigToIdx)
+	for i, ref := range br.Header().Refs() {
+		if !r.filter.Keep(ref.Name()) {
+			refToIdx[i] = refExcluded
 		}
+	}
+	return refToIdx
+}
 
-		//         read1                                               read2
-		//     ---a-- X|----- dist = a2 ----|         |--- dist = b ---|X ------ b2 ------
-		//     ==============================         ====================================
-		//             C1 (length L1)       |----D----|         C2 (length L2)
-		apos, bpos := rec.Pos, rec.MatePos
-		ca, cb := r.contigs[ai], r.contigs[bi]
+// readCounts are the reads of a BAM file by what extract made of them
+type readCounts struct {
+	reads, used int
+	skipped     SkippedReads
+	skippedMapq int
+	// skippedContigs are on the contigs left out, or their mates are
+	skippedContigs int
+	qc             pairQC
+}
 
-		// An intra-contig link
-		if ai == bi {
-			if link := abs(apos - bpos); link >= MinLinkDist {
-				ca.links = append(ca.links, link)
-			}
-			continue
-		}
+// add sums the counts of other into r
+func (r *readCounts) add(other readCounts) {
+	r.reads += other.reads
+	r.used += other.used
+	r.skipped.add(other.skipped)
+	r.skippedMapq += other.skippedMapq
+	r.skippedContigs += other.skippedContigs
+	r.qc.add(other.qc)
+}
 
-		// An inter-contig link
-		if ai > bi {
-			ai, bi = bi, ai
-			apos, bpos = bpos, apos
-			ca, cb = cb, ca
-		}
+// add sums the counts of other into r
+func (r *SkippedReads) add(other SkippedReads) {
+	r.Unmapped += other.Unmapped
+	r.Secondary += other.Secondary
+	r.Supplementary += other.Supplementary
+	r.QCFail += other.QCFail
+	r.Duplicate += other.Duplicate
+	r.MapqZero += other.MapqZero
+}
 
-		L1 := ca.length
-		L2 := cb.length
-		apos2, bpos2 := L1-apos, L2-bpos
-		ApBp := apos2 + bpos
-		ApBm := apos2 + bpos2
-		AmBp := apos + bpos
-		AmBm := apos + bpos2
-		pair := [2]int{ai, bi}
-		contigPairs[pair] = append(contigPairs[pair], [4]int{ApBp, ApBm, AmBp, AmBm})
+// linkOf filters the read, counts it along its contig, and returns its link
+// when both mates are on the contigs
+func (r *Extracter) linkOf(rec *bamRecord, refToIdx []int, coverage *CoverageTrack,
+	counts *readCounts) (LinkRecord, bool) {
+	counts.reads++
+	r.countPair(rec, &counts.qc)
+	if r.skip(rec, &counts.skipped) {
+		return LinkRecord{}, false
+	}
+	if r.MinMapq > 0 && (int(rec.MapQ) < r.MinMapq || rec.MateMapQ() >= 0 && rec.MateMapQ() < r.MinMapq) {
+		counts.skippedMapq++
+		return LinkRecord{}, false
 	}
 
-	intraGroups := 0
-	total := 0
-	// Write intra-links to .dis file
-	for _, contig := range r.contigs {
-		if len(contig.links) == 0 {
-			continue
-		}
-		intraGroups++
-		// contig.links = unique(contig.links)
-		total += len(contig.links)
+	// Make sure we have these contig ids
+	ai, bi := refIndex(refToIdx, rec.RefID), refIndex(refToIdx, rec.MateRefID)
+	if ai == refExcluded || bi == refExcluded {
+		counts.skippedContigs++
+		return LinkRecord{}, false
 	}
-	log.Noticef("Extracted %d intra-contig link groups (total = %d)",
-		intraGroups, total)
+	if ai < 0 {
+		return LinkRecord{}, false
+	}
+	coverage.Add(ai, int(rec.Pos))
+	if bi < 0 {
+		return LinkRecord{}, false
+	}
+	counts.used++
+	return LinkRecord{
+		ContigA: ai, PosA: int(rec.Pos), StrandA: flagStrand(rec.Flags, 0x10),
+		ContigB: bi, PosB: int(rec.MatePos), StrandB: flagStrand(rec.Flags, 0x20),
+	}, true
+}
 
-	// Write inter-links to .clm file
-	total = 0
-	maxLinks := 0
-	tags := []string{"++", "+-", "-+", "--"}
-	for pair, links := range contigPairs {
-		for i := 0; i < 4; i++ {
-			linksWithDir := make([]int, len(links))
-			for j, link := range links {
-				linksWithDir[j] = link[i]
-			}
-			// linksWithDir = unique(linksWithDir)
-			nLinks := len(linksWithDir)
-			if nLinks > maxLinks {
-				maxLinks = nLinks
-			}
-			if nLinks < r.MinLinks {
-				continue
-			}
-			total += nLinks
-			ai, bi := pair[0], pair[1]
-			at, bt := r.contigs[ai].name, r.contigs[bi].name
-			_, _ = fmt.Fprintf(wclm, "%s%c %s%c\t%d\t%s\n",
-				at, tags[i][0], bt, tags[i][1], nLinks, arrayToString(linksWithDir, " "))
-		}
+// skip returns whether the read is skipped for its flags or a MAPQ of 0,
+// and counts it by its reason
+func (r *Extracter) skip(rec *bamRecord, skipped *SkippedReads) bool {
+	switch {
+	case rec.Flags&0x4 != 0:
+		skipped.Unmapped++
+	case rec.Flags&0x100 != 0 && !r.KeepSecondary:
+		skipped.Secondary++
+	case rec.Flags&0x800 != 0 && !r.KeepSupplementary && !r.porec:
+		skipped.Supplementary++
+	case rec.Flags&0x200 != 0 && !r.KeepQCFail:
+		skipped.QCFail++
+	case rec.Flags&0x400 != 0:
+		skipped.Duplicate++
+	case rec.MapQ == 0:
+		skipped.MapqZero++
+	default:
+		return false
 	}
+	return true
+}
 
-	_ = wclm.Flush()
-	log.Noticef("Extracted %d inter-contig groups to `%s` (total = %d, maxLinks = %d, minLinks = %d)",
-		len(contigPairs), clmfile, total, maxLinks, r.MinLinks)
-	_ = br.Close()
+// flagStrand returns the strand of the read, or its mate, given the reverse bit
+func flagStrand(flags, reverse uint16) byte {
+	if flags&reverse != 0 {
+		return '-'
+	}
+	return '+'
 }
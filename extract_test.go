@@ -9,8 +9,22 @@
 package allhic_test
 
 import (
-	"github.com/tanghaibao/allhic"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
+	"github.com/tanghaibao/allhic"
 )
 
 func TestCountSimplePattern(t *testing.T) {
@@ -34,3 +48,1405 @@ func TestCountRegexPattern(t *testing.T) {
 		t.Errorf("CountPattern(#{seq}, #{pattern})=#{got}; want #{expected}")
 	}
 }
+
+// TestExtractSinks checks that the in-memory sink yields the same CLM as the
+// files written by the default sink
+func TestExtractSinks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping extraction in short mode")
+	}
+	bamfile, err := filepath.Abs(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		writeFastaForBAM(t, "test.bam", "contigs.fasta")
+
+		extracter := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta",
+			RE: allhic.DefaultRE, MinLinks: 3}
+		extracter.Run()
+		fromFiles := mustNewCLM(t, extracter.OutClmfile, extracter.OutContigsfile)
+
+		sink := &allhic.MemorySink{}
+		inMemory := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta",
+			RE: allhic.DefaultRE, MinLinks: 3, Sink: sink}
+		inMemory.Run()
+		fromMemory := sink.CLM()
+
+		if !reflect.DeepEqual(fromFiles.Tigs, fromMemory.Tigs) {
+			t.Fatal("contigs differ between the file and memory sinks")
+		}
+		if !reflect.DeepEqual(fromFiles.M(), fromMemory.M()) {
+			t.Fatal("contact matrices differ between the file and memory sinks")
+		}
+		for i := range fromFiles.Tigs {
+			for j := i + 1; j < len(fromFiles.Tigs); j++ {
+				s1, o1 := fromFiles.OrientationSupport(i, j)
+				s2, o2 := fromMemory.OrientationSupport(i, j)
+				if s1 != s2 || o1 != o2 {
+					t.Fatalf("orientation support of (%d, %d) differs", i, j)
+				}
+			}
+		}
+
+		data, err := ioutil.ReadFile(extracter.OutPairsfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(sink.ContigPairs()) == 0 || len(rows)-1 != len(sink.ContigPairs()) {
+			t.Errorf("%d rows in pairs file, %d contig pairs in memory",
+				len(rows)-1, len(sink.ContigPairs()))
+		}
+	})
+}
+
+// mapqPair is a read pair of the MAPQ fixture, from posA on contig a to posB
+// on contig b
+type mapqPair struct {
+	a, posA, mapqA int
+	b, posB, mapqB int
+}
+
+// writeMapqBAM writes the read pairs on two contigs into a BAM, with the MQ
+// tag of the mates unless noMQ
+func writeMapqBAM(t testing.TB, filename string, pairs []mapqPair, noMQ bool) {
+	writeMapqBAMOf(t, filename, map[string]int{"ctgA": 60000, "ctgB": 60000}, pairs, noMQ)
+}
+
+// writeMapqBAMOf writes the read pairs into a BAM of the contigs, in the
+// order of their names, with their lengths
+func writeMapqBAMOf(t testing.TB, filename string, lengths map[string]int, pairs []mapqPair, noMQ bool) {
+	writeFlagsBAMOf(t, filename, lengths, pairs, nil, noMQ)
+}
+
+// writeFlagsBAMOf writes the read pairs as writeMapqBAMOf, with both mates
+// of the pair i given flags[i] on top of the paired flags
+func writeFlagsBAMOf(t testing.TB, filename string, lengths map[string]int, pairs []mapqPair,
+	flags []sam.Flags, noMQ bool) {
+	var names []string
+	for name := range lengths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var refs []*sam.Reference
+	for _, name := range names {
+		ref, err := sam.NewReference(name, "", "", lengths[name], nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	h, err := sam.NewHeader(nil, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bam.NewWriter(f, h, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, qual := []byte("ACGTACGTAC"), []byte("IIIIIIIIII")
+	cigar := []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, len(seq))}
+	for i, p := range pairs {
+		for mate, flag := range []sam.Flags{sam.Read1, sam.Read2} {
+			ref, pos, mapq, mref, mpos, mmapq := refs[p.a], p.posA, p.mapqA, refs[p.b], p.posB, p.mapqB
+			if mate == 1 {
+				ref, pos, mapq, mref, mpos, mmapq = mref, mpos, mmapq, ref, pos, mapq
+			}
+			var aux []sam.Aux
+			if !noMQ {
+				mq, err := sam.NewAux(sam.NewTag("MQ"), uint8(mmapq))
+				if err != nil {
+					t.Fatal(err)
+				}
+				aux = append(aux, mq)
+			}
+			rec, err := sam.NewRecord(fmt.Sprintf("pair%d", i), ref, mref, pos, mpos, 0,
+				byte(mapq), cigar, seq, qual, aux)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Flags = sam.Paired | flag
+			if flags != nil {
+				rec.Flags |= flags[i]
+			}
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExtractMinMapq extracts a BAM of read pairs of mixed MAPQ with
+// --minMapq, which must yield the links, the distribution and the coverage
+// of the BAM of only the pairs of both mates above it
+func TestExtractMinMapq(t *testing.T) {
+	var good, mixed []mapqPair
+	for i := 0; i < 40; i++ {
+		good = append(good, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60})
+	}
+	for i := 0; i < 8; i++ {
+		good = append(good, mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	mixed = append(mixed, good...)
+	for i := 0; i < 5; i++ {
+		mixed = append(mixed,
+			mapqPair{0, 3000 + i*900, 60, 0, 30000 + i*500, 5},
+			mapqPair{0, 56000 + i*100, 10, 1, 2000 + i*100, 10},
+			mapqPair{0, 57000 + i*100, 60, 1, 3000 + i*100, 19})
+	}
+
+	extract := func(bamfile string, minMapq int) (*allhic.Extracter, *allhic.MemorySink) {
+		sink := &allhic.MemorySink{}
+		r := &allhic.Extracter{Bamfile: bamfile, Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+			MinLinks: 1, MinMapq: minMapq, Sink: sink}
+		r.Run()
+		return r, sink
+	}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "good.bam", good, false)
+		writeMapqBAM(t, "mixed.bam", mixed, false)
+		writeMapqBAM(t, "noMQ.bam", mixed, true)
+		writeFastaForBAM(t, "good.bam", "contigs.fasta")
+
+		_, want := extract("good.bam", 0)
+		filtered, got := extract("mixed.bam", 20)
+		if filtered.SkippedMapq != 30 {
+			t.Errorf("skipped %d reads, want the 30 reads of the pairs below MAPQ 20", filtered.SkippedMapq)
+		}
+		if !reflect.DeepEqual(got.CLM().M(), want.CLM().M()) {
+			t.Error("links differ from those of the pairs above MAPQ 20")
+		}
+		if !reflect.DeepEqual(got.Model(), want.Model()) {
+			t.Error("distribution differs from that of the pairs above MAPQ 20")
+		}
+		if !reflect.DeepEqual(got.CoverageTrack(), want.CoverageTrack()) {
+			t.Error("coverage differs from that of the pairs above MAPQ 20")
+		}
+
+		if _, all := extract("mixed.bam", 0); reflect.DeepEqual(all.CLM().M(), want.CLM().M()) {
+			t.Error("--minMapq 0 skipped the links of MAPQ 5 to 19")
+		}
+		// Without the MQ tags, only the reads of low MAPQ go
+		if noMQ, _ := extract("noMQ.bam", 20); noMQ.SkippedMapq != 20 {
+			t.Errorf("skipped %d reads without MQ tags, want the 20 reads below MAPQ 20", noMQ.SkippedMapq)
+		}
+	})
+}
+
+// TestExtractRECounts counts the RE sites of soft-masked contigs, across the
+// lines of the FASTA, for degenerate and multiple motifs, into the counts_RE
+// file, whose counts then go into the active.ids
+func TestExtractRECounts(t *testing.T) {
+	contig := func(sites map[int]string) string {
+		s := []byte(strings.Repeat("A", 60000))
+		for pos, site := range sites {
+			copy(s[pos:], site)
+		}
+		var b strings.Builder
+		for i := 0; i < len(s); i += 60 {
+			b.Write(s[i : i+60])
+			b.WriteString("\n")
+		}
+		return b.String()
+	}
+	// The third GATC of ctgA spans the first two lines
+	fasta := ">ctgA\n" + contig(map[int]string{1000: "gatc", 2000: "GATC", 58: "GATC"}) +
+		">ctgB\n" + contig(map[int]string{1000: "GAATC", 2000: "gactc", 3000: "AAGCTT"})
+	var pairs []mapqPair
+	for i := 0; i < 20; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "test.bam", pairs, false)
+		if err := ioutil.WriteFile("contigs.fasta", []byte(fasta), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for RE, want := range map[string]string{
+			"GATC":        "ctgA\t4\t60000 ctgB\t1\t60000",
+			"GATC,GANTC":  "ctgA\t4\t60000 ctgB\t3\t60000",
+			"GARTC":       "ctgA\t1\t60000 ctgB\t2\t60000",
+			"aagctt,GATC": "ctgA\t4\t60000 ctgB\t2\t60000",
+		} {
+			r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: RE, MinLinks: 1}
+			r.Run()
+			s, err := ioutil.ReadFile(r.OutContigsfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+			if rows[0]+"\n" != allhic.REHeader || strings.Join(rows[1:], " ") != want {
+				t.Errorf("RE %s: got counts\n%s\nwant %s", RE, s, want)
+			}
+			if RE != "GATC" {
+				continue
+			}
+			clm := mustNewCLM(t, r.OutClmfile, r.OutContigsfile)
+			clm.WriteActive("test")
+			s, err = ioutil.ReadFile("test.active.ids")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows := strings.Split(string(s), "\n"); !strings.HasSuffix(rows[1], "\t4") ||
+				!strings.HasSuffix(rows[2], "\t1") {
+				t.Errorf("active.ids lack the RE counts:\n%s", s)
+			}
+		}
+	})
+}
+
+// TestExtractBamfiles reads the lanes of a library from two BAM files, as
+// if they were the one BAM of all the lanes, and rejects the headers of
+// other contigs
+func TestExtractBamfiles(t *testing.T) {
+	var lane1, lane2 []mapqPair
+	for i := 0; i < 40; i++ {
+		lane1 = append(lane1, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60})
+		lane2 = append(lane2, mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60},
+			mapqPair{1, 1000 + i*900, 60, 1, 3000 + i*1100, 0})
+	}
+	extract := func(bamfiles ...string) (*allhic.Extracter, *allhic.MemorySink) {
+		sink := &allhic.MemorySink{}
+		r := &allhic.Extracter{Bamfile: bamfiles[0], Bamfiles: bamfiles, Fastafile: "contigs.fasta",
+			RE: allhic.DefaultRE, MinLinks: 1, Sink: sink}
+		r.Run()
+		return r, sink
+	}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "all.bam", append(append([]mapqPair{}, lane1...), lane2...), false)
+		writeMapqBAM(t, "lane1.bam", lane1, false)
+		writeMapqBAM(t, "lane2.bam", lane2, false)
+		writeFastaForBAM(t, "all.bam", "contigs.fasta")
+
+		_, want := extract("all.bam")
+		lanes, got := extract("lane1.bam", "lane2.bam")
+		if !reflect.DeepEqual(got.CLM().M(), want.CLM().M()) {
+			t.Error("links of the lanes differ from those of the merged BAM")
+		}
+		if !reflect.DeepEqual(got.Model(), want.Model()) {
+			t.Error("distribution of the lanes differs from that of the merged BAM")
+		}
+		if !reflect.DeepEqual(got.CoverageTrack(), want.CoverageTrack()) {
+			t.Error("coverage of the lanes differs from that of the merged BAM")
+		}
+		wantStats := []allhic.BamStats{{"lane1.bam", 80, 80}, {"lane2.bam", 160, 120}}
+		if !reflect.DeepEqual(lanes.BamStats, wantStats) {
+			t.Errorf("got stats %+v, want %+v", lanes.BamStats, wantStats)
+		}
+
+		for want, lengths := range map[string]map[string]int{
+			"contig ctgB is 50000 bp in other.bam but 60000 bp in lane1.bam": {"ctgA": 60000, "ctgB": 50000},
+			"contig ctgC of other.bam is not in lane1.bam":                   {"ctgA": 60000, "ctgB": 60000, "ctgC": 1000},
+			"other.bam has 1 contigs but lane1.bam has 2":                    {"ctgA": 60000},
+		} {
+			writeMapqBAMOf(t, "other.bam", lengths, nil, false)
+			r := allhic.Extracter{Bamfiles: []string{"lane1.bam", "other.bam"}}
+			if err := r.CheckHeaders(); err == nil || err.Error() != want {
+				t.Errorf("got error %v, want %q", err, want)
+			}
+		}
+	})
+}
+
+// TestExtractDistribution writes every bin of the link size distribution
+// to the TSV, and the decays fitted to it to the JSON
+func TestExtractDistribution(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping extraction in short mode")
+	}
+	bamfile, err := filepath.Abs(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		writeFastaForBAM(t, "test.bam", "contigs.fasta")
+		sink := allhic.NewFileSink("test", allhic.DefaultRE)
+		r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+			MinLinks: 3, Sink: sink}
+		r.Run()
+
+		s, err := ioutil.ReadFile(sink.OutDistTSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if rows[0]+"\n" != allhic.DistributionTSVHeader {
+			t.Fatalf("unexpected header %q", rows[0])
+		}
+		links, empty, lastEnd := 0, 0, 0
+		for _, row := range rows[1:] {
+			var start, end, n int
+			var density, model float64
+			if _, err := fmt.Sscanf(row, "%d\t%d\t%d\t%g\t%g", &start, &end, &n, &density, &model); err != nil {
+				t.Fatalf("malformed bin %q: %s", row, err)
+			}
+			if lastEnd > 0 && start != lastEnd || end <= start {
+				t.Errorf("bin %q does not follow the bin ending at %d", row, lastEnd)
+			}
+			if n == 0 {
+				empty++
+			}
+			links, lastEnd = links+n, end
+		}
+		if empty == 0 {
+			t.Error("no empty bins in the distribution")
+		}
+
+		var fits allhic.DistributionFits
+		s, err = ioutil.ReadFile(sink.OutDistJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(s, &fits); err != nil {
+			t.Fatal(err)
+		}
+		if fits.SchemaVersion != allhic.DistributionVersion || fits.Bins != len(rows)-1 || fits.Links != links {
+			t.Errorf("fits %+v of the wrong bins, want %d bins of %d links", fits, len(rows)-1, links)
+		}
+		for name, fit := range map[string]allhic.DecayFit{"power law": fits.PowerLaw, "exponential": fits.Exponential} {
+			if fit.Exponent >= 0 || fit.Scale <= 0 || fit.RSquared <= 0 || fit.RSquared > 1 {
+				t.Errorf("%s fit %+v does not decay", name, fit)
+			}
+		}
+		if fits.Best != allhic.DecayPowerLaw && fits.Best != allhic.DecayExponential {
+			t.Errorf("unknown best decay %q", fits.Best)
+		}
+	})
+}
+
+// TestExtractDedup duplicates read pairs of a BAM, and checks that extract
+// --dedup writes the clm of the BAM without them, when the sorts of the
+// links spill to disk too
+func TestExtractDedup(t *testing.T) {
+	var pairs []mapqPair
+	for i := 0; i < 30; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60},
+			mapqPair{1, 40000 - i*300, 60, 0, 50000 + i*250, 60})
+	}
+	duplicated := append([]mapqPair{}, pairs...)
+	for i := 0; i < len(pairs); i += 3 {
+		duplicated = append(duplicated, pairs[i])
+	}
+	duplicated = append(duplicated[:10], append([]mapqPair{duplicated[9], duplicated[9]}, duplicated[10:]...)...)
+	inTempDir(t, func() {
+		writeMapqBAM(t, "clean.bam", pairs, false)
+		writeMapqBAM(t, "dup.bam", duplicated, false)
+		writeFastaForBAM(t, "clean.bam", "contigs.fasta")
+		clean := allhic.Extracter{Bamfile: "clean.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE, MinLinks: 1}
+		clean.Run()
+		want, err := ioutil.ReadFile(clean.OutClmfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, memory := range []int64{0, 500} {
+			dedup := allhic.Extracter{Bamfile: "dup.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+				MinLinks: 1, Dedup: true, DedupMemory: memory}
+			dedup.Run()
+			if dedup.Duplicates != 2*(len(duplicated)-len(pairs)) {
+				t.Errorf("memory %d: removed %d duplicates, want %d", memory, dedup.Duplicates,
+					2*(len(duplicated)-len(pairs)))
+			}
+			got, err := ioutil.ReadFile(dedup.OutClmfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("memory %d: got clm\n%s\nwant\n%s", memory, got, want)
+			}
+		}
+	})
+}
+
+// TestExtractLowMem checks that extract --lowmem, the inter-contig links
+// sorted on disk in many runs and the intra-contig links binned as they
+// come, writes the outputs of the links in memory, the distribution
+// included, and leaves no temporary files behind
+func TestExtractLowMem(t *testing.T) {
+	lengths := map[string]int{"ctgA": 90000, "ctgB": 60000, "ctgC": 30000, "ctgD": 120000}
+	var pairs []mapqPair
+	for i := 0; i < 40; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60},
+			mapqPair{3, 5000 + i*2000, 60, 3, 90000 + i*500, 60},
+			mapqPair{2, 29000 - i*300, 60, 0, 85000 + i*100, 60},
+			mapqPair{1, 1000 + i*900, 60, 3, 119000 - i*50, 60})
+		if i%3 == 0 {
+			pairs = append(pairs, mapqPair{3, 60000 + i*400, 60, 0, 44000 + i*600, 60},
+				mapqPair{1, 59000 - i*10, 60, 2, 500 + i*10, 60})
+		}
+	}
+	inTempDir(t, func() {
+		writeMapqBAMOf(t, "reads.bam", lengths, pairs, false)
+		writeFastaForBAM(t, "reads.bam", "contigs.fasta")
+		if err := os.Mkdir("tmp", 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range []struct {
+			minDist  int
+			bins     int
+			binScale string
+		}{{0, 0, ""}, {20000, 0, ""}, {0, 40, allhic.BinScaleLinear}} {
+			outputs := map[bool]map[string]string{}
+			for _, lowmem := range []bool{false, true} {
+				dir := fmt.Sprintf("lowmem%v-%d-%d", lowmem, tt.minDist, tt.bins)
+				r := allhic.Extracter{Bamfile: "reads.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+					MinLinks: 1, MinDist: tt.minDist, Bins: tt.bins, BinScale: tt.binScale, Dedup: true,
+					LowMem: lowmem, DedupMemory: 500, TempDir: "tmp", OutPrefix: filepath.Join(dir, "reads")}
+				r.Run()
+				files, err := ioutil.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				outputs[lowmem] = map[string]string{}
+				for _, file := range files {
+					data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+					if err != nil {
+						t.Fatal(err)
+					}
+					outputs[lowmem][file.Name()] = string(data)
+				}
+			}
+			if len(outputs[true]) != len(outputs[false]) || outputs[false]["reads.clm"] == "" ||
+				!strings.Contains(outputs[false]["reads.distribution.txt"], "#Bin") {
+				t.Errorf("%+v: %d outputs with --lowmem, want %d with the distribution", tt,
+					len(outputs[true]), len(outputs[false]))
+			}
+			for name, want := range outputs[false] {
+				if got := outputs[true][name]; got != want {
+					t.Errorf("%+v: %s with --lowmem\n%s\nwant\n%s", tt, name, got, want)
+				}
+			}
+		}
+		left, err := ioutil.ReadDir("tmp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d temporary files left, e.g. %s", len(left), left[0].Name())
+		}
+	})
+}
+
+// TestExtractFlags extracts a BAM of pairs of each combination of the
+// secondary, supplementary, QC-fail and duplicate flags, which are skipped
+// by default, and checks the reasons counted and the keep flags
+func TestExtractFlags(t *testing.T) {
+	var good, flagged []mapqPair
+	var flags []sam.Flags
+	for i := 0; i < 20; i++ {
+		good = append(good, mapqPair{0, 1000 + i*700, 60, 0, 2000 + i*1300, 60})
+	}
+	flagged = append(flagged, good...)
+	flags = make([]sam.Flags, len(good))
+	bits := []sam.Flags{sam.Secondary, sam.Supplementary, sam.QCFail, sam.Duplicate}
+	var kept []mapqPair
+	for mask := 1; mask < 16; mask++ {
+		pair := mapqPair{0, 30000 + mask*500, 60, 1, 1000 + mask*900, 60}
+		var f sam.Flags
+		for i, bit := range bits {
+			if mask&(1<<i) != 0 {
+				f |= bit
+			}
+		}
+		flagged, flags = append(flagged, pair), append(flags, f)
+		if f&sam.Duplicate == 0 {
+			kept = append(kept, pair)
+		}
+	}
+	flagged = append(flagged,
+		mapqPair{0, 50000, 60, 1, 50000, 60},
+		mapqPair{0, 51000, 0, 1, 51000, 0},
+		mapqPair{0, 52000, 0, 1, 52000, 0})
+	flags = append(flags, sam.Unmapped|sam.Secondary, sam.Duplicate, 0)
+
+	lengths := map[string]int{"ctgA": 60000, "ctgB": 60000}
+	extract := func(bamfile string, edit func(*allhic.Extracter)) (*allhic.Extracter, *allhic.MemorySink) {
+		sink := &allhic.MemorySink{}
+		r := &allhic.Extracter{Bamfile: bamfile, Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+			MinLinks: 1, Sink: sink}
+		edit(r)
+		r.Run()
+		return r, sink
+	}
+	none := func(r *allhic.Extracter) {}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "good.bam", good, false)
+		writeMapqBAM(t, "kept.bam", append(append([]mapqPair{}, good...), kept...), false)
+		writeFlagsBAMOf(t, "flagged.bam", lengths, flagged, flags, false)
+		writeFastaForBAM(t, "good.bam", "contigs.fasta")
+
+		_, want := extract("good.bam", none)
+		r, got := extract("flagged.bam", none)
+		skipped := allhic.SkippedReads{Unmapped: 2, Secondary: 16, Supplementary: 8, QCFail: 4,
+			Duplicate: 4, MapqZero: 2}
+		if r.Skipped != skipped {
+			t.Errorf("skipped %+v, want %+v", r.Skipped, skipped)
+		}
+		if !reflect.DeepEqual(got.CLM().M(), want.CLM().M()) {
+			t.Error("links differ from those of the pairs without flags")
+		}
+
+		r, _ = extract("flagged.bam", func(r *allhic.Extracter) { r.KeepSecondary = true })
+		skipped = allhic.SkippedReads{Unmapped: 2, Supplementary: 16, QCFail: 8, Duplicate: 6, MapqZero: 2}
+		if r.Skipped != skipped || r.BamStats[0].Used != 2*len(good)+2 {
+			t.Errorf("--keepSecondary skipped %+v and used %d reads, want %+v and %d",
+				r.Skipped, r.BamStats[0].Used, skipped, 2*len(good)+2)
+		}
+
+		_, want = extract("kept.bam", none)
+		r, got = extract("flagged.bam", func(r *allhic.Extracter) {
+			r.KeepSecondary, r.KeepSupplementary, r.KeepQCFail = true, true, true
+		})
+		skipped = allhic.SkippedReads{Unmapped: 2, Duplicate: 18, MapqZero: 2}
+		if r.Skipped != skipped {
+			t.Errorf("keeping all skipped %+v, want %+v", r.Skipped, skipped)
+		}
+		if !reflect.DeepEqual(got.CLM().M(), want.CLM().M()) {
+			t.Error("links differ from those of the pairs without the duplicate flag")
+		}
+	})
+}
+
+// extractFiles runs extract on the BAM with the threads, and returns the
+// files it writes by name
+func extractFiles(t testing.TB, bamfile string, threads int, dedup bool) map[string]string {
+	files := make(map[string]string)
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		writeFastaForBAM(t, "test.bam", "contigs.fasta")
+		r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+			MinLinks: 3, Threads: threads, Dedup: dedup}
+		r.Run()
+		entries, err := ioutil.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), "test.") || entry.Name() == "test.bam" {
+				continue
+			}
+			s, err := ioutil.ReadFile(entry.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = string(s)
+		}
+	})
+	return files
+}
+
+// TestExtractThreads decodes the BAM in parallel, which must write the
+// files of the serial read byte for byte
+func TestExtractThreads(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping extraction in short mode")
+	}
+	bamfile, err := filepath.Abs(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dedup := range []bool{false, true} {
+		want := extractFiles(t, bamfile, 1, dedup)
+		if want["test.clm"] == "" {
+			t.Fatalf("no clm among %d files", len(want))
+		}
+		for _, threads := range []int{2, 3, 8} {
+			got := extractFiles(t, bamfile, threads, dedup)
+			if len(got) != len(want) {
+				t.Errorf("threads=%d: wrote %d files, want %d", threads, len(got), len(want))
+			}
+			for name, s := range want {
+				if got[name] != s {
+					t.Errorf("threads=%d dedup=%t: %s differs from the serial read", threads, dedup, name)
+				}
+			}
+		}
+	}
+}
+
+// benchBAMPairs is the size of the synthetic BAM of BenchmarkExtractThreads,
+// about 25 bytes a pair; 1 << 27 pairs make a BAM of about 3 GB
+const benchBAMPairs = 1 << 20
+
+// BenchmarkExtractThreads reports the throughput of extract, in MB/s of the
+// BAM, on a synthetic BAM of random pairs on 100 contigs
+func BenchmarkExtractThreads(b *testing.B) {
+	lengths := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		lengths[fmt.Sprintf("ctg%03d", i)] = 1000000
+	}
+	rng := rand.New(rand.NewSource(1))
+	pairs := make([]mapqPair, benchBAMPairs)
+	for i := range pairs {
+		a, b := rng.Intn(100), rng.Intn(100)
+		if rng.Intn(4) > 0 {
+			b = a
+		}
+		pairs[i] = mapqPair{a, rng.Intn(1000000), 60, b, rng.Intn(1000000), 60}
+	}
+	threads := []int{1, 2, 4}
+	if runtime.NumCPU() > 4 {
+		threads = append(threads, runtime.NumCPU())
+	}
+	inTempDir(b, func() {
+		writeMapqBAMOf(b, "bench.bam", lengths, pairs, false)
+		writeFastaForBAM(b, "bench.bam", "contigs.fasta")
+		fi, err := os.Stat("bench.bam")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, n := range threads {
+			b.Run(fmt.Sprintf("threads=%d", n), func(b *testing.B) {
+				b.SetBytes(fi.Size())
+				for i := 0; i < b.N; i++ {
+					r := allhic.Extracter{Bamfile: "bench.bam", Fastafile: "contigs.fasta",
+						RE: allhic.DefaultRE, MinLinks: 3, Threads: n}
+					r.Run()
+				}
+			})
+		}
+	})
+}
+
+// TestExtractContigLinks writes the links of each contig, and flags the
+// contig whose links mostly go to the others as it would a chimera
+func TestExtractContigLinks(t *testing.T) {
+	lengths := make(map[string]int)
+	var pairs []mapqPair
+	for i := 0; i < 10; i++ {
+		lengths[fmt.Sprintf("ctg%02d", i)] = 60000
+		intra := 20
+		if i == 5 {
+			intra = 2
+		}
+		for j := 0; j < intra; j++ {
+			pairs = append(pairs, mapqPair{i, 1000 + j*2000, 60, i, 50000 - j*1000, 60})
+		}
+		if i < 9 {
+			pairs = append(pairs, mapqPair{i, 100, 60, i + 1, 200, 60}, mapqPair{i, 300, 60, i + 1, 400, 60})
+		}
+	}
+	for j := 0; j < 20; j++ {
+		partner := j % 9
+		if partner >= 5 {
+			partner++
+		}
+		pairs = append(pairs, mapqPair{5, 1000 + j*100, 60, partner, 2000 + j*100, 60})
+	}
+	inTempDir(t, func() {
+		writeMapqBAMOf(t, "links.bam", lengths, pairs, false)
+		writeFastaForBAM(t, "links.bam", "contigs.fasta")
+		r := allhic.Extracter{Bamfile: "links.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE, MinLinks: 1}
+		r.Run()
+		s, err := ioutil.ReadFile("links.contig_links.tsv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if len(rows) != 11 || rows[0]+"\n" != allhic.ContigLinksHeader {
+			t.Fatalf("malformed contig links:\n%s", s)
+		}
+		// Each pair links both of its reads
+		if want := "ctg05\t60000\t4\t48\t9\t0.08333\tlow_cis_trans"; rows[6] != want {
+			t.Errorf("got row %q, want %q", rows[6], want)
+		}
+		for _, row := range rows[1:] {
+			if strings.HasSuffix(row, allhic.FlagLowCisTrans) != strings.HasPrefix(row, "ctg05") {
+				t.Errorf("row %q is flagged wrongly", row)
+			}
+		}
+		if want := "ctg00\t60000\t40\t10\t2\t4\t-"; rows[1] != want {
+			t.Errorf("got row %q, want %q", rows[1], want)
+		}
+	})
+}
+
+// TestExtractBins writes the distribution of custom bins, which the reader
+// of the distribution files reads back, and that of the default bins,
+// which are those of LACHESIS
+func TestExtractBins(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping extraction in short mode")
+	}
+	bamfile, err := filepath.Abs(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		writeFastaForBAM(t, "test.bam", "contigs.fasta")
+		var lachesis string
+		for _, tc := range []struct {
+			bins  int
+			scale string
+		}{{0, ""}, {256, allhic.BinScaleLog}, {300, allhic.BinScaleLog}, {50, allhic.BinScaleLinear}} {
+			sink := allhic.NewFileSink("test", allhic.DefaultRE)
+			r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+				MinLinks: 3, Bins: tc.bins, BinScale: tc.scale, Sink: sink}
+			r.Run()
+			model, err := allhic.ReadLinkDistribution(sink.OutDistfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := allhic.NewSpacedModel(tc.bins, tc.scale)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(model.BinStarts(), want.BinStarts()) {
+				t.Errorf("%d %s bins: read back the bins\n%v\nwant\n%v", tc.bins, tc.scale,
+					model.BinStarts(), want.BinStarts())
+			}
+			links := 0
+			for _, n := range model.NLinks() {
+				links += n
+			}
+			if links == 0 {
+				t.Errorf("%d %s bins: no links read back", tc.bins, tc.scale)
+			}
+			s, err := ioutil.ReadFile(sink.OutDistfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tc.bins == 0:
+				lachesis = string(s)
+			case tc.bins == 256 && string(s) != lachesis:
+				t.Error("256 log bins, 16 in each doubling, differ from the default bins of LACHESIS")
+			}
+		}
+	})
+}
+
+func TestSpacedModelErrors(t *testing.T) {
+	for _, tc := range []struct {
+		bins  int
+		scale string
+		want  string
+	}{
+		{10, "sqrt", "unknown bin scale sqrt"},
+		{0, allhic.BinScaleLinear, "linear bins need their number"},
+		{-1, allhic.BinScaleLog, "cannot make -1 bins"},
+		{1 << 28, allhic.BinScaleLog, "cannot make 268435456 bins"},
+	} {
+		if _, err := allhic.NewSpacedModel(tc.bins, tc.scale); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%d %s bins: got error %v, want %q", tc.bins, tc.scale, err, tc.want)
+		}
+	}
+	linear, err := allhic.NewSpacedModel(4, allhic.BinScaleLinear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{allhic.MinLinkDist, 33555968, 67109888, 100663808, allhic.MaxLinkDist}
+	if !reflect.DeepEqual(linear.BinStarts(), want) {
+		t.Errorf("got linear bins %v, want %v", linear.BinStarts(), want)
+	}
+}
+
+// TestExtractDists bounds the intra-contig links of the distribution by
+// --minDist and --maxDist, and the inter-contig link sizes of the clm by
+// --minDist
+func TestExtractDists(t *testing.T) {
+	var pairs []mapqPair
+	for _, dist := range []int{500, 3000, 5000, 20000, 40000} {
+		for i := 0; i < 5; i++ {
+			pairs = append(pairs, mapqPair{0, 1000 + i*100, 60, 0, 1000 + i*100 + dist, 60})
+		}
+	}
+	pairs = append(pairs, mapqPair{0, 59000, 60, 1, 500, 60}, mapqPair{0, 30000, 60, 1, 30000, 60})
+	inTempDir(t, func() {
+		writeMapqBAM(t, "dists.bam", pairs, false)
+		writeFastaForBAM(t, "dists.bam", "contigs.fasta")
+		r := allhic.Extracter{Bamfile: "dists.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+			MinLinks: 1, MinDist: 4000, MaxDist: 30000}
+		r.Run()
+		// Each pair links both of its reads, those under 2 kb never count
+		if r.SkippedMinDist != 10 || r.SkippedMaxDist != 10 || r.SkippedInterMinDist != 2 {
+			t.Errorf("skipped %d, %d and %d links, want 10 below --minDist, 10 above --maxDist and 2 inter",
+				r.SkippedMinDist, r.SkippedMaxDist, r.SkippedInterMinDist)
+		}
+		model, err := allhic.ReadLinkDistribution("dists.distribution.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		links := 0
+		for _, n := range model.NLinks() {
+			links += n
+		}
+		if links != 20 {
+			t.Errorf("distribution has %d links, want the 20 from 5 to 20 kb", links)
+		}
+		s, err := ioutil.ReadFile(r.OutClmfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "ctgA+ ctgB+\t2\t60000 60000\n"
+		if rows := strings.Split(string(s), "\n"); rows[0]+"\n" != want || len(rows) != 5 {
+			t.Errorf("got clm\n%s\nwant the first row %q", s, want)
+		}
+	})
+}
+
+// TestExtractEmptyDistribution fails on bounds that leave no intra-contig
+// link to the distribution, in place of fitting it to nothing
+func TestExtractEmptyDistribution(t *testing.T) {
+	var pairs []mapqPair
+	for i := 0; i < 20; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 20000 + i*1300, 60},
+			mapqPair{1, 1000 + i*500, 60, 1, 30000 + i*200, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	tests := []struct {
+		name string
+		r    allhic.Extracter
+		flag string
+	}{
+		{"minDist", allhic.Extracter{MinDist: 50000}, "--minDist 50000"},
+		{"minDist lowmem", allhic.Extracter{MinDist: 50000, LowMem: true}, "--minDist 50000"},
+		{"distLowerBound", allhic.Extracter{DistLowerBound: 50000}, "--distLowerBound 50000"},
+		{"distLowerBound lowmem", allhic.Extracter{DistLowerBound: 50000, LowMem: true}, "--distLowerBound 50000"},
+	}
+	inTempDir(t, func() {
+		writeMapqBAMOf(t, "empty.bam", map[string]int{"ctgA": 60000, "ctgB": 40000}, pairs, false)
+		writeFastaForBAM(t, "empty.bam", "contigs.fasta")
+		for _, tt := range tests {
+			r := tt.r
+			r.Bamfile, r.Fastafile, r.RE, r.MinLinks = "empty.bam", "contigs.fasta", allhic.DefaultRE, 1
+			r.Sink = &allhic.MemorySink{}
+			err := r.Run()
+			if err == nil || !strings.Contains(err.Error(), "no intra-contig link") ||
+				!strings.Contains(err.Error(), tt.flag) {
+				t.Errorf("%s: got error %v, want no intra-contig link naming %s", tt.name, err, tt.flag)
+			}
+		}
+	})
+}
+
+// TestExtractDistLowerBound fits the distribution of links of a power law
+// of exponent -1, over an excess of short links of religation, which
+// steepen the fit unless --distLowerBound leaves them out
+func TestExtractDistLowerBound(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var links []allhic.LinkRecord
+	for i := 0; i < 20000; i++ {
+		// Log-uniform link sizes, of density 1/x
+		x := int(allhic.MinLinkDist * math.Pow(2, 9*rng.Float64()))
+		links = append(links, allhic.LinkRecord{ContigA: 0, PosA: i, ContigB: 0, PosB: i + x})
+	}
+	for i := 0; i < 5000; i++ {
+		x := allhic.MinLinkDist + rng.Intn(2000)
+		links = append(links, allhic.LinkRecord{ContigA: 0, PosA: i, ContigB: 0, PosB: i + x})
+	}
+	for i := 0; i < 10; i++ {
+		links = append(links, allhic.LinkRecord{ContigA: 0, PosA: 99990000 + i, ContigB: 1, PosB: 1000 + i})
+	}
+	inTempDir(t, func() {
+		var clms []string
+		exponents := map[int]float64{}
+		for _, bound := range []int{0, 16384} {
+			contigs := []*allhic.ContigInfo{allhic.NewContigInfo("ctgA", 1, 100000000),
+				allhic.NewContigInfo("ctgB", 1, 100000)}
+			agg := allhic.NewLinkAggregator(contigs, 1)
+			agg.DistLowerBound = bound
+			for _, link := range links {
+				agg.Add(link)
+			}
+			prefix := fmt.Sprintf("bound%d", bound)
+			sink := allhic.NewFileSink(prefix, allhic.DefaultRE)
+			if err := agg.Finish(sink); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			model, err := allhic.ReadLinkDistribution(sink.OutDistfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := bound
+			if bound == 0 {
+				want = allhic.DistLowerBound
+			}
+			if model.DistLowerBound() != want {
+				t.Errorf("distribution from %d bp, want %d", model.DistLowerBound(), want)
+			}
+			var fits allhic.DistributionFits
+			data, err := ioutil.ReadFile(sink.OutDistJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &fits); err != nil {
+				t.Fatal(err)
+			}
+			if fits.DistLowerBound != want {
+				t.Errorf("fits from %d bp, want %d", fits.DistLowerBound, want)
+			}
+			exponents[bound] = fits.PowerLaw.Exponent
+			clm, err := ioutil.ReadFile(sink.OutClmfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clms = append(clms, string(clm))
+		}
+		if exponents[0] > -1.1 || math.Abs(exponents[16384]+1) > 0.05 {
+			t.Errorf("power law exponents %.3f and %.3f from 16 kb, want under -1.1 and -1",
+				exponents[0], exponents[16384])
+		}
+		if clms[0] != clms[1] || clms[0] == "" {
+			t.Errorf("clm changed with the bound:\n%s\n%s", clms[0], clms[1])
+		}
+	})
+}
+
+// TestExtractContigFilter leaves an organelle out of extract, by its
+// exclude list or the include list of the others, which must yield the
+// outputs of the BAM without it
+func TestExtractContigFilter(t *testing.T) {
+	var kept, all []mapqPair
+	for i := 0; i < 20; i++ {
+		kept = append(kept, mapqPair{0, 1000 + i*700, 60, 0, 20000 + i*1300, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	all = append(all, kept...)
+	for i := 0; i < 5; i++ {
+		all = append(all, mapqPair{0, 3000 + i*100, 60, 2, 4000 + i*100, 60},
+			mapqPair{2, 1000 + i*100, 60, 2, 30000 + i*100, 60})
+	}
+	extract := func(bamfile, includefile, excludefile string) (*allhic.Extracter, *allhic.MemorySink) {
+		sink := &allhic.MemorySink{}
+		r := &allhic.Extracter{Bamfile: bamfile, Fastafile: bamfile + ".fasta", RE: allhic.DefaultRE,
+			MinLinks: 1, Includefile: includefile, Excludefile: excludefile, Sink: sink}
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return r, sink
+	}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "kept.bam", kept, false)
+		writeMapqBAMOf(t, "all.bam", map[string]int{"ctgA": 60000, "ctgB": 60000, "ctgM": 60000}, all, false)
+		writeFastaForBAM(t, "kept.bam", "kept.bam.fasta")
+		writeFastaForBAM(t, "all.bam", "all.bam.fasta")
+		writeFiles(t, map[string]string{
+			"exclude.txt": "#Contig\nctgM\nctgX\n",
+			"include.txt": "ctgA\nctgB\n",
+		})
+
+		_, want := extract("kept.bam", "", "")
+		for _, lists := range [][2]string{{"", "exclude.txt"}, {"include.txt", ""}, {"include.txt", "exclude.txt"}} {
+			r, got := extract("all.bam", lists[0], lists[1])
+			if r.SkippedContigs != 20 {
+				t.Errorf("%v: skipped %d reads, want the 20 reads of the pairs on ctgM", lists, r.SkippedContigs)
+			}
+			if !reflect.DeepEqual(got.CLM().M(), want.CLM().M()) || len(got.CLM().Tigs) != len(want.CLM().Tigs) {
+				t.Errorf("%v: links differ from those of the BAM without ctgM", lists)
+			}
+			if !reflect.DeepEqual(got.Model(), want.Model()) {
+				t.Errorf("%v: distribution differs from that of the BAM without ctgM", lists)
+			}
+			if !reflect.DeepEqual(got.CoverageTrack(), want.CoverageTrack()) {
+				t.Errorf("%v: coverage differs from that of the BAM without ctgM", lists)
+			}
+		}
+
+		// Lists that leave no contig fail before any read
+		writeFiles(t, map[string]string{"none.txt": "ctgX\n"})
+		for _, lists := range [][2]string{{"none.txt", ""}, {"include.txt", "include.txt"}} {
+			r := &allhic.Extracter{Bamfile: "all.bam", Fastafile: "all.bam.fasta", RE: allhic.DefaultRE,
+				MinLinks: 1, Includefile: lists[0], Excludefile: lists[1], Sink: &allhic.MemorySink{}}
+			if err := r.Run(); err == nil || !strings.Contains(err.Error(), "no contig") {
+				t.Errorf("%v: got error %v, want no contig left", lists, err)
+			}
+		}
+	})
+}
+
+// TestExtractOutPrefix writes all the files of extract to the prefix, in a
+// new directory, and none next to the BAM file
+func TestExtractOutPrefix(t *testing.T) {
+	var pairs []mapqPair
+	for i := 0; i < 20; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 20000 + i*1300, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	extract := func(outPrefix string) map[string]string {
+		files := make(map[string]string)
+		inTempDir(t, func() {
+			writeMapqBAM(t, "test.bam", pairs, false)
+			writeFastaForBAM(t, "test.bam", "contigs.fasta")
+			r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+				MinLinks: 1, OutPrefix: outPrefix}
+			r.Run()
+			if outPrefix != "" && r.OutClmfile != outPrefix+".clm" {
+				t.Errorf("clmfile is %s, want %s.clm", r.OutClmfile, outPrefix)
+			}
+			err := filepath.Walk(".", func(name string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() || name == "test.bam" || name == "contigs.fasta" {
+					return err
+				}
+				s, err := ioutil.ReadFile(name)
+				files[filepath.ToSlash(name)] = string(s)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		return files
+	}
+
+	want := extract("")
+	got := extract("out/run1")
+	if len(got) == 0 || len(got) != len(want) {
+		t.Fatalf("wrote %d files, want the %d files without a prefix", len(got), len(want))
+	}
+	for name, s := range got {
+		if !strings.HasPrefix(name, "out/run1.") {
+			t.Errorf("wrote %s outside of the prefix", name)
+			continue
+		}
+		if w, ok := want["test."+strings.TrimPrefix(name, "out/run1.")]; !ok || w != s {
+			t.Errorf("%s differs from the file without a prefix", name)
+		}
+	}
+}
+
+// TestExtractOmniC counts the contigs by their lengths less the Ns in the
+// omnic mode, which the distribution records
+func TestExtractOmniC(t *testing.T) {
+	var pairs []mapqPair
+	for i := 0; i < 20; i++ {
+		pairs = append(pairs, mapqPair{0, 1000 + i*700, 60, 0, 20000 + i*1300, 60},
+			mapqPair{0, 55000 + i*100, 60, 1, 1000 + i*200, 60})
+	}
+	inTempDir(t, func() {
+		writeMapqBAM(t, "test.bam", pairs, false)
+		writeFiles(t, map[string]string{
+			"contigs.fasta": ">ctgA\n" + strings.Repeat("ACGT", 14750) + strings.Repeat("N", 500) +
+				strings.Repeat("n", 500) + "\n>ctgB\n" + strings.Repeat("GATC", 15000) + "\n",
+		})
+		for _, mode := range []string{allhic.ModeRE, allhic.ModeOmniC} {
+			r := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+				Mode: mode, MinLinks: 1}
+			r.Run()
+			counts, err := ioutil.ReadFile(r.OutContigsfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := allhic.REHeader + "ctgA\t1\t60000\nctgB\t15001\t60000\n"
+			if mode == allhic.ModeOmniC {
+				want = allhic.OmniCHeader + "ctgA\t59000\t60000\nctgB\t60000\t60000\n"
+				if r.OutContigsfile != "test.counts_omnic.txt" {
+					t.Errorf("counts written to %s, want test.counts_omnic.txt", r.OutContigsfile)
+				}
+			}
+			if string(counts) != want {
+				t.Errorf("%s: counts are\n%s, want\n%s", mode, counts, want)
+			}
+
+			model, err := allhic.ReadLinkDistribution("test.distribution.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if model.Mode() != mode {
+				t.Errorf("distribution is of the %s mode, want %s", model.Mode(), mode)
+			}
+			var fits allhic.DistributionFits
+			s, err := ioutil.ReadFile("test.distribution.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(s, &fits); err != nil || fits.Mode != mode {
+				t.Errorf("distribution.json is of the %s mode, want %s (%v)", fits.Mode, mode, err)
+			}
+		}
+	})
+}
+
+// TestExtractValidPairs extracts the validPairs of HiC-Pro of the same read
+// pairs as a BAM, which must write the same files
+func TestExtractValidPairs(t *testing.T) {
+	lengths := map[string]int{"ctgA": 60000, "ctgB": 60000, "ctgC": 30000}
+	var pairs []mapqPair
+	var flags []sam.Flags
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 400; i++ {
+		a, b := rng.Intn(3), rng.Intn(3)
+		pair := mapqPair{a, rng.Intn(30000), 60, b, rng.Intn(30000), 60}
+		if i%10 == 0 {
+			pair.mapqB = 10
+		}
+		if i%25 == 0 {
+			pair.mapqA = 0
+		}
+		pairs = append(pairs, pair)
+		flags = append(flags, []sam.Flags{0, sam.Reverse | sam.MateReverse}[i%2])
+	}
+	names := []string{"ctgA", "ctgB", "ctgC"}
+	var b strings.Builder
+	b.WriteString("# HiC-Pro allValidPairs\n")
+	for i, p := range pairs {
+		strand := []string{"+", "-"}[i%2]
+		fmt.Fprintf(&b, "pair%d\t%s\t%d\t%s\t%s\t%d\t%s\t300\tHIC_%s_1\tHIC_%s_2\t%d\t%d\n",
+			i, names[p.a], p.posA+1, strand, names[p.b], p.posB+1, strand,
+			names[p.a], names[p.b], p.mapqA, p.mapqB)
+	}
+
+	read := func(dir string) map[string]string {
+		files := make(map[string]string)
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			s, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = string(s)
+		}
+		return files
+	}
+	inTempDir(t, func() {
+		writeFlagsBAMOf(t, "test.bam", lengths, pairs, flags, false)
+		writeFastaForBAM(t, "test.bam", "contigs.fasta")
+		writeFiles(t, map[string]string{"test.allValidPairs": b.String()})
+		gzipFile(t, "test.allValidPairs", "test.allValidPairs.gz")
+
+		for input, dir := range map[string]string{"test.bam": "bam", "test.allValidPairs.gz": "validpairs"} {
+			r := allhic.Extracter{Bamfile: input, Fastafile: "contigs.fasta", RE: allhic.DefaultRE,
+				MinLinks: 1, MinMapq: 20, OutPrefix: filepath.Join(dir, "test")}
+			r.Run()
+			if r.BamStats[0].Reads != 2*len(pairs) || r.SkippedMapq == 0 || r.Skipped.MapqZero == 0 {
+				t.Errorf("%s: %d reads, %d skipped for their MAPQ and %d of MAPQ 0, want %d reads",
+					input, r.BamStats[0].Reads, r.SkippedMapq, r.Skipped.MapqZero, 2*len(pairs))
+			}
+		}
+		want, got := read("bam"), read("validpairs")
+		if len(got) == 0 || len(got) != len(want) {
+			t.Fatalf("wrote %d files, want the %d files of the BAM", len(got), len(want))
+		}
+		for name, s := range want {
+			if got[name] != s {
+				t.Errorf("%s differs from that of the BAM", name)
+			}
+		}
+	})
+}
+
+// poreCSegment is an aligned segment of a Pore-C read of the fixture
+type poreCSegment struct {
+	read string
+	ref  int
+	pos  int
+}
+
+// writePoreCBAM writes the segments of the Pore-C reads into a BAM of the
+// contigs, the first of each read primary and the others supplementary,
+// with the program of pore-c-py in the header
+func writePoreCBAM(t testing.TB, filename string, names []string, length int, segments []poreCSegment) {
+	var refs []*sam.Reference
+	for _, name := range names {
+		ref, err := sam.NewReference(name, "", "", length, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	h, err := sam.NewHeader([]byte("@HD\tVN:1.6\tSO:unsorted\n@PG\tID:pore-c-py\tPN:pore-c-py\n"), refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := bam.NewWriter(f, h, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, qual := []byte("ACGTACGTAC"), []byte("IIIIIIIIII")
+	cigar := []sam.CigarOp{sam.NewCigarOp(sam.CigarMatch, len(seq))}
+	for i, s := range segments {
+		rec, err := sam.NewRecord(s.read, refs[s.ref], nil, s.pos, -1, 0, 60, cigar, seq, qual, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && segments[i-1].read == s.read {
+			rec.Flags |= sam.Supplementary
+		}
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPoreCContacts decomposes a 4-way read into its six pairs, weighed
+// 2/3 each with the downweight, as four whole links
+func TestPoreCContacts(t *testing.T) {
+	for _, downweight := range []bool{false, true} {
+		contacts := allhic.PoreCContacts(4, downweight)
+		want := []allhic.PoreCContact{{I: 0, J: 1}, {I: 0, J: 2}, {I: 0, J: 3},
+			{I: 1, J: 2}, {I: 1, J: 3}, {I: 2, J: 3}}
+		for i := range want {
+			want[i].Weight = 1
+			if downweight {
+				want[i].Weight = 2.0 / 3
+			}
+		}
+		if !reflect.DeepEqual(contacts, want) {
+			t.Errorf("downweight %v: contacts are %v, want %v", downweight, contacts, want)
+		}
+		links := allhic.PoreCLinks([]byte("read1"), contacts)
+		total := 0
+		for _, n := range links {
+			if n < 0 || n > 1 {
+				t.Errorf("downweight %v: %v links, want 0 or 1 for each pair", downweight, links)
+			}
+			total += n
+		}
+		if want := map[bool]int{false: 6, true: 4}[downweight]; total != want {
+			t.Errorf("downweight %v: %d links, want %d", downweight, total, want)
+		}
+		if again := allhic.PoreCLinks([]byte("read1"), contacts); !reflect.DeepEqual(again, links) {
+			t.Errorf("downweight %v: links %v then %v for the same read", downweight, links, again)
+		}
+	}
+	if links := allhic.PoreCLinks([]byte("read2"), allhic.PoreCContacts(2, true)); !reflect.DeepEqual(links, []int{2}) {
+		t.Errorf("2-way read has %v links, want [2] of its weight 2", links)
+	}
+}
+
+// TestExtractPoreC extracts the links of all the pairs of the segments of
+// Pore-C reads, told by the header of the BAM
+func TestExtractPoreC(t *testing.T) {
+	names := []string{"ctgA", "ctgB", "ctgC", "ctgD"}
+	segments := []poreCSegment{
+		{"read4", 0, 1000}, {"read4", 1, 2000}, {"read4", 2, 3000}, {"read4", 3, 4000},
+		{"read2", 0, 5000}, {"read2", 1, 6000},
+		{"read1", 2, 7000},
+		{"cis2", 3, 10000}, {"cis2", 3, 40000},
+	}
+	inTempDir(t, func() {
+		writePoreCBAM(t, "porec.bam", names, 60000, segments)
+		writeFastaForBAM(t, "porec.bam", "porec.fasta")
+		for _, downweight := range []bool{false, true} {
+			sink := &allhic.MemorySink{}
+			r := allhic.Extracter{Bamfile: "porec.bam", Fastafile: "porec.fasta", RE: allhic.DefaultRE,
+				MinLinks: 1, PoreCDownweight: downweight, Sink: sink}
+			r.Run()
+			if !reflect.DeepEqual(r.PoreCReads, []int{0, 1, 2, 0, 1}) {
+				t.Errorf("reads by their segments are %v, want one of 1 and 4, two of 2", r.PoreCReads)
+			}
+			if r.Skipped.Supplementary != 0 {
+				t.Errorf("skipped %d supplementary segments", r.Skipped.Supplementary)
+			}
+			total := 0
+			for _, stats := range sink.ContigLinkStats() {
+				total += stats.InterLinks
+				if !downweight && stats.Partners != 3 {
+					t.Errorf("%s has %d partners, want the 3 others of read4", stats.Name, stats.Partners)
+				}
+			}
+			// Both directions of each pair count for both contigs: the 6
+			// pairs of read4 and the pair of read2, or 4 of the pairs of
+			// read4 and the pair of read2 twice, weighed 2/(n-1)
+			if want := map[bool]int{false: 4 * (6 + 1), true: 4 * (4 + 2)}[downweight]; total != want {
+				t.Errorf("downweight %v: %d inter-contig links, want %d", downweight, total, want)
+			}
+		}
+	})
+}
+
+// TestExtractLibraryQC extracts read pairs of each class of the library QC,
+// and checks the counts, the warnings and their thresholds
+func TestExtractLibraryQC(t *testing.T) {
+	pairs := []mapqPair{
+		{0, 1000, 60, 0, 1500, 60},  // Outward, a self-circle
+		{0, 3000, 60, 0, 2500, 60},  // Inward, religated
+		{0, 1000, 60, 0, 30000, 60}, // FF, over 10 kb
+		{0, 5000, 60, 0, 8000, 60},  // RR
+		{0, 1000, 60, 1, 1000, 60},  // Inter-contig
+		{0, 2000, 60, 1, 2000, 60},  // Duplicate
+		{0, 4000, 0, 1, 4000, 60},   // MAPQ 0
+		{0, 6000, 60, 0, 9000, 60},  // Unmapped
+	}
+	flags := []sam.Flags{sam.Reverse, sam.Reverse, 0, sam.Reverse | sam.MateReverse, 0, sam.Duplicate, 0,
+		sam.Unmapped | sam.MateUnmapped}
+	inTempDir(t, func() {
+		writeFlagsBAMOf(t, "qc.bam", map[string]int{"ctgA": 60000, "ctgB": 60000}, pairs, flags, false)
+		writeFastaForBAM(t, "qc.bam", "qc.fasta")
+		r := allhic.Extracter{Bamfile: "qc.bam", Fastafile: "qc.fasta", RE: allhic.DefaultRE, MinLinks: 1}
+		r.Run()
+		want := map[string][2]interface{}{
+			"pairs": {8, "-"}, "mapped": {7, "ok"}, "mapq": {6, "-"}, "duplicates": {1, "ok"},
+			"contacts": {5, "-"}, "intra": {4, "-"}, "inter": {1, "-"}, "long_cis": {1, "ok"},
+			"intra_10kb": {1, "-"}, "intra_1mb": {0, "-"}, "religation": {1, "warn"},
+			"self_circle": {1, "warn"}, "FF": {1, "-"}, "FR": {1, "-"}, "RF": {1, "-"}, "RR": {1, "-"},
+		}
+		data, err := ioutil.ReadFile("qc.qc.tsv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(data)), "\n")[1:]
+		if len(rows) != len(want) || len(r.LibraryQC) != len(want) {
+			t.Fatalf("%d rows in qc.tsv and %d in memory, want %d", len(rows), len(r.LibraryQC), len(want))
+		}
+		for _, row := range rows {
+			words := strings.Split(row, "\t")
+			w, ok := want[words[0]]
+			if !ok || words[1] != fmt.Sprint(w[0]) || words[4] != w[1] {
+				t.Errorf("row %q, want %v", row, w)
+			}
+		}
+
+		var summary allhic.ExtractSummary
+		data, err = ioutil.ReadFile("qc.summary.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(summary.QC, r.LibraryQC) ||
+			!reflect.DeepEqual(summary.Warnings, []string{"religation", "self_circle"}) {
+			t.Errorf("summary %+v, want the rows of qc.tsv", summary)
+		}
+
+		// A quarter of the intra-contig pairs is under the raised bounds
+		sink := &allhic.MemorySink{}
+		r = allhic.Extracter{Bamfile: "qc.bam", Fastafile: "qc.fasta", RE: allhic.DefaultRE, MinLinks: 1,
+			QCThresholds: allhic.QCThresholds{MaxReligation: 0.3, MaxSelfCircle: 0.3}, Sink: sink}
+		r.Run()
+		for _, m := range sink.QCMetrics() {
+			if m.Status == allhic.QCStatusWarn {
+				t.Errorf("%s warns at %.2f", m.Metric, m.Fraction)
+			}
+		}
+	})
+}
@@ -0,0 +1,237 @@
+/*
+ *  extractsink.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// ExtractSink receives the results of the link aggregation
+type ExtractSink interface {
+	// Contigs receives the contigs with their RE counts, before any link
+	Contigs(contigs []*ContigInfo)
+	// ContigLinks receives one oriented contig pair with at least MinLinks links
+	ContigLinks(at, bt string, ao, bo byte, links []int)
+	// Distribution receives the link size distribution
+	Distribution(model *LinkDensityModel)
+	// Pairs receives the contig pair analyses
+	Pairs(pairs []*ContigPair)
+	// LinkStats receives the intra- and inter-contig links of each contig
+	LinkStats(stats []ContigLinkStats)
+	// Coverage receives the read coverage along the contigs
+	Coverage(track *CoverageTrack)
+	// LibraryQC receives the rows of the library QC, none for Pore-C
+	LibraryQC(rows []QCMetric)
+	// Close is called once everything has been sent
+	Close() error
+}
+
+// FileSink writes the results to the files that extract has always written
+type FileSink struct {
+	OutContigsfile string
+	OutClmfile     string
+	OutDistfile    string
+	OutPairsfile   string
+	// The intra- and inter-contig links of each contig
+	OutContigLinksfile string
+	// The distribution as TSV, and the decays fitted to it as JSON
+	OutDistTSV  string
+	OutDistJSON string
+	// Coverage outputs, contigs with RepeatRatio times the median coverage
+	// are written as candidate repeats
+	OutBedGraphfile string
+	OutCoveragefile string
+	OutRepeatsfile  string
+	RepeatRatio     float64
+	// The library QC as TSV, and in the summary as JSON
+	OutQCfile      string
+	OutSummaryfile string
+	// Mode of extract, ModeOmniC heads the counts file as effective lengths
+	Mode string
+	fclm *AtomicFile
+	wclm *bufio.Writer
+}
+
+// NewFileSink is the constructor for FileSink, with all files named after prefix
+func NewFileSink(prefix, RE string) *FileSink {
+	return &FileSink{
+		OutContigsfile:     prefix + ".counts_" + strings.ReplaceAll(RE, ",", "_") + ".txt",
+		OutClmfile:         prefix + ".clm",
+		OutDistfile:        prefix + ".distribution.txt",
+		OutDistTSV:         prefix + ".distribution.tsv",
+		OutDistJSON:        prefix + ".distribution.json",
+		OutPairsfile:       prefix + ".pairs.txt",
+		OutContigLinksfile: prefix + ".contig_links.tsv",
+		OutBedGraphfile:    prefix + ".coverage.bedGraph",
+		OutCoveragefile:    prefix + ".coverage.txt",
+		OutRepeatsfile:     prefix + ".repeats.txt",
+		OutQCfile:          prefix + ".qc.tsv",
+		OutSummaryfile:     prefix + ".summary.json",
+		RepeatRatio:        RepeatRatio,
+	}
+}
+
+// Contigs writes the RE file
+func (r *FileSink) Contigs(contigs []*ContigInfo) {
+	writeRE(r.OutContigsfile, r.Mode, contigs)
+}
+
+// openClm creates the clmfile on first use
+func (r *FileSink) openClm() {
+	if r.fclm != nil {
+		return
+	}
+	r.fclm = mustCreateAtomic(r.OutClmfile)
+	r.wclm = bufio.NewWriter(r.fclm)
+}
+
+// ContigLinks writes a row to the clmfile
+func (r *FileSink) ContigLinks(at, bt string, ao, bo byte, links []int) {
+	r.openClm()
+	_, _ = fmt.Fprintf(r.wclm, "%s%c %s%c\t%d\t%s\n",
+		at, ao, bt, bo, len(links), arrayToString(links, " "))
+}
+
+// Distribution writes the distribution files
+func (r *FileSink) Distribution(model *LinkDensityModel) {
+	model.writeDistribution(r.OutDistfile)
+	model.writeDistributionTSV(r.OutDistTSV)
+	model.writeDistributionJSON(r.OutDistJSON)
+}
+
+// Pairs writes the pairs file
+func (r *FileSink) Pairs(pairs []*ContigPair) {
+	f := mustCreateAtomic(r.OutPairsfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, PairsFileHeader)
+	for _, c := range pairs {
+		_, _ = fmt.Fprintln(w, c)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Contig pair analyses written to `%s`", r.OutPairsfile)
+}
+
+// LinkStats writes the table of the links of each contig
+func (r *FileSink) LinkStats(stats []ContigLinkStats) {
+	writeContigLinks(r.OutContigLinksfile, stats)
+}
+
+// Coverage writes the bedGraph, the per-contig summary and the repeats
+func (r *FileSink) Coverage(track *CoverageTrack) {
+	track.writeBedGraph(r.OutBedGraphfile)
+	summary := track.Summary()
+	writeCoverageSummary(r.OutCoveragefile, summary)
+	writeRepeats(r.OutRepeatsfile, summary, r.RepeatRatio)
+}
+
+// LibraryQC writes the library QC and the summary
+func (r *FileSink) LibraryQC(rows []QCMetric) {
+	writeLibraryQC(r.OutQCfile, rows)
+	ErrorAbort(writeExtractSummary(rows, r.OutSummaryfile))
+}
+
+// Close flushes the clmfile, which is created empty when there were no links
+func (r *FileSink) Close() error {
+	r.openClm()
+	if err := r.wclm.Flush(); err != nil {
+		return err
+	}
+	log.Noticef("Inter-contig links written to `%s`", r.OutClmfile)
+	return r.fclm.Close()
+}
+
+// MemorySink keeps the results in memory
+type MemorySink struct {
+	contigs []*ContigInfo
+	lines   []CLMLine
+	pairs   []*ContigPair
+	stats   []ContigLinkStats
+	model   *LinkDensityModel
+	track   *CoverageTrack
+	qc      []QCMetric
+}
+
+// Contigs keeps the contigs
+func (r *MemorySink) Contigs(contigs []*ContigInfo) {
+	r.contigs = contigs
+}
+
+// ContigLinks keeps the links of the oriented contig pair
+func (r *MemorySink) ContigLinks(at, bt string, ao, bo byte, links []int) {
+	r.lines = append(r.lines, CLMLine{at, bt, ao, bo, links})
+}
+
+// Distribution keeps the link size distribution
+func (r *MemorySink) Distribution(model *LinkDensityModel) {
+	r.model = model
+}
+
+// Pairs keeps the contig pair analyses
+func (r *MemorySink) Pairs(pairs []*ContigPair) {
+	r.pairs = pairs
+}
+
+// LinkStats keeps the links of each contig
+func (r *MemorySink) LinkStats(stats []ContigLinkStats) {
+	r.stats = stats
+}
+
+// Coverage keeps the coverage track
+func (r *MemorySink) Coverage(track *CoverageTrack) {
+	r.track = track
+}
+
+// LibraryQC keeps the rows of the library QC
+func (r *MemorySink) LibraryQC(rows []QCMetric) {
+	r.qc = rows
+}
+
+// Close does nothing
+func (r *MemorySink) Close() error {
+	return nil
+}
+
+// Model returns the link size distribution
+func (r *MemorySink) Model() *LinkDensityModel {
+	return r.model
+}
+
+// ContigPairs returns the contig pair analyses
+func (r *MemorySink) ContigPairs() []*ContigPair {
+	return r.pairs
+}
+
+// ContigLinkStats returns the links of each contig
+func (r *MemorySink) ContigLinkStats() []ContigLinkStats {
+	return r.stats
+}
+
+// CoverageTrack returns the read coverage along the contigs
+func (r *MemorySink) CoverageTrack() *CoverageTrack {
+	return r.track
+}
+
+// QCMetrics returns the rows of the library QC
+func (r *MemorySink) QCMetrics() []QCMetric {
+	return r.qc
+}
+
+// CLM builds the CLM over all contigs, as NewCLM would from the RE file and
+// clmfile written by a FileSink
+func (r *MemorySink) CLM() *CLM {
+	p := newCLM()
+	for _, contig := range r.contigs {
+		p.addTig(contig.name, contig.length).RECounts = contig.recounts
+	}
+	p.addClmLines(r.lines)
+	return p
+}
@@ -0,0 +1,234 @@
+/*
+ *  extsort.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// sortRecordOverhead approximates the cost of holding a record in the
+// in-memory buffer, on top of what the codec reports
+const sortRecordOverhead = 16
+
+// SortCodec describes the records handled by an ExternalSorter
+type SortCodec interface {
+	// Encode writes the binary form of rec
+	Encode(w *bufio.Writer, rec interface{}) error
+	// Decode reads the next record, and returns io.EOF at the end of the run
+	Decode(r *bufio.Reader) (interface{}, error)
+	// Less reports whether a sorts before b
+	Less(a, b interface{}) bool
+	// Size estimates the in-memory size of rec in bytes
+	Size(rec interface{}) int
+}
+
+// ExternalSorter sorts more records than fit in memory. Records are buffered
+// up to the memory budget, then sorted and written as a run to a temporary
+// file in the scratch directory. The runs are k-way merged at the end. The
+// sort is stable: records that compare equal come out in the order added.
+type ExternalSorter struct {
+	codec    SortCodec
+	memLimit int64
+	tempDir  string
+	buf      []interface{}
+	bufBytes int64
+	runs     []*os.File
+	nRecords int64
+}
+
+// NewExternalSorter is the constructor for ExternalSorter, an empty tempDir
+// uses the system default
+func NewExternalSorter(codec SortCodec, memLimit int64, tempDir string) *ExternalSorter {
+	return &ExternalSorter{codec: codec, memLimit: memLimit, tempDir: tempDir}
+}
+
+// Add buffers a record, writing a sorted run once the budget is exceeded
+func (r *ExternalSorter) Add(rec interface{}) error {
+	r.buf = append(r.buf, rec)
+	r.bufBytes += int64(r.codec.Size(rec) + sortRecordOverhead)
+	r.nRecords++
+	if r.bufBytes > r.memLimit {
+		return r.writeRun()
+	}
+	return nil
+}
+
+// sortBuffer sorts the buffered records in place
+func (r *ExternalSorter) sortBuffer() {
+	sort.SliceStable(r.buf, func(i, j int) bool {
+		return r.codec.Less(r.buf[i], r.buf[j])
+	})
+}
+
+// writeRun sorts the buffer and writes it to a new temporary file
+func (r *ExternalSorter) writeRun() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+	r.sortBuffer()
+	f, err := ioutil.TempFile(r.tempDir, "allhic-sort-*.run")
+	if err != nil {
+		return err
+	}
+	r.runs = append(r.runs, f)
+	w := bufio.NewWriter(f)
+	for _, rec := range r.buf {
+		if err := r.codec.Encode(w, rec); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for i := range r.buf {
+		r.buf[i] = nil
+	}
+	r.buf = r.buf[:0]
+	r.bufBytes = 0
+	return nil
+}
+
+// Runs returns the number of sorted runs written to disk so far
+func (r *ExternalSorter) Runs() int {
+	return len(r.runs)
+}
+
+// Each calls f on all records in sorted order, stopping at the first error.
+// When everything fit in memory no run is written at all.
+func (r *ExternalSorter) Each(f func(rec interface{}) error) error {
+	if len(r.runs) == 0 {
+		r.sortBuffer()
+		for _, rec := range r.buf {
+			if err := f(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := r.writeRun(); err != nil {
+		return err
+	}
+	log.Noticef("Merge %d records from %d sorted runs", r.nRecords, len(r.runs))
+
+	h := &runHeap{less: r.codec.Less}
+	for i, run := range r.runs {
+		if _, err := run.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		c := &runCursor{idx: i, r: bufio.NewReader(run)}
+		ok, err := c.next(r.codec)
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.cursors = append(h.cursors, c)
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 {
+		c := h.cursors[0]
+		if err := f(c.rec); err != nil {
+			return err
+		}
+		ok, err := c.next(r.codec)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// Merge writes all records in sorted order to w, using the codec encoding
+func (r *ExternalSorter) Merge(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := r.Each(func(rec interface{}) error {
+		return r.codec.Encode(bw, rec)
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Close removes the temporary runs
+func (r *ExternalSorter) Close() error {
+	var err error
+	for _, run := range r.runs {
+		if e := run.Close(); e != nil && err == nil {
+			err = e
+		}
+		if e := os.Remove(run.Name()); e != nil && err == nil {
+			err = e
+		}
+	}
+	r.runs = nil
+	r.buf = nil
+	return err
+}
+
+// runCursor holds the current record of one sorted run
+type runCursor struct {
+	idx int
+	r   *bufio.Reader
+	rec interface{}
+}
+
+// next advances the cursor, returning false at the end of the run
+func (c *runCursor) next(codec SortCodec) (bool, error) {
+	rec, err := codec.Decode(c.r)
+	if err == io.EOF {
+		c.rec = nil
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.rec = rec
+	return true, nil
+}
+
+// runHeap is a min-heap of run cursors, ties go to the earlier run so that
+// the merge is stable
+type runHeap struct {
+	cursors []*runCursor
+	less    func(a, b interface{}) bool
+}
+
+func (h *runHeap) Len() int { return len(h.cursors) }
+
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if h.less(a.rec, b.rec) {
+		return true
+	}
+	if h.less(b.rec, a.rec) {
+		return false
+	}
+	return a.idx < b.idx
+}
+
+func (h *runHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *runHeap) Push(x interface{}) { h.cursors = append(h.cursors, x.(*runCursor)) }
+
+func (h *runHeap) Pop() interface{} {
+	n := len(h.cursors)
+	c := h.cursors[n-1]
+	h.cursors = h.cursors[:n-1]
+	return c
+}
@@ -0,0 +1,159 @@
+/*
+ *  extsort_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// keyedRecord is a synthetic record, seq remembers the insertion order
+type keyedRecord struct {
+	key uint32
+	seq uint32
+}
+
+// keyedCodec sorts keyedRecords by key, as 8 little-endian bytes on disk
+type keyedCodec struct{}
+
+func (keyedCodec) Encode(w *bufio.Writer, rec interface{}) error {
+	var buf [8]byte
+	r := rec.(keyedRecord)
+	binary.LittleEndian.PutUint32(buf[0:], r.key)
+	binary.LittleEndian.PutUint32(buf[4:], r.seq)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func (keyedCodec) Decode(r *bufio.Reader) (interface{}, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	return keyedRecord{binary.LittleEndian.Uint32(buf[0:]), binary.LittleEndian.Uint32(buf[4:])}, nil
+}
+
+func (keyedCodec) Less(a, b interface{}) bool {
+	return a.(keyedRecord).key < b.(keyedRecord).key
+}
+
+func (keyedCodec) Size(rec interface{}) int {
+	return 8
+}
+
+// sortKeyed runs n random records through a sorter with the given budget and
+// checks that the output is a stable sort of the input
+func sortKeyed(t *testing.T, n int, memLimit int64) int {
+	dir, err := ioutil.TempDir("", "allhic-sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rng := rand.New(rand.NewSource(int64(n)))
+	sorter := allhic.NewExternalSorter(keyedCodec{}, memLimit, dir)
+	defer sorter.Close()
+	counts := map[uint32]int{}
+	for i := 0; i < n; i++ {
+		key := uint32(rng.Intn(n / 4))
+		counts[key]++
+		if err := sorter.Add(keyedRecord{key, uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := 0
+	var prev keyedRecord
+	err = sorter.Each(func(rec interface{}) error {
+		r := rec.(keyedRecord)
+		if seen > 0 && (r.key < prev.key || r.key == prev.key && r.seq < prev.seq) {
+			t.Fatalf("record %d out of order: %v after %v", seen, r, prev)
+		}
+		counts[r.key]--
+		prev = r
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != n {
+		t.Fatalf("got %d records, want %d", seen, n)
+	}
+	for key, c := range counts {
+		if c != 0 {
+			t.Fatalf("key %d: count off by %d", key, c)
+		}
+	}
+	return sorter.Runs()
+}
+
+// TestExternalSorterInMemory checks the path where no run is spilled
+func TestExternalSorterInMemory(t *testing.T) {
+	if runs := sortKeyed(t, 10000, 1<<30); runs != 0 {
+		t.Errorf("expected everything in memory, got %d runs", runs)
+	}
+}
+
+// TestExternalSorterManyRuns forces a few hundred runs over millions of records
+func TestExternalSorterManyRuns(t *testing.T) {
+	n := 2000000
+	if testing.Short() {
+		n = 200000
+	}
+	// About 150 runs of 24 bytes per buffered record
+	start := time.Now()
+	runs := sortKeyed(t, n, int64(n/150)*24)
+	if runs < 100 {
+		t.Errorf("expected many runs, got %d", runs)
+	}
+	elapsed := time.Since(start)
+	t.Logf("sorted %d records in %d runs in %v (%.2f M records/s)",
+		n, runs, elapsed, float64(n)/elapsed.Seconds()/1e6)
+}
+
+// TestExternalSorterMerge checks the encoded output written to a writer
+func TestExternalSorterMerge(t *testing.T) {
+	sorter := allhic.NewExternalSorter(keyedCodec{}, 64, "")
+	defer sorter.Close()
+	for i, key := range []uint32{5, 3, 9, 3, 1, 7, 5} {
+		if err := sorter.Add(keyedRecord{key, uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := ioutil.TempFile("", "allhic-sort-*.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if err := sorter.Merge(f); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Seek(0, io.SeekStart)
+	r := bufio.NewReader(f)
+	want := []keyedRecord{{1, 4}, {3, 1}, {3, 3}, {5, 0}, {5, 6}, {7, 5}, {9, 2}}
+	for i, w := range want {
+		rec, err := keyedCodec{}.Decode(r)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if rec.(keyedRecord) != w {
+			t.Errorf("record %d: got %v, want %v", i, rec, w)
+		}
+	}
+	_ = f.Close()
+}
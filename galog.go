@@ -0,0 +1,119 @@
+/*
+ *  galog.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// gaLogHeader is the header of <prefix>.ga.log.csv
+const gaLogHeader = "phase,generation,best_score,mean_score,std_score,mutations,crossovers,elapsed_seconds\n"
+
+// moveCounts counts the mutations and the crossovers of the tours of the GA,
+// which the islands make in parallel
+type moveCounts struct {
+	mutations  int64
+	crossovers int64
+}
+
+// mutated counts a mutation, unless the moves are not counted
+func (r *moveCounts) mutated() {
+	if r != nil {
+		atomic.AddInt64(&r.mutations, 1)
+	}
+}
+
+// crossed counts a crossover, unless the moves are not counted
+func (r *moveCounts) crossed() {
+	if r != nil {
+		atomic.AddInt64(&r.crossovers, 1)
+	}
+}
+
+// gaLog writes the progress of the GA as CSV, one row every interval
+// generations. Each row goes out in a single write, so that a killed run
+// leaves the rows up to its last generation.
+type gaLog struct {
+	f        *os.File
+	interval uint
+	start    time.Time
+	counts   moveCounts // Shared by the tours of the GA
+	last     moveCounts // At the previous row
+}
+
+// newGALog creates the log in filename, or appends to it when resuming
+func newGALog(filename string, interval int, resume bool) (*gaLog, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create GA log %s: %s", filename, err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if _, err := f.WriteString(gaLogHeader); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return &gaLog{f: f, interval: uint(interval), start: time.Now()}, nil
+}
+
+// write logs the generation of the GA in phase, when it is due, with the
+// moves made since the previous row
+func (r *gaLog) write(phase int, ga *eaopt.GA) error {
+	if r == nil || ga.Generations%r.interval != 0 {
+		return nil
+	}
+	n, sum, sumSq := 0.0, 0.0, 0.0
+	for _, pop := range ga.Populations {
+		for _, indi := range pop.Individuals {
+			score := -indi.Fitness
+			n++
+			sum += score
+			sumSq += score * score
+		}
+	}
+	mean := sum / n
+	std := math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	mutations := atomic.LoadInt64(&r.counts.mutations)
+	crossovers := atomic.LoadInt64(&r.counts.crossovers)
+	_, err := fmt.Fprintf(r.f, "%d,%d,%.8g,%.8g,%.8g,%d,%d,%.3f\n", phase, ga.Generations,
+		-ga.HallOfFame[0].Fitness, mean, std, mutations-r.last.mutations,
+		crossovers-r.last.crossovers, time.Since(r.start).Seconds())
+	r.last = moveCounts{mutations: mutations, crossovers: crossovers}
+	return err
+}
+
+// counter returns the counts for the tours of the GA to update, nil
+// without a log
+func (r *gaLog) counter() *moveCounts {
+	if r == nil {
+		return nil
+	}
+	return &r.counts
+}
+
+// Close closes the log file
+func (r *gaLog) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,70 @@
+/*
+ *  galog_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestGALog checks the rows of the progress log of a short GA, every 5
+// generations of both phases
+func TestGALog(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.LogInterval = 5
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open("test.ga.log.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := "phase,generation,best_score,mean_score,std_score,mutations,crossovers,elapsed_seconds"
+		if got := strings.Join(rows[0], ","); got != header {
+			t.Fatalf("header is %s, want %s", got, header)
+		}
+		phases := map[string]bool{}
+		lastBest, lastElapsed := 0.0, 0.0
+		for i, row := range rows[1:] {
+			v := make([]float64, len(row))
+			for k, field := range row {
+				if v[k], err = strconv.ParseFloat(field, 64); err != nil {
+					t.Fatalf("row %d: %v", i+1, err)
+				}
+			}
+			phase, gen, best, mean, std, mutations, crossovers, elapsed := row[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7]
+			if int(gen)%5 != 0 {
+				t.Errorf("row %d is generation %g, not every 5", i+1, gen)
+			}
+			if gen > 0 && (mutations == 0 || crossovers != 0) {
+				t.Errorf("row %d: %g mutations and %g crossovers, want mutations only", i+1, mutations, crossovers)
+			}
+			if mean > best+1e-12 || std < 0 {
+				t.Errorf("row %d: mean %g above the best %g or std %g", i+1, mean, best, std)
+			}
+			if phases[phase] && best < lastBest || elapsed < lastElapsed {
+				t.Errorf("row %d: best score or time went down", i+1)
+			}
+			phases[phase] = true
+			lastBest, lastElapsed = best, elapsed
+		}
+		if !phases["1"] || !phases["2"] {
+			t.Errorf("log has phases %v, want 1 and 2", phases)
+		}
+	})
+}
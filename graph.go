@@ -0,0 +1,179 @@
+/*
+ *  graph.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphPrior adds the edges of an assembly graph to the score of the tours.
+// Each pair of adjacent tigs joined by an edge, with the orientations of the
+// edge, earns a bonus, and, with a penalty, each edge whose tigs are both in
+// the tour but not next to each other costs it. Both terms only depend on
+// the pairs of adjacent tigs, which keeps the scores of the moves of the GA
+// up to date, see deltaScore.
+type GraphPrior struct {
+	clm      *CLM                  // Orientations of the tours without their own
+	oriented map[OrientedPair]bool // Edges, see newOrientedPair
+	linked   map[uint64]bool       // Tig pairs joined by any edge, see pairKey
+	pairs    [][2]int
+	bonus    float64
+	penalty  float64
+}
+
+// ReadGFA reads the L-lines of an assembly graph in GFA, of the overlaps
+// `L from fromOrient to toOrient overlap`, into a prior on the tours of the
+// CLM. The edges with contigs not in the ids file are skipped. The bonus and
+// the penalty are weight and penalty times the mean score of the active
+// contigs next to their best-linked partner, so that they weigh the same
+// whatever the depth of the Hi-C library.
+func (r *CLM) ReadGFA(filename string, weight, penalty float64) (*GraphPrior, error) {
+	f, err := openReader(filename)
+	if err != nil {
+		return nil, openError("GFA", filename, err)
+	}
+	defer f.Close()
+
+	prior := &GraphPrior{clm: r, oriented: make(map[OrientedPair]bool), linked: make(map[uint64]bool)}
+	unknown := make(map[string]bool)
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if !strings.HasPrefix(scanner.Text(), "L\t") {
+			continue
+		}
+		words := strings.Split(scanner.Text(), "\t")
+		if len(words) < 5 || !isOrientation(words[2]) || !isOrientation(words[4]) {
+			return nil, fmt.Errorf("expected an L-line of from, orientation, to, orientation at line %d of %s: %s",
+				lineno, filename, scanner.Text())
+		}
+		a, aok := r.tigToIdx[r.opts.Aliases.Name(words[1])]
+		b, bok := r.tigToIdx[r.opts.Aliases.Name(words[3])]
+		if !aok || !bok {
+			for _, tig := range []struct {
+				name string
+				ok   bool
+			}{{words[1], aok}, {words[3], bok}} {
+				if !tig.ok {
+					unknown[tig.name] = true
+				}
+			}
+			continue
+		}
+		if a == b {
+			continue
+		}
+		prior.oriented[newOrientedPair(a, b, words[2][0], words[4][0])] = true
+		if key := pairKey(a, b); !prior.linked[key] {
+			prior.linked[key] = true
+			prior.pairs = append(prior.pairs, [2]int{a, b})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read GFA file %s: %s", filename, err)
+	}
+	if len(unknown) > 0 {
+		log.Warningf("Skipped the edges of %d contigs in `%s` not found in `%s`", len(unknown), filename, r.REfile)
+	}
+	unit := r.Tour.bestNeighborScore()
+	prior.bonus, prior.penalty = weight*unit, penalty*unit
+	log.Noticef("Loaded %d edges between %d contig pairs from `%s`, bonus %.5g and penalty %.5g per edge",
+		len(prior.oriented), len(prior.pairs), filename, prior.bonus, prior.penalty)
+	return prior, nil
+}
+
+// isOrientation tells whether the word is the orientation of a segment
+func isOrientation(word string) bool {
+	return word == "+" || word == "-"
+}
+
+// pairKey is the key of the tigs a and b in either order
+func pairKey(a, b int) uint64 {
+	if a > b {
+		a, b = b, a
+	}
+	return uint64(a)<<32 | uint64(b)
+}
+
+// score returns the bonuses and the penalties of the tour, using the
+// buffers of s
+func (r *GraphPrior) score(tour Tour, s *evalScratch) float64 {
+	if r == nil {
+		return 0
+	}
+	score := r.span(tour.Tigs, 0, tour.Len()-2)
+	if r.penalty == 0 {
+		return score
+	}
+	pos := s.positions(tour)
+	defer s.clearPositions(tour)
+	for _, pair := range r.pairs {
+		if pos[pair[0]] >= 0 && pos[pair[1]] >= 0 {
+			score += r.penalty // Taken back by span when adjacent
+		}
+	}
+	return score
+}
+
+// span sums the terms of the pairs of adjacent tigs at positions k, k+1,
+// for k from i to j
+func (r *GraphPrior) span(tigs []Tig, i, j int) float64 {
+	if r == nil {
+		return 0
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j > len(tigs)-2 {
+		j = len(tigs) - 2
+	}
+	score := 0.0
+	for k := i; k <= j; k++ {
+		a, b := tigs[k], tigs[k+1]
+		if !r.linked[pairKey(a.Idx, b.Idx)] {
+			continue
+		}
+		score -= r.penalty
+		if r.oriented[newOrientedPair(a.Idx, b.Idx, r.sign(a), r.sign(b))] {
+			score -= r.bonus
+		}
+	}
+	return score
+}
+
+// sign returns the orientation of the tig in the tour, or that of the CLM
+// when the tour does not carry one
+func (r *GraphPrior) sign(tig Tig) byte {
+	if tig.Sign != 0 {
+		return tig.Sign
+	}
+	return r.clm.Signs[tig.Idx]
+}
+
+// bestNeighborScore is the mean over the tigs of the tour of the score of
+// the tig next to its best-linked partner, 1 without any links
+func (r Tour) bestNeighborScore() float64 {
+	sum := 0.0
+	for _, a := range r.Tigs {
+		best := 0.0
+		for _, b := range r.Tigs {
+			if b.Idx == a.Idx {
+				continue
+			}
+			if s := r.M.links(a.Idx, b.Idx) / (float64(a.Size+b.Size) / 2); s > best {
+				best = s
+			}
+		}
+		sum += best
+	}
+	if sum == 0 {
+		return 1
+	}
+	return sum / float64(r.Len())
+}
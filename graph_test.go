@@ -0,0 +1,138 @@
+/*
+ *  graph_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeGFA writes the edges, as `from fromOrient to toOrient`, into the
+// L-lines of a GFA after a segment line
+func writeGFA(t *testing.T, dir string, edges ...string) string {
+	gfa := "H\tVN:Z:1.0\nS\ttig0000000\t*\n"
+	for _, edge := range edges {
+		gfa += "L\t" + strings.Join(strings.Fields(edge), "\t") + "\t0M\n"
+	}
+	filename := filepath.Join(dir, "asm.gfa")
+	if err := ioutil.WriteFile(filename, []byte(gfa), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// TestGraphMutate keeps the scores with the graph edges through the moves
+// of the GA, and checks them against whole scores
+func TestGraphMutate(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, 60, 3, 10)
+	var edges []string
+	for i := 0; i < 60; i += 3 {
+		edges = append(edges, fmt.Sprintf("tig%07d + tig%07d +", i, (i*7+1)%60), fmt.Sprintf("tig%07d + tig%07d -", i, (i*11+2)%60))
+	}
+	edges = append(edges, "tig0000001 - unknown +")
+	clm := mustNewCLM(t, clmfile, idsfile)
+	clm.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+	graph, err := clm.ReadGFA(writeGFA(t, dir, edges...), 2, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clm.Tour.Graph = graph
+	without, _ := allhic.Tour{Tigs: clm.Tour.Tigs, M: clm.Tour.M}.Evaluate()
+	if with, _ := clm.Tour.Evaluate(); with == without {
+		t.Fatal("graph edges do not count in the score")
+	}
+	rng := rand.New(rand.NewSource(42))
+	mutant := clm.Tour.Clone().(allhic.Tour).WithDeltaScore()
+	for i := 0; i < 2000; i++ {
+		mutant.Mutate(rng)
+		got, _ := mutant.Evaluate()
+		want, _ := allhic.Tour{Tigs: mutant.Tigs, M: mutant.M, Graph: mutant.Graph}.Evaluate()
+		if math.Abs(got-want) > 1e-9*math.Abs(want) {
+			t.Fatalf("move %d: kept score %v, want %v", i, got, want)
+		}
+	}
+}
+
+// writeRingCLM writes a chain of 6 contigs of the same size, linked in
+// their forward orientations, and a 7th contig linked as much to either end
+// of the chain, which closes the ring
+func writeRingCLM(dir string) (idsfile, clmfile string) {
+	const size = 50000
+	var contigs []clmContig
+	var pairs []clmPair
+	for i := 0; i < 7; i++ {
+		contigs = append(contigs, clmContig{fmt.Sprintf("tig%07d", i), size})
+	}
+	links := func(a, b, n int) {
+		pair := clmPair{a: fmt.Sprintf("tig%07d", a), b: fmt.Sprintf("tig%07d", b)}
+		for l := 0; l < n; l++ {
+			pair.links = append(pair.links, clmLink{size - 500, 500 + l*100})
+		}
+		pairs = append(pairs, pair)
+	}
+	for i := 0; i < 5; i++ {
+		links(i, i+1, 40)
+	}
+	links(5, 6, 5)
+	links(6, 0, 5)
+	return writeCLMFixture(dir, "chain", contigs, pairs)
+}
+
+// TestOptimizeGFA places the 7th contig of the chain at the end that the
+// graph joins it to, either end scoring the same by the links alone
+func TestOptimizeGFA(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeRingCLM(dir)
+	for edge, partner := range map[string]string{
+		"tig0000005 + tig0000006 +": "tig0000005",
+		"tig0000006 + tig0000000 +": "tig0000000",
+	} {
+		opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true, Seed: 42,
+			NPop: 20, NGen: 50, MutProb: allhic.MutaProb, GFAfile: writeGFA(t, dir, edge)}
+		tour := runOptimizer(t, opt)
+		if !strings.Contains(tour, "gfaWeight=1") {
+			t.Errorf("tours lack the weight of the graph:\n%s", tour)
+		}
+		lines := strings.Split(strings.TrimSpace(tour), "\n")
+		final := strings.Fields(lines[len(lines)-1])
+		for i, tig := range final {
+			if strings.HasPrefix(tig, "tig0000006") {
+				next := (i > 0 && strings.HasPrefix(final[i-1], partner)) ||
+					(i+1 < len(final) && strings.HasPrefix(final[i+1], partner))
+				if !next {
+					t.Errorf("edge %s: got tour %v, want tig0000006 next to %s", edge, final, partner)
+				}
+			}
+		}
+	}
+}
+
+func TestOptimizeGFAErrors(t *testing.T) {
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"cannot weigh the assembly graph by -1": func(r *allhic.Optimizer) { r.GFAfile, r.GFAWeight = "asm.gfa", -1 },
+		"against the likelihood score":          func(r *allhic.Optimizer) { r.GFAfile, r.Score = "asm.gfa", allhic.ScoreLikelihood },
+		"cannot open GFA":                       func(r *allhic.Optimizer) { r.GFAfile = "missing.gfa" },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		inTempDir(t, func() {
+			if err := opt.Run(); err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v, want %q", err, want)
+			}
+		})
+	}
+}
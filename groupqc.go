@@ -0,0 +1,172 @@
+/*
+ *  groupqc.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GroupQCer checks the partition against the allele table. Allelic contigs
+// belong to different haplotypes, so a pair of them in the same cluster is a
+// conflict that points to failed pruning or clustering.
+type GroupQCer struct {
+	Clustersfile string
+	AllelesFile  string
+	clusters     []string       // Names of the clusters, in file order
+	ctgToCluster map[string]int // Contig to its index in clusters
+	// Output files
+	OutAllelesFile string
+	OutPairsFile   string
+}
+
+// AlleleGroupQC summarizes where the contigs of one allele group landed
+type AlleleGroupQC struct {
+	Contigs   AlleleGroup
+	Clustered int // Contigs in any cluster
+	Clusters  int // Distinct clusters among them
+	Conflicts int // Pairs of contigs in the same cluster
+}
+
+// ClusterPair is a pair of cluster indices, with a <= b
+type ClusterPair [2]int
+
+// Run is the main function body of groupqc
+func (r *GroupQCer) Run() {
+	r.readClusters()
+	alleleGroups := parseAllelesFile(r.AllelesFile)
+	groups, pairs := r.countAllelicPairs(alleleGroups)
+
+	prefix := RemoveExt(r.Clustersfile)
+	r.OutAllelesFile = prefix + ".groupqc.alleles.txt"
+	r.OutPairsFile = prefix + ".groupqc.txt"
+	r.writeAlleleGroups(groups)
+	r.writeClusterPairs(pairs)
+	r.summarize(pairs)
+	log.Notice("Success")
+}
+
+// readClusters parses the clusters file written by partition
+// #Group  nContigs    Contigs
+// 2g1     3           tig1 tig2 tig3
+func (r *GroupQCer) readClusters() {
+	recs := ReadCSVLines(r.Clustersfile)
+	r.ctgToCluster = make(map[string]int)
+	for _, rec := range recs {
+		if len(rec) < 3 {
+			continue
+		}
+		for _, contig := range strings.Fields(rec[2]) {
+			r.ctgToCluster[contig] = len(r.clusters)
+		}
+		r.clusters = append(r.clusters, rec[0])
+	}
+	log.Noticef("Loaded %d contigs in %d clusters from `%s`",
+		len(r.ctgToCluster), len(r.clusters), r.Clustersfile)
+}
+
+// countAllelicPairs places every pair of clustered contigs within an allele
+// group onto the pair of clusters they landed in
+func (r *GroupQCer) countAllelicPairs(alleleGroups []AlleleGroup) ([]AlleleGroupQC, map[ClusterPair]int) {
+	groups := make([]AlleleGroupQC, len(alleleGroups))
+	pairs := make(map[ClusterPair]int)
+	for i, alleleGroup := range alleleGroups {
+		var placed []int
+		distinct := make(map[int]bool)
+		for _, contig := range alleleGroup {
+			if c, ok := r.ctgToCluster[contig]; ok {
+				placed = append(placed, c)
+				distinct[c] = true
+			}
+		}
+		conflicts := 0
+		for j := 0; j < len(placed); j++ {
+			for k := j + 1; k < len(placed); k++ {
+				a, b := placed[j], placed[k]
+				if a > b {
+					a, b = b, a
+				}
+				pairs[ClusterPair{a, b}]++
+				if a == b {
+					conflicts++
+				}
+			}
+		}
+		groups[i] = AlleleGroupQC{Contigs: alleleGroup, Clustered: len(placed),
+			Clusters: len(distinct), Conflicts: conflicts}
+	}
+	return groups, pairs
+}
+
+// writeAlleleGroups writes one line per allele group
+func (r *GroupQCer) writeAlleleGroups(groups []AlleleGroupQC) {
+	f := mustCreateAtomic(r.OutAllelesFile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, GroupQCAllelesHeader)
+	for _, g := range groups {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", strings.Join(g.Contigs, ","),
+			g.Clustered, g.Clusters, g.Conflicts)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Write %d allele groups to `%s`", len(groups), r.OutAllelesFile)
+}
+
+// writeClusterPairs writes the allelic pairs between each pair of clusters,
+// the lines where both clusters are the same are the conflicts
+func (r *GroupQCer) writeClusterPairs(pairs map[ClusterPair]int) {
+	keys := make([]ClusterPair, 0, len(pairs))
+	for pair := range pairs {
+		keys = append(keys, pair)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	f := mustCreateAtomic(r.OutPairsFile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, GroupQCHeader)
+	for _, pair := range keys {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%t\n", r.clusters[pair[0]], r.clusters[pair[1]],
+			pairs[pair], pair[0] == pair[1])
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Write %d cluster pairs to `%s`", len(keys), r.OutPairsFile)
+}
+
+// summarize logs the overall conflict rate and the worst cluster
+func (r *GroupQCer) summarize(pairs map[ClusterPair]int) {
+	total, conflicts := 0, 0
+	worst, worstConflicts := -1, 0
+	for pair, n := range pairs {
+		total += n
+		if pair[0] != pair[1] {
+			continue
+		}
+		conflicts += n
+		if n > worstConflicts || (n == worstConflicts && pair[0] < worst) {
+			worst, worstConflicts = pair[0], n
+		}
+	}
+	if total == 0 {
+		log.Warningf("No allele group has two contigs in the clusters")
+		return
+	}
+	log.Noticef("Allelic pairs in the same cluster: %s", Percentage(conflicts, total))
+	if worst >= 0 {
+		log.Warningf("Cluster %s has the most allelic conflicts (%d)",
+			r.clusters[worst], worstConflicts)
+	}
+}
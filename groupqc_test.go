@@ -0,0 +1,54 @@
+/*
+ *  groupqc_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestGroupQC places two allele groups on two clusters, where the second
+// group has a pair of contigs in the same cluster
+func TestGroupQC(t *testing.T) {
+	clusters := "#Group\tnContigs\tContigs\n" +
+		"2g1\t3\ta1 b1 b2\n" +
+		"2g2\t2\ta2 b3\n"
+	alleles := "Chr1\t100\ta1\ta2\n" +
+		"Chr1\t200\tb1\tb2\tb3\tmissing\n"
+	inTempDir(t, func() {
+		if err := ioutil.WriteFile("test.clusters.txt", []byte(clusters), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile("alleles.table", []byte(alleles), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := allhic.GroupQCer{Clustersfile: "test.clusters.txt", AllelesFile: "alleles.table"}
+		p.Run()
+
+		expected := map[string]string{
+			p.OutPairsFile: allhic.GroupQCHeader +
+				"2g1\t2g1\t1\ttrue\n" +
+				"2g1\t2g2\t3\tfalse\n",
+			p.OutAllelesFile: allhic.GroupQCAllelesHeader +
+				"a1,a2\t2\t2\t0\n" +
+				"b1,b2,b3,missing\t3\t2\t1\n",
+		}
+		for filename, want := range expected {
+			got, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: got\n%s\nwant\n%s", filename, got, want)
+			}
+		}
+	})
+}
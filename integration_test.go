@@ -0,0 +1,277 @@
+/*
+ *  integration_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+	"github.com/tanghaibao/allhic"
+)
+
+// simulationScoreBaseline is the Evaluate score of the tour found by
+// shortOptimizer(42) on the simulated group, a regression in the GA shows up
+// as a score above it
+const simulationScoreBaseline = -0.09479595
+
+// simulationScoreTolerance is the relative slack allowed on the baseline
+const simulationScoreTolerance = 0.01
+
+// writeFastaForBAM writes random sequences matching the references of the
+// bamfile, and returns their lengths
+func writeFastaForBAM(t testing.TB, bamfile, fastafile string) map[string]int {
+	f, err := os.Open(bamfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	br, err := bam.NewReader(f, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+
+	out, err := os.Create(fastafile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(out)
+	rng := rand.New(rand.NewSource(1))
+	sizes := map[string]int{}
+	for _, ref := range br.Header().Refs() {
+		s := make([]byte, ref.Len())
+		_, _ = rng.Read(s)
+		for i := range s {
+			s[i] = "ACGT"[s[i]&3]
+		}
+		fmt.Fprintf(w, ">%s\n%s\n", ref.Name(), s)
+		sizes[ref.Name()] = ref.Len()
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sizes
+}
+
+// readTourContigs returns the contigs of the last tour in the tourfile
+func readTourContigs(t *testing.T, tourfile string) []string {
+	data, err := ioutil.ReadFile(tourfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var tigs []string
+	for _, word := range strings.Fields(rows[len(rows)-1]) {
+		tigs = append(tigs, word[:len(word)-1])
+	}
+	return tigs
+}
+
+// readFastaSizes returns the sequence lengths and the sequences of a FASTA
+func readFastaSizes(t *testing.T, fastafile string) (map[string]int, map[string]string) {
+	f, err := os.Open(fastafile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sizes := map[string]int{}
+	seqs := map[string]string{}
+	var name string
+	var sb strings.Builder
+	flush := func() {
+		if name != "" {
+			seqs[name] = sb.String()
+			sizes[name] = sb.Len()
+		}
+		sb.Reset()
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 1<<30)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ">") {
+			flush()
+			name = strings.Fields(line[1:])[0]
+			continue
+		}
+		sb.WriteString(line)
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return sizes, seqs
+}
+
+// checkAGP verifies the AGP against the component and object FASTA, and
+// returns how many times each component is used
+func checkAGP(t *testing.T, agpfile string, tigSizes, objSizes map[string]int, objSeqs map[string]string) map[string]int {
+	data, err := ioutil.ReadFile(agpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]int{}
+	ends := map[string]int{}
+	parts := map[string]int{}
+	for _, row := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		w := strings.Split(row, "\t")
+		if len(w) != 9 {
+			t.Fatalf("malformed AGP row: %q", row)
+		}
+		object := w[0]
+		beg, _ := strconv.Atoi(w[1])
+		end, _ := strconv.Atoi(w[2])
+		part, _ := strconv.Atoi(w[3])
+		if beg != ends[object]+1 || end < beg || part != parts[object]+1 {
+			t.Fatalf("AGP row does not continue its object: %q", row)
+		}
+		ends[object], parts[object] = end, part
+		if w[4] == "U" || w[4] == "N" {
+			gap, _ := strconv.Atoi(w[5])
+			if gap != end-beg+1 {
+				t.Fatalf("gap length does not match its coordinates: %q", row)
+			}
+			if s := objSeqs[object][beg-1 : end]; strings.Trim(s, "N") != "" {
+				t.Fatalf("gap is not filled with N: %q", row)
+			}
+			continue
+		}
+		cbeg, _ := strconv.Atoi(w[6])
+		cend, _ := strconv.Atoi(w[7])
+		if cbeg != 1 || cend != tigSizes[w[5]] || cend-cbeg != end-beg {
+			t.Fatalf("component does not match the contig length %d: %q", tigSizes[w[5]], row)
+		}
+		used[w[5]]++
+	}
+	for object, end := range ends {
+		if objSizes[object] != end {
+			t.Errorf("object %s: FASTA length %d, AGP length %d", object, objSizes[object], end)
+		}
+	}
+	if len(ends) != len(objSizes) {
+		t.Errorf("%d objects in AGP, %d in FASTA", len(ends), len(objSizes))
+	}
+	return used
+}
+
+// writeGroup keeps the header and the first n contigs of an RE counts file
+func writeGroup(t *testing.T, refile, groupfile string, n int) string {
+	data, err := ioutil.ReadFile(refile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.SplitAfter(string(data), "\n")
+	if len(rows) > n+1 {
+		rows = rows[:n+1]
+	}
+	if err := ioutil.WriteFile(groupfile, []byte(strings.Join(rows, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return groupfile
+}
+
+// TestIntegrationExtractOptimizeBuild runs extract, optimize and build on the
+// bundled bamfile, and checks that the release accounts for every contig.
+// Assess is not part of the chain as it needs reads aligned to the built
+// scaffolds, which the bundled data does not have.
+func TestIntegrationExtractOptimizeBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	bamfile, err := filepath.Abs(testBAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inTempDir(t, func() {
+		if err := os.Symlink(bamfile, "test.bam"); err != nil {
+			t.Fatal(err)
+		}
+		tigSizes := writeFastaForBAM(t, "test.bam", "contigs.fasta")
+
+		extracter := allhic.Extracter{Bamfile: "test.bam", Fastafile: "contigs.fasta",
+			RE: allhic.DefaultRE}
+		extracter.Run()
+
+		// Optimize a group of the first contigs, as partition would produce
+		groupfile := writeGroup(t, extracter.OutContigsfile, "g1.counts_GATC.txt", 120)
+		optimizer := allhic.Optimizer{REfile: groupfile,
+			Clmfile: extracter.OutClmfile, RunGA: true, Seed: 42,
+			NPop: 10, NGen: 20, MutProb: allhic.MutaProb}
+		if err := optimizer.Run(); err != nil {
+			t.Fatal(err)
+		}
+		placed := readTourContigs(t, optimizer.OutTourFile)
+
+		// Every contig is either placed exactly once or unplaced
+		seen := map[string]bool{}
+		for _, tig := range placed {
+			if seen[tig] {
+				t.Fatalf("contig %s placed twice", tig)
+			}
+			if _, ok := tigSizes[tig]; !ok {
+				t.Fatalf("placed contig %s is not in the input", tig)
+			}
+			seen[tig] = true
+		}
+		if len(placed) == 0 {
+			t.Fatal("no contigs placed")
+		}
+		t.Logf("%d of %d contigs placed", len(placed), len(tigSizes))
+
+		builder := allhic.Builder{Tourfiles: []string{optimizer.OutTourFile},
+			Fastafile: "contigs.fasta", OutFastafile: "asm.chr.fasta", Threads: 2}
+		builder.Run()
+		objSizes, objSeqs := readFastaSizes(t, "asm.chr.fasta")
+		used := checkAGP(t, builder.OutAGPfile, tigSizes, objSizes, objSeqs)
+		if len(used) != len(placed) {
+			t.Errorf("%d contigs in AGP, %d in tour", len(used), len(placed))
+		}
+		for _, tig := range placed {
+			if used[tig] != 1 {
+				t.Errorf("contig %s appears %d times in AGP", tig, used[tig])
+			}
+		}
+	})
+}
+
+// TestIntegrationScore checks the GA against the recorded baseline score
+func TestIntegrationScore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	idsfile, clmfile := simulationFiles(t)
+	tour := runOptimizer(t, shortOptimizer(t, 42))
+
+	var score float64
+	inTempDir(t, func() {
+		if err := ioutil.WriteFile("test.tour", []byte(tour), 0644); err != nil {
+			t.Fatal(err)
+		}
+		clm := mustNewCLM(t, clmfile, idsfile)
+		clm.ParseTourFile("test.tour")
+		clm.Activate(true, allhic.NewRNGStreams(42).Stream(0))
+		score, _ = clm.Tour.Evaluate()
+	})
+	t.Logf("score = %.8f (baseline %.8f)", score, float64(simulationScoreBaseline))
+	limit := simulationScoreBaseline * (1 - simulationScoreTolerance)
+	if score > limit {
+		t.Errorf("score %.5f is worse than the baseline %.5f", score, float64(simulationScoreBaseline))
+	}
+}
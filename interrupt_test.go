@@ -0,0 +1,64 @@
+/*
+ *  interrupt_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestOptimizeInterrupted stops runs by a tiny time limit and by a canceled
+// context, and checks that they leave a tour of all the contigs and a
+// checkpoint, from which the GA carries on as if it had never stopped
+func TestOptimizeInterrupted(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	var want string
+	var nTigs int
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		want = lastTour(t, opt)
+		nTigs = len(allhic.ParseTourWords(opt.OutTourFile))
+	})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, edit := range map[string]func(*allhic.Optimizer){
+		"time limit": func(r *allhic.Optimizer) { r.TimeLimit = time.Nanosecond },
+		"context":    func(r *allhic.Optimizer) { r.Context = canceled },
+	} {
+		stopped, resumed := opt, opt
+		edit(&stopped)
+		resumed.ResumeCheckpoint = true
+		inTempDir(t, func() {
+			if err := stopped.Run(); err != allhic.ErrInterrupted {
+				t.Fatalf("%s: got error %v, want %v", name, err, allhic.ErrInterrupted)
+			}
+			if got := len(allhic.ParseTourWords(stopped.OutTourFile)); got != nTigs {
+				t.Errorf("%s: last tour has %d contigs, want %d", name, got, nTigs)
+			}
+			for _, filename := range []string{"test.ga.checkpoint", "test.ga.log.csv"} {
+				if _, err := os.Stat(filename); err != nil {
+					t.Errorf("%s: %s", name, err)
+				}
+			}
+			if err := resumed.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := lastTour(t, resumed); got != want {
+				t.Errorf("%s: resumed run ends on\n%s\nwant\n%s", name, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ *  island.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/MaxHalford/eaopt"
+)
+
+// migrateBest is the migration between the islands of the GA, which evolve
+// their populations in parallel. Each island sends clones of its best tours
+// to the next island in a ring, where they replace the worst tours.
+type migrateBest struct {
+	nMigrants int
+}
+
+// Apply migrates the best tours of each island, as they were before any of
+// them arrived. The populations are sorted by fitness after each generation.
+func (r migrateBest) Apply(pops eaopt.Populations, rng *rand.Rand) {
+	migrants := make([]eaopt.Individuals, len(pops))
+	for i, pop := range pops {
+		n := r.nMigrants
+		if n > len(pop.Individuals) {
+			n = len(pop.Individuals)
+		}
+		migrants[i] = make(eaopt.Individuals, n)
+		for k := range migrants[i] {
+			migrants[i][k] = pop.Individuals[k].Clone(rng)
+		}
+	}
+	for i, from := range migrants {
+		to := pops[(i+1)%len(pops)].Individuals
+		copy(to[len(to)-len(from):], from)
+	}
+}
+
+// Validate checks that some tours migrate
+func (r migrateBest) Validate() error {
+	if r.nMigrants <= 0 {
+		return errors.New("nMigrants should be higher than 0")
+	}
+	return nil
+}
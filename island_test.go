@@ -0,0 +1,67 @@
+/*
+ *  island_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MaxHalford/eaopt"
+	"github.com/tanghaibao/allhic"
+)
+
+// TestMigrateBest sends the best tours of each island in place of the worst
+// ones of the next island
+func TestMigrateBest(t *testing.T) {
+	tour, _ := syntheticTour(10)
+	pops := make(eaopt.Populations, 3)
+	for i := range pops {
+		for k := 0; k < 5; k++ {
+			fitness := float64(10*i + k) // Sorted by fitness
+			pops[i].Individuals = append(pops[i].Individuals,
+				eaopt.Individual{Genome: tour.Clone(), Fitness: fitness, Evaluated: true})
+		}
+	}
+	allhic.MigrateBest(pops, 2)
+	want := [][]float64{{0, 1, 2, 20, 21}, {10, 11, 12, 0, 1}, {20, 21, 22, 10, 11}}
+	for i, pop := range pops {
+		got := make([]float64, len(pop.Individuals))
+		for k, indi := range pop.Individuals {
+			got[k] = indi.Fitness
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("island %d has fitnesses %v, want %v", i, got, want[i])
+		}
+	}
+	migrant := pops[1].Individuals[3].Genome.(allhic.Tour)
+	migrant.Tigs[0].Idx = -1
+	if pops[0].Individuals[0].Genome.(allhic.Tour).Tigs[0].Idx == -1 {
+		t.Error("migrants share their tigs with the tours they are cloned from")
+	}
+}
+
+// TestOptimizeIslands evolves several islands, which the seed reproduces,
+// and a single island, which is the GA of a single population
+func TestOptimizeIslands(t *testing.T) {
+	islands := shortOptimizer(t, 42)
+	islands.Islands, islands.MigrationInterval = 3, 5
+	a, b := runOptimizer(t, islands), runOptimizer(t, islands)
+	if a != b {
+		t.Error("two runs of 3 islands with the same seed produced different tours")
+	}
+	if !strings.Contains(a, "islands=3 migration=5") {
+		t.Error("tours are not labelled with the islands")
+	}
+	single := shortOptimizer(t, 42)
+	single.Islands = 1
+	if runOptimizer(t, single) != runOptimizer(t, shortOptimizer(t, 42)) {
+		t.Error("a single island differs from the GA of a single population")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *  joint.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+// JointScorer scores the order and the orientations of the tigs together,
+// for the GA to optimize both at once. The orientations are carried by the
+// tigs of each tour, see Tig.Sign. The pairs of tigs up to JointOrientWindow
+// apart in the tour score the links of the clm row of their orientations
+// over the link distances that the layout implies, i.e. the gap between the
+// tigs plus the distances in the row. The other pairs score as in Evaluate.
+type JointScorer struct {
+	clm *CLM
+}
+
+// NewJointScorer scores the tours over the oriented contacts of clm
+func NewJointScorer(clm *CLM) *JointScorer {
+	return &JointScorer{clm: clm}
+}
+
+// Name labels the joint scores
+func (r *JointScorer) Name() string {
+	return ScoreJointOrient
+}
+
+// Score returns the score of the order and the orientations of the tour
+func (r *JointScorer) Score(tour Tour) float64 {
+	score := Tour{Tigs: tour.Tigs, M: tour.M}.evaluate()
+	mid := tour.midpoints()
+	for i, a := range tour.Tigs {
+		for j := i + 1; j < tour.Len() && j <= i+JointOrientWindow; j++ {
+			b := tour.Tigs[j]
+			dist := mid[j] - mid[i]
+			if dist > LIMIT {
+				break
+			}
+			// The oriented links replace the links of the pair in M
+			score += tour.M.links(a.Idx, b.Idx) / dist
+			score -= r.orientedLinks(a, b, dist-float64(a.Size+b.Size)/2)
+		}
+	}
+	return score
+}
+
+// orientedLinks sums the links from tig a to tig b, as oriented in the tour,
+// over their distances with the gap between the tigs, as in EvaluateQ
+func (r *JointScorer) orientedLinks(a, b Tig, gap float64) float64 {
+	gi, ok := r.clm.orientedContacts[newOrientedPair(a.Idx, b.Idx, r.sign(a), r.sign(b))]
+	if !ok {
+		return 0
+	}
+	g := &r.clm.gdists[gi]
+	links := 0.0
+	for k, center := range r.clm.golden.centers[:r.clm.golden.Bins] {
+		if g[k] != 0 {
+			links += float64(g[k]) / (float64(center) + gap)
+		}
+	}
+	return links
+}
+
+// sign returns the orientation of the tig in the tour, or that of the CLM
+// when the tour does not carry one
+func (r *JointScorer) sign(tig Tig) byte {
+	if tig.Sign != 0 {
+		return tig.Sign
+	}
+	return r.clm.Signs[tig.Idx]
+}
+
+// jointOrient tells if the tour carries the orientations of its tigs
+func (r Tour) jointOrient() bool {
+	_, ok := r.Scorer.(*JointScorer)
+	return ok
+}
+
+// flipSigns flips the orientations that the tour carries between positions
+// p and q, except for the imposed strands of the CLM
+func (r Tour) flipSigns(p, q int) {
+	var clm *CLM
+	if scorer, ok := r.Scorer.(*JointScorer); ok {
+		clm = scorer.clm
+	}
+	for i := p; i <= q; i++ {
+		if clm == nil || !clm.fixedStrand(r.Tigs[i].Idx) {
+			r.Tigs[i].Sign = rr(r.Tigs[i].Sign)
+		}
+	}
+}
+
+// carrySigns copies the orientations of the CLM into the tigs of the tour
+func (r *CLM) carrySigns(tour Tour) {
+	for i, tig := range tour.Tigs {
+		tour.Tigs[i].Sign = r.Signs[tig.Idx]
+	}
+}
+
+// takeSigns copies the orientations that the tour carries back to the CLM
+func (r *CLM) takeSigns(tour Tour) {
+	for i, tig := range tour.Tigs {
+		if tig.Sign != 0 {
+			r.Signs[tig.Idx] = tig.Sign
+		}
+		tour.Tigs[i].Sign = 0
+	}
+}
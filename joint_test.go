@@ -0,0 +1,90 @@
+/*
+ *  joint_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeJointFixture writes a small contig S and two large contigs L and R,
+// laid out as S+ L+ R+. S links to the start of L, and L to R at their
+// junction, but the midpoints put S between L and R, as L- S- R+. Only the
+// oriented distances tell that S sits before L.
+func writeJointFixture(dir string) (idsfile, clmfile string) {
+	ls, lr, sr := clmPair{a: "L", b: "S"}, clmPair{a: "L", b: "R"}, clmPair{a: "S", b: "R"}
+	for k := 0; k < 10; k++ {
+		ls.links = append(ls.links, clmLink{1000 + 1500*k, 18000 + 200*k})
+		lr.links = append(lr.links, clmLink{199000 - 1500*k, 1000 + 1500*k})
+	}
+	for k := 0; k < 3; k++ {
+		sr.links = append(sr.links, clmLink{19000, 2000 + 3000*k})
+	}
+	return writeCLMFixture(dir, "joint", []clmContig{{"L", 200000}, {"S", 20000}, {"R", 200000}},
+		[]clmPair{ls, lr, sr})
+}
+
+// TestJointScorer checks that the links over midpoint distances prefer
+// L- S- R+, and the joint score the true layout S+ L+ R+
+func TestJointScorer(t *testing.T) {
+	idsfile, clmfile := writeJointFixture(t.TempDir())
+	r := mustNewCLM(t, clmfile, idsfile)
+	M := r.M()
+	sizes := []int{200000, 20000, 200000}
+	layout := func(order string) allhic.Tour {
+		tour := allhic.Tour{M: M}
+		for _, atom := range strings.Fields(order) {
+			idx := strings.Index("LSR", atom[:1])
+			tour.Tigs = append(tour.Tigs, allhic.Tig{Idx: idx, Size: sizes[idx], Sign: atom[1]})
+		}
+		return tour
+	}
+	truth, trap := layout("S+ L+ R+"), layout("L- S- R+")
+	truthScore, _ := truth.Evaluate()
+	trapScore, _ := trap.Evaluate()
+	if trapScore >= truthScore {
+		t.Errorf("default score: %s %v, %s %v, expected the trap to score better",
+			"L- S- R+", -trapScore, "S+ L+ R+", -truthScore)
+	}
+
+	scorer := allhic.NewJointScorer(r)
+	truth.Scorer, trap.Scorer = scorer, scorer
+	truthScore, _ = truth.Evaluate()
+	trapScore, _ = trap.Evaluate()
+	if truthScore >= trapScore {
+		t.Errorf("joint score: %s %v, %s %v, expected the truth to score better",
+			"S+ L+ R+", -truthScore, "L- S- R+", -trapScore)
+	}
+	if got := truth.ScoreName(); got != allhic.ScoreJointOrient {
+		t.Errorf("ScoreName() = %s, want %s", got, allhic.ScoreJointOrient)
+	}
+}
+
+// TestOptimizeJointOrient runs the whole optimization on the fixture, where
+// the two-phase approach leaves S on the wrong side of L
+func TestOptimizeJointOrient(t *testing.T) {
+	idsfile, clmfile := writeJointFixture(t.TempDir())
+	finalTour := func(joint bool) string {
+		opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true,
+			Seed: 42, NPop: 20, NGen: 50, MutProb: allhic.MutaProb, JointOrient: joint}
+		tours := strings.Split(strings.TrimSpace(runOptimizer(t, opt)), "\n")
+		return tours[len(tours)-1]
+	}
+	isTruth := func(tour string) bool {
+		return tour == "S+ L+ R+" || tour == "R- L- S-"
+	}
+	if tour := finalTour(false); isTruth(tour) {
+		t.Errorf("two-phase tour %s, expected the fixture to trap it", tour)
+	}
+	if tour := finalTour(true); !isTruth(tour) {
+		t.Errorf("joint tour %s, want S+ L+ R+ or R- L- S-", tour)
+	}
+}
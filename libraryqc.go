@@ -0,0 +1,227 @@
+/*
+ *  libraryqc.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// QCStatusOK and QCStatusWarn are the statuses of the QC metrics with a
+// threshold, the others have none
+const (
+	QCStatusOK   = "ok"
+	QCStatusWarn = "warn"
+)
+
+// QCThresholds are the fractions of the library QC that warn, a zero field
+// uses the default, e.g. QCMinLongCis for MinLongCis
+type QCThresholds struct {
+	// MinMapped is the fewest pairs with both reads mapped
+	MinMapped float64
+	// MaxDuplicates is the most duplicates among the pairs passing MAPQ
+	MaxDuplicates float64
+	// MinLongCis is the fewest pairs within a contig and over QCLongCis
+	// apart among the contacts
+	MinLongCis float64
+	// MaxReligation and MaxSelfCircle are the most short inward and outward
+	// pairs among the intra-contig pairs
+	MaxReligation float64
+	MaxSelfCircle float64
+}
+
+// withDefaults returns the thresholds with the defaults in place of zeros
+func (r QCThresholds) withDefaults() QCThresholds {
+	for _, t := range []struct {
+		value *float64
+		def   float64
+	}{
+		{&r.MinMapped, QCMinMapped}, {&r.MaxDuplicates, QCMaxDuplicates},
+		{&r.MinLongCis, QCMinLongCis}, {&r.MaxReligation, QCMaxReligation},
+		{&r.MaxSelfCircle, QCMaxSelfCircle},
+	} {
+		if *t.value == 0 {
+			*t.value = t.def
+		}
+	}
+	return r
+}
+
+// QCMetric is a row of the library QC, a Count of pairs and its Fraction of
+// the Count of the metric Of, with the Status of its threshold if any
+type QCMetric struct {
+	Metric   string  `json:"metric"`
+	Count    int     `json:"count"`
+	Of       string  `json:"of,omitempty"`
+	Fraction float64 `json:"fraction"`
+	Status   string  `json:"status,omitempty"`
+}
+
+// String outputs the string representation of QCMetric
+func (r QCMetric) String() string {
+	of, status := r.Of, r.Status
+	if of == "" {
+		of = "-"
+	}
+	if status == "" {
+		status = "-"
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%.4f\t%s", r.Metric, r.Count, of, r.Fraction, status)
+}
+
+// Orientations of the intra-contig pairs, by the strands of the leftmost
+// read then the other: FR points inward and RF outward
+var qcOrientations = [4]string{"FF", "FR", "RF", "RR"}
+
+// pairQC counts the read pairs by what they tell of the library, each pair
+// by its first read, the others being those skipped by extract
+type pairQC struct {
+	pairs, mapped, mapq, duplicates int
+	intra, inter                    int
+	// intraLong and intraVeryLong are over QCLongCis and QCVeryLongCis
+	intraLong, intraVeryLong int
+	// religation and selfCircle are the inward and outward pairs closer
+	// than MinLinkDist, of the uncut or religated fragments and of those
+	// circularized on themselves
+	religation, selfCircle int
+	orientations           [4]int
+}
+
+// add sums the counts of other into r
+func (r *pairQC) add(other pairQC) {
+	r.pairs += other.pairs
+	r.mapped += other.mapped
+	r.mapq += other.mapq
+	r.duplicates += other.duplicates
+	r.intra += other.intra
+	r.inter += other.inter
+	r.intraLong += other.intraLong
+	r.intraVeryLong += other.intraVeryLong
+	r.religation += other.religation
+	r.selfCircle += other.selfCircle
+	for i, n := range other.orientations {
+		r.orientations[i] += n
+	}
+}
+
+// countPair counts the pair of the primary first read, which passes MAPQ
+// with both reads at MinMapq or over, or over 0 without MinMapq
+func (r *Extracter) countPair(rec *bamRecord, qc *pairQC) {
+	if rec.Flags&0x40 == 0 || rec.Flags&0x900 != 0 {
+		return
+	}
+	qc.pairs++
+	if rec.Flags&0xC != 0 {
+		return
+	}
+	qc.mapped++
+	minMapq := max(r.MinMapq, 1)
+	if int(rec.MapQ) < minMapq || rec.MateMapQ() >= 0 && rec.MateMapQ() < minMapq {
+		return
+	}
+	qc.mapq++
+	if rec.Flags&0x400 != 0 {
+		qc.duplicates++
+		return
+	}
+	if rec.RefID != rec.MateRefID {
+		qc.inter++
+		return
+	}
+	qc.intra++
+	dist := int(rec.MatePos - rec.Pos)
+	left, right := rec.Flags&0x10 != 0, rec.Flags&0x20 != 0
+	if dist < 0 {
+		dist, left, right = -dist, right, left
+	}
+	orientation := 0
+	if left {
+		orientation += 2
+	}
+	if right {
+		orientation++
+	}
+	qc.orientations[orientation]++
+	switch {
+	case dist > QCVeryLongCis:
+		qc.intraVeryLong++
+		qc.intraLong++
+	case dist > QCLongCis:
+		qc.intraLong++
+	case dist < MinLinkDist && orientation == 1:
+		qc.religation++
+	case dist < MinLinkDist && orientation == 2:
+		qc.selfCircle++
+	}
+}
+
+// libraryQC makes the rows of the library QC, the duplicates being those
+// flagged in the BAM and the pairs of the links dropped by Dedup, which
+// are counted in the contacts still
+func (r *pairQC) libraryQC(dedupPairs int, thresholds QCThresholds) []QCMetric {
+	t := thresholds.withDefaults()
+	contacts := r.intra + r.inter
+	var rows []QCMetric
+	row := func(metric string, count int, of string, total int, status func(float64) bool) {
+		m := QCMetric{Metric: metric, Count: count, Of: of}
+		if total > 0 {
+			m.Fraction = float64(count) / float64(total)
+		}
+		if status != nil {
+			m.Status = QCStatusOK
+			if total > 0 && !status(m.Fraction) {
+				m.Status = QCStatusWarn
+			}
+		}
+		rows = append(rows, m)
+	}
+	atLeast := func(bound float64) func(float64) bool { return func(x float64) bool { return x >= bound } }
+	atMost := func(bound float64) func(float64) bool { return func(x float64) bool { return x <= bound } }
+	row("pairs", r.pairs, "", 0, nil)
+	row("mapped", r.mapped, "pairs", r.pairs, atLeast(t.MinMapped))
+	row("mapq", r.mapq, "mapped", r.mapped, nil)
+	row("duplicates", r.duplicates+dedupPairs, "mapq", r.mapq, atMost(t.MaxDuplicates))
+	row("contacts", contacts, "mapq", r.mapq, nil)
+	row("intra", r.intra, "contacts", contacts, nil)
+	row("inter", r.inter, "contacts", contacts, nil)
+	row("long_cis", r.intraLong, "contacts", contacts, atLeast(t.MinLongCis))
+	row("intra_10kb", r.intraLong, "intra", r.intra, nil)
+	row("intra_1mb", r.intraVeryLong, "intra", r.intra, nil)
+	row("religation", r.religation, "intra", r.intra, atMost(t.MaxReligation))
+	row("self_circle", r.selfCircle, "intra", r.intra, atMost(t.MaxSelfCircle))
+	for i, orientation := range qcOrientations {
+		row(orientation, r.orientations[i], "intra", r.intra, nil)
+	}
+	return rows
+}
+
+// logLibraryQC warns of the metrics over or under their thresholds
+func logLibraryQC(rows []QCMetric) {
+	nWarnings := 0
+	for _, m := range rows {
+		if m.Status == QCStatusWarn {
+			log.Warningf("Library QC: %s at %.1f%% of %s is out of bounds", m.Metric, 100*m.Fraction, m.Of)
+			nWarnings++
+		}
+	}
+	log.Noticef("Library QC of %d pairs with %d warnings", rows[0].Count, nWarnings)
+}
+
+// writeLibraryQC writes the rows of the library QC
+func writeLibraryQC(outfile string, rows []QCMetric) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, QCHeader)
+	for _, m := range rows {
+		_, _ = fmt.Fprintln(w, m)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Library QC written to `%s`", outfile)
+}
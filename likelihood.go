@@ -0,0 +1,75 @@
+/*
+ *  likelihood.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import "math"
+
+// MinExpectedLinks keeps the log of the expected links finite where the
+// distribution has no links
+const MinExpectedLinks = 1e-12
+
+// LikelihoodScorer scores a tour by the Poisson log-likelihood of the links
+// between each pair of tigs within LIMIT. The links expected between two
+// tigs are their sizes times the link density, per bp of sequence and per bp
+// of link size, at the distance between their midpoints in the tour. Unlike
+// Evaluate, pairs without links count too, against being placed close.
+type LikelihoodScorer struct {
+	decay *LinkDensityModel
+}
+
+// NewLikelihoodScorer reads the link size distribution written by extract
+func NewLikelihoodScorer(distfile string) (*LikelihoodScorer, error) {
+	decay, err := readLinkDistribution(distfile)
+	if err != nil {
+		return nil, err
+	}
+	log.Noticef("Score tours by the likelihood of the link size distribution in `%s` (%d bins, from %d bp)",
+		distfile, len(decay.linkDensity), decay.DistLowerBound())
+	return &LikelihoodScorer{decay: decay}, nil
+}
+
+// Name labels the likelihood scores
+func (r *LikelihoodScorer) Name() string {
+	return ScoreLikelihood
+}
+
+// Score returns the negative log-likelihood of the tour, without the terms
+// that do not depend on the ordering
+func (r *LikelihoodScorer) Score(tour Tour) float64 {
+	mid := tour.midpoints()
+	size := tour.Len()
+
+	score := 0.0
+	end := 0
+	for i := 0; i < size; i++ {
+		a := tour.Tigs[i]
+		if end <= i {
+			end = i + 1
+		}
+		for end < size && mid[end]-mid[i] <= LIMIT {
+			end++
+		}
+		for j := i + 1; j < end; j++ {
+			b := tour.Tigs[j]
+			expected := r.expected(a.Size, b.Size, mid[j]-mid[i])
+			observed := float64(tour.M.At(a.Idx, b.Idx))
+			score -= observed*math.Log(expected) - expected
+		}
+	}
+	return score
+}
+
+// expected returns the links expected between two tigs at distance dist
+func (r *LikelihoodScorer) expected(asize, bsize int, dist float64) float64 {
+	expected := float64(asize) * float64(bsize) * r.decay.density(dist)
+	if expected < MinExpectedLinks {
+		return MinExpectedLinks
+	}
+	return expected
+}
@@ -0,0 +1,105 @@
+/*
+ *  likelihood_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeDecay writes a distribution file where the link density decays as
+// 2e-3 / dist, so two 10kb tigs 10kb apart expect 20 links
+func writeDecay(t testing.TB, distfile string) {
+	var b strings.Builder
+	b.WriteString(allhic.DistributionHeader)
+	for i, start := 0, 1000; i < 16; i, start = i+1, start*2 {
+		fmt.Fprintf(&b, "%d\t%d\t%d\t0\t0\t%.4g\n", i, start, start, 2e-3/float64(start))
+	}
+	if err := ioutil.WriteFile(distfile, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLikelihoodScorer scores a chain of tigs, with the links expected from
+// the decay, in its true order and with two tigs swapped
+func TestLikelihoodScorer(t *testing.T) {
+	inTempDir(t, func() {
+		writeDecay(t, "test.distribution.txt")
+		scorer, err := allhic.NewLikelihoodScorer("test.distribution.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		N := 8
+		tour := allhic.Tour{Tigs: make([]allhic.Tig, N), M: allhic.NewMatrix(N), Scorer: scorer}
+		for i := 0; i < N; i++ {
+			tour.Tigs[i] = allhic.Tig{Idx: i, Size: 10000}
+			for j := i + 1; j < N && j <= i+3; j++ {
+				tour.M.Set(i, j, 20/(j-i))
+				tour.M.Set(j, i, 20/(j-i))
+			}
+		}
+		if got := tour.ScoreName(); got != allhic.ScoreLikelihood {
+			t.Errorf("ScoreName() = %s, want %s", got, allhic.ScoreLikelihood)
+		}
+		score, _ := tour.Evaluate()
+		if want := scorer.Score(tour); score != want {
+			t.Errorf("Evaluate() = %v, want the score of the scorer %v", score, want)
+		}
+
+		swapped := tour.Clone().(allhic.Tour)
+		swapped.Swap(2, 5)
+		if swappedScore, _ := swapped.Evaluate(); swappedScore <= score {
+			t.Errorf("swapped tour scores %v, not worse than the true order %v", swappedScore, score)
+		}
+	})
+}
+
+func TestLikelihoodScorerErrors(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"empty.distribution.txt": allhic.DistributionHeader,
+			"short.distribution.txt": "0\t1000\t1000\t5\n",
+			"gap.distribution.txt":   "0\t1000\t1000\t5\t0\t0.1\t2000\n1\t3000\t1000\t5\t0\t0.1\t4000\n",
+		})
+		for name, want := range map[string]string{
+			"missing.distribution.txt": "cannot open distribution file",
+			"empty.distribution.txt":   "no bins",
+			"short.distribution.txt":   "expected 6 columns at line 1",
+			"gap.distribution.txt":     "starts at 3000, not at the end 2000",
+		} {
+			if _, err := allhic.NewLikelihoodScorer(name); err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got error %v, want %q", name, err, want)
+			}
+		}
+	})
+}
+
+// TestOptimizeLikelihood runs the GA with the likelihood score and checks
+// that the tours are labelled with it
+func TestOptimizeLikelihood(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := shortOptimizer(t, 42)
+	opt.Score = allhic.ScoreLikelihood
+	opt.DistFile = filepath.Join(dir, "test.distribution.txt")
+	writeDecay(t, opt.DistFile)
+	tour := runOptimizer(t, opt)
+	if !strings.Contains(tour, "scoring=likelihood") {
+		t.Errorf("tours are not labelled with the likelihood score:\n%s", tour)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *  linkbins.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// LinkBinSize is the resolution (bp) at which links are aggregated when
+	// the Anchorer runs under a memory limit
+	LinkBinSize = 1000
+	// binnedLinkBytes is the on-disk size of a single binned link record
+	binnedLinkBytes = 20
+	// binnedLinkMapBytes is the approximate in-memory cost of one map entry
+	binnedLinkMapBytes = 48
+)
+
+// binnedLinkKey identifies a pair of bins on two contigs
+type binnedLinkKey struct {
+	ai, abin, bi, bbin int32
+}
+
+// binnedLinks aggregates inter-contig links into counts per pair of contig
+// bins. The counts are kept in memory until they exceed the memory limit, at
+// which point they are spilled to a temporary file. Since the counts are
+// additive, the same key may appear in several spills.
+type binnedLinks struct {
+	memLimit int64
+	counts   map[binnedLinkKey]uint32
+	f        *os.File
+	w        *bufio.Writer
+	nRecords int64
+	nSpills  int
+}
+
+// newBinnedLinks creates the temporary file backing the binned links
+func newBinnedLinks(memLimit int64) *binnedLinks {
+	f, err := ioutil.TempFile("", "allhic-links-*.bin")
+	ErrorAbort(err)
+	log.Noticef("Binned links (resolution=%d, memLimit=%d) spilled to `%s`",
+		LinkBinSize, memLimit, f.Name())
+	return &binnedLinks{
+		memLimit: memLimit,
+		counts:   make(map[binnedLinkKey]uint32),
+		f:        f,
+		w:        bufio.NewWriter(f),
+	}
+}
+
+// add counts a single link between positions on two contigs
+func (r *binnedLinks) add(a, b *Contig, apos, bpos int64) {
+	key := binnedLinkKey{int32(a.idx), int32(apos / LinkBinSize),
+		int32(b.idx), int32(bpos / LinkBinSize)}
+	r.counts[key]++
+	if int64(len(r.counts))*binnedLinkMapBytes > r.memLimit {
+		r.spill()
+	}
+}
+
+// spill writes the counts currently in memory to the temporary file
+func (r *binnedLinks) spill() {
+	if len(r.counts) == 0 {
+		return
+	}
+	buf := make([]byte, binnedLinkBytes)
+	for key, count := range r.counts {
+		binary.LittleEndian.PutUint32(buf[0:], uint32(key.ai))
+		binary.LittleEndian.PutUint32(buf[4:], uint32(key.abin))
+		binary.LittleEndian.PutUint32(buf[8:], uint32(key.bi))
+		binary.LittleEndian.PutUint32(buf[12:], uint32(key.bbin))
+		binary.LittleEndian.PutUint32(buf[16:], count)
+		_, err := r.w.Write(buf)
+		ErrorAbort(err)
+	}
+	r.nRecords += int64(len(r.counts))
+	r.nSpills++
+	r.counts = make(map[binnedLinkKey]uint32)
+}
+
+// close flushes all pending counts, after which the links can be re-read
+func (r *binnedLinks) close() {
+	r.spill()
+	ErrorAbort(r.w.Flush())
+	log.Noticef("Wrote %d binned link records in %d spills (%d bytes)",
+		r.nRecords, r.nSpills, r.nRecords*binnedLinkBytes)
+}
+
+// forEach streams through the file and calls f on each record, positions
+// are reported as the centers of the bins
+func (r *binnedLinks) forEach(f func(ai, bi int, apos, bpos, n int64)) {
+	_, err := r.f.Seek(0, io.SeekStart)
+	ErrorAbort(err)
+	reader := bufio.NewReader(r.f)
+	buf := make([]byte, binnedLinkBytes)
+	for {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			if err != io.EOF {
+				log.Error(err)
+			}
+			break
+		}
+		ai := int(binary.LittleEndian.Uint32(buf[0:]))
+		abin := int64(binary.LittleEndian.Uint32(buf[4:]))
+		bi := int(binary.LittleEndian.Uint32(buf[8:]))
+		bbin := int64(binary.LittleEndian.Uint32(buf[12:]))
+		n := int64(binary.LittleEndian.Uint32(buf[16:]))
+		f(ai, bi, abin*LinkBinSize+LinkBinSize/2, bbin*LinkBinSize+LinkBinSize/2, n)
+	}
+}
+
+// remove deletes the temporary file
+func (r *binnedLinks) remove() {
+	_ = r.f.Close()
+	_ = os.Remove(r.f.Name())
+}
@@ -0,0 +1,125 @@
+/*
+ *  lowmem.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// interLinkBytes is the size of an inter-contig link size on disk, see
+// interLinkCodec
+const interLinkBytes = 4 + 4 + 1 + 8
+
+// interLink is the size of an inter-contig link in one of the four
+// orientations of its contig pair, see LinkAggregator.Add
+type interLink struct {
+	ai, bi      int32
+	orientation uint8
+	dist        int64
+}
+
+// interLinkCodec sorts the link sizes by their contig pair and orientation,
+// those of the same in the order added as the sort is stable
+type interLinkCodec struct{}
+
+func (c interLinkCodec) Encode(w *bufio.Writer, rec interface{}) error {
+	var buf [interLinkBytes]byte
+	r := rec.(interLink)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(r.ai))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(r.bi))
+	buf[8] = r.orientation
+	binary.LittleEndian.PutUint64(buf[9:], uint64(r.dist))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func (c interLinkCodec) Decode(r *bufio.Reader) (interface{}, error) {
+	var buf [interLinkBytes]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	return interLink{
+		ai:          int32(binary.LittleEndian.Uint32(buf[0:])),
+		bi:          int32(binary.LittleEndian.Uint32(buf[4:])),
+		orientation: buf[8],
+		dist:        int64(binary.LittleEndian.Uint64(buf[9:])),
+	}, nil
+}
+
+func (c interLinkCodec) Less(a, b interface{}) bool {
+	x, y := a.(interLink), b.(interLink)
+	switch {
+	case x.ai != y.ai:
+		return x.ai < y.ai
+	case x.bi != y.bi:
+		return x.bi < y.bi
+	}
+	return x.orientation < y.orientation
+}
+
+func (c interLinkCodec) Size(rec interface{}) int {
+	return interLinkBytes
+}
+
+// spillLinks sorts the inter-contig links on disk, in runs under tempDir
+// within memLimit, in place of holding them in contigPairs, and tallies
+// the intra-contig links into the bins of the distribution as they come,
+// in place of holding them in the contigs
+func (r *LinkAggregator) spillLinks(memLimit int64, tempDir string) {
+	r.spill = NewExternalSorter(interLinkCodec{}, memLimit, tempDir)
+	m, err := newSpacedModel(r.Bins, r.BinScale)
+	ErrorAbort(err)
+	r.binned = m
+}
+
+// addSpilled adds the four sizes of an inter-contig link to the sort
+func (r *LinkAggregator) addSpilled(pair [2]int, dists [4]int) {
+	for i, dist := range dists {
+		ErrorAbort(r.spill.Add(interLink{ai: int32(pair[0]), bi: int32(pair[1]),
+			orientation: uint8(i), dist: int64(dist)}))
+	}
+}
+
+// eachSpilled merges the sorted link sizes, and calls f on those of each
+// contig pair and orientation in turn, in the order of sortedPairs
+func (r *LinkAggregator) eachSpilled(f func(pair [2]int, orientation int, links []int)) {
+	defer func() { ErrorAbort(r.spill.Close()) }()
+	var last interLink
+	var links []int
+	flush := func() {
+		if len(links) > 0 {
+			f([2]int{int(last.ai), int(last.bi)}, int(last.orientation), links)
+		}
+		links = nil
+	}
+	ErrorAbort(r.spill.Each(func(rec interface{}) error {
+		link := rec.(interLink)
+		if link.ai != last.ai || link.bi != last.bi || link.orientation != last.orientation {
+			flush()
+			last = link
+		}
+		links = append(links, int(link.dist))
+		return nil
+	}))
+	flush()
+}
+
+// newScratchDir creates a temporary directory under tempDir, the system
+// default when empty, and returns it with the function that removes it
+func newScratchDir(tempDir string) (string, func(), error) {
+	dir, err := ioutil.TempDir(tempDir, "allhic-extract-*")
+	if err != nil {
+		return "", nil, err
+	}
+	return dir, func() { ErrorAbort(os.RemoveAll(dir)) }, nil
+}
@@ -0,0 +1,126 @@
+/*
+ *  mergeclm.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// CLMMerger merges the clm and ids files extracted separately from several
+// Hi-C libraries of the same contigs
+type CLMMerger struct {
+	Clmfiles []string
+	REfiles  []string // One per clmfile
+	Strict   bool
+	// Output files
+	OutClmfile string
+	OutREfile  string
+}
+
+// mergedCLM is the union of the ids files, the rows of all the clm files
+// and the lines of the ids files to write out
+type mergedCLM struct {
+	*CLM
+	lines   []indexedClmLine
+	idLines []string
+}
+
+// MergeCLMFiles parses each clmfile with its ids file and merges them into
+// one CLM. The links of the same oriented pair are concatenated, as for
+// duplicate rows in one clmfile, so the mean distances and the golden arrays
+// are those of all the links together. A contig with different sizes in two
+// ids files is an error.
+func MergeCLMFiles(clmfiles, refiles []string) (*CLM, error) {
+	m, err := mergeCLMFiles(clmfiles, refiles, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.CLM, nil
+}
+
+// mergeCLMFiles reads the ids files and then the clm files into a mergedCLM
+func mergeCLMFiles(clmfiles, refiles []string, strict bool) (*mergedCLM, error) {
+	if len(clmfiles) != len(refiles) {
+		return nil, fmt.Errorf("%d clm files but %d ids files", len(clmfiles), len(refiles))
+	}
+	m := &mergedCLM{CLM: newCLM()}
+	sources := make([]string, 0)
+	for _, refile := range refiles {
+		var conflict error
+		err := readREFile(refile, func(line, name string, size int, recovered bool) {
+			idx, ok := m.tigToIdx[name]
+			if !ok {
+				m.addTig(name, size).Recovered = recovered
+				m.idLines = append(m.idLines, line)
+				sources = append(sources, refile)
+				return
+			}
+			if tig := m.Tigs[idx]; tig.Size != size && conflict == nil {
+				conflict = fmt.Errorf("contig %s has size %d in %s but %d in %s",
+					name, tig.Size, sources[idx], size, refile)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			return nil, conflict
+		}
+	}
+
+	var lines []CLMLine
+	for _, clmfile := range clmfiles {
+		clmLines, err := readClmLines(clmfile, strict, 0)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, clmLines...)
+	}
+	m.lines, _ = m.mergeClmLines(lines)
+	m.addClmLines(lines)
+	log.Noticef("Merged %d clm files into %d tigs and %d oriented contig pairs",
+		len(clmfiles), len(m.Tigs), len(m.lines))
+	return m, nil
+}
+
+// Run is the main function body of mergeclm
+func (r *CLMMerger) Run() {
+	m, err := mergeCLMFiles(r.Clmfiles, r.REfiles, r.Strict)
+	ErrorAbort(err)
+	r.OutREfile = RemoveExt(r.OutClmfile) + ".ids"
+	m.writeRE(r.OutREfile)
+	m.writeClm(r.OutClmfile)
+	log.Notice("Success")
+}
+
+// writeRE writes the ids lines, each from the first ids file with the contig
+func (r *mergedCLM) writeRE(outfile string) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	for _, line := range r.idLines {
+		_, _ = fmt.Fprintln(w, line)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Write %d contigs to `%s`", len(r.idLines), outfile)
+}
+
+// writeClm writes one row per oriented contig pair, with all its links
+func (r *mergedCLM) writeClm(outfile string) {
+	f := mustCreateAtomic(outfile)
+	w := bufio.NewWriter(f)
+	for _, line := range r.lines {
+		_, _ = fmt.Fprintf(w, "%s%c %s%c\t%d\t%s\n",
+			line.at, line.ao, line.bt, line.bo, len(line.links), arrayToString(line.links, " "))
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Write %d rows to `%s`", len(r.lines), outfile)
+}
@@ -0,0 +1,94 @@
+/*
+ *  mergeclm_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeFiles writes each file with its content in the current directory
+func writeFiles(t *testing.T, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestMergeCLM merges two libraries that share t1 and t2, and have the pair
+// (t1, t2) written in opposite directions
+func TestMergeCLM(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"lib1.ids": "t0\t10\t5000\nt1\t10\t6000\nt2\t10\t7000\n",
+			"lib1.clm": "t0+ t1+\t2\t1000 2000\nt1+ t2-\t1\t5000\n",
+			"lib2.ids": "t1\t10\t6000\nt2\t10\t7000\trecover\nt3\t10\t8000\n",
+			"lib2.clm": "t2+ t1-\t2\t3000 4000\nt2+ t3+\t1\t100\n",
+			"all.ids":  "t0\t10\t5000\nt1\t10\t6000\nt2\t10\t7000\nt3\t10\t8000\n",
+		})
+		// All the rows in one clmfile, which merges the duplicate rows
+		lib1, _ := ioutil.ReadFile("lib1.clm")
+		lib2, _ := ioutil.ReadFile("lib2.clm")
+		writeFiles(t, map[string]string{"all.clm": string(lib1) + string(lib2)})
+
+		p := allhic.CLMMerger{OutClmfile: "out.clm",
+			Clmfiles: []string{"lib1.clm", "lib2.clm"}, REfiles: []string{"lib1.ids", "lib2.ids"}}
+		p.Run()
+		clm, err := ioutil.ReadFile(p.OutClmfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "t0+ t1+\t2\t1000 2000\nt1+ t2-\t3\t3000 4000 5000\nt2+ t3+\t1\t100\n"
+		if string(clm) != want {
+			t.Errorf("got clmfile %q, want %q", clm, want)
+		}
+		ids, err := ioutil.ReadFile(p.OutREfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "t0\t10\t5000\nt1\t10\t6000\nt2\t10\t7000\nt3\t10\t8000\n"; string(ids) != want {
+			t.Errorf("got ids file %q, want %q", ids, want)
+		}
+
+		merged, err := allhic.MergeCLMFiles(p.Clmfiles, p.REfiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []*allhic.CLM{mustNewCLM(t, "out.clm", "out.ids"),
+			mustNewCLM(t, "all.clm", "all.ids")} {
+			if !reflect.DeepEqual(merged.M(), r.M()) {
+				t.Errorf("%s: contact matrices differ", r.Clmfile)
+			}
+			signs := []byte("+-+-")
+			merged.Signs, r.Signs = signs, signs
+			if !reflect.DeepEqual(merged.Q(), r.Q()) {
+				t.Errorf("%s: golden arrays differ", r.Clmfile)
+			}
+		}
+	})
+}
+
+func TestMergeCLMSizeConflict(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"lib1.ids": "t0\t5000\nt1\t6000\n",
+			"lib2.ids": "t0\t5000\nt1\t6500\n",
+			"lib.clm":  "t0+ t1+\t2\t1000 2000\n",
+		})
+		_, err := allhic.MergeCLMFiles([]string{"lib.clm", "lib.clm"}, []string{"lib1.ids", "lib2.ids"})
+		if err == nil || !strings.Contains(err.Error(), "contig t1 has size 6000 in lib1.ids but 6500 in lib2.ids") {
+			t.Errorf("got error %v, want a size conflict on t1", err)
+		}
+	})
+}
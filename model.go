@@ -14,6 +14,9 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // LinkDensityModel is a power-law model Y = A * X ^ B, stores co-efficients
@@ -25,8 +28,23 @@ type LinkDensityModel struct {
 	binNorms    []int
 	nLinks      []int
 	linkDensity []float64
+	fits        *DistributionFits
+	// spaced are bins spaced by newSpacedModel, rather than those of LACHESIS
+	spaced bool
+	// mode of extract that counted the links, ModeRE when empty
+	mode string
+	// lowerBound is the shortest intra-contig link counted, MinLinkDist
+	// when 0; the bins starting below it are left to the power law
+	lowerBound int
 }
 
+// BinScaleLog and BinScaleLinear space the bins of the link size
+// distribution evenly in the log of the link size, or in the link size
+const (
+	BinScaleLog    = "log"
+	BinScaleLinear = "linear"
+)
+
 // ********* Calculation of link distribution model ************
 
 // NewLinkDensityModel makes an empty link distribution ready to be filled in
@@ -39,24 +57,95 @@ func NewLinkDensityModel() *LinkDensityModel {
 	}
 }
 
+// newSpacedModel makes an empty link distribution of bins from MinLinkDist
+// to MaxLinkDist on the scale, and the geometric bins of LACHESIS, 16 for
+// each power of 2, for no bins on the log scale
+func newSpacedModel(bins int, scale string) (*LinkDensityModel, error) {
+	if scale == "" {
+		scale = BinScaleLog
+	}
+	if scale != BinScaleLog && scale != BinScaleLinear {
+		return nil, fmt.Errorf("unknown bin scale %s, expected %s or %s", scale, BinScaleLog, BinScaleLinear)
+	}
+	if bins < 0 || bins > MaxLinkDist-MinLinkDist {
+		return nil, fmt.Errorf("cannot make %d bins of the link sizes from %d to %d",
+			bins, MinLinkDist, MaxLinkDist)
+	}
+	if bins == 0 {
+		if scale == BinScaleLinear {
+			return nil, fmt.Errorf("linear bins need their number")
+		}
+		bins = nBins
+	}
+	if bins == nBins && scale == BinScaleLog {
+		r := NewLinkDensityModel()
+		r.makeBins()
+		return r, nil
+	}
+	r := &LinkDensityModel{
+		binStarts:   make([]int, bins+1),
+		binNorms:    make([]int, bins),
+		nLinks:      make([]int, bins),
+		linkDensity: make([]float64, bins),
+		spaced:      true,
+	}
+	ratio := float64(MaxLinkDist) / float64(MinLinkDist)
+	for i := range r.binStarts {
+		f := float64(i) / float64(bins)
+		start := MinLinkDist + int(math.Round(f*float64(MaxLinkDist-MinLinkDist)))
+		if scale == BinScaleLog {
+			start = int(math.Round(MinLinkDist * math.Pow(ratio, f)))
+		}
+		// The first log bins would be under 1 bp
+		if i > 0 && start <= r.binStarts[i-1] {
+			start = r.binStarts[i-1] + 1
+		}
+		r.binStarts[i] = start
+	}
+	return r, nil
+}
+
 // writeDistribution writes the link size distribution to file
 func (r *LinkDensityModel) writeDistribution(outfile string) {
-	f, _ := os.Create(outfile)
+	f := mustCreateAtomic(outfile)
 	w := bufio.NewWriter(f)
 
 	_, _ = fmt.Fprintf(w, DistributionHeader)
-	for i := 0; i < nBins; i++ {
-		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%.4g\n",
-			i, r.binStarts[i], r.BinSize(i), r.nLinks[i], r.binNorms[i], r.linkDensity[i])
+	_, _ = fmt.Fprintf(w, "#Mode\t%s\n", r.Mode())
+	_, _ = fmt.Fprintf(w, "#DistLowerBound\t%d\n", r.DistLowerBound())
+	for i := range r.nLinks {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%.4g\t%d\n",
+			i, r.binStarts[i], r.BinSize(i), r.nLinks[i], r.binNorms[i], r.linkDensity[i], r.binStarts[i+1])
 	}
 
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
 	log.Noticef("Link size distribution written to `%s`", outfile)
-	_ = f.Close()
+}
+
+// Mode returns the mode of extract that counted the links, ModeRE for the
+// distributions written before the modes
+func (r *LinkDensityModel) Mode() string {
+	if r.mode == "" {
+		return ModeRE
+	}
+	return r.mode
+}
+
+// DistLowerBound returns the shortest intra-contig link of the
+// distribution, MinLinkDist for the distributions written before the bound
+func (r *LinkDensityModel) DistLowerBound() int {
+	if r.lowerBound == 0 {
+		return MinLinkDist
+	}
+	return r.lowerBound
 }
 
 // linkBin takes a link distance and convert to a binID
 func (r *LinkDensityModel) linkBin(dist int) int {
+	if r.spaced {
+		return sort.SearchInts(r.binStarts, dist+1) - 1
+	}
 	if dist < MinLinkDist {
 		return -1
 	}
@@ -74,7 +163,7 @@ func (r *LinkDensityModel) BinSize(i int) int {
 // makeNorms computes the normalization size for each bin
 func (r *LinkDensityModel) makeNorms(contigSizes []int) {
 	for _, size := range contigSizes {
-		for j := 0; j < nBins; j++ {
+		for j := range r.binNorms {
 			z := size - r.binStarts[j]
 			if z < 0 {
 				break
@@ -103,28 +192,26 @@ func (r *LinkDensityModel) makeBins() {
 func (r *LinkDensityModel) countBinDensities(contigs []*ContigInfo) {
 	maxLinkDist := math.MinInt32
 	for _, contig := range contigs {
-		for _, link := range contig.links {
-			if link > maxLinkDist {
-				maxLinkDist = link
-			}
+		if link := contig.maxLink(); link > maxLinkDist {
+			maxLinkDist = link
 		}
 	}
 	// Step 2: calculate assayable sequence length
 	// Find the length of assayable intra-contig sequence in each bin
 	intraContigLinkRange := math.Log2(float64(maxLinkDist) / float64(MinLinkDist))
 	nIntraContigBins := int(math.Ceil(intraContigLinkRange * 16))
+	if r.spaced {
+		nIntraContigBins = r.linkBin(maxLinkDist) + 1
+	}
 	if nIntraContigBins > len(r.nLinks) {
 		nIntraContigBins = len(r.nLinks)
 	}
 
-	// Step 3: loop through all links and tabulate the counts
+	// Step 3: loop through all links and tabulate the counts, on top of
+	// those binned as they came
 	for _, contig := range contigs {
 		for _, link := range contig.links {
-			bin := r.linkBin(link)
-			if bin == -1 || bin >= len(r.nLinks) {
-				continue
-			}
-			r.nLinks[bin]++
+			r.countLink(link)
 		}
 	}
 
@@ -138,7 +225,7 @@ func (r *LinkDensityModel) countBinDensities(contigs []*ContigInfo) {
 	// distribution.
 	topBin := nIntraContigBins - 1
 	nTopLinks := 0
-	nTopLinksNeeded := len(contigs[0].links) / 100
+	nTopLinksNeeded := contigs[0].nLinks() / 100
 	for ; nTopLinks < nTopLinksNeeded; topBin-- {
 		nTopLinks += r.nLinks[topBin]
 	}
@@ -149,19 +236,32 @@ func (r *LinkDensityModel) countBinDensities(contigs []*ContigInfo) {
 		if r.nLinks[i] == 0 { // This will trigger nan in regression
 			continue
 		}
+		if r.binStarts[i] < r.lowerBound { // Short of the links under the bound
+			continue
+		}
 		Xs = append(Xs, r.binStarts[i])
 		Ys = append(Ys, r.linkDensity[i])
 	}
 	r.fitPowerLaw(Xs, Ys)
+	r.fitDecays(Xs, Ys)
 
 	// Overwrite the values of last few bins, or a bin with na values
-	for i := 0; i < nBins; i++ {
-		if r.linkDensity[i] == 0 || i >= topBin {
+	for i := range r.linkDensity {
+		if r.linkDensity[i] == 0 || i >= topBin || r.binStarts[i] < r.lowerBound {
 			r.linkDensity[i] = r.transformPowerLaw(r.binStarts[i])
 		}
 	}
 }
 
+// countLink tallies a link into its bin
+func (r *LinkDensityModel) countLink(link int) {
+	bin := r.linkBin(link)
+	if bin == -1 || bin >= len(r.nLinks) {
+		return
+	}
+	r.nLinks[bin]++
+}
+
 // fitPowerLaw fits power law distribution
 // See reference: http://mathworld.wolfram.com/LeastSquaresFittingPowerLaw.html
 // Assumes the form Y = A * X^B, returns (A, B), the coefficients
@@ -195,3 +295,122 @@ func (r *LinkDensityModel) tranformLogProb(X int) float64 {
 	// return math.Log(float64(r.Seqsize-X)) + r.model.B*math.Log(float64(X))
 	return r.B * math.Log(float64(X))
 }
+
+// readLinkDistQuantile finds the link distance below which fraction q of the
+// intra-contig links fall, from a distribution file written by extract. The
+// distance is rounded up to the end of the bin.
+func readLinkDistQuantile(distfile string, q float64) (int, bool) {
+	f, err := os.Open(distfile)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	var binEnds, nLinks []int
+	total := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) < 4 || words[0][0] == '#' {
+			continue
+		}
+		binStart, _ := strconv.Atoi(words[1])
+		binSize, _ := strconv.Atoi(words[2])
+		n, _ := strconv.Atoi(words[3])
+		binEnd := binStart + binSize
+		if len(words) >= 7 {
+			binEnd, _ = strconv.Atoi(words[6])
+		}
+		binEnds = append(binEnds, binEnd)
+		nLinks = append(nLinks, n)
+		total += n
+	}
+	if total == 0 {
+		return 0, false
+	}
+	cumSum := 0
+	for i, n := range nLinks {
+		cumSum += n
+		if float64(cumSum) >= q*float64(total) {
+			return binEnds[i], true
+		}
+	}
+	return binEnds[len(binEnds)-1], true
+}
+
+// readLinkDistribution reads the bins and their link density back from a
+// distribution file written by extract, whose bins must follow each other.
+// The end of a bin is in the last column, or its start plus its size in the
+// files of 6 columns.
+func readLinkDistribution(distfile string) (*LinkDensityModel, error) {
+	f, err := openReader(distfile)
+	if err != nil {
+		return nil, openError("distribution", distfile, err)
+	}
+	defer f.Close()
+
+	r := &LinkDensityModel{}
+	binEnd := 0
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 2 && words[0] == "#Mode" {
+			r.mode = words[1]
+		}
+		if len(words) == 2 && words[0] == "#DistLowerBound" {
+			if r.lowerBound, err = strconv.Atoi(words[1]); err != nil || r.lowerBound < 0 {
+				return nil, fmt.Errorf("malformed distance lower bound at line %d of %s: %s",
+					lineno, distfile, scanner.Text())
+			}
+		}
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) < 6 {
+			return nil, fmt.Errorf("expected 6 columns at line %d of %s: %s",
+				lineno, distfile, scanner.Text())
+		}
+		binStart, err1 := strconv.Atoi(words[1])
+		binSize, err2 := strconv.Atoi(words[2])
+		n, err3 := strconv.Atoi(words[3])
+		density, err4 := strconv.ParseFloat(words[5], 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("malformed bin at line %d of %s: %s",
+				lineno, distfile, scanner.Text())
+		}
+		end := binStart + binSize
+		if len(words) >= 7 {
+			if end, err1 = strconv.Atoi(words[6]); err1 != nil || end <= binStart {
+				return nil, fmt.Errorf("malformed bin end at line %d of %s: %s",
+					lineno, distfile, scanner.Text())
+			}
+		}
+		if len(r.binStarts) > 0 && binStart != binEnd {
+			return nil, fmt.Errorf("bin at line %d of %s starts at %d, not at the end %d of the previous bin",
+				lineno, distfile, binStart, binEnd)
+		}
+		r.binStarts = append(r.binStarts, binStart)
+		r.nLinks = append(r.nLinks, n)
+		r.linkDensity = append(r.linkDensity, density)
+		binEnd = end
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read distribution file %s: %s", distfile, err)
+	}
+	if len(r.linkDensity) == 0 {
+		return nil, fmt.Errorf("no bins in distribution file %s", distfile)
+	}
+	r.binStarts = append(r.binStarts, binEnd) // So that BinSize() works
+	return r, nil
+}
+
+// density returns the link density at distance dist, that of the last bin
+// beyond it and of the first bin below it
+func (r *LinkDensityModel) density(dist float64) float64 {
+	n := len(r.linkDensity)
+	i := sort.Search(n, func(i int) bool { return float64(r.binStarts[i]) > dist }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.linkDensity[i]
+}
@@ -0,0 +1,101 @@
+/*
+ *  mutation.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The moves of Mutate, in the order of MutWeights
+const (
+	mutSwap = iota
+	mutSplice
+	mutInsert
+	mutReverse
+	mutTranslocate
+)
+
+// mutMoves names the moves of Mutate
+var mutMoves = [...]string{MoveSwap, MoveSplice, MoveInsert, MoveReverse, MoveTranslocate}
+
+// MutWeights weighs the moves of Mutate against each other, by mutSwap,
+// mutSplice, etc. A move of weight zero is never made.
+type MutWeights [len(mutMoves)]float64
+
+// defaultMutWeights are the weights of the moves without --mutWeights
+var defaultMutWeights = MutWeights{0.2, 0.2, 0.3, 0.3, 0}
+
+// ParseMutWeights parses the weights of the moves from name:weight pairs
+// separated by commas, e.g. swap:1,reverse:1,translocate:0.5. The moves not
+// listed are never made.
+func ParseMutWeights(s string) (MutWeights, error) {
+	var weights MutWeights
+	total := 0.0
+	for _, field := range strings.Split(s, ",") {
+		name, value := field, ""
+		if k := strings.Index(field, ":"); k >= 0 {
+			name, value = field[:k], field[k+1:]
+		}
+		move := -1
+		for i, m := range mutMoves {
+			if m == strings.TrimSpace(name) {
+				move = i
+			}
+		}
+		if move < 0 {
+			return weights, fmt.Errorf("unknown mutation `%s` in `%s`, not one of %s",
+				name, s, strings.Join(mutMoves[:], ", "))
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 {
+			return weights, fmt.Errorf("malformed weight `%s` of mutation %s", value, mutMoves[move])
+		}
+		weights[move] = w
+		total += w
+	}
+	if total <= 0 {
+		return weights, fmt.Errorf("mutation weights `%s` are all zero", s)
+	}
+	return weights, nil
+}
+
+// String formats the weights as ParseMutWeights reads them
+func (r MutWeights) String() string {
+	fields := make([]string, 0, len(r))
+	for i, w := range r {
+		if w > 0 {
+			fields = append(fields, fmt.Sprintf("%s:%g", mutMoves[i], w))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// pick returns the move at rd in [0, 1), each move taking a share of the
+// range by its weight
+func (r *MutWeights) pick(rd float64) int {
+	total := 0.0
+	for _, w := range r {
+		total += w
+	}
+	rd *= total
+	cum, last := 0.0, 0
+	for i, w := range r {
+		if w <= 0 {
+			continue
+		}
+		cum += w
+		if rd < cum {
+			return i
+		}
+		last = i
+	}
+	return last // Rounding at the end of the range
+}
@@ -0,0 +1,108 @@
+/*
+ *  mutation_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// mustParseMutWeights parses the mutation weights or fails the test
+func mustParseMutWeights(t *testing.T, s string) *allhic.MutWeights {
+	weights, err := allhic.ParseMutWeights(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &weights
+}
+
+func TestParseMutWeights(t *testing.T) {
+	weights := mustParseMutWeights(t, "swap:1, reverse:1,translocate:0.5,insert:0")
+	if got, want := weights.String(), "swap:1,reverse:1,translocate:0.5"; got != want {
+		t.Errorf("got weights %s, want %s", got, want)
+	}
+	for s, want := range map[string]string{
+		"swap:1,flip:1":       "unknown mutation `flip`",
+		"swap:-1,reverse:1":   "malformed weight `-1`",
+		"swap":                "malformed weight ``",
+		"swap:0,translocate:": "malformed weight ``",
+		"swap:0,reverse:0":    "are all zero",
+	} {
+		if _, err := allhic.ParseMutWeights(s); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", s, err, want)
+		}
+	}
+}
+
+// TestMutateMoves makes each move alone many times, and checks that the
+// tour keeps every tig exactly once, and the score kept up to date
+func TestMutateMoves(t *testing.T) {
+	tour, _ := syntheticTour(200)
+	for _, move := range []string{allhic.MoveSwap, allhic.MoveSplice, allhic.MoveInsert,
+		allhic.MoveReverse, allhic.MoveTranslocate} {
+		rng := rand.New(rand.NewSource(42))
+		mutant := tour.Clone().(allhic.Tour).WithDeltaScore()
+		mutant.Moves = mustParseMutWeights(t, move+":1")
+		for i := 0; i < 500; i++ {
+			mutant.Mutate(rng)
+			seen := make(map[int]bool, mutant.Len())
+			for _, tig := range mutant.Tigs {
+				seen[tig.Idx] = true
+			}
+			if len(seen) != tour.Len() || mutant.Len() != tour.Len() {
+				t.Fatalf("%s: move %d: tour has %d tigs, %d distinct, want %d",
+					move, i, mutant.Len(), len(seen), tour.Len())
+			}
+			got, _ := mutant.Evaluate()
+			want, _ := allhic.Tour{Tigs: mutant.Tigs, M: mutant.M}.Evaluate()
+			if math.Abs(got-want) > 1e-9*math.Abs(want) {
+				t.Fatalf("%s: move %d: kept score %v, want %v", move, i, got, want)
+			}
+		}
+	}
+}
+
+// TestMutateReverseSigns reverses segments of a tour that carries the
+// orientations, and checks that each reversed segment flips its tigs
+func TestMutateReverseSigns(t *testing.T) {
+	tour, _ := syntheticTour(50)
+	for i := range tour.Tigs {
+		tour.Tigs[i].Sign = "+-"[i%2]
+	}
+	tour.Scorer = allhic.NewJointScorer(nil) // Carries the orientations
+	tour.Moves = mustParseMutWeights(t, "reverse:1")
+	flip := map[byte]byte{'+': '-', '-': '+'}
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		before := tour.Clone().(allhic.Tour)
+		tour.Mutate(rng)
+		p, q := 0, tour.Len()-1
+		for p < tour.Len() && tour.Tigs[p] == before.Tigs[p] {
+			p++
+		}
+		for q >= 0 && tour.Tigs[q] == before.Tigs[q] {
+			q--
+		}
+		if p > q {
+			t.Fatalf("move %d: tour left as is", i)
+		}
+		for k := p; k <= q; k++ {
+			want := before.Tigs[p+q-k]
+			want.Sign = flip[want.Sign]
+			if tour.Tigs[k] != want {
+				t.Fatalf("move %d: tig %d is %v, want %v reversed from %d-%d",
+					i, k, tour.Tigs[k], want, p, q)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *  normalize.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Normalize scales the links of each pair of tigs in M, so that the tigs
+// with many restriction sites, or long ones, do not draw the others for
+// their links alone. With NormalizeRE, the links are divided by the product
+// of the RE counts of the two tigs, read from recountsFile, the REfile when
+// empty, and with NormalizeLength by the product of their lengths. The tigs
+// without an RE count fall back to their lengths. Either way the scales
+// are relative to the mean, so that the links keep their magnitude.
+func (r *CLM) Normalize(mode, recountsFile string) error {
+	switch mode {
+	case "", NormalizeNone:
+		r.linkScale = nil
+		return nil
+	case NormalizeRE, NormalizeLength:
+	default:
+		return fmt.Errorf("unknown normalization `%s`", mode)
+	}
+	counts := make([]int, len(r.Tigs))
+	if mode == NormalizeRE {
+		if recountsFile == "" {
+			recountsFile = r.REfile
+		}
+		recounts, err := r.readRECounts(recountsFile)
+		if err != nil {
+			return err
+		}
+		for i, tig := range r.Tigs {
+			if counts[i] = recounts[tig.Name]; counts[i] <= 0 {
+				log.Warningf("Contig %s has no RE counts in `%s`, normalized by length", tig.Name, recountsFile)
+			}
+		}
+	}
+	r.linkScale = make([]float64, len(r.Tigs))
+	meanRE, meanSize := meanCounts(counts), meanSizes(r.Tigs)
+	for i, tig := range r.Tigs {
+		switch {
+		case counts[i] > 0:
+			r.linkScale[i] = meanRE / float64(counts[i])
+		case tig.Size > 0:
+			r.linkScale[i] = meanSize / float64(tig.Size)
+		default:
+			r.linkScale[i] = 1
+		}
+	}
+	log.Noticef("Links normalized by %s", mode)
+	return nil
+}
+
+// scale returns the factor of the links between the tigs ai and bi
+func (r *CLM) scale(ai, bi int) float64 {
+	if r.linkScale == nil {
+		return 1
+	}
+	return r.linkScale[ai] * r.linkScale[bi]
+}
+
+// links returns the links between the tigs ai and bi in M, normalized when
+// asked for, which keeps at least one for the pairs with links
+func (r *CLM) links(ai, bi int, nlinks int32) int {
+	if r.linkScale == nil {
+		return int(nlinks)
+	}
+	w := int(math.Round(float64(nlinks) * r.scale(ai, bi)))
+	if w < 1 && nlinks > 0 {
+		w = 1
+	}
+	return w
+}
+
+// readRECounts reads the RE counts of the contigs from a counts_RE file,
+// of rows `contig RECounts length` as written by extract
+func (r *CLM) readRECounts(filename string) (map[string]int, error) {
+	f, err := openReader(filename)
+	if err != nil {
+		return nil, openError("RE counts", filename, err)
+	}
+	defer f.Close()
+
+	recounts := make(map[string]int)
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) < 3 {
+			return nil, fmt.Errorf("expected the RE counts in the 2nd of 3 columns at line %d of %s: %s",
+				lineno, filename, scanner.Text())
+		}
+		count, err := strconv.Atoi(words[1])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("bad RE count `%s` at line %d of %s", words[1], lineno, filename)
+		}
+		recounts[r.opts.Aliases.Name(words[0])] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read RE counts file %s: %s", filename, err)
+	}
+	return recounts, nil
+}
+
+// meanCounts is the mean of the positive counts, 1 without any
+func meanCounts(counts []int) float64 {
+	sum, n := 0.0, 0
+	for _, count := range counts {
+		if count > 0 {
+			sum += float64(count)
+			n++
+		}
+	}
+	if n == 0 {
+		return 1
+	}
+	return sum / float64(n)
+}
+
+// meanSizes is the mean size of the tigs, 1 without any
+func meanSizes(tigs []*TigF) float64 {
+	sizes := make([]int, len(tigs))
+	for i, tig := range tigs {
+		sizes[i] = tig.Size
+	}
+	return meanCounts(sizes)
+}
@@ -0,0 +1,86 @@
+/*
+ *  normalize_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestNormalize scales the links of a triangle of contigs by their RE
+// counts, the one missing from the RE counts file by its length
+func TestNormalize(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, 3, 2, 100)
+	recounts := filepath.Join(dir, "synthetic.counts_GATC.txt")
+	err := ioutil.WriteFile(recounts, []byte("#Contig\tRECounts\tLength\n"+
+		"tig0000000\t10\t50000\ntig0000001\t40\t50001\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := mustNewCLM(t, clmfile, idsfile).M()
+	clm := mustNewCLM(t, clmfile, idsfile)
+	if err := clm.Normalize(allhic.NormalizeRE, recounts); err != nil {
+		t.Fatal(err)
+	}
+	M := clm.M()
+	// Scaled by the mean RE count of 25, and the mean length of 50001
+	scales := []float64{2.5, 0.625, 50001.0 / 50002}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if i == j {
+				continue
+			}
+			want := int(math.Round(float64(raw.At(i, j)) * scales[i] * scales[j]))
+			if got := M.At(i, j); got != want {
+				t.Errorf("M[%d][%d]: got %d, want %d from %d links", i, j, got, want, raw.At(i, j))
+			}
+		}
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, 3, 2, 10)
+	clm := mustNewCLM(t, clmfile, idsfile)
+	for want, normalize := range map[string]func() error{
+		"unknown normalization":     func() error { return clm.Normalize("coverage", "") },
+		"expected the RE counts in": func() error { return clm.Normalize(allhic.NormalizeRE, idsfile) },
+	} {
+		if err := normalize(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"unknown normalization":                  func(r *allhic.Optimizer) { r.Normalize = "coverage" },
+		"cannot normalize the links of the like": func(r *allhic.Optimizer) { r.Normalize, r.Score = allhic.NormalizeRE, allhic.ScoreLikelihood },
+		"cannot normalize the links of the join": func(r *allhic.Optimizer) { r.Normalize, r.JointOrient = allhic.NormalizeLength, true },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		if err := opt.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
+
+// TestOptimizeNormalize labels the tours of the normalized runs, whose
+// scores are not comparable with the others
+func TestOptimizeNormalize(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.Normalize = allhic.NormalizeLength
+	if tours := runOptimizer(t, opt); !strings.Contains(tours, "normalize=length") {
+		t.Errorf("tours lack the normalization:\n%s", tours)
+	}
+}
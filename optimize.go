@@ -11,78 +11,1337 @@ package allhic
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"path"
 	"strings"
+	"time"
+
+	"github.com/MaxHalford/eaopt"
 )
 
 // Optimizer runs the order-and-orientation procedure, given a clmfile
 type Optimizer struct {
-	REfile    string
-	Clmfile   string
-	RunGA     bool
-	Resume    bool
-	Seed      int64
-	NPop      int
-	NGen      int
-	MutProb   float64
+	REfile  string
+	Clmfile string
+	RunGA   bool
+	Resume  bool
+	Seed    int64
+	NPop    int
+	NGen    int
+	MutProb float64
+	// MutWeights weighs the moves of Mutate, see ParseMutWeights, empty uses
+	// the default weights
+	MutWeights string
+	// CrossProb is the crossover probability with Crossover, 0 uses
+	// CrossoverProb
 	CrossProb float64
-	rng       *rand.Rand
+	// Crossover is CrossoverNone, the default, CrossoverOX, CrossoverPMX or
+	// CrossoverER, see NewCrossoverOperator
+	Crossover string
+	// Method is MethodGA, the default, or MethodSA, which anneals from TStart,
+	// times the score, by TFactor per iteration, zeros use SATStart,
+	// SATFactor and SAIterations
+	Method     string
+	TStart     float64
+	TFactor    float64
+	Iterations int
+	// LogInterval writes every that many generations to <prefix>.ga.log.csv,
+	// 0 every generation
+	LogInterval int
+	// TourInterval appends the best tour to the tour file every that many
+	// generations, 0 uses the TourInterval constant. KeepBest keeps the
+	// that many best distinct tours of the GA in <prefix>.best<KeepBest>.tour
+	TourInterval int
+	KeepBest     int
+	// Islands evolves that many populations of NPop tours in parallel, which
+	// exchange their best tours every MigrationInterval generations, zeros
+	// use 1 island and the MigrationInterval constant
+	Islands           int
+	MigrationInterval int
+	// Restarts runs the GA that many times from the same tigs, with seeds
+	// derived from Seed, and goes on from the best tour, see runRestarts.
+	// KeepRestarts keeps the tour file of each restart.
+	Restarts     int
+	KeepRestarts bool
+	// NoPolish skips the hill climbing after the GA, see Polish, which
+	// moves the tigs up to PolishWindow positions away, 0 uses PolishWindow
+	NoPolish     bool
+	PolishWindow int
+	// Patience stops the GA after that many generations without improving
+	// the best score by more than MinDelta, relative to it, 0 uses NGen
+	Patience int
+	MinDelta float64
+	// Selection picks the parents of the offsprings, SelectionTournament
+	// with TournamentSize tours, 0 uses the TournamentSize constant, or
+	// SelectionRoulette. Elite best tours of each population carry over to
+	// the next generation.
+	Selection      string
+	TournamentSize int
+	Elite          int
+	// Inject replaces InjectFraction of the worst tours of a GA population
+	// with shuffled ones once its diversity stays under DiversityThreshold
+	// for InjectStall generations, see diversity. Zeros use the constants.
+	Inject             bool
+	DiversityThreshold float64
+	InjectStall        int
+	InjectFraction     float64
+	// ResumeFile starts from the last tour in this file, while Resume uses
+	// the tour file of a previous run, <prefix>.tour
+	ResumeFile string
+	// StartTour orders the active tigs as in the last tour of this file,
+	// see ActivateWithTour, and seeds StartFraction of the first GA
+	// population with perturbed copies of it, 0 uses the StartFraction
+	// constant
+	StartTour     string
+	StartFraction float64
+	// ConstraintsFile pins contigs at positions or at the ends of the tour,
+	// see ReadConstraints
+	ConstraintsFile string
+	// StrandsFile imposes the orientations of contigs, see ReadStrands
+	StrandsFile string
+	// GFAfile adds the edges of an assembly graph to the score, each pair of
+	// adjacent contigs joined as in the graph earning GFAWeight, 0 uses the
+	// GFAWeight constant, and each edge whose contigs are apart costing
+	// GFAPenalty, see ReadGFA
+	GFAfile    string
+	GFAWeight  float64
+	GFAPenalty float64
+	// Write the per-contig delta scores of PruneTour
+	DebugPrune bool
+	// Score is ScoreDefault, ScoreEndWeighted or ScoreLikelihood
+	Score string
+	// EndDist is the near-end threshold of ScoreEndWeighted, 0 derives it
+	// from the distribution file
+	EndDist int
+	// DistFile is the link size distribution written by extract, empty uses
+	// the one next to the clmfile
+	DistFile string
+	// Normalize is NormalizeNone, NormalizeRE or NormalizeLength, see
+	// CLM.Normalize, which reads the RE counts from REcounts, empty uses
+	// the REfile
+	Normalize string
+	REcounts  string
+	// OrientInit is OrientInitSpectral or OrientInitGreedy
+	OrientInit string
+	// JointOrient has the GA optimize the orientations along with the order,
+	// see JointScorer
+	JointOrient bool
+	// FixOrientation only optimizes the order, and keeps the orientations of
+	// the start tour, or '+', see CLM.FixOrientation
+	FixOrientation bool
+	// OrientOnly keeps the order of the StartTour, and only optimizes the
+	// orientations, without the GA
+	OrientOnly bool
+	// StopAfter is StageActivate or StagePrune to persist the state after
+	// that stage and stop, StartFrom is StageGA to pick the state up again
+	StopAfter string
+	StartFrom string
+	// Strict fails on malformed clm rows rather than skipping them
+	Strict bool
+	// UseCache keeps the parsed clm in <prefix>.clm.cache for later runs
+	UseCache bool
+	// Threads parses the clmfile, scores the PruneTour deletions and the GA
+	// population, 0 uses all CPUs. The workers only score the tours, into
+	// their own slots, and draw no random numbers, so that a Seed ends on
+	// the same tours whatever the number of threads.
+	Threads int
+	// MinLinks drops the contig pairs with fewer links, 1 keeps all pairs
+	MinLinks int
+	// DistLB and DistUB are the distances at the centers of the first and
+	// the last of DistBins golden array bins, zeros use DefaultGoldenScale
+	DistLB   int
+	DistUB   int
+	DistBins int
+	// ActiveClm also writes the clm rows between active tigs next to the
+	// <prefix>.active.ids
+	ActiveClm bool
+	// AliasFile maps the contig names of the ids, clm and tour files to
+	// canonical names, see ReadAliasFile
+	AliasFile string
+	// MinOrientationDelta flags the orientations in <prefix>.orientation.tsv
+	// that drop the score by less than this when flipped
+	MinOrientationDelta float64
+	// DumpMatrix writes the O and M matrices of the active tigs after
+	// activate to <DumpMatrix>.O.tsv and <DumpMatrix>.M.tsv
+	DumpMatrix string
+	// NoPruneSize, NoPruneDensity and NoPruneTour skip the pruning by
+	// size, by density and by the tour, whatever the cutoffs
+	NoPruneSize    bool
+	NoPruneDensity bool
+	NoPruneTour    bool
+	// MinContigSize and DensityLowerBound (links per bp) are the cutoffs
+	// for activating tigs, zero keeps all tigs
+	MinContigSize     int
+	DensityLowerBound float64
+	// CheckpointEvery saves the state of the GA to <prefix>.ga.checkpoint
+	// every that many generations, 0 never does
+	CheckpointEvery int
+	// ResumeCheckpoint picks the GA up from <prefix>.ga.checkpoint, which
+	// needs the options of the run that wrote it
+	ResumeCheckpoint bool
+	// TimeLimit stops the GA after the generation that runs out of it, 0
+	// never does, as does Context once canceled, e.g. on a signal. The run
+	// then writes the best tour so far and the checkpoint, and fails with
+	// ErrInterrupted.
+	TimeLimit   time.Duration
+	Context     context.Context
+	ctx         context.Context
+	interrupted bool
+	// OnGeneration is called after each generation of the GA with the best
+	// score so far and its tour, which the callback must not change, and
+	// OnPhase at the end of each phase, StageActivate, StagePrune, ga1 and
+	// ga2 for the GA phases, MethodSA, PhasePolish and PhaseOrient, with the
+	// tour of the CLM. Both are called from the goroutine of Run, never
+	// concurrently, and block the run until they return. An error stops the
+	// run as TimeLimit does, and Run fails with it.
+	OnGeneration func(gen int, best float64, tour Tour) error
+	OnPhase      func(phase string, tour Tour) error
+	aborted      error
+	streams      RNGStreams
+	src          *splitMix64 // Source of rng, which the checkpoints save
+	rng          *rand.Rand
+	checkpoint   *gaState
+	progress     *gaLog     // <prefix>.ga.log.csv
+	best         *bestTours // <prefix>.best<KeepBest>.tour
+	cross        CrossoverOperator
+	moves        *MutWeights
+	// haltPhase stops the run after the first checkpoint in that GA phase
+	// of the restart haltRestart, halted once it has
+	haltPhase   int
+	haltRestart int
+	halted      bool
+	// restart is the GA in progress of Restarts, after the restarted ones
+	restart   int
+	restarted []restartResult
+	// OutPrefix is where the output files go, as in <OutPrefix>.tour, its
+	// directory created when missing; empty uses the name of the REfile in
+	// the working directory
+	OutPrefix string
+	// Stdout echoes the tours and the progress of the GA, nil is os.Stdout
+	Stdout io.Writer
 	// Output files
 	OutTourFile string
+	// OutTigs and OutScore are the number of tigs and the score of the
+	// final tour
+	OutTigs  int
+	OutScore float64
+	// Summary is what the run wrote to <prefix>.summary.json
+	Summary     *OptimizeSummary
+	start       time.Time
+	generations int // Run by the GA over its phases
+}
+
+// Run kicks off the Optimizer. The stages are activate, prune and ga, of
+// which prune only runs when asked for by StopAfter. It fails on options
+// that do not make sense together and on input files that cannot be read.
+func (r *Optimizer) Run() error {
+	r.start = time.Now()
+	r.generations, r.restart, r.restarted = 0, 0, nil
+	r.interrupted, r.aborted = false, nil
+	if r.Score != "" && r.Score != ScoreDefault && r.Score != ScoreEndWeighted &&
+		r.Score != ScoreLikelihood {
+		return fmt.Errorf("unknown score `%s`", r.Score)
+	}
+	if r.JointOrient && r.Score != "" && r.Score != ScoreDefault {
+		return fmt.Errorf("cannot combine the joint orientations with the %s score", r.Score)
+	}
+	if r.Normalize != "" && r.Normalize != NormalizeNone && r.Normalize != NormalizeRE &&
+		r.Normalize != NormalizeLength {
+		return fmt.Errorf("unknown normalization `%s`", r.Normalize)
+	}
+	if r.normalized() && (r.JointOrient || r.Score == ScoreLikelihood) {
+		return fmt.Errorf("cannot normalize the links of the %s score", r.scoreName())
+	}
+	if r.GFAfile != "" && (r.GFAWeight < 0 || r.GFAPenalty < 0 || r.Score == ScoreLikelihood) {
+		return fmt.Errorf("cannot weigh the assembly graph by %g and %g against the %s score",
+			r.GFAWeight, r.GFAPenalty, r.scoreName())
+	}
+	if r.JointOrient && r.FixOrientation {
+		return fmt.Errorf("cannot both optimize and fix the orientations")
+	}
+	if r.OrientOnly && (r.StartTour == "" || r.FixOrientation || r.JointOrient) {
+		return fmt.Errorf("cannot orient only without a start tour, or with the orientations fixed or joint")
+	}
+	if r.OrientInit != "" && r.OrientInit != OrientInitSpectral && r.OrientInit != OrientInitGreedy {
+		return fmt.Errorf("unknown orientation initialization `%s`", r.OrientInit)
+	}
+	if r.Method != "" && r.Method != MethodGA && r.Method != MethodSA {
+		return fmt.Errorf("unknown method `%s`", r.Method)
+	}
+	if r.Method == MethodSA && (r.ResumeCheckpoint || r.islands() > 1 ||
+		(r.Crossover != "" && r.Crossover != CrossoverNone)) {
+		return fmt.Errorf("cannot resume a checkpoint, evolve islands or cross the tours with %s", MethodSA)
+	}
+	if r.Restarts < 0 || (r.restarts() > 1 && r.Method == MethodSA) {
+		return fmt.Errorf("cannot restart the ordering %d times with %s", r.Restarts, r.method())
+	}
+	if r.Islands < 0 || r.MigrationInterval < 0 {
+		return fmt.Errorf("cannot evolve %d islands with migrations every %d generations",
+			r.Islands, r.MigrationInterval)
+	}
+	if r.StartFraction < 0 || r.StartFraction > 1 {
+		return fmt.Errorf("cannot seed a fraction %g of the GA population with the start tour", r.StartFraction)
+	}
+	if r.Selection != "" && r.Selection != SelectionTournament && r.Selection != SelectionRoulette {
+		return fmt.Errorf("unknown selection `%s`", r.Selection)
+	}
+	tournament := r.Selection != SelectionRoulette && r.NPop > 0 && r.tournamentSize() >= r.NPop
+	if r.TournamentSize < 0 || r.TournamentSize == 1 || r.Elite < 0 || tournament ||
+		(r.NPop > 0 && r.Elite >= r.NPop) {
+		return fmt.Errorf("cannot select by tournaments of %d tours and keep %d elites out of %d",
+			r.tournamentSize(), r.Elite, r.NPop)
+	}
+	if r.DiversityThreshold < 0 || r.DiversityThreshold > 1 || r.InjectStall < 0 ||
+		r.InjectFraction < 0 || r.InjectFraction > 1 {
+		return fmt.Errorf("cannot inject a fraction %g of the tours after %d generations under diversity %g",
+			r.InjectFraction, r.InjectStall, r.DiversityThreshold)
+	}
+	if r.Inject && r.Method == MethodSA {
+		return fmt.Errorf("cannot inject tours with %s", MethodSA)
+	}
+	if r.TimeLimit < 0 {
+		return fmt.Errorf("cannot stop after a time limit of %s", r.TimeLimit)
+	}
+	if r.TourInterval < 0 || r.KeepBest < 0 {
+		return fmt.Errorf("cannot write the tours every %d generations and keep the %d best",
+			r.TourInterval, r.KeepBest)
+	}
+	if r.TStart < 0 || r.TFactor < 0 || r.TFactor > 1 || r.Iterations < 0 {
+		return fmt.Errorf("cannot anneal with tstart %g, tfactor %g and %d iterations",
+			r.TStart, r.TFactor, r.Iterations)
+	}
+	cross, err := NewCrossoverOperator(r.Crossover)
+	if err != nil {
+		return err
+	}
+	r.cross = cross
+	if r.MutWeights != "" {
+		moves, err := ParseMutWeights(r.MutWeights)
+		if err != nil {
+			return err
+		}
+		r.moves = &moves
+	}
+	if r.Patience < 0 || r.MinDelta < 0 {
+		return fmt.Errorf("cannot stop the GA with patience %d and min delta %g", r.Patience, r.MinDelta)
+	}
+	if err := r.checkStages(); err != nil {
+		return err
+	}
+	if err := r.checkStdin(); err != nil {
+		return err
+	}
+	if err := mkdirPrefix(r.prefix()); err != nil {
+		return err
+	}
+	r.ctx = r.Context
+	if r.ctx == nil {
+		r.ctx = context.Background()
+	}
+	if r.TimeLimit > 0 {
+		var cancel context.CancelFunc
+		r.ctx, cancel = context.WithTimeout(r.ctx, r.TimeLimit)
+		defer cancel()
+	}
+	r.streams = NewRNGStreams(r.Seed)
+	r.src = r.streams.source(0)
+	r.rng = rand.New(r.src)
+	log.Noticef("Random seed %d, rerun with --seed %d to reproduce", r.Seed, r.Seed)
+	golden, err := NewGoldenScale(r.DistLB, r.DistUB, r.DistBins)
+	if err != nil {
+		return err
+	}
+	if golden != DefaultGoldenScale {
+		log.Noticef("Golden array bins centered at %v", golden.Centers())
+	}
+	opts := CLMOptions{Strict: r.Strict, MinLinks: r.MinLinks, Golden: golden, Threads: r.Threads}
+	if r.AliasFile != "" {
+		if opts.Aliases, err = ReadAliasFile(r.AliasFile); err != nil {
+			return err
+		}
+	}
+	if r.UseCache {
+		opts.Cachefile = r.prefix() + ".clm.cache"
+	}
+	clm, err := NewCLMWithOptions(r.Clmfile, r.REfile, opts)
+	if err != nil {
+		return err
+	}
+	if r.StrandsFile != "" {
+		if err := clm.ReadStrands(r.StrandsFile); err != nil {
+			return err
+		}
+	}
+	r.warnMode()
+	if err := clm.Normalize(r.Normalize, r.REcounts); err != nil {
+		return err
+	}
+	clm.MinContigSize = r.MinContigSize
+	clm.DensityLowerBound = r.DensityLowerBound
+	clm.OrientInit = r.OrientInit
+	clm.FixOrientation = r.FixOrientation
+	clm.Stdout = r.Stdout
+	r.skipPruning(clm)
+	clm.TourInfo = fmt.Sprintf("seed=%d mutpb=%g cxpb=%g", r.Seed, r.MutProb, r.crossProb())
+	if r.cross != nil {
+		clm.TourInfo += " crossover=" + r.cross.Name()
+	}
+	if r.moves != nil {
+		clm.TourInfo += " mutWeights=" + r.moves.String()
+	}
+	if r.islands() > 1 {
+		clm.TourInfo += fmt.Sprintf(" islands=%d migration=%d", r.islands(), r.migrationInterval())
+	}
+	if r.restarts() > 1 {
+		clm.TourInfo += fmt.Sprintf(" restarts=%d", r.restarts())
+	}
+	if r.Selection == SelectionRoulette {
+		clm.TourInfo += " selection=" + SelectionRoulette
+	} else if r.tournamentSize() != TournamentSize {
+		clm.TourInfo += fmt.Sprintf(" tournament=%d", r.tournamentSize())
+	}
+	if r.Elite > 0 {
+		clm.TourInfo += fmt.Sprintf(" elite=%d", r.Elite)
+	}
+	if r.Inject {
+		threshold, stall, fraction := r.injection()
+		clm.TourInfo += fmt.Sprintf(" diversity=%g injectStall=%d injectFraction=%g", threshold, stall, fraction)
+	}
+	if r.Method == MethodSA {
+		tstart, tfactor, iterations := r.annealing()
+		clm.TourInfo += fmt.Sprintf(" method=%s tstart=%g tfactor=%g iterations=%d",
+			MethodSA, tstart, tfactor, iterations)
+	}
+	if r.Score != "" && r.Score != ScoreDefault {
+		// Label the scores, which are not comparable with the default ones
+		clm.TourInfo += " scoring=" + r.Score
+	}
+	if r.JointOrient {
+		clm.TourInfo += " scoring=" + ScoreJointOrient
+	}
+	if r.GFAfile != "" {
+		// The bonuses of the graph edges count in the scores
+		clm.TourInfo += fmt.Sprintf(" gfaWeight=%g", r.gfaWeight())
+		if r.GFAPenalty > 0 {
+			clm.TourInfo += fmt.Sprintf(" gfaPenalty=%g", r.GFAPenalty)
+		}
+	}
+	if r.normalized() {
+		// The scores are not comparable with those of other normalizations
+		clm.TourInfo += " normalize=" + r.Normalize
+	}
+	tourfile := r.prefix() + ".tour"
+
+	if r.StartFrom == StageGA {
+		if err := r.loadStage(clm); err != nil {
+			return err
+		}
+	} else {
+		if err := r.activate(clm, tourfile); err != nil {
+			return err
+		}
+		if r.DumpMatrix != "" {
+			clm.WriteMatrices(r.DumpMatrix)
+		}
+		r.onPhase(StageActivate, clm.Tour)
+		if r.StopAfter != "" {
+			// Anything from an earlier prune no longer applies
+			_ = os.Remove(r.prunedFile())
+			if err := writeActiveFile(r.activeFile(), clm); err != nil {
+				return err
+			}
+		}
+		switch r.StopAfter {
+		case StageActivate:
+			log.Notice("Stop after activate")
+			return r.aborted
+		case StagePrune:
+			if !r.NoPruneTour && !r.interrupted {
+				clm.PruneTour(r.debugPruneFile(), r.Threads)
+				r.onPhase(StagePrune, clm.Tour)
+			}
+			if err := writeActiveFile(r.prunedFile(), clm); err != nil {
+				return err
+			}
+			log.Notice("Stop after prune")
+			return r.aborted
+		}
+	}
+	if r.ConstraintsFile != "" {
+		if err := r.pin(clm); err != nil {
+			return err
+		}
+	}
+	if r.GFAfile != "" {
+		graph, err := clm.ReadGFA(r.GFAfile, r.gfaWeight(), r.GFAPenalty)
+		if err != nil {
+			return err
+		}
+		clm.Tour.Graph = graph
+	}
+	return r.optimize(clm, tourfile)
+}
+
+// pin constrains the tour of the CLM with the ConstraintsFile, and moves
+// the tigs that break the constraints
+func (r *Optimizer) pin(clm *CLM) error {
+	pins, err := clm.ReadConstraints(r.ConstraintsFile)
+	if err != nil {
+		return err
+	}
+	clm.Tour.Pins = pins
+	if pins.repair(clm.Tour.Tigs) {
+		log.Notice("Moved the contigs of the initial tour to meet the constraints")
+	}
+	return nil
+}
+
+// checkStages rejects the stage flags that do not make sense together
+func (r *Optimizer) checkStages() error {
+	switch {
+	case r.StopAfter != "" && r.StopAfter != StageActivate && r.StopAfter != StagePrune:
+		return fmt.Errorf("cannot stop after `%s`, use %s or %s",
+			r.StopAfter, StageActivate, StagePrune)
+	case r.StartFrom != "" && r.StartFrom != StageGA:
+		return fmt.Errorf("cannot start from `%s`, use %s", r.StartFrom, StageGA)
+	case r.StartFrom != "" && r.StopAfter != "":
+		return fmt.Errorf("cannot both start from %s and stop after %s",
+			r.StartFrom, r.StopAfter)
+	case r.StartFrom != "" && (r.Resume || r.ResumeFile != ""):
+		return fmt.Errorf("cannot both resume and start from %s", r.StartFrom)
+	case r.StartTour != "" && (r.Resume || r.ResumeFile != "" || r.StartFrom != "" || r.ResumeCheckpoint):
+		return fmt.Errorf("cannot both resume and start from a tour")
+	case r.ResumeCheckpoint && (r.Resume || r.ResumeFile != ""):
+		return fmt.Errorf("cannot both resume from a tour and from the GA checkpoint")
+	case r.ResumeCheckpoint && r.StopAfter != "":
+		return fmt.Errorf("cannot both resume from the GA checkpoint and stop after %s", r.StopAfter)
+	}
+	return nil
 }
 
-// Run kicks off the Optimizer
-func (r *Optimizer) Run() {
-	r.rng = rand.New(rand.NewSource(r.Seed))
-	clm := NewCLM(r.Clmfile, r.REfile)
-	tourfile := RemoveExt(path.Base(r.REfile)) + ".tour"
+// skipPruning clears the cutoffs of the pruning stages that are disabled,
+// and logs which stages are skipped
+func (r *Optimizer) skipPruning(clm *CLM) {
+	var skipped []string
+	if r.NoPruneSize {
+		clm.MinContigSize = 0
+		skipped = append(skipped, "size")
+	}
+	if r.NoPruneDensity {
+		clm.DensityLowerBound = 0
+		skipped = append(skipped, "density")
+	}
+	if r.NoPruneTour {
+		skipped = append(skipped, "tour")
+	}
+	if len(skipped) > 0 {
+		log.Noticef("Skip pruning by %s", strings.Join(skipped, ", "))
+	}
+}
 
-	// Load tourfile if it exists
-	if _, err := os.Stat(tourfile); r.Resume && err == nil {
+// checkStdin rejects the options that need the clmfile on disk, when the
+// clm is read from stdin
+func (r *Optimizer) checkStdin() error {
+	if r.Clmfile != StdinFile {
+		return nil
+	}
+	switch {
+	case r.Resume || r.ResumeFile != "" || r.StartFrom != "":
+		return fmt.Errorf("cannot resume when reading the clm from stdin")
+	case r.UseCache:
+		return fmt.Errorf("cannot cache the clm read from stdin")
+	case r.ActiveClm:
+		return fmt.Errorf("cannot write the active clm rows when reading the clm from stdin")
+	case r.Score == ScoreEndWeighted && r.EndDist == 0:
+		return fmt.Errorf("no distribution file next to the clm read from stdin, set the end distance")
+	case r.Score == ScoreLikelihood && r.DistFile == "":
+		return fmt.Errorf("no distribution file next to the clm read from stdin, set the distribution file")
+	}
+	return nil
+}
+
+// activate selects the active tigs and their signs, from the existing
+// tourfile when resuming
+func (r *Optimizer) activate(clm *CLM, tourfile string) error {
+	switch {
+	case r.ResumeFile != "":
+		if err := clm.ActivateFromTour(r.ResumeFile); err != nil {
+			return err
+		}
+		if path.Clean(r.ResumeFile) == tourfile {
+			backupTourFile(tourfile)
+		}
+	case r.Resume:
+		// Load tourfile if it exists
+		if _, err := os.Stat(tourfile); err != nil {
+			log.Warningf("No tour file `%s` to resume from, start de novo", tourfile)
+			clm.Activate(false, r.rng)
+			break
+		}
 		log.Noticef("Found existing tour file `%s`", tourfile)
-		clm.parseTourFile(tourfile)
-		// Rename the tour file
-		backupTourFile := tourfile + ".sav"
-		_ = os.Rename(tourfile, backupTourFile)
-		log.Noticef("Backup `%s` to `%s`", tourfile, backupTourFile)
+		if err := repairTourFile(tourfile); err != nil {
+			return err
+		}
+		if err := clm.ActivateFromTour(tourfile); err != nil {
+			return err
+		}
+		backupTourFile(tourfile)
+	case r.StartTour != "":
+		log.Noticef("Start from the tour in `%s`", r.StartTour)
+		if err := clm.ActivateWithTour(r.StartTour); err != nil {
+			return err
+		}
+	default:
+		clm.Activate(false, r.rng)
 	}
+	return r.scoreMatrix(clm)
+}
 
-	clm.Activate(r.Resume, r.rng)
+// backupTourFile renames the tour file that a new run is about to overwrite
+func backupTourFile(tourfile string) {
+	backup := tourfile + ".sav"
+	_ = os.Rename(tourfile, backup)
+	log.Noticef("Backup `%s` to `%s`", tourfile, backup)
+}
 
+// loadStage restores the state persisted by the last stage that ran
+func (r *Optimizer) loadStage(clm *CLM) error {
+	activefile := r.prunedFile()
+	if _, err := os.Stat(activefile); err != nil {
+		activefile = r.activeFile()
+	}
+	words, pruned, err := readActiveFile(activefile)
+	if err != nil {
+		return err
+	}
+	clm.setTour(words)
+	for name, reason := range pruned {
+		if idx, ok := clm.tigToIdx[name]; ok && !clm.Tigs[idx].IsActive {
+			clm.Tigs[idx].Pruned = reason
+		}
+	}
+	clm.Tour.M = clm.M()
+	return r.scoreMatrix(clm)
+}
+
+// scoreMatrix replaces M with the weighted links, or sets the scorer of the
+// tour, when the score or JointOrient asks for it
+func (r *Optimizer) scoreMatrix(clm *CLM) error {
+	switch r.Score {
+	case ScoreEndWeighted:
+		clm.Tour.M = clm.EndWeightedM(r.endDist())
+	case ScoreLikelihood:
+		scorer, err := NewLikelihoodScorer(r.distFile())
+		if err != nil {
+			return err
+		}
+		clm.Tour.Scorer = scorer
+	}
+	if r.JointOrient {
+		clm.Tour.Scorer = NewJointScorer(clm)
+	}
+	return nil
+}
+
+// optimize runs the GA and then flips the orientations until they settle
+func (r *Optimizer) optimize(clm *CLM, tourfile string) error {
 	// tourfile logs the intermediate configurations
 	log.Noticef("Optimization history logged to `%s`", tourfile)
-	fwtour, _ := os.Create(tourfile)
+	fwtour, err := os.Create(tourfile)
+	if err != nil {
+		return fmt.Errorf("cannot create tour file %s: %s", tourfile, err)
+	}
 	r.OutTourFile = tourfile
 
-	clm.printTour(os.Stdout, clm.Tour, "INIT")
+	clm.printTour(clm.stdout(), clm.Tour, "INIT")
 	clm.printTour(fwtour, clm.Tour, "INIT")
+	startScore, _ := clm.Tour.Evaluate()
 
-	if r.RunGA {
-		for phase := 1; phase < 3; phase++ {
-			clm.OptimizeOrdering(fwtour, r, phase)
+	runGA := r.RunGA && !r.OrientOnly && !r.interrupted
+	if runGA && r.Method == MethodSA {
+		clm.Tour.Moves = r.moves
+		clm.SARun(fwtour, r)
+		r.onPhase(MethodSA, clm.Tour)
+	} else if runGA {
+		clm.Tour.Cross, clm.Tour.Moves = r.cross, r.moves
+		startPhase, err := r.loadCheckpoint(clm)
+		if err == nil {
+			r.progress, err = newGALog(r.gaLogFile(), r.LogInterval, r.ResumeCheckpoint)
+		}
+		r.best = newBestTours(r.KeepBest)
+		if err != nil {
+			_ = fwtour.Close()
+			return err
+		}
+		if r.restarts() > 1 {
+			err = r.runRestarts(clm, fwtour, startPhase)
+		} else {
+			err = r.runPhases(clm, fwtour, startPhase)
+		}
+		if err != nil {
+			_ = r.progress.Close()
+			_ = fwtour.Close()
+			return err
+		}
+		err = r.progress.Close()
+		if err == nil {
+			err = r.best.write(clm, r.bestFile())
+		}
+		if err != nil {
+			_ = fwtour.Close()
+			return err
+		}
+		r.progress, r.best = nil, nil
+		if (r.CheckpointEvery > 0 || r.ResumeCheckpoint) && !r.interrupted {
+			_ = os.Remove(r.checkpointFile())
 		}
 	}
+	if r.interrupted {
+		// The best tour so far, with neither polish nor flips
+		return r.stop(clm, fwtour, startScore)
+	}
 
-	for phase := 1; ; phase++ {
-		tag1, tag2 := clm.OptimizeOrientations(fwtour, phase)
-		if tag1 == REJECT && tag2 == REJECT {
-			log.Noticef("Terminating ... no more %v", ACCEPT)
-			break
+	switch {
+	case r.OrientOnly:
+		r.orientOnly(clm, fwtour)
+	case r.FixOrientation:
+		if !r.NoPolish {
+			r.polish(clm, fwtour)
 		}
+	default:
+		if !r.NoPolish {
+			r.polish(clm, fwtour)
+		}
+		if !r.interrupted {
+			clm.orient(fwtour)
+			r.onPhase(PhaseOrient, clm.Tour)
+		}
+	}
+	if r.interrupted {
+		// Aborted by OnPhase
+		return r.stop(clm, fwtour, startScore)
+	}
+	clm.printTour(clm.stdout(), clm.Tour, "FINAL")
+	clm.reportStrandConflicts()
+	score, _ := clm.Tour.Evaluate()
+	r.OutTigs, r.OutScore = clm.Tour.Len(), -score
+	if r.StartTour != "" && !r.OrientOnly {
+		gain := 0.0
+		if startScore != 0 {
+			gain = (startScore - score) / math.Abs(startScore) * 100
+		}
+		log.Noticef("Final score %.5f, from %.5f of the start tour `%s` (%+.3f%%)",
+			-score, -startScore, r.StartTour, gain)
+	}
+	clm.reportRecovered()
+	err = clm.WriteActive(r.prefix())
+	if err == nil {
+		err = clm.WriteOrientations(r.prefix(), r.MinOrientationDelta)
+	}
+	if err == nil && r.ActiveClm {
+		err = clm.WriteActiveClm(r.prefix())
+	}
+	if err == nil {
+		err = r.writeSummary(clm, startScore, r.summaryFile())
+	}
+	if err != nil {
+		_ = fwtour.Close()
+		return err
 	}
-	clm.printTour(os.Stdout, clm.Tour, "FINAL")
 	log.Notice("Success")
-	_ = fwtour.Close()
+	return fwtour.Close()
+}
+
+// stop ends an interrupted run on the tour of the CLM, which it writes to
+// the tour file and the summary
+func (r *Optimizer) stop(clm *CLM, fwtour *os.File, startScore float64) error {
+	clm.printTour(fwtour, clm.Tour, "INTERRUPTED")
+	score, _ := clm.Tour.Evaluate()
+	r.OutTigs, r.OutScore = clm.Tour.Len(), -score
+	if err := r.writeSummary(clm, startScore, r.summaryFile()); err != nil {
+		_ = fwtour.Close()
+		return err
+	}
+	if err := fwtour.Close(); err != nil {
+		return err
+	}
+	return r.interruption()
+}
+
+// orientOnly orients the tigs of the start tour, in its order, and logs the
+// score of the orientations before and after
+func (r *Optimizer) orientOnly(clm *CLM, fwtour *os.File) {
+	before := clm.EvaluateQ()
+	signs := make([]byte, len(clm.Signs))
+	copy(signs, clm.Signs)
+	clm.flipAll()
+	clm.printTour(fwtour, clm.Tour, "FLIPALL")
+	clm.orient(fwtour)
+	flipped := 0
+	for _, tig := range clm.Tour.Tigs {
+		if clm.Signs[tig.Idx] != signs[tig.Idx] {
+			flipped++
+		}
+	}
+	log.Noticef("Orientations scored %.5f in the start tour and %.5f after, with %d of %d contigs flipped",
+		before, clm.EvaluateQ(), flipped, clm.Tour.Len())
+	r.onPhase(PhaseOrient, clm.Tour)
+}
+
+// runPhases runs the GA phases from startPhase on the tour of the CLM
+func (r *Optimizer) runPhases(clm *CLM, fwtour *os.File, startPhase int) error {
+	for phase := startPhase; phase < 3 && !r.interrupted; phase++ {
+		clm.OptimizeOrdering(fwtour, r, phase)
+		if r.halted {
+			return errHalted
+		}
+		r.onPhase(fmt.Sprintf("%s%d", StageGA, phase), clm.Tour)
+	}
+	return nil
 }
 
 // OptimizeOrdering changes the ordering of contigs by Genetic Algorithm
 func (r *CLM) OptimizeOrdering(fwtour *os.File, opt *Optimizer, phase int) {
 	r.GARun(fwtour, opt, phase)
-	// r.pruneTour()
+}
+
+// patience returns the number of generations without improvement after
+// which the GA stops
+func (r *Optimizer) patience() int {
+	if r.Patience > 0 {
+		return r.Patience
+	}
+	return r.NGen
+}
+
+// method returns how the tigs are ordered, none without the GA or SA
+func (r *Optimizer) method() string {
+	switch {
+	case !r.RunGA || r.OrientOnly:
+		return "none"
+	case r.Method == "":
+		return MethodGA
+	}
+	return r.Method
+}
+
+// tournamentSize returns how many tours compete for each parent
+func (r *Optimizer) tournamentSize() int {
+	if r.TournamentSize > 0 {
+		return r.TournamentSize
+	}
+	return TournamentSize
+}
+
+// selector picks the parents of the offsprings of the GA
+func (r *Optimizer) selector() eaopt.Selector {
+	if r.Selection == SelectionRoulette {
+		return eaopt.SelRoulette{}
+	}
+	return eaopt.SelTournament{NContestants: uint(r.tournamentSize())}
+}
+
+// normalized tells whether the links of the ordering score are normalized
+func (r *Optimizer) normalized() bool {
+	return r.Normalize != "" && r.Normalize != NormalizeNone
+}
+
+// scoreName returns the name of the score of the run
+func (r *Optimizer) scoreName() string {
+	switch {
+	case r.JointOrient:
+		return ScoreJointOrient
+	case r.Score == "":
+		return ScoreDefault
+	}
+	return r.Score
+}
+
+// stopping tells whether the time limit is reached or the context of the
+// run is canceled, and logs it the first time
+func (r *Optimizer) stopping() bool {
+	if r.interrupted || r.ctx == nil {
+		return r.interrupted
+	}
+	switch r.ctx.Err() {
+	case nil:
+		return false
+	case context.DeadlineExceeded:
+		log.Warningf("Time limit of %s reached, stop after the current generation", r.TimeLimit)
+	default:
+		log.Warning("Interrupted, stop after the current generation")
+	}
+	r.interrupted = true
+	return true
+}
+
+// onPhase calls OnPhase at the end of the phase, unless the run is stopping
+func (r *Optimizer) onPhase(phase string, tour Tour) {
+	if r.OnPhase != nil && !r.interrupted {
+		r.abort(r.OnPhase(phase, tour))
+	}
+}
+
+// abort stops the run on the error of a callback, as its time limit would
+func (r *Optimizer) abort(err error) {
+	if err == nil {
+		return
+	}
+	log.Warningf("Aborted by the callback: %s, stop the run", err)
+	r.aborted, r.interrupted = err, true
+}
+
+// fail stops the run on an error of the GA, e.g. in writing its log or
+// its checkpoint, which Run returns. The first error is kept.
+func (r *Optimizer) fail(err error) {
+	if err == nil || r.aborted != nil {
+		return
+	}
+	log.Errorf("%s, stop the run", err)
+	r.aborted, r.interrupted = err, true
+}
+
+// interruption returns the error of an interrupted run, that of the
+// callback that aborted it, or ErrInterrupted
+func (r *Optimizer) interruption() error {
+	if r.aborted != nil {
+		return r.aborted
+	}
+	return ErrInterrupted
+}
+
+// injection returns the diversity threshold, the stall and the fraction of
+// the injections of shuffled tours into the GA
+func (r *Optimizer) injection() (float64, int, float64) {
+	threshold, stall, fraction := r.DiversityThreshold, r.InjectStall, r.InjectFraction
+	if threshold == 0 {
+		threshold = DiversityThreshold
+	}
+	if stall == 0 {
+		stall = InjectStall
+	}
+	if fraction == 0 {
+		fraction = InjectFraction
+	}
+	return threshold, stall, fraction
+}
+
+// diversity watches the GA populations for the injections, nil without them
+func (r *Optimizer) diversity() *diversity {
+	if !r.Inject {
+		return nil
+	}
+	return newDiversity(r.injection())
+}
+
+// polish climbs the score of the tour from the GA, and logs the gain
+func (r *Optimizer) polish(clm *CLM, fwtour *os.File) {
+	window := r.PolishWindow
+	if window <= 0 {
+		window = PolishWindow
+	}
+	before, after, moves := clm.Polish(window, PolishBudget)
+	gain := 0.0
+	if before != 0 {
+		gain = (before - after) / math.Abs(before) * 100
+	}
+	log.Noticef("Polish improved the score from %.5f to %.5f (%.3f%%) in %d moves, window %d",
+		-before, -after, gain, moves, window)
+	clm.printTour(fwtour, clm.Tour, "POLISH", fmt.Sprintf("moves=%d", moves))
+	r.onPhase(PhasePolish, clm.Tour)
+}
+
+// gfaWeight returns the bonus of the edges of the assembly graph
+func (r *Optimizer) gfaWeight() float64 {
+	if r.GFAWeight > 0 {
+		return r.GFAWeight
+	}
+	return GFAWeight
+}
+
+// islands returns the number of populations of the GA
+func (r *Optimizer) islands() int {
+	if r.Islands > 1 {
+		return r.Islands
+	}
+	return 1
+}
+
+// startSeeds returns how many tours of each population of the GA in phase
+// are seeded from the start tour, 0 when the GA does not start from it
+func (r *Optimizer) startSeeds(phase int) int {
+	if r.StartTour == "" || phase != 1 {
+		return 0
+	}
+	fraction := r.StartFraction
+	if fraction == 0 {
+		fraction = StartFraction
+	}
+	return int(math.Max(math.Round(fraction*float64(r.NPop)), 1))
+}
+
+// tourInterval returns how many generations apart the best tour of the GA
+// is written
+func (r *Optimizer) tourInterval() uint {
+	if r.TourInterval > 0 {
+		return uint(r.TourInterval)
+	}
+	return TourInterval
+}
+
+// migrationInterval returns how many generations apart the islands exchange
+// their best tours
+func (r *Optimizer) migrationInterval() int {
+	if r.MigrationInterval > 0 {
+		return r.MigrationInterval
+	}
+	return MigrationInterval
+}
+
+// annealing returns the starting temperature, the cooling factor and the
+// iterations of SA
+func (r *Optimizer) annealing() (tstart, tfactor float64, iterations int) {
+	tstart, tfactor, iterations = r.TStart, r.TFactor, r.Iterations
+	if tstart == 0 {
+		tstart = SATStart
+	}
+	if tfactor == 0 {
+		tfactor = SATFactor
+	}
+	if iterations == 0 {
+		iterations = SAIterations
+	}
+	return
+}
+
+// crossProb returns the crossover probability in the GA, 0 without an
+// operator
+func (r *Optimizer) crossProb() float64 {
+	switch {
+	case r.cross == nil:
+		return 0
+	case r.CrossProb > 0:
+		return r.CrossProb
+	}
+	return CrossoverProb
+}
+
+// loadCheckpoint reads the GA checkpoint when resuming from it, and returns
+// the GA phase to start from
+func (r *Optimizer) loadCheckpoint(clm *CLM) (int, error) {
+	if !r.ResumeCheckpoint {
+		return 1, nil
+	}
+	filename := r.checkpointFile()
+	if _, err := os.Stat(filename); err != nil {
+		log.Warningf("No GA checkpoint `%s` to resume from, start the GA anew", filename)
+		return 1, nil
+	}
+	state, err := clm.readCheckpoint(filename, r.Seed, r.NPop, r.islands(), r.restarts())
+	if err != nil {
+		return 0, err
+	}
+	log.Noticef("Found GA checkpoint `%s` at GA%d-%d", filename, state.Phase, state.Generation)
+	r.checkpoint = state
+	return state.Phase, nil
+}
+
+// endDist returns the near-end threshold of ScoreEndWeighted
+func (r *Optimizer) endDist() int {
+	if r.EndDist > 0 {
+		return r.EndDist
+	}
+	distfile := r.distFile()
+	if dist, ok := readLinkDistQuantile(distfile, EndDistQuantile); ok {
+		log.Noticef("Links below %d bp (P%.0f of `%s`) count as near the ends",
+			dist, EndDistQuantile*100, distfile)
+		return dist
+	}
+	log.Warningf("Cannot read `%s`, links below %d bp count as near the ends",
+		distfile, EndDist)
+	return EndDist
+}
+
+// distFile returns DistFile, or the distribution file next to the clmfile
+func (r *Optimizer) distFile() string {
+	if r.DistFile != "" {
+		return r.DistFile
+	}
+	return RemoveExt(strings.TrimSuffix(r.Clmfile, ".gz")) + ".distribution.txt"
+}
+
+// warnMode warns when the counts of the RE normalization come from another
+// mode of extract than the distribution, e.g. RE counts with the links of
+// Omni-C; either way the counts file holds the right ones for its mode
+func (r *Optimizer) warnMode() {
+	if r.Normalize != NormalizeRE {
+		return
+	}
+	model, err := readLinkDistribution(r.distFile())
+	if err != nil {
+		return
+	}
+	recounts := r.REcounts
+	if recounts == "" {
+		recounts = r.REfile
+	}
+	if mode := readCountsMode(recounts); mode != model.Mode() {
+		log.Warningf("Counts `%s` are of the %s mode of extract, but the distribution `%s` of the %s mode",
+			recounts, mode, r.distFile(), model.Mode())
+	}
+}
+
+// prefix returns OutPrefix, or the name of the group, as in the REfile
+// without the extension, or the .gz before it
+func (r *Optimizer) prefix() string {
+	if r.OutPrefix != "" {
+		return r.OutPrefix
+	}
+	return RemoveExt(path.Base(strings.TrimSuffix(r.REfile, ".gz")))
+}
+
+// debugPruneFile returns where PruneTour writes its delta scores, empty
+// unless DebugPrune is set
+func (r *Optimizer) debugPruneFile() string {
+	if !r.DebugPrune {
+		return ""
+	}
+	return r.pruneDeltasFile()
+}
+
+// pruneDeltasFile returns where PruneTour writes its delta scores
+func (r *Optimizer) pruneDeltasFile() string {
+	return r.prefix() + ".prune_deltas.tsv"
+}
+
+// summaryFile returns where the summary of the run goes
+func (r *Optimizer) summaryFile() string {
+	return r.prefix() + ".summary.json"
+}
+
+// checkpointFile returns where the state of the GA is checkpointed
+func (r *Optimizer) checkpointFile() string {
+	return r.prefix() + ".ga.checkpoint"
+}
+
+// gaLogFile returns where the progress of the GA is logged
+func (r *Optimizer) gaLogFile() string {
+	return r.prefix() + ".ga.log.csv"
+}
+
+// bestFile returns where the KeepBest best tours of the GA are kept
+func (r *Optimizer) bestFile() string {
+	return fmt.Sprintf("%s.best%d.tour", r.prefix(), r.KeepBest)
+}
+
+// activeFile returns where the state after activate is persisted
+func (r *Optimizer) activeFile() string {
+	return r.prefix() + ".active.json"
+}
+
+// prunedFile returns where the reduced tour after prune is persisted
+func (r *Optimizer) prunedFile() string {
+	return r.prefix() + ".prune.json"
+}
+
+// ActiveJSON keeps the active tigs in tour order along with their signs,
+// and why each inactive tig was pruned
+type ActiveJSON struct {
+	Tigs   []string          `json:"tigs"`
+	Signs  string            `json:"signs"`
+	Pruned map[string]string `json:"pruned,omitempty"`
+}
+
+// writeActiveFile persists the active tigs and signs of the current tour
+func writeActiveFile(filename string, clm *CLM) error {
+	A := ActiveJSON{Tigs: make([]string, clm.Tour.Len())}
+	signs := make([]byte, clm.Tour.Len())
+	for i, tig := range clm.Tour.Tigs {
+		A.Tigs[i] = clm.Tigs[tig.Idx].Name
+		signs[i] = clm.Signs[tig.Idx]
+	}
+	A.Signs = string(signs)
+	for _, tig := range clm.Tigs {
+		if !tig.IsActive && tig.Pruned != "" {
+			if A.Pruned == nil {
+				A.Pruned = make(map[string]string)
+			}
+			A.Pruned[tig.Name] = tig.Pruned
+		}
+	}
+
+	s, _ := json.MarshalIndent(A, "", "\t")
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(s); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Noticef("Active tigs (N=%d) written to `%s`", len(A.Tigs), filename)
+	return nil
+}
+
+// readActiveFile reads the tour written by writeActiveFile as tig names
+// suffixed with their signs, as on a line of the tour file, and the reasons
+// of the pruned tigs
+func readActiveFile(filename string) ([]string, map[string]string, error) {
+	log.Noticef("Parse active tigs `%s`", filename)
+	s, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	var A ActiveJSON
+	if err := json.Unmarshal(s, &A); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse `%s`: %s", filename, err)
+	}
+	if len(A.Signs) != len(A.Tigs) {
+		return nil, nil, fmt.Errorf("`%s` has %d tigs but %d signs",
+			filename, len(A.Tigs), len(A.Signs))
+	}
+	words := make([]string, len(A.Tigs))
+	for i, tig := range A.Tigs {
+		words[i] = tig + string(A.Signs[i])
+	}
+	return words, A.Pruned, nil
+}
+
+// WriteActive writes prefix.active.ids with the size of every tig, whether
+// it is active and otherwise why it was pruned, and its RE counts, - when
+// the ids file has none
+func (r *CLM) WriteActive(prefix string) error {
+	filename := prefix + ".active.ids"
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, ActiveIdsHeader)
+	activeCounts := 0
+	for _, tig := range r.Tigs {
+		status, reason := "active", "-"
+		if tig.IsActive {
+			activeCounts++
+		} else {
+			status = "inactive"
+			if tig.Pruned != "" {
+				reason = tig.Pruned
+			}
+		}
+		recounts := "-"
+		if tig.RECounts > 0 {
+			recounts = fmt.Sprint(tig.RECounts)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", tig.Name, tig.Size, status, reason, recounts)
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Noticef("Active tigs (%d of %d) written to `%s`", activeCounts, len(r.Tigs), filename)
+	return nil
+}
+
+// WriteOrientations writes prefix.orientation.tsv with how much each contig
+// in the tour supports its sign, see OrientationScores. Contigs whose score
+// drops by less than minDelta when flipped are flagged as low confidence.
+func (r *CLM) WriteOrientations(prefix string, minDelta float64) error {
+	filename := prefix + ".orientation.tsv"
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, OrientationHeader)
+	low, noData := 0, 0
+	for _, s := range r.OrientationScores() {
+		switch {
+		case s.NoData:
+			noData++
+			_, _ = fmt.Fprintf(w, "%s\t%c\tNA\t%s\n", s.Name, s.Sign, OrientationNoData)
+			continue
+		case s.Delta < minDelta:
+			low++
+			_, _ = fmt.Fprintf(w, "%s\t%c\t%.5f\t%s\n", s.Name, s.Sign, s.Delta, OrientationLow)
+		default:
+			_, _ = fmt.Fprintf(w, "%s\t%c\t%.5f\t%s\n", s.Name, s.Sign, s.Delta, OrientationOK)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Noticef("Orientations of %d tigs (%d low confidence, %d without data) written to `%s`",
+		r.Tour.Len(), low, noData, filename)
+	return nil
+}
+
+// WriteActiveClm writes prefix.active.clm with the rows of the clmfile
+// between two active tigs
+func (r *CLM) WriteActiveClm(prefix string) error {
+	filename := prefix + ".active.clm"
+	in, err := openReader(r.Clmfile)
+	if err != nil {
+		return openError("clm", r.Clmfile, err)
+	}
+	defer in.Close()
+
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	rows := 0
+	err = scanClmRows(in, func(row, at, bt string) {
+		ai, aok := r.tigToIdx[at]
+		bi, bok := r.tigToIdx[bt]
+		if aok && bok && r.Tigs[ai].IsActive && r.Tigs[bi].IsActive {
+			_, _ = w.WriteString(row)
+			rows++
+		}
+	})
+	if err == nil {
+		err = w.Flush()
+	} else {
+		err = fmt.Errorf("cannot read clm file %s: %s", r.Clmfile, err)
+	}
+	if err != nil {
+		_ = f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Noticef("%d rows between active tigs written to `%s`", rows, filename)
+	return nil
+}
+
+// WriteMatrices writes the pairwise strandedness matrix O to prefix.O.tsv
+// and the contact matrix M to prefix.M.tsv, both restricted to the active
+// tigs and with their names along the first row and column
+func (r *CLM) WriteMatrices(prefix string) {
+	active := r.activeIdxs()
+	O := r.O()
+	M := r.M()
+	r.writeMatrix(prefix+".O.tsv", active, func(i, j int) int { return int(O.At(i, j)) })
+	r.writeMatrix(prefix+".M.tsv", active, M.At)
 }
 
 // OptimizeOrientations changes the orientations of contigs by using heuristic flipping algorithms.
@@ -94,27 +1353,102 @@ func (r *CLM) OptimizeOrientations(fwtour *os.File, phase int) (string, string)
 	return tag1, tag2
 }
 
-// parseTourFile parses tour file
-// Only the last line is retained and converted into a Tour
+// orient flips the orientations until they settle
+func (r *CLM) orient(fwtour *os.File) {
+	for phase := 1; ; phase++ {
+		tag1, tag2 := r.OptimizeOrientations(fwtour, phase)
+		if tag1 == REJECT && tag2 == REJECT {
+			log.Noticef("Terminating ... no more %v", ACCEPT)
+			break
+		}
+	}
+}
+
+// parseTourFile parses tour file, see readTourWords, and aborts on errors
 func parseTourFile(filename string) []string {
+	words, err := readTourWords(filename)
+	ErrorAbort(err)
+	return words
+}
+
+// readTourWords reads the tigs of a tour file
+// Only the last line is retained and converted into a Tour. A trailing block
+// without its final newline was cut short and is skipped, unless there is
+// no complete block to fall back on.
+func readTourWords(filename string) ([]string, error) {
 	log.Noticef("Parse tour file `%s`", filename)
-	f := mustOpen(filename)
+	tour, err := readTourFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if tour.partial != nil {
+		if tour.words == nil {
+			log.Warningf("Tour file `%s` does not end with a newline", filename)
+			return tour.partial, nil
+		}
+		log.Warningf("Skip the incomplete block at the end of tour file `%s`", filename)
+	}
+	return tour.words, nil
+}
+
+// tourFile is the content of a tour file, split at the last complete block
+type tourFile struct {
+	words   []string // Tigs on the last complete line
+	end     int64    // Offset where the last complete block ends
+	partial []string // Tigs on a trailing line without newline
+	size    int64    // Size of the file
+}
+
+// readTourFile scans the tour file for its last complete block, that is a
+// line of tigs terminated by a newline
+func readTourFile(filename string) (tourFile, error) {
+	var tour tourFile
+	f, err := os.Open(filename)
+	if err != nil {
+		return tour, err
+	}
+	defer f.Close()
 
+	header := false
 	reader := bufio.NewReader(f)
-	var words []string
 	for {
 		row, err := reader.ReadString('\n')
-		row = strings.TrimSpace(row)
-		if row == "" && err == io.EOF {
+		tour.size += int64(len(row))
+		line := strings.TrimSpace(row)
+		if err != nil {
+			if err != io.EOF {
+				return tour, err
+			}
+			if line != "" && line[0] != '>' {
+				tour.partial = strings.Split(line, " ")
+			} else if line != "" || header {
+				tour.partial = []string{}
+			}
 			break
 		}
-		if row[0] == '>' { // header
-			continue
+		switch {
+		case line == "":
+		case line[0] == '>': // header
+			header = true
+		default:
+			tour.words = strings.Split(line, " ")
+			tour.end = tour.size
+			header = false
 		}
-		words = strings.Split(row, " ")
 	}
-	_ = f.Close()
-	return words
+	return tour, nil
+}
+
+// repairTourFile truncates an incomplete block at the end of the tour file,
+// left behind when a run was interrupted while logging
+func repairTourFile(filename string) error {
+	tour, err := readTourFile(filename)
+	if err != nil || tour.partial == nil || tour.words == nil {
+		return err
+	}
+	log.Warningf("Truncate the incomplete block at the end of `%s` (%d bytes)",
+		filename, tour.size-tour.end)
+	return os.Truncate(filename, tour.end)
 }
 
 // prepareTour prepares a boilerplate for an empty tour
@@ -122,29 +1456,45 @@ func (r *CLM) prepareTour() {
 	r.Signs = make([]byte, len(r.Tigs))
 	for _, tig := range r.Tigs {
 		tig.IsActive = false
+		tig.Pruned = PrunedNotListed
 	}
 }
 
 // parseTourFile parses tour file
 // Only the last line is retained and converted into a Tour
 func (r *CLM) parseTourFile(filename string) {
-	words := parseTourFile(filename)
+	r.setTour(parseTourFile(filename))
+}
+
+// setTour activates the tigs on a line of the tour file, in that order
+func (r *CLM) setTour(words []string) {
+	r.activateTour(words)
+	r.printTour(r.stdout(), r.Tour, "INIT")
+}
+
+// activateTour is setTour without printing the tour
+func (r *CLM) activateTour(words []string) {
 	r.prepareTour()
 
 	tigs := make([]Tig, 0)
 	for _, word := range words {
-		tigName, tigOrientation := word[:len(word)-1], word[len(word)-1]
+		tigName, tigOrientation := r.opts.Aliases.Name(word[:len(word)-1]), word[len(word)-1]
 		idx, ok := r.tigToIdx[tigName]
 		if !ok {
-			log.Errorf("Contig %s not found!", tigName)
+			log.Warningf("Contig %s not found in `%s`, skipped", tigName, r.REfile)
+			continue
+		}
+		if r.Tigs[idx].IsActive {
+			log.Warningf("Contig %s appears more than once in the tour, skipped", tigName)
 			continue
 		}
 		tigs = append(tigs, Tig{Idx: idx, Size: r.Tigs[idx].Size})
 		r.Signs[idx] = tigOrientation
 		r.Tigs[idx].IsActive = true
+		r.Tigs[idx].Pruned = ""
 	}
 	r.Tour.Tigs = tigs
-	r.printTour(os.Stdout, r.Tour, "INIT")
+	r.reportImposed()
 }
 
 // parseClustersFile parses clusters file
@@ -166,18 +1516,48 @@ func (r *CLM) parseClustersFile(clustersfile string, group int) {
 		})
 		r.Signs[idx] = '+'
 		r.Tigs[idx].IsActive = true
+		r.Tigs[idx].Pruned = ""
 	}
 	r.Tour.Tigs = tigs
-	r.printTour(os.Stdout, r.Tour, "INIT")
+	r.printTour(r.stdout(), r.Tour, "INIT")
 }
 
-// printTour logs the current tour to file
-func (r *CLM) printTour(fwtour *os.File, tour Tour, label string) {
-	_, _ = fwtour.WriteString(">" + label + "\n")
+// printTour logs the current tour to file. Each block goes out in a single
+// write and is synced, so that a crash loses at most the block being written.
+// The header has the label followed by key=value fields: the score of the
+// tour once its matrix is built, the extra fields, TourInfo and the time.
+//
+// >GA1-500 score=123456.78901 gen=500 seed=42 mutpb=0.2 cxpb=0.7 time=2026-10-15T09:30:00Z
+func (r *CLM) printTour(fwtour io.Writer, tour Tour, label string, fields ...string) {
 	atoms := make([]string, tour.Len())
 	for i := 0; i < tour.Len(); i++ {
 		idx := tour.Tigs[i].Idx
-		atoms[i] = r.Tigs[idx].Name + string(r.Signs[idx])
+		sign := r.Signs[idx]
+		if tour.Tigs[i].Sign != 0 {
+			sign = tour.Tigs[i].Sign
+		}
+		atoms[i] = r.Tigs[idx].Name + string(sign)
+	}
+	header := []string{">" + label}
+	if tour.M.N > 0 {
+		score, _ := tour.Evaluate()
+		header = append(header, fmt.Sprintf("score=%.5f", -score))
+	}
+	header = append(header, fields...)
+	if r.TourInfo != "" {
+		header = append(header, r.TourInfo)
+	}
+	header = append(header, "time="+time.Now().Format(time.RFC3339))
+	_, _ = io.WriteString(fwtour, strings.Join(header, " ")+"\n"+strings.Join(atoms, " ")+"\n")
+	if f, ok := fwtour.(*os.File); ok && f != os.Stdout {
+		_ = f.Sync()
+	}
+}
+
+// stdout returns where the tours and the progress of the GA are echoed
+func (r *CLM) stdout() io.Writer {
+	if r.Stdout == nil {
+		return os.Stdout
 	}
-	_, _ = fwtour.WriteString(strings.Join(atoms, " ") + "\n")
+	return r.Stdout
 }
@@ -0,0 +1,426 @@
+/*
+ *  optimize_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// simulationFiles returns the absolute paths to the simulated ids and clm files
+func simulationFiles(t testing.TB) (idsfile, clmfile string) {
+	dir, err := filepath.Abs(filepath.Join("tests", "simulation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "test.ids"), filepath.Join(dir, "test.clm")
+}
+
+// inTempDir runs f with the working directory set to a fresh temporary dir
+func inTempDir(t testing.TB, f func()) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	f()
+}
+
+// tourTimes matches the time field in the headers of a tour file
+var tourTimes = regexp.MustCompile(` time=\S+`)
+
+// runOptimizer runs a short GA on the simulated group and returns the
+// tourfile, without the times in the headers
+func runOptimizer(t testing.TB, opt allhic.Optimizer) string {
+	var tour []byte
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if tour, err = ioutil.ReadFile(opt.OutTourFile); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return tourTimes.ReplaceAllString(string(tour), "")
+}
+
+// shortOptimizer returns an Optimizer on the simulated group with a small GA
+func shortOptimizer(t testing.TB, seed int64) allhic.Optimizer {
+	idsfile, clmfile := simulationFiles(t)
+	return allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true,
+		Seed: seed, NPop: 20, NGen: 50, MutProb: allhic.MutaProb}
+}
+
+func TestOptimizeDeterministic(t *testing.T) {
+	a := runOptimizer(t, shortOptimizer(t, 42))
+	b := runOptimizer(t, shortOptimizer(t, 42))
+	if a != b {
+		t.Fatalf("Two runs with the same seed produced different tours:\n%s\n%s", a, b)
+	}
+}
+
+// pruneDeltas runs PruneTour on the simulated group and returns the TSV
+func pruneDeltas(t *testing.T, threads int) string {
+	idsfile, clmfile := simulationFiles(t)
+	var deltas []byte
+	inTempDir(t, func() {
+		clm := mustNewCLM(t, clmfile, idsfile)
+		clm.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+		clm.PruneTour("test.prune_deltas.tsv", threads)
+		var err error
+		if deltas, err = ioutil.ReadFile("test.prune_deltas.tsv"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return string(deltas)
+}
+
+// TestPruneTourDeltas checks the debug TSV is complete and ordered, run with
+// -race to check that the workers only write their own entries
+func TestPruneTourDeltas(t *testing.T) {
+	a := pruneDeltas(t, 0)
+	rows := strings.Split(strings.TrimSpace(a), "\n")
+	if len(rows) < 101 || !strings.HasPrefix(rows[0], "#Round") {
+		t.Fatalf("expected a header and a row per contig, got %d rows", len(rows))
+	}
+	if fields := strings.Split(rows[1], "\t"); len(fields) != 6 || fields[0] != "1" {
+		t.Errorf("malformed row: %q", rows[1])
+	}
+	if b := pruneDeltas(t, 0); a != b {
+		t.Error("delta scores are not written in a deterministic order")
+	}
+}
+
+// TestPruneTourThreads checks that the size of the worker pool changes
+// neither the delta scores nor the inactivated tigs
+func TestPruneTourThreads(t *testing.T) {
+	want := pruneDeltas(t, 1)
+	for _, threads := range []int{2, 7, 64} {
+		if got := pruneDeltas(t, threads); got != want {
+			t.Errorf("threads=%d: pruning differs from a single worker", threads)
+		}
+	}
+}
+
+// TestOptimizeStages stops after prune and picks the reduced tour up again
+func TestOptimizeStages(t *testing.T) {
+	opt, resumed := shortOptimizer(t, 42), shortOptimizer(t, 42)
+	opt.StopAfter, opt.DebugPrune = allhic.StagePrune, true
+	resumed.StartFrom = allhic.StageGA
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{"test.active.json", "test.prune.json", "test.prune_deltas.tsv"} {
+			if _, err := os.Stat(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := os.Stat("test.tour"); err == nil {
+			t.Fatal("tour file written before the ga stage")
+		}
+		var pruned allhic.ActiveJSON
+		s, err := ioutil.ReadFile("test.prune.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(s, &pruned); err != nil {
+			t.Fatal(err)
+		}
+		if len(pruned.Tigs) == 0 || len(pruned.Signs) != len(pruned.Tigs) {
+			t.Fatalf("malformed pruned state: %d tigs, %d signs",
+				len(pruned.Tigs), len(pruned.Signs))
+		}
+
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+		tour, err := ioutil.ReadFile(resumed.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(tour)), "\n")
+		if got := len(strings.Fields(lines[1])); got != len(pruned.Tigs) {
+			t.Errorf("ga started from %d tigs, want the %d pruned tigs", got, len(pruned.Tigs))
+		}
+	})
+
+	// The delta scores are only written with DebugPrune
+	opt.DebugPrune = false
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat("test.prune_deltas.tsv"); !os.IsNotExist(err) {
+			t.Error("delta scores written without DebugPrune")
+		}
+	})
+}
+
+// TestActivateFromTour takes the active tigs, order and signs from the last
+// tour, skipping a tig that is not in the ids file
+func TestActivateFromTour(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	inTempDir(t, func() {
+		tour := ">INIT\ntig0000+ tig0001+ tig0002+\n>FINAL\ntig0002- tigXXXX+ tig0000+\n"
+		if err := ioutil.WriteFile("old.tour", []byte(tour), 0644); err != nil {
+			t.Fatal(err)
+		}
+		clm := mustNewCLM(t, clmfile, idsfile)
+		clm.ActivateFromTour("old.tour")
+		var got []string
+		for _, tig := range clm.Tour.Tigs {
+			got = append(got, clm.Tigs[tig.Idx].Name+string(clm.Signs[tig.Idx]))
+		}
+		if want := []string{"tig0002-", "tig0000+"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got tour %v, want %v", got, want)
+		}
+		active := 0
+		for _, tig := range clm.Tigs {
+			if tig.IsActive {
+				active++
+			}
+		}
+		if active != 2 {
+			t.Errorf("got %d active tigs, want 2", active)
+		}
+		if clm.Tour.M.N == 0 {
+			t.Error("contact matrix not built")
+		}
+	})
+}
+
+// TestWriteActive runs prune and ga as separate stages and checks that the
+// reasons of the pruned tigs carry over into the active.ids, and that the
+// active.clm only has rows between active tigs
+func TestWriteActive(t *testing.T) {
+	opt, resumed := shortOptimizer(t, 42), shortOptimizer(t, 42)
+	opt.MinContigSize = 20000
+	opt.StopAfter = allhic.StagePrune
+	resumed.StartFrom = allhic.StageGA
+	resumed.ActiveClm = true
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile("test.active.ids")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if rows[0]+"\n" != allhic.ActiveIdsHeader {
+			t.Fatalf("unexpected header %q", rows[0])
+		}
+		status := make(map[string]string)
+		reasons := make(map[string]int)
+		for _, row := range rows[1:] {
+			fields := strings.Split(row, "\t")
+			size, _ := strconv.Atoi(fields[1])
+			status[fields[0]] = fields[2]
+			reasons[fields[3]]++
+			switch {
+			case fields[2] == "active" && fields[3] != "-":
+				t.Errorf("active tig with a reason: %q", row)
+			case fields[2] == "inactive" && fields[3] == "-":
+				t.Errorf("inactive tig without a reason: %q", row)
+			case size < opt.MinContigSize && fields[3] != allhic.PrunedSize:
+				t.Errorf("short tig not pruned by size: %q", row)
+			}
+		}
+		if reasons[allhic.PrunedSize] == 0 || reasons[allhic.PrunedTour] == 0 {
+			t.Errorf("expected tigs pruned by size and by the tour: %v", reasons)
+		}
+
+		s, err = ioutil.ReadFile("test.active.clm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range strings.Split(strings.TrimSpace(string(s)), "\n") {
+			for _, tig := range strings.Fields(strings.Split(row, "\t")[0]) {
+				if status[tig[:len(tig)-1]] != "active" {
+					t.Fatalf("row with an inactive tig: %q", row)
+				}
+			}
+		}
+	})
+}
+
+func TestWriteMatrices(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"test.ids": "t0\t10\t5000\nt1\t10\t6000\nt2\t10\t7000\n",
+			"test.clm": "t0+ t1-\t2\t1000 2000\nt1+ t2+\t3\t1000 2000 3000\nt0+ t2+\t1\t4000\n",
+		})
+		r := mustNewCLM(t, "test.clm", "test.ids")
+		r.Tigs[2].IsActive = false
+		r.WriteMatrices("dump")
+		for filename, want := range map[string]string{
+			"dump.O.tsv": "#Contig\tt0\tt1\nt0\t0\t-2\nt1\t-2\t0\n",
+			"dump.M.tsv": "#Contig\tt0\tt1\nt0\t0\t2\nt1\t2\t0\n",
+		} {
+			s, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(s) != want {
+				t.Errorf("%s: got %q, want %q", filename, s, want)
+			}
+		}
+	})
+}
+
+// TestOptimizeStdin pipes the clmfile into optimize and expects the same
+// tour as when it is read from disk
+func TestOptimizeStdin(t *testing.T) {
+	want := runOptimizer(t, shortOptimizer(t, 42))
+
+	_, clmfile := simulationFiles(t)
+	clm, err := ioutil.ReadFile(clmfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = pr
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		_, _ = pw.Write(clm)
+		_ = pw.Close()
+	}()
+
+	opt := shortOptimizer(t, 42)
+	opt.Clmfile = allhic.StdinFile
+	if got := runOptimizer(t, opt); got != want {
+		t.Errorf("tour from stdin differs from the file:\n%s\n%s", got, want)
+	}
+}
+
+func TestOptimizeStdinRejects(t *testing.T) {
+	for _, opt := range []allhic.Optimizer{
+		{ResumeFile: "test.tour"},
+		{Resume: true},
+		{StartFrom: allhic.StageGA},
+		{UseCache: true},
+		{ActiveClm: true},
+		{Score: allhic.ScoreEndWeighted},
+		{Score: allhic.ScoreLikelihood},
+	} {
+		opt.Clmfile = allhic.StdinFile
+		if err := opt.CheckStdin(); err == nil {
+			t.Errorf("%+v: expected an error reading the clm from stdin", opt)
+		}
+		opt.Clmfile = "test.clm"
+		if err := opt.CheckStdin(); err != nil {
+			t.Errorf("%+v: unexpected error %v", opt, err)
+		}
+	}
+	opt := allhic.Optimizer{Clmfile: allhic.StdinFile, Score: allhic.ScoreEndWeighted, EndDist: 5000}
+	if err := opt.CheckStdin(); err != nil {
+		t.Errorf("unexpected error %v with an end distance", err)
+	}
+}
+
+// TestNoPrune disables every pruning stage, so all the tigs of the ids
+// file stay in the tour despite the cutoffs
+func TestNoPrune(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.MinContigSize = 20000
+	opt.DensityLowerBound = 1e-3
+	opt.NoPruneSize, opt.NoPruneDensity, opt.NoPruneTour = true, true, true
+	opt.StopAfter, opt.DebugPrune = allhic.StagePrune, true
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile("test.prune.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var A allhic.ActiveJSON
+		if err := json.Unmarshal(s, &A); err != nil {
+			t.Fatal(err)
+		}
+		if len(A.Tigs) != 100 || len(A.Pruned) != 0 {
+			t.Errorf("got %d tigs in the tour and %d pruned, want 100 and 0",
+				len(A.Tigs), len(A.Pruned))
+		}
+		if _, err := os.Stat("test.prune_deltas.tsv"); !os.IsNotExist(err) {
+			t.Error("PruneTour ran with NoPruneTour")
+		}
+	})
+}
+
+// TestOptimizerErrors checks that Run returns the errors of the options and
+// of the input files rather than exit
+func TestOptimizerErrors(t *testing.T) {
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"unknown score":      func(r *allhic.Optimizer) { r.Score = "bogus" },
+		"cannot stop after":  func(r *allhic.Optimizer) { r.StopAfter = "bogus" },
+		"cannot open clm":    func(r *allhic.Optimizer) { r.Clmfile = "missing.clm" },
+		"cannot stop the GA": func(r *allhic.Optimizer) { r.MinDelta = -1 },
+		"unknown crossover":  func(r *allhic.Optimizer) { r.Crossover = "cx" },
+		"unknown mutation":   func(r *allhic.Optimizer) { r.MutWeights = "flip:1" },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		opt.OutPrefix = filepath.Join(t.TempDir(), "test")
+		if err := opt.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
+
+// TestOptimizePatience stops the GA early, and still expects the tours of
+// the orientation phases and the final outputs
+func TestOptimizePatience(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.Patience, opt.MinDelta = 5, 0.5
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile(opt.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if header := lines[len(lines)-2]; !strings.HasPrefix(header, ">FLIPONE") || !strings.Contains(header, "score=") {
+			t.Errorf("tour file ends with %s, want the last FLIPONE tour with its score", header)
+		}
+		for _, f := range []string{"test.active.ids", "test.orientation.tsv"} {
+			if _, err := os.Stat(f); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
@@ -12,6 +12,8 @@ package allhic
 import (
 	"fmt"
 	"math"
+	"math/rand"
+	"sort"
 
 	"github.com/gonum/matrix/mat64"
 )
@@ -27,22 +29,108 @@ func flipLog(method string, score, scoreFlipped float64, tag string) {
 	log.Noticef("%v: %.5f => %.5f %v", method, score, scoreFlipped, tag)
 }
 
-// flipAll initializes the orientations based on pairwise O matrix.
+// MinEigenRatio is the smallest ratio between the two leading eigenvalues of
+// O for which the spectral orientations are trusted
+const MinEigenRatio = 1.05
+
+// flipAll initializes the orientations, by default based on pairwise O
+// matrix, see initSpectral(). With OrientInitGreedy, the orientations are
+// propagated along a maximum spanning tree of the contacts, see
+// greedySigns(). The imposed strands are kept, see imposeStrands().
 func (r *CLM) flipAll() (tag string) {
+	r.imposeStrands(r.Signs)
+	oldSigns := make([]byte, len(r.Signs))
+	copy(oldSigns, r.Signs)
+	score := r.EvaluateQ()
+
+	var signs []byte
+	switch r.OrientInit {
+	case OrientInitGreedy:
+		signs = r.greedySigns()
+	default:
+		signs = r.initSpectral()
+	}
+	r.alignStrands(signs)
+	r.imposeStrands(signs)
+	r.Signs = signs
+	newScore := r.EvaluateQ()
+	tag = ACCEPT
+	if newScore < score {
+		copy(r.Signs, oldSigns) // Recover
+		tag = REJECT
+	}
+	flipLog("FLIPALL", score, newScore, tag)
+	return
+}
+
+// initSpectral returns the orientations from the decomposition of O. When
+// the decomposition is degenerate, the greedy orientations are used instead
+// if they score better.
+func (r *CLM) initSpectral() []byte {
+	signs, ok := r.spectralSigns()
+	if ok {
+		return signs
+	}
+	// Keep the eigenvector signs only if they still beat the greedy ones
+	greedy := r.greedySigns()
+	spectralScore := math.Inf(-1)
+	if signs != nil {
+		r.Signs = signs
+		spectralScore = r.EvaluateQ()
+	}
+	r.Signs = greedy
+	greedyScore := r.EvaluateQ()
+	log.Warningf("FLIPALL: degenerate strandedness matrix, spectral %.5f vs greedy %.5f",
+		spectralScore, greedyScore)
+	if greedyScore > spectralScore {
+		return greedy
+	}
+	return signs
+}
+
+// spectralSigns orients the contigs by the signs of the leading eigenvector
+// of O, and reports whether the decomposition can be trusted. Groups whose
+// M is sparse go through lanczosSigns rather than a dense O.
+func (r *CLM) spectralSigns() ([]byte, bool) {
+	if r.sparse() {
+		return r.lanczosSigns()
+	}
 	var (
 		M mat64.Dense
 		e mat64.EigenSym
 	)
 
-	oldSigns := make([]byte, len(r.Signs))
-	copy(oldSigns, r.Signs)
-	score := r.EvaluateQ()
-
 	N := len(r.Tigs)
-	e.Factorize(r.O(), true)
+	O := r.O()
+	zeroRows, activeCounts := 0, 0
+	for i, tig := range r.Tigs {
+		if !tig.IsActive {
+			continue
+		}
+		activeCounts++
+		zero := true
+		for j := 0; j < N && zero; j++ {
+			zero = O.At(i, j) == 0
+		}
+		if zero {
+			zeroRows++
+		}
+	}
+
+	if !e.Factorize(O, true) {
+		log.Warningf("FLIPALL: eigen decomposition of O did not converge")
+		return nil, false
+	}
 	M.EigenvectorsSym(&e)
 	v := M.ColView(N - 1) // v is the eigenvector corresponding to the largest eigenvalue
-	// fmt.Printf("%0.2v\n\n", mat64.Formatted(v))
+
+	values := e.Values(nil) // in ascending order
+	leading, ratio := values[N-1], math.Inf(1)
+	if N > 1 && values[N-2] != 0 {
+		ratio = leading / math.Abs(values[N-2])
+	}
+	log.Noticef("FLIPALL: leading eigenvalue %.3f, ratio to second %.3f, %d of %d active tigs without strandedness",
+		leading, ratio, zeroRows, activeCounts)
 
 	signs := make([]byte, N)
 	for i := 0; i < N; i++ {
@@ -52,18 +140,237 @@ func (r *CLM) flipAll() (tag string) {
 			signs[i] = '+'
 		}
 	}
-	r.Signs = signs
-	newScore := r.EvaluateQ()
-	tag = ACCEPT
-	if newScore < score {
-		copy(r.Signs, oldSigns) // Recover
-		tag = REJECT
+	ok := leading > 0 && ratio >= MinEigenRatio && 2*zeroRows <= activeCounts
+	return signs, ok
+}
+
+// LanczosSteps is the number of Lanczos steps of lanczosSigns, which holds
+// as many vectors over the active tigs
+const LanczosSteps = 100
+
+// lanczosSigns is spectralSigns on the rows of O between active tigs,
+// without O. The leading eigenpairs come from LanczosSteps steps of the
+// Lanczos iteration, with full reorthogonalization, and are only trusted
+// when the leading one has converged. The inactive tigs are left '+'.
+func (r *CLM) lanczosSigns() ([]byte, bool) {
+	N := len(r.Tigs)
+	col := make([]int, N)
+	var active []int
+	for i, tig := range r.Tigs {
+		col[i] = -1
+		if tig.IsActive {
+			col[i] = len(active)
+			active = append(active, i)
+		}
 	}
-	flipLog("FLIPALL", score, newScore, tag)
-	return
+	signs := make([]byte, N)
+	for i := range signs {
+		signs[i] = '+'
+	}
+	n := len(active)
+	if n == 0 {
+		return signs, false
+	}
+
+	// The nonzero cells of O, row by row in the order of the columns
+	type cell struct {
+		j int
+		v float64
+	}
+	rows := make([][]cell, n)
+	for pair, contact := range r.contacts {
+		a, b := col[pair.a()], col[pair.b()]
+		v := float64(contact.consensus()) * float64(contact.nlinks)
+		if a < 0 || b < 0 || v == 0 {
+			continue
+		}
+		rows[a] = append(rows[a], cell{b, v})
+		rows[b] = append(rows[b], cell{a, v})
+	}
+	zeroRows := 0
+	for _, row := range rows {
+		sort.Slice(row, func(x, y int) bool { return row[x].j < row[y].j })
+		if len(row) == 0 {
+			zeroRows++
+		}
+	}
+	multiply := func(y, x []float64) {
+		for i, row := range rows {
+			s := 0.0
+			for _, c := range row {
+				s += c.v * x[c.j]
+			}
+			y[i] = s
+		}
+	}
+	dot := func(x, y []float64) float64 {
+		s := 0.0
+		for i := range x {
+			s += x[i] * y[i]
+		}
+		return s
+	}
+
+	// Lanczos from a fixed random start, which keeps the signs reproducible
+	steps := LanczosSteps
+	if steps > n {
+		steps = n
+	}
+	rng := rand.New(rand.NewSource(1))
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = rng.Float64() - 0.5
+	}
+	norm := math.Sqrt(dot(v, v))
+	for i := range v {
+		v[i] /= norm
+	}
+	var V [][]float64
+	var alpha, beta []float64
+	w := make([]float64, n)
+	for k := 0; k < steps; k++ {
+		V = append(V, v)
+		multiply(w, v)
+		alpha = append(alpha, dot(w, v))
+		// Orthogonalize twice against all the vectors so far
+		for pass := 0; pass < 2; pass++ {
+			for _, u := range V {
+				d := dot(w, u)
+				for i := range w {
+					w[i] -= d * u[i]
+				}
+			}
+		}
+		b := math.Sqrt(dot(w, w))
+		beta = append(beta, b)
+		if b < 1e-10*math.Max(math.Abs(alpha[0]), 1) {
+			break // The Krylov space spans an invariant subspace
+		}
+		v = make([]float64, n)
+		for i := range v {
+			v[i] = w[i] / b
+		}
+	}
+
+	// Ritz values and vectors from the tridiagonal matrix
+	m := len(V)
+	T := mat64.NewSymDense(m, nil)
+	for k := 0; k < m; k++ {
+		T.SetSym(k, k, alpha[k])
+		if k+1 < m {
+			T.SetSym(k, k+1, beta[k])
+		}
+	}
+	var (
+		Y mat64.Dense
+		e mat64.EigenSym
+	)
+	if !e.Factorize(T, true) {
+		log.Warningf("FLIPALL: Lanczos decomposition of O did not converge")
+		return signs, false
+	}
+	Y.EigenvectorsSym(&e)
+	values := e.Values(nil) // in ascending order
+	leading, ratio := values[m-1], math.Inf(1)
+	if m > 1 && values[m-2] != 0 {
+		ratio = leading / math.Abs(values[m-2])
+	}
+	residual := math.Abs(beta[m-1] * Y.At(m-1, m-1))
+	log.Noticef("FLIPALL: leading eigenvalue %.3f, ratio to second %.3f, %d of %d active tigs without strandedness (Lanczos, %d steps, residual %.3g)",
+		leading, ratio, zeroRows, n, m, residual)
+
+	for i, idx := range active {
+		x := 0.0
+		for k, u := range V {
+			x += u[i] * Y.At(k, m-1)
+		}
+		if x < 0 {
+			signs[idx] = '-'
+		}
+	}
+	converged := residual <= 1e-6*math.Abs(leading)
+	ok := leading > 0 && ratio >= MinEigenRatio && 2*zeroRows <= n && converged
+	return signs, ok
 }
 
-// flipWhole test flipping all contigs at the same time to see if score improves
+// greedySigns orients the contigs along the maximum spanning tree of the
+// contact graph, strongest links first. Each tree is rooted at its
+// lowest-indexed contig, which is kept '+', and every other contig takes the
+// orientation implied by the strandedness of its tree edge.
+func (r *CLM) greedySigns() []byte {
+	N := len(r.Tigs)
+	pairs := make([]Pair, 0, len(r.contacts))
+	for pair := range r.contacts {
+		if r.Tigs[pair.a()].IsActive && r.Tigs[pair.b()].IsActive {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i], pairs[j]
+		if na, nb := r.contacts[a].nlinks, r.contacts[b].nlinks; na != nb {
+			return na > nb
+		}
+		return a < b // The packed pair sorts by a, then by b
+	})
+
+	// Kruskal on the sorted edges
+	parent := make([]int, N)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+	type edge struct {
+		to           int
+		strandedness int8
+	}
+	tree := make([][]edge, N)
+	for _, pair := range pairs {
+		a, b := pair.a(), pair.b()
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			continue
+		}
+		parent[ra] = rb
+		s := r.contacts[pair].consensus()
+		tree[a] = append(tree[a], edge{b, s})
+		tree[b] = append(tree[b], edge{a, s})
+	}
+
+	// Propagate the orientations from the root of each tree
+	signs := make([]byte, N)
+	for root := 0; root < N; root++ {
+		if signs[root] != 0 {
+			continue
+		}
+		signs[root] = '+'
+		queue := []int{root}
+		for len(queue) > 0 {
+			a := queue[0]
+			queue = queue[1:]
+			for _, e := range tree[a] {
+				if signs[e.to] != 0 {
+					continue
+				}
+				if e.strandedness < 0 {
+					signs[e.to] = rr(signs[a])
+				} else {
+					signs[e.to] = signs[a]
+				}
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return signs
+}
+
+// flipWhole test flipping all contigs at the same time to see if score
+// improves, except for those with imposed strands
 func (r *CLM) flipWhole() (tag string) {
 	oldSigns := make([]byte, len(r.Signs))
 	copy(oldSigns, r.Signs)
@@ -71,7 +378,9 @@ func (r *CLM) flipWhole() (tag string) {
 
 	// Flip all the tigs
 	for i, s := range r.Signs {
-		r.Signs[i] = rr(s)
+		if !r.fixedStrand(i) {
+			r.Signs[i] = rr(s)
+		}
 	}
 	newScore := r.EvaluateQ()
 	tag = ACCEPT
@@ -83,16 +392,24 @@ func (r *CLM) flipWhole() (tag string) {
 	return
 }
 
-// flipOne test flipping every single contig sequentially to see if score improves
+// flipOne test flipping every single contig sequentially to see if score
+// improves, except for those with imposed strands. Each flip only changes
+// the terms of EvaluateQ with the contig, see flipDelta.
 func (r *CLM) flipOne() (tag string) {
 	nAccepts := 0
 	nRejects := 0
 	anyTagACCEPT := false
 	score := r.EvaluateQ()
+	cumsize, pos := r.tourOffsets()
+	linked := r.linkedTigs()
 	for i, t := range r.Tour.Tigs {
 		idx := t.Idx
+		if r.fixedStrand(idx) {
+			continue
+		}
+		delta := r.flipDelta(i, cumsize, pos, linked[idx])
 		r.Signs[idx] = rr(r.Signs[idx])
-		newScore := r.EvaluateQ()
+		newScore := score + delta
 		if newScore > score {
 			nAccepts++
 			tag = ACCEPT
@@ -119,34 +436,113 @@ func (r *CLM) flipOne() (tag string) {
 	return
 }
 
-// O yields a pairwise orientation matrix, where each cell contains the strandedness
-// times the number of links between i-th and j-th contig
+// flipDelta is the change of EvaluateQ when the contig at position i of the
+// tour is flipped, from its pairs with the linked contigs within LIMIT
+func (r *CLM) flipDelta(i int, cumsize, pos []int, linked []int) float64 {
+	a := r.Tour.Tigs[i].Idx
+	sign := r.Signs[a]
+	delta := 0.0
+	for _, b := range linked {
+		j := pos[b]
+		var s, f float64
+		switch {
+		case j > i:
+			dist := cumsize[j-1] - cumsize[i]
+			if dist > LIMIT {
+				continue
+			}
+			s, _ = r.pairScoreQ(a, b, sign, r.Signs[b], dist)
+			f, _ = r.pairScoreQ(a, b, rr(sign), r.Signs[b], dist)
+		case j >= 0 && j < i:
+			dist := cumsize[i-1] - cumsize[j]
+			if dist > LIMIT {
+				continue
+			}
+			s, _ = r.pairScoreQ(b, a, r.Signs[b], sign, dist)
+			f, _ = r.pairScoreQ(b, a, r.Signs[b], rr(sign), dist)
+		default:
+			continue
+		}
+		delta += f - s
+	}
+	return delta
+}
+
+// tourOffsets returns the start of each contig of the tour, as the sum of
+// the sizes before it, and the position in the tour of each tig, -1 when
+// not in the tour
+func (r *CLM) tourOffsets() (cumsize, pos []int) {
+	cumsize = make([]int, r.Tour.Len())
+	cumSum := 0
+	for i, t := range r.Tour.Tigs {
+		cumsize[i] = cumSum
+		cumSum += t.Size
+	}
+	pos = make([]int, len(r.Tigs))
+	for i := range pos {
+		pos[i] = -1
+	}
+	for i, t := range r.Tour.Tigs {
+		pos[t.Idx] = i
+	}
+	return
+}
+
+// linkedTigs returns the tigs with oriented contacts to each tig, in order
+func (r *CLM) linkedTigs() [][]int {
+	linked := make([][]int, len(r.Tigs))
+	for pair := range r.orientedContacts {
+		a, b := pair.a(), pair.b()
+		linked[a] = append(linked[a], b)
+		linked[b] = append(linked[b], a)
+	}
+	for a, tigs := range linked {
+		sort.Ints(tigs)
+		n := 0
+		for k, b := range tigs {
+			if k == 0 || b != tigs[k-1] {
+				tigs[n] = b
+				n++
+			}
+		}
+		linked[a] = tigs[:n]
+	}
+	return linked
+}
+
+// O yields a pairwise orientation matrix, where each cell contains the consensus
+// strandedness times the number of links between i-th and j-th contig. It is
+// dense, for the groups whose M is, see spectralSigns.
 func (r *CLM) O() *mat64.SymDense {
 	N := len(r.Tigs)
 	P := mat64.NewSymDense(N, nil)
 	for pair, contact := range r.contacts {
-		score := float64(contact.strandedness * contact.nlinks)
-		P.SetSym(pair.ai, pair.bi, score)
+		score := float64(contact.consensus()) * float64(contact.nlinks)
+		P.SetSym(pair.a(), pair.b(), score)
 	}
 	return P
 }
 
 // Q yields a contact frequency matrix when contigs are already oriented. This is a
 // similar matrix as M, but rather than having the number of links in the
-// cell, it points to an array that has the actual distances.
-func (r *CLM) Q() [][]GArray {
+// cell, it points to an array that has the actual distances. Cells without
+// an entry are nil. It is dense, EvaluateQ visits the same cells sparsely.
+func (r *CLM) Q() [][]*GArray {
 	N := len(r.Tigs)
-	P := Make2DGArraySlice(N, N)
+	P := make([][]*GArray, N)
 	for i := 0; i < N; i++ {
-		for j := 0; j < N; j++ {
-			P[i][j][0] = -1 // Sentinel to signal that there is no entry
-		}
+		P[i] = make([]*GArray, N)
 	}
-	for pair, gdists := range r.orientedContacts {
-		ai := pair.ai
-		bi := pair.bi
-		if r.Signs[ai] == pair.ao && r.Signs[bi] == pair.bo {
-			P[ai][bi] = gdists
+	for pair, gi := range r.orientedContacts {
+		ai := pair.a()
+		bi := pair.b()
+		ao, bo := pair.orientations()
+		if r.Signs[ai] == ao && r.Signs[bi] == bo {
+			P[ai][bi] = &r.gdists[gi]
+		}
+		// The reverse orientation shares the canonical key
+		if r.Signs[bi] == rr(bo) && r.Signs[ai] == rr(ao) {
+			P[bi][ai] = &r.gdists[gi]
 		}
 	}
 	return P
@@ -157,10 +553,61 @@ func (r *CLM) Q() [][]GArray {
 // For performance consideration, we actually use a histogram to approximate
 // all link distances. See goldenArray() for details.
 func (r *CLM) EvaluateQ() float64 {
-	tour := r.Tour
-	Q := r.Q()
+	cumsize, pos := r.tourOffsets()
+
+	// The cells of Q in the tour, in the row of the tig on the left, as the
+	// position of the tig on the right and the index of the GArray
+	type cell struct{ j, gi int }
+	rows := make([][]cell, r.Tour.Len())
+	for pair, gi := range r.orientedContacts {
+		ai, bi := pair.a(), pair.b()
+		i, j := pos[ai], pos[bi]
+		if i < 0 || j < 0 {
+			continue
+		}
+		ao, bo := pair.orientations()
+		if i < j && r.Signs[ai] == ao && r.Signs[bi] == bo {
+			rows[i] = append(rows[i], cell{j, int(gi)})
+		}
+		// The reverse orientation shares the canonical key
+		if j < i && r.Signs[bi] == rr(bo) && r.Signs[ai] == rr(ao) {
+			rows[j] = append(rows[j], cell{i, int(gi)})
+		}
+	}
+
+	// Now add up all the pairwise scores, in the order of the tour
 	score := 0.0
+	for i, row := range rows {
+		sort.Slice(row, func(x, y int) bool { return row[x].j < row[y].j })
+		for _, c := range row {
+			dist := cumsize[c.j-1] - cumsize[i]
+			if dist > LIMIT {
+				break
+			}
+			for k, center := range r.golden.centers[:r.golden.Bins] {
+				// score += float64(Q[a][b][k]) / float64(center+dist)
+				score -= float64(r.gdists[c.gi][k]) * math.Log(float64(center+dist))
+			}
+		}
+	}
+	return score
+}
+
+// OrientationScore is how much the tour score drops when the contig alone
+// is flipped, from the links to its neighbors within LIMIT
+type OrientationScore struct {
+	Idx    int
+	Name   string
+	Sign   byte
+	Delta  float64
+	NoData bool // No oriented contacts within LIMIT in either orientation
+}
 
+// OrientationScores returns the score of each contig in the tour, in tour
+// order. Delta is the EvaluateQ of the tour minus that with the contig
+// flipped, holding the other contigs fixed.
+func (r *CLM) OrientationScores() []OrientationScore {
+	tour := r.Tour
 	size := tour.Len()
 	cumsize := make([]int, size)
 	cumSum := 0
@@ -168,26 +615,49 @@ func (r *CLM) EvaluateQ() float64 {
 		cumsize[i] = cumSum
 		cumSum += t.Size
 	}
-	// fmt.Println(tour.Tigs, cumsize)
 
-	// Now add up all the pairwise scores
-	for i := 0; i < size; i++ {
-		a := tour.Tigs[i].Idx
+	scores := make([]OrientationScore, size)
+	for i, t := range tour.Tigs {
+		a := t.Idx
+		sign := r.Signs[a]
+		score, flipped, found := 0.0, 0.0, false
+		// Pairs with the contig on the left and on the right, within LIMIT
 		for j := i + 1; j < size; j++ {
-			b := tour.Tigs[j].Idx
-			if Q[a][b][0] == -1 {
-				continue // Entire GArray is empty
-			}
 			dist := cumsize[j-1] - cumsize[i]
 			if dist > LIMIT {
 				break
 			}
-			for k := 0; k < BB; k++ {
-				// score += float64(Q[a][b][k]) / float64(GR[k]+dist)
-				score -= float64(Q[a][b][k]) * math.Log(float64(GR[k]+dist))
+			b := tour.Tigs[j].Idx
+			s, ok := r.pairScoreQ(a, b, sign, r.Signs[b], dist)
+			f, fok := r.pairScoreQ(a, b, rr(sign), r.Signs[b], dist)
+			score, flipped, found = score+s, flipped+f, found || ok || fok
+		}
+		for j := i - 1; j >= 0; j-- {
+			dist := cumsize[i-1] - cumsize[j]
+			if dist > LIMIT {
+				break
 			}
-			// fmt.Println(r.Tigs[a], r.Tigs[b], Q[a][b], score)
+			b := tour.Tigs[j].Idx
+			s, ok := r.pairScoreQ(b, a, r.Signs[b], sign, dist)
+			f, fok := r.pairScoreQ(b, a, r.Signs[b], rr(sign), dist)
+			score, flipped, found = score+s, flipped+f, found || ok || fok
 		}
+		scores[i] = OrientationScore{Idx: a, Name: r.Tigs[a].Name, Sign: sign,
+			Delta: score - flipped, NoData: !found}
 	}
-	return score
+	return scores
+}
+
+// pairScoreQ is the term of EvaluateQ for the links from contig a, oriented
+// ao, to contig b on its right, oriented bo, with dist between them
+func (r *CLM) pairScoreQ(a, b int, ao, bo byte, dist int) (float64, bool) {
+	gi, ok := r.orientedContacts[newOrientedPair(a, b, ao, bo)]
+	if !ok {
+		return 0, false
+	}
+	score := 0.0
+	for k, center := range r.golden.centers[:r.golden.Bins] {
+		score -= float64(r.gdists[gi][k]) * math.Log(float64(center+dist))
+	}
+	return score, true
 }
@@ -0,0 +1,264 @@
+/*
+ *  orientation_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestDegenerateOrientations uses two disconnected pairs with equal links, so
+// the two leading eigenvalues of O tie and the greedy orientations are used
+func TestDegenerateOrientations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allhic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idsfile := filepath.Join(dir, "degenerate.ids")
+	clmfile := filepath.Join(dir, "degenerate.clm")
+	ids := "#Contig\tRECounts\tLength\nt0\t10\t5000\nt1\t10\t5000\nt2\t10\t5000\nt3\t10\t5000\n"
+	clm := "t0+ t1-\t5\t100 200 300 400 500\nt2+ t3+\t5\t100 200 300 400 500\n"
+	if err := ioutil.WriteFile(idsfile, []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(clmfile, []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustNewCLM(t, clmfile, idsfile)
+	if _, ok := r.SpectralSigns(); ok {
+		t.Error("expected the decomposition to be reported as degenerate")
+	}
+	if got := string(r.GreedySigns()); got != "+-++" {
+		t.Errorf("GreedySigns() = %q, want %q", got, "+-++")
+	}
+}
+
+// writeOrientedChain writes a chain of contigs with the given orientations,
+// where the links of the nearby pairs sit at the ends that face in the
+// orientation that the signs imply, so that each flipped contig adds about
+// 8kb
+func writeOrientedChain(signs string) (clmfile, idsfile string) {
+	var contigs []clmContig
+	for i := range signs {
+		contigs = append(contigs, clmContig{fmt.Sprintf("t%d", i), 10000})
+	}
+	var pairs []clmPair
+	for i := range signs {
+		for j := i + 1; j < len(signs) && j <= i+3; j++ {
+			pair := clmPair{a: fmt.Sprintf("t%d", i), b: fmt.Sprintf("t%d", j)}
+			for k := 0; k < 24/(j-i); k++ {
+				x, y := 9000-100*k, 1000
+				if signs[i] == '-' {
+					x = 1000 + 100*k
+				}
+				if signs[j] == '-' {
+					y = 9000
+				}
+				pair.links = append(pair.links, clmLink{x, y})
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	idsfile, clmfile = writeCLMFixture(".", "chain", contigs, pairs)
+	return
+}
+
+// TestOrientInit recovers the orientations of a chain in its true order, up
+// to flipping all of them, with both initializations
+func TestOrientInit(t *testing.T) {
+	inTempDir(t, func() {
+		truth := "+--+-++-+--+"
+		clmfile, idsfile := writeOrientedChain(truth)
+		tigs := make([]string, len(truth))
+		for i := range tigs {
+			tigs[i] = fmt.Sprintf("t%d+", i)
+		}
+		writeFiles(t, map[string]string{"chain.tour": strings.Join(tigs, " ") + "\n"})
+		flipped := strings.Map(func(r rune) rune { return '+' + '-' - r }, truth)
+		for _, init := range []string{allhic.OrientInitSpectral, allhic.OrientInitGreedy} {
+			r := mustNewCLM(t, clmfile, idsfile)
+			r.OrientInit = init
+			r.ActivateFromTour("chain.tour")
+			if tag := r.FlipAll(); tag != allhic.ACCEPT {
+				t.Errorf("%s: got %s, want the initial orientations accepted", init, tag)
+			}
+			if got := string(r.Signs); got != truth && got != flipped {
+				t.Errorf("%s: got signs %s, want %s or %s", init, got, truth, flipped)
+			}
+		}
+	})
+}
+
+// TestLanczosSigns finds the orientations of the dense decomposition of O
+// with the Lanczos iteration of large groups, up to flipping all of them
+func TestLanczosSigns(t *testing.T) {
+	inTempDir(t, func() {
+		rng := rand.New(rand.NewSource(7))
+		for _, n := range []int{12, 300} {
+			truth := make([]byte, n)
+			for i := range truth {
+				truth[i] = "+-"[rng.Intn(2)]
+			}
+			clmfile, idsfile := writeOrientedChain(string(truth))
+			r := mustNewCLM(t, clmfile, idsfile)
+			r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+			want, wantOK := r.SpectralSigns()
+			got, ok := r.LanczosSigns()
+			flipped := strings.Map(func(r rune) rune { return '+' + '-' - r }, string(want))
+			if ok != wantOK || string(got) != string(want) && string(got) != flipped {
+				t.Errorf("N=%d: got signs %s (%v), want %s (%v)", n, got, ok, want, wantOK)
+			}
+		}
+	})
+}
+
+// TestEvaluateQSparse scores the tour on the cells of Q as the dense
+// matrix did, in the same order, and each flip as the change of the score
+func TestEvaluateQSparse(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	r := mustNewCLM(t, clmfile, idsfile)
+	rng := allhic.NewRNGStreams(42).Stream(0)
+	r.Activate(false, rng)
+	Q := r.Q()
+	for round := 0; round < 3; round++ {
+		r.Tour.Shuffle(rng)
+		want, offset := 0.0, make([]int, r.Tour.Len())
+		for i := 1; i < len(offset); i++ {
+			offset[i] = offset[i-1] + r.Tour.Tigs[i-1].Size
+		}
+		for i, a := range r.Tour.Tigs {
+			for j := i + 1; j < len(offset); j++ {
+				dist := offset[j-1] - offset[i]
+				q := Q[a.Idx][r.Tour.Tigs[j].Idx]
+				if q == nil {
+					continue
+				}
+				if dist > allhic.LIMIT {
+					break
+				}
+				for k, center := range allhic.DefaultGoldenScale.Centers() {
+					want -= float64(q[k]) * math.Log(float64(center+dist))
+				}
+			}
+		}
+		score := r.EvaluateQ()
+		if score != want {
+			t.Errorf("round %d: EvaluateQ() = %v, want %v", round, score, want)
+		}
+		for i, tig := range r.Tour.Tigs[:20] {
+			sign := r.Signs[tig.Idx]
+			r.Signs[tig.Idx] = "+-"[strings.IndexByte("-+", sign)]
+			flipped := r.EvaluateQ() - score
+			r.Signs[tig.Idx] = sign
+			if delta := r.FlipDelta(i); math.Abs(delta-flipped) > 1e-9*math.Abs(score) {
+				t.Errorf("round %d, %s: flip delta %v, want %v", round, r.Tigs[tig.Idx].Name, delta, flipped)
+			}
+		}
+	}
+}
+
+// TestOrientationScores checks each delta against EvaluateQ of the whole
+// tour with the contig flipped
+func TestOrientationScores(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	r := mustNewCLM(t, clmfile, idsfile)
+	r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+	score := r.EvaluateQ()
+	scores := r.OrientationScores()
+	if len(scores) != r.Tour.Len() {
+		t.Fatalf("got %d scores for %d tigs", len(scores), r.Tour.Len())
+	}
+	for _, s := range scores[:20] {
+		r.Signs[s.Idx] = "+-"[strings.IndexByte("-+", s.Sign)]
+		want := score - r.EvaluateQ()
+		r.Signs[s.Idx] = s.Sign
+		if math.Abs(s.Delta-want) > 1e-6*math.Abs(score) {
+			t.Errorf("%s: got delta %v, want %v", s.Name, s.Delta, want)
+		}
+	}
+}
+
+func TestWriteOrientations(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{
+			"test.ids": "t0\t10\t5000\nt1\t10\t5000\nt2\t10\t5000\n",
+			// t0 and t1 are closest as t0+ t1+, and t1 is barely oriented
+			"test.clm": "t0+ t1+\t2\t1000 2000\nt0+ t1-\t2\t1500 2500\n" +
+				"t0- t1+\t2\t9000 10000\nt0- t1-\t2\t9500 10500\n",
+			"test.tour": "t0+ t1+ t2+\n",
+		})
+		r := mustNewCLM(t, "test.clm", "test.ids")
+		r.ActivateFromTour("test.tour")
+		r.WriteOrientations("test", 0.1)
+		s, err := ioutil.ReadFile("test.orientation.tsv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if len(rows) != 4 || rows[0]+"\n" != allhic.OrientationHeader {
+			t.Fatalf("expected a header and 3 rows, got %q", rows)
+		}
+		for i, want := range []string{allhic.OrientationOK, allhic.OrientationLow, allhic.OrientationNoData} {
+			fields := strings.Split(rows[i+1], "\t")
+			if fields[3] != want {
+				t.Errorf("got %q, want confidence %s", rows[i+1], want)
+			}
+		}
+		if want := "t2\t+\tNA\t" + allhic.OrientationNoData; rows[3] != want {
+			t.Errorf("got %q, want %q", rows[3], want)
+		}
+	})
+}
+
+// BenchmarkActivate activates a chain of 100k contigs with random strands,
+// whose dense O and Q would take over 100 GB
+func BenchmarkActivate(b *testing.B) {
+	nTigs := 100000
+	rng := rand.New(rand.NewSource(1))
+	contigs := make([]clmContig, nTigs)
+	signs := make([]byte, nTigs)
+	for i := range contigs {
+		contigs[i] = clmContig{fmt.Sprintf("tig%07d", i), 20000}
+		signs[i] = "+-"[rng.Intn(2)]
+	}
+	var pairs []clmPair
+	for i := 0; i < nTigs; i++ {
+		for j := i + 1; j < nTigs && j <= i+3; j++ {
+			// Near the facing ends of the contigs in their strands
+			x, y := 19000, 1000
+			if signs[i] == '-' {
+				x = 1000
+			}
+			if signs[j] == '-' {
+				y = 19000
+			}
+			pairs = append(pairs, clmPair{contigs[i].name, contigs[j].name,
+				[]clmLink{{x, y}, {x - 300, y + 200}, {x + 100, y - 400}}})
+		}
+	}
+	idsfile, clmfile := writeCLMFixture(b.TempDir(), "chain", contigs, pairs)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		r := mustNewCLM(b, clmfile, idsfile)
+		b.StartTimer()
+		r.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+	}
+}
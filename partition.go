@@ -27,18 +27,33 @@ type Partitioner struct {
 	matrix      [][]int64
 	longestRE   int
 	clusters    Clusters
-	// Output files
+	// mode of extract that wrote the Contigsfile, whose counts are the
+	// effective lengths in ModeOmniC
+	mode string
+	// Output files, named after OutPrefix, its directory created when
+	// missing; empty names the groups after the Contigsfile and the
+	// clusters after the PairsFile
+	OutPrefix  string
 	OutREfiles []string
 	// Parameters
 	MinREs              int
 	MaxLinkDensity      int
 	NonInformativeRatio int
+	// Contigs listed in Excludefile, e.g. the repeats from extract, are
+	// only recovered into clusters after clustering
+	Excludefile string
 }
 
 // Run is the main function body of partition
 func (r *Partitioner) Run() {
+	if r.OutPrefix != "" {
+		ErrorAbort(mkdirPrefix(r.OutPrefix))
+	}
 	r.readRE()
 	r.skipContigsWithFewREs()
+	if r.Excludefile != "" {
+		r.skipExcluded()
+	}
 	// if r.K == 1 {
 	// 	r.makeTrivialClusters()
 	// } else {
@@ -101,6 +116,19 @@ func (r *Partitioner) skipContigsWithFewREs() {
 		nShort, avgRE, avgLen, MinREs)
 }
 
+// skipExcluded skip contigs listed in the exclude file
+func (r *Partitioner) skipExcluded() {
+	excluded := readExcludeFile(r.Excludefile)
+	nExcluded := 0
+	for _, contig := range r.contigs {
+		if excluded[contig.name] {
+			contig.skip = true
+			nExcluded++
+		}
+	}
+	log.Noticef("Marked %d contigs listed in `%s`", nExcluded, r.Excludefile)
+}
+
 // skipRepeats skip contigs likely from repetitive regions. Contigs are repetitive if they have more links
 // compared to the average contig. This should be run after contig length normalization.
 func (r *Partitioner) skipRepeats() {
@@ -196,8 +224,13 @@ func (r *Partitioner) readRE() {
 	for i, contig := range r.contigs {
 		r.contigToIdx[contig.name] = i
 	}
-	log.Noticef("Loaded %d contig RE lengths for normalization from `%s`",
-		len(r.contigs), r.Contigsfile)
+	r.mode = readCountsMode(r.Contigsfile)
+	what := "RE lengths"
+	if r.mode == ModeOmniC {
+		what = "effective lengths"
+	}
+	log.Noticef("Loaded %d contig %s for normalization from `%s`",
+		len(r.contigs), what, r.Contigsfile)
 }
 
 // splitRE reads in a three-column tab-separated file
@@ -208,8 +241,12 @@ func (r *Partitioner) splitRE() {
 		for _, idx := range cl {
 			contigs = append(contigs, r.contigs[idx])
 		}
-		outfile := fmt.Sprintf("%s.%dg%d.txt", RemoveExt(r.Contigsfile), r.K, j+1)
-		writeRE(outfile, contigs)
+		prefix := r.OutPrefix
+		if prefix == "" {
+			prefix = RemoveExt(r.Contigsfile)
+		}
+		outfile := fmt.Sprintf("%s.%dg%d.txt", prefix, r.K, j+1)
+		writeRE(outfile, r.mode, contigs)
 		r.OutREfiles = append(r.OutREfiles, outfile)
 	}
 }
@@ -41,10 +41,10 @@ func (r *Plotter) Run() {
 func (r *Plotter) host() {
 	box := packr.NewBox("./templates")
 	port := 3000
-	f, _ := os.Create("index.html")
+	f := mustCreateAtomic("index.html")
 	s, _ := box.FindString("index.html")
 	_, _ = f.WriteString(s)
-	_ = f.Sync()
+	ErrorAbort(f.Close())
 
 	http.Handle("/", http.FileServer(http.Dir(".")))
 
@@ -57,5 +57,4 @@ func (r *Plotter) host() {
 			break
 		}
 	}
-	_ = f.Close()
 }
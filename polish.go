@@ -0,0 +1,102 @@
+/*
+ *  polish.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math"
+)
+
+// polisher climbs the score of a tour by single moves, see Polish
+type polisher struct {
+	tour   Tour
+	joint  bool
+	budget int // Moves left to try
+	moves  int // Moves kept
+}
+
+// Polish refines the tour after the GA by hill climbing. It reverses the
+// segments of up to window tigs (2-opt) and moves single tigs up to window
+// positions away, and keeps each move that improves the score, until none
+// does or budget moves were tried. The moves update the score as in Mutate,
+// see deltaScore. It returns the scores before and after, and the moves kept.
+func (r *CLM) Polish(window, budget int) (before, after float64, moves int) {
+	tour := r.Tour.Clone().(Tour)
+	tour.delta = new(deltaScore)
+	p := &polisher{tour: tour, joint: tour.jointOrient(), budget: budget}
+	if p.joint {
+		r.carrySigns(tour)
+	}
+	before, _ = tour.Evaluate()
+	for improved := true; improved && p.budget > 0; {
+		improved = false
+		for i := 0; i < tour.Len() && p.budget > 0; i++ {
+			for j := i + 1; j <= i+window && j < tour.Len(); j++ {
+				if p.reverse(i, j) {
+					improved = true
+				}
+				if p.insert(i, j, false) {
+					improved = true
+				}
+				if p.insert(i, j, true) {
+					improved = true
+				}
+			}
+		}
+	}
+	tour.delta = nil
+	after = tour.evaluate() // Rather than the sum of the changes
+	r.takeSigns(tour)
+	r.Tour = tour
+	return before, after, p.moves
+}
+
+// reverse tries to turn the tigs between p and q around, which flips them
+// when the tour carries the orientations
+func (r *polisher) reverse(p, q int) bool {
+	apply := func() {
+		invert(r.tour, p, q)
+		if r.joint {
+			r.tour.flipSigns(p, q)
+		}
+	}
+	return r.try(p, q, nil, nil, apply, apply)
+}
+
+// insert tries to move the tig at q to p when toFront, and otherwise the tig
+// at p to q
+func (r *polisher) insert(p, q int, toFront bool) bool {
+	from, to := p, q
+	if toFront {
+		from, to = q, p
+	}
+	return r.try(p, q, []int{from}, []int{to},
+		func() { insert(r.tour, p, q, toFront) },
+		func() { insert(r.tour, p, q, !toFront) })
+}
+
+// try applies a move between p and q, and takes it back unless it improves
+// the score by more than PolishMinGain. The positions moved are those taken
+// out of order by the move, and by taking it back.
+func (r *polisher) try(p, q int, moved, back []int, apply, undo func()) bool {
+	if r.budget <= 0 {
+		return false
+	}
+	r.budget--
+	tour := r.tour
+	before, _ := tour.Evaluate()
+	tour.move(p, q, moved, apply)
+	if after, _ := tour.Evaluate(); after < before-PolishMinGain*math.Abs(before) &&
+		tour.Pins.valid(tour.Tigs, p, q) {
+		r.moves++
+		return true
+	}
+	tour.move(p, q, back, undo)
+	tour.delta.score, tour.delta.ok = before, true // As before the move
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+ *  polish_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// shuffledCLM returns the simulated group with its tigs in random order
+func shuffledCLM(t *testing.T) *allhic.CLM {
+	idsfile, clmfile := simulationFiles(t)
+	clm := mustNewCLM(t, clmfile, idsfile)
+	clm.Activate(false, allhic.NewRNGStreams(42).Stream(0))
+	return clm
+}
+
+// tigIdxs returns the sorted indices of the tigs of the tour
+func tigIdxs(tour allhic.Tour) []int {
+	idxs := make([]int, tour.Len())
+	for i, tig := range tour.Tigs {
+		idxs[i] = tig.Idx
+	}
+	sort.Ints(idxs)
+	return idxs
+}
+
+// TestPolish climbs from a shuffled tour to a local optimum, which keeps the
+// tigs, improves the score and leaves no move to make
+func TestPolish(t *testing.T) {
+	clm := shuffledCLM(t)
+	want, _ := clm.Tour.Evaluate()
+	tigs := tigIdxs(clm.Tour)
+	before, after, moves := clm.Polish(allhic.PolishWindow, allhic.PolishBudget)
+	if math.Abs(before-want) > 1e-9*math.Abs(want) {
+		t.Errorf("score before %v, want %v", before, want)
+	}
+	if got, _ := clm.Tour.Evaluate(); after >= before || got != after || moves == 0 {
+		t.Errorf("polish from %v to %v (tour %v) in %d moves, want a better score",
+			before, after, got, moves)
+	}
+	if got := tigIdxs(clm.Tour); !reflect.DeepEqual(got, tigs) {
+		t.Errorf("polished tour has tigs %v, want %v", got, tigs)
+	}
+	if _, again, moves := clm.Polish(allhic.PolishWindow, allhic.PolishBudget); moves != 0 || again != after {
+		t.Errorf("polish again made %d moves to %v, want none", moves, again)
+	}
+}
+
+// TestPolishBudget stops the polish after the moves tried
+func TestPolishBudget(t *testing.T) {
+	clm := shuffledCLM(t)
+	if _, _, moves := clm.Polish(allhic.PolishWindow, 5); moves > 5 {
+		t.Errorf("polish kept %d moves out of 5 tried", moves)
+	}
+}
+
+// TestPolishJoint polishes a tour that carries the orientations, which go
+// back to the CLM
+func TestPolishJoint(t *testing.T) {
+	clm := shuffledCLM(t)
+	clm.Tour.Scorer = allhic.NewJointScorer(clm)
+	before, after, moves := clm.Polish(allhic.PolishWindow, allhic.PolishBudget)
+	if after >= before || moves == 0 {
+		t.Errorf("polish from %v to %v in %d moves, want a better score", before, after, moves)
+	}
+	for _, tig := range clm.Tour.Tigs {
+		if tig.Sign != 0 {
+			t.Fatalf("tig %d keeps its orientation in the tour", tig.Idx)
+		}
+	}
+	if got, _ := clm.Tour.Evaluate(); got != after {
+		t.Errorf("polished tour scores %v with the orientations of the CLM, want %v", got, after)
+	}
+}
+
+// TestOptimizeNoPolish writes the polished tour, unless asked not to
+func TestOptimizeNoPolish(t *testing.T) {
+	for _, noPolish := range []bool{false, true} {
+		opt := shortOptimizer(t, 42)
+		opt.NoPolish = noPolish
+		if got := strings.Contains(runOptimizer(t, opt), ">POLISH"); got == noPolish {
+			t.Errorf("noPolish=%t: POLISH tour written %t", noPolish, got)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ *  porec.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// PoreCReadsShown is the number of segments from which the Pore-C reads are
+// logged together
+const PoreCReadsShown = 10
+
+// poreCSegment is an aligned segment of a Pore-C read on the contig of the
+// index
+type poreCSegment struct {
+	contig, pos int
+	strand      byte
+}
+
+// PoreCContact is the pairwise contact of the segments I and J of a Pore-C
+// read, of the given Weight
+type PoreCContact struct {
+	I, J   int
+	Weight float64
+}
+
+// isPoreCBAM tells a BAM of Pore-C reads by the programs of its header, as
+// those of pore-c-py or of the wf-pore-c workflow
+func isPoreCBAM(h *sam.Header) bool {
+	for _, prog := range h.Progs() {
+		for _, s := range []string{prog.UID(), prog.Name(), prog.Command()} {
+			s = strings.ToLower(s)
+			if strings.Contains(s, "pore-c") || strings.Contains(s, "pore_c") || strings.Contains(s, "porec") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// poreCContacts decomposes a read of n segments into all their pairs, of
+// weight 2/(n-1) with downweight, so that the read weighs n, or 1 without
+func poreCContacts(n int, downweight bool) []PoreCContact {
+	weight := 1.0
+	if downweight && n > 1 {
+		weight = 2 / float64(n-1)
+	}
+	contacts := make([]PoreCContact, 0, n*(n-1)/2)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			contacts = append(contacts, PoreCContact{I: i, J: j, Weight: weight})
+		}
+	}
+	return contacts
+}
+
+// poreCLinks returns the number of links of each contact, in whole links
+// for the clm: each contact has the integer part of its weight, and those
+// first by a hash of the read name and the segments one more, up to the
+// weight of the read. The links are thus the weights on average, the same
+// from one run to the next.
+func poreCLinks(name []byte, contacts []PoreCContact) []int {
+	links := make([]int, len(contacts))
+	total := 0.0
+	for i, c := range contacts {
+		links[i] = int(c.Weight)
+		total += c.Weight
+	}
+	extra := int(total+0.5) - sumInts(links)
+	if extra <= 0 {
+		return links
+	}
+	keys := make([]uint64, len(contacts))
+	order := make([]int, len(contacts))
+	for i, c := range contacts {
+		h := fnv.New64a()
+		_, _ = h.Write(name)
+		_, _ = h.Write([]byte{byte(c.I), byte(c.I >> 8), byte(c.J), byte(c.J >> 8)})
+		keys[i], order[i] = h.Sum64(), i
+	}
+	sort.Slice(order, func(a, b int) bool { return keys[order[a]] < keys[order[b]] })
+	for _, i := range order[:extra] {
+		links[i]++
+	}
+	return links
+}
+
+// extractPoreC reads the segments of the Pore-C reads, the alignments of
+// the same name one after the other, and adds the links of all their
+// pairs, in both directions as the two mates of a read pair would
+func (r *Extracter) extractPoreC(bamfile string, agg *LinkAggregator, coverage *CoverageTrack) {
+	fh := mustOpen(bamfile)
+	defer fh.Close()
+
+	log.Noticef("Parse Pore-C bamfile `%s`", bamfile)
+	br, err := newBAMRecordReader(fh, r.Threads)
+	if err != nil {
+		ErrorAbort(fmt.Errorf("cannot open bamfile `%s` (%s)", bamfile, err))
+	}
+	if br.Header().SortOrder == sam.Coordinate {
+		ErrorAbort(fmt.Errorf("the Pore-C reads of `%s` are sorted by coordinate, group them by name", bamfile))
+	}
+	refToIdx := r.refTable(br, agg)
+	progress := NewProgress("Parse Pore-C bamfile", bamfile, func() int64 { return fileOffset(fh) })
+	add := agg.Add
+	if r.dedup != nil {
+		add = r.dedup.Add
+	}
+	var counts readCounts
+	var rec bamRecord
+	var name []byte
+	var segments []poreCSegment
+	started := false
+	for nrecords := 1; ; nrecords++ {
+		if progress.Tick() {
+			progress.Report(fmt.Sprintf("%d records", nrecords))
+		}
+		if err := br.Read(&rec); err != nil {
+			if err != io.EOF {
+				log.Error(err)
+			}
+			break
+		}
+		if !started || !bytes.Equal(rec.Name, name) {
+			if started {
+				r.addPoreCRead(name, segments, &counts, add)
+			}
+			started, name, segments = true, append(name[:0], rec.Name...), segments[:0]
+		}
+		if segment, ok := r.segmentOf(&rec, refToIdx, coverage, &counts); ok {
+			segments = append(segments, segment)
+		}
+	}
+	if started {
+		r.addPoreCRead(name, segments, &counts, add)
+	}
+	_ = br.Close()
+	r.Skipped.add(counts.skipped)
+	r.SkippedMapq += counts.skippedMapq
+	r.SkippedContigs += counts.skippedContigs
+	r.BamStats = append(r.BamStats, BamStats{Bamfile: bamfile, Reads: counts.reads, Used: counts.used})
+}
+
+// segmentOf filters an alignment of a Pore-C read as linkOf does a read of
+// a pair, the supplementary ones being the other segments, and counts it
+// along its contig
+func (r *Extracter) segmentOf(rec *bamRecord, refToIdx []int, coverage *CoverageTrack,
+	counts *readCounts) (poreCSegment, bool) {
+	counts.reads++
+	if r.skip(rec, &counts.skipped) {
+		return poreCSegment{}, false
+	}
+	if r.MinMapq > 0 && int(rec.MapQ) < r.MinMapq {
+		counts.skippedMapq++
+		return poreCSegment{}, false
+	}
+	ai := refIndex(refToIdx, rec.RefID)
+	if ai == refExcluded {
+		counts.skippedContigs++
+		return poreCSegment{}, false
+	}
+	if ai < 0 {
+		return poreCSegment{}, false
+	}
+	coverage.Add(ai, int(rec.Pos))
+	return poreCSegment{contig: ai, pos: int(rec.Pos), strand: flagStrand(rec.Flags, 0x10)}, true
+}
+
+// addPoreCRead counts the read by its segments and adds the links of their
+// pairs
+func (r *Extracter) addPoreCRead(name []byte, segments []poreCSegment, counts *readCounts,
+	add func(LinkRecord)) {
+	n := len(segments)
+	for len(r.PoreCReads) <= n {
+		r.PoreCReads = append(r.PoreCReads, 0)
+	}
+	r.PoreCReads[n]++
+	if n < 2 {
+		return
+	}
+	counts.used += n
+	contacts := poreCContacts(n, r.PoreCDownweight)
+	for i, links := range poreCLinks(name, contacts) {
+		a, b := segments[contacts[i].I], segments[contacts[i].J]
+		for k := 0; k < links; k++ {
+			add(LinkRecord{ContigA: a.contig, PosA: a.pos, StrandA: a.strand,
+				ContigB: b.contig, PosB: b.pos, StrandB: b.strand})
+			add(LinkRecord{ContigA: b.contig, PosA: b.pos, StrandA: b.strand,
+				ContigB: a.contig, PosB: a.pos, StrandB: a.strand})
+		}
+	}
+}
+
+// logPoreCReads logs the Pore-C reads by their segments, those of
+// PoreCReadsShown or more together
+func (r *Extracter) logPoreCReads() {
+	var parts []string
+	over := 0
+	for n, reads := range r.PoreCReads {
+		switch {
+		case n >= PoreCReadsShown:
+			over += reads
+		case reads > 0:
+			parts = append(parts, fmt.Sprintf("%d: %d", n, reads))
+		}
+	}
+	if over > 0 {
+		parts = append(parts, fmt.Sprintf("%d+: %d", PoreCReadsShown, over))
+	}
+	log.Noticef("Pore-C reads by their aligned segments: %s", strings.Join(parts, ", "))
+}
@@ -0,0 +1,125 @@
+/*
+ *  progress.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ProgressInterval is the least time between two progress reports
+const ProgressInterval = 5 * time.Second
+
+// progressCheckEvery is how many ticks pass between two looks at the clock,
+// so that a tick is only a counter increment
+const progressCheckEvery = 1 << 16
+
+// Progress logs how far a long read of a file has got, along with an ETA
+// from the offset in the file against its size. The reports are at the
+// INFO level, which --quiet hides.
+type Progress struct {
+	what     string
+	size     int64        // Size of the file, 0 if unknown
+	offset   func() int64 // Bytes of the file read so far
+	interval time.Duration
+	ticks    int
+	start    time.Time
+	next     time.Time
+}
+
+// NewProgress starts timing the read of filename, which is at offset()
+func NewProgress(what, filename string, offset func() int64) *Progress {
+	var size int64
+	if fi, err := os.Stat(filename); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	return newProgress(what, size, offset, ProgressInterval)
+}
+
+// newProgress starts timing the read of size bytes
+func newProgress(what string, size int64, offset func() int64, interval time.Duration) *Progress {
+	now := time.Now()
+	return &Progress{what: what, size: size, offset: offset, interval: interval,
+		start: now, next: now.Add(interval)}
+}
+
+// Tick counts one record, and returns true when a report is due
+func (p *Progress) Tick() bool {
+	p.ticks++
+	if p.ticks%progressCheckEvery != 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Before(p.next) {
+		return false
+	}
+	p.next = now.Add(p.interval)
+	return true
+}
+
+// Report logs counts, e.g. "1000000 lines, 5000 pairs", with the progress
+func (p *Progress) Report(counts string) {
+	log.Info(p.message(counts, time.Now()))
+}
+
+// message formats the report at time now
+func (p *Progress) message(counts string, now time.Time) string {
+	elapsed := now.Sub(p.start)
+	msg := fmt.Sprintf("%s: %s in %s", p.what, counts, elapsed.Round(time.Second))
+	offset := int64(-1)
+	if p.offset != nil {
+		offset = p.offset()
+	}
+	if p.size <= 0 || offset <= 0 {
+		return msg
+	}
+	done := float64(offset) / float64(p.size)
+	if done > 1 {
+		done = 1
+	}
+	eta := time.Duration(float64(elapsed) * (1 - done) / done)
+	return fmt.Sprintf("%s (%.1f%% of %s, ETA %s)", msg, done*100,
+		humanizeBytes(p.size), eta.Round(time.Second))
+}
+
+// humanizeBytes formats a number of bytes with a binary unit
+func humanizeBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// fileOffset returns how many bytes of the file under r, as returned by
+// openReader or os.Open, were consumed, or -1 if unknown
+func fileOffset(r io.Reader) int64 {
+	switch f := r.(type) {
+	case *bufferedFile:
+		if pos, err := f.f.Seek(0, io.SeekCurrent); err == nil {
+			return pos - int64(f.Reader.Buffered())
+		}
+	case *gzipFile:
+		if pos, err := f.f.Seek(0, io.SeekCurrent); err == nil {
+			return pos
+		}
+	case *os.File:
+		if pos, err := f.Seek(0, io.SeekCurrent); err == nil {
+			return pos
+		}
+	}
+	return -1
+}
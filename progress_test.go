@@ -0,0 +1,65 @@
+/*
+ *  progress_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"bufio"
+	"testing"
+	"time"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestProgressTick(t *testing.T) {
+	p := allhic.NewProgressOfSize(100, nil, 0)
+	due := 0
+	for i := 0; i < 1<<17; i++ {
+		if p.Tick() {
+			due++
+		}
+	}
+	// The clock is only read every 65536 ticks
+	if due != 2 {
+		t.Errorf("got %d reports due, want 2", due)
+	}
+	if p := allhic.NewProgressOfSize(100, nil, time.Hour); p.Tick() {
+		t.Error("report due before the interval")
+	}
+}
+
+func TestProgressMessage(t *testing.T) {
+	offset := int64(0)
+	p := allhic.NewProgressOfSize(4<<30, func() int64 { return offset }, time.Second)
+	offset = 1 << 30
+	want := "Parse: 10 lines in 1m0s (25.0% of 4.0 GiB, ETA 3m0s)"
+	if got := p.Message("10 lines", time.Minute); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	offset = -1
+	if got := p.Message("10 lines", time.Minute); got != "Parse: 10 lines in 1m0s" {
+		t.Errorf("got %q without an offset", got)
+	}
+}
+
+func TestFileOffset(t *testing.T) {
+	inTempDir(t, func() {
+		writeFiles(t, map[string]string{"test.clm": "t0+ t1+\t1\t100\nt0+ t1-\t1\t200\n"})
+		f, err := allhic.OpenReader("test.clm")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := bufio.NewReader(f).ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		if got := allhic.FileOffset(f); got != 28 {
+			t.Errorf("got offset %d after reading the file, want 28", got)
+		}
+	})
+}
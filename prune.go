@@ -13,7 +13,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 
 	hungarianAlgorithm "github.com/oddg/hungarian-algorithm"
@@ -21,8 +20,11 @@ import (
 
 // Pruner processes the pruning step
 type Pruner struct {
-	AllelesFile  string
-	PairsFile    string
+	AllelesFile string
+	PairsFile   string
+	// OutPrefix names the pruned pairs <OutPrefix>.prune.txt, its directory
+	// created when missing; empty uses the PairsFile without .txt
+	OutPrefix    string
 	edges        []ContigPair
 	alleleGroups []AlleleGroup
 }
@@ -53,7 +55,12 @@ func (r *Pruner) Run() {
 	r.pruneAllelic()
 	r.pruneCrossAllelicBipartiteMatching()
 	// r.pruneCrossAllelic()
-	newPairsFile := RemoveExt(r.PairsFile) + ".prune.txt"
+	prefix := r.OutPrefix
+	if prefix == "" {
+		prefix = RemoveExt(r.PairsFile)
+	}
+	ErrorAbort(mkdirPrefix(prefix))
+	newPairsFile := prefix + ".prune.txt"
 	writePairsFile(newPairsFile, r.edges)
 }
 
@@ -389,14 +396,14 @@ func parseAllelesTable(allelesFile string) []AlleleGroup {
 
 // writePairsFile simply writes pruned contig pairs to file
 func writePairsFile(pairsFile string, edges []ContigPair) {
-	f, _ := os.Create(pairsFile)
+	f := mustCreateAtomic(pairsFile)
 	w := bufio.NewWriter(f)
 	_, _ = fmt.Fprintf(w, PairsFileHeader)
 
 	for _, c := range edges {
 		_, _ = fmt.Fprintln(w, c)
 	}
-	_ = w.Flush()
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
 	log.Noticef("Pruned contig pair analyses written to `%s`", pairsFile)
-	_ = f.Close()
 }
@@ -0,0 +1,114 @@
+/*
+ *  random.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"math/rand"
+)
+
+// golden64 is the Weyl sequence increment used by splitmix64
+const golden64 = 0x9E3779B97F4A7C15
+
+// splitMix64 is a small, fast rand.Source64 whose entire state is one uint64
+// See also: <http://xoshiro.di.unimi.it/splitmix64.c>
+type splitMix64 struct {
+	state uint64
+}
+
+// mix64 is the splitmix64 finalizer, which scrambles the bits of z
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// Uint64 returns the next pseudo-random 64-bit value
+func (r *splitMix64) Uint64() uint64 {
+	r.state += golden64
+	return mix64(r.state)
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer
+func (r *splitMix64) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// Seed resets the state of the source
+func (r *splitMix64) Seed(seed int64) {
+	r.state = uint64(seed)
+}
+
+// replaySource is a math/rand source that counts its draws, so that its
+// state is the seed and the count, and can be replayed
+type replaySource struct {
+	src   rand.Source64
+	seed  int64
+	draws uint64
+}
+
+// newReplaySource returns the source seeded with seed, after draws draws
+func newReplaySource(seed int64, draws uint64) *replaySource {
+	r := &replaySource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+	for r.draws < draws {
+		r.Int63()
+	}
+	return r
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer
+func (r *replaySource) Int63() int64 {
+	r.draws++
+	return r.src.Int63()
+}
+
+// Uint64 returns a pseudo-random 64-bit value
+func (r *replaySource) Uint64() uint64 {
+	r.draws++
+	return r.src.Uint64()
+}
+
+// Seed resets the source
+func (r *replaySource) Seed(seed int64) {
+	r.src.Seed(seed)
+	r.seed, r.draws = seed, 0
+}
+
+// RNGStreams derives independent, reproducible random streams from a single
+// master seed. Each goroutine that draws random numbers should own its own
+// stream so that it neither contends on the global rand lock nor depends on
+// the scheduling order of the other goroutines.
+type RNGStreams struct {
+	Seed int64
+}
+
+// NewRNGStreams is the constructor for RNGStreams
+func NewRNGStreams(seed int64) RNGStreams {
+	return RNGStreams{Seed: seed}
+}
+
+// Stream returns the i-th random stream, the same (seed, i) always yields the
+// same sequence
+func (r RNGStreams) Stream(i int) *rand.Rand {
+	return rand.New(r.source(i))
+}
+
+// source returns the source of the i-th random stream, whose state can be
+// saved and restored
+func (r RNGStreams) source(i int) *splitMix64 {
+	return &splitMix64{state: mix64(uint64(r.Seed)*golden64 + mix64(uint64(i)+1))}
+}
+
+// Streams returns n independent random streams, one per worker
+func (r RNGStreams) Streams(n int) []*rand.Rand {
+	rngs := make([]*rand.Rand, n)
+	for i := range rngs {
+		rngs[i] = r.Stream(i)
+	}
+	return rngs
+}
@@ -0,0 +1,48 @@
+/*
+ *  random_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+func TestRNGStreamsReproducible(t *testing.T) {
+	streams := allhic.NewRNGStreams(42)
+	workers := 8
+	draws := make([][]int64, workers)
+	var wg sync.WaitGroup
+	for i, rng := range streams.Streams(workers) {
+		wg.Add(1)
+		go func(i int, rng *rand.Rand) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				draws[i] = append(draws[i], rng.Int63())
+			}
+		}(i, rng)
+	}
+	wg.Wait()
+
+	seen := map[int64]int{}
+	for i := 0; i < workers; i++ {
+		rng := streams.Stream(i)
+		for j := 0; j < 1000; j++ {
+			if got := rng.Int63(); got != draws[i][j] {
+				t.Fatalf("Stream %d draw %d: expected %d, got %d", i, j, draws[i][j], got)
+			}
+		}
+		if w, ok := seen[draws[i][0]]; ok {
+			t.Fatalf("Streams %d and %d start with the same value", w, i)
+		}
+		seen[draws[i][0]] = i
+	}
+}
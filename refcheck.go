@@ -0,0 +1,162 @@
+/*
+ *  refcheck.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// refCheckExamples is how many names are listed for each kind of problem
+const refCheckExamples = 5
+
+// RefCheck compares the sequences in a BAM header with the companion input
+// of a command, so that a BAM aligned to another version of the contigs is
+// caught before the long computation rather than silently losing data
+type RefCheck struct {
+	MinOverlap float64 // Smallest fraction of sequences that must match
+	Force      bool    // Report the problems but do not abort
+}
+
+// Sizes checks the header against the exact sequence lengths from source.
+// The overlap is over the larger of the two sets of names.
+func (r RefCheck) Sizes(refs []*sam.Reference, sizes map[string]int, source string) {
+	total := max(len(refs), len(sizes))
+	r.compare(refs, sizes, source, total, func(refLen, size int) bool {
+		return refLen == size
+	})
+}
+
+// Extents checks the header against the extents of the features in source,
+// which must fit in the sequences. The overlap is over the names in source.
+func (r RefCheck) Extents(refs []*sam.Reference, extents map[string]int, source string) {
+	r.compare(refs, extents, source, len(extents), func(refLen, end int) bool {
+		return end <= refLen
+	})
+}
+
+// compare reports the names on one side only and the length mismatches,
+// then aborts unless enough sequences match on both sides
+func (r RefCheck) compare(refs []*sam.Reference, sizes map[string]int, source string,
+	total int, lengthOK func(refLen, size int) bool) {
+	var bamOnly, sourceOnly, mismatches []string
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		name := ref.Name()
+		seen[name] = true
+		size, ok := sizes[name]
+		if !ok {
+			bamOnly = append(bamOnly, name)
+			continue
+		}
+		if !lengthOK(ref.Len(), size) {
+			mismatches = append(mismatches,
+				fmt.Sprintf("%s (bam: %d, %s: %d)", name, ref.Len(), source, size))
+		}
+	}
+	for name := range sizes {
+		if !seen[name] {
+			sourceOnly = append(sourceOnly, name)
+		}
+	}
+	sort.Strings(sourceOnly)
+
+	matched := len(sizes) - len(sourceOnly) - len(mismatches)
+	overlap := 1.0
+	if total > 0 {
+		overlap = float64(matched) / float64(total)
+	}
+	if len(bamOnly) == 0 && len(sourceOnly) == 0 && len(mismatches) == 0 {
+		log.Noticef("All %d sequences match between the bam header and `%s`", matched, source)
+		return
+	}
+	reportRefs(bamOnly, "only in the bam header")
+	reportRefs(sourceOnly, "only in `"+source+"`")
+	reportRefs(mismatches, "with different lengths")
+	log.Warningf("%d of %d sequences (%.1f%%) match between the bam header and `%s`",
+		matched, total, overlap*100, source)
+	if overlap >= r.MinOverlap {
+		return
+	}
+	err := fmt.Errorf("only %.1f%% of the sequences match `%s` (minimum %.1f%%), was the bam aligned to other contigs?",
+		overlap*100, source, r.MinOverlap*100)
+	if r.Force {
+		log.Warningf("%s Continue anyway (--force)", err)
+		return
+	}
+	ErrorAbort(err)
+}
+
+// reportRefs logs the count and the first few of a list of problems
+func reportRefs(names []string, what string) {
+	if len(names) == 0 {
+		return
+	}
+	examples := names
+	if len(examples) > refCheckExamples {
+		examples = examples[:refCheckExamples]
+	}
+	suffix := ""
+	if len(names) > len(examples) {
+		suffix = ", ..."
+	}
+	log.Warningf("%d sequences %s, e.g. %s%s", len(names), what,
+		strings.Join(examples, ", "), suffix)
+}
+
+// readBAMRefs reads the sequences in the header of the bamfile
+func readBAMRefs(bamfile string) []*sam.Reference {
+	return readBAMHeader(bamfile).Refs()
+}
+
+// readBAMHeader reads the header of the bamfile
+func readBAMHeader(bamfile string) *sam.Header {
+	fh := mustOpen(bamfile)
+	defer fh.Close()
+	br, err := newBAMRecordReader(fh, 0)
+	if err != nil {
+		ErrorAbort(fmt.Errorf("cannot read the header of `%s` (%s)", bamfile, err))
+	}
+	h := br.Header()
+	_ = br.Close()
+	return h
+}
+
+// readSizes reads the sequence lengths from the first two columns of a
+// samtools index or an ids file, if there is one
+func readSizes(filename string) (map[string]int, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	sizes := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) < 2 || words[0][0] == '#' {
+			continue
+		}
+		size, err := strconv.Atoi(words[1])
+		if err != nil {
+			return nil, false
+		}
+		sizes[words[0]] = size
+	}
+	if scanner.Err() != nil {
+		return nil, false
+	}
+	return sizes, true
+}
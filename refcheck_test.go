@@ -0,0 +1,65 @@
+/*
+ *  refcheck_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/14/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/biogo/hts/sam"
+	"github.com/tanghaibao/allhic"
+)
+
+func makeRefs(t *testing.T, sizes map[string]int) []*sam.Reference {
+	var refs []*sam.Reference
+	for _, name := range []string{"tig1", "tig2", "tig3", "tig4"} {
+		size, ok := sizes[name]
+		if !ok {
+			continue
+		}
+		ref, err := sam.NewReference(name, "", "", size, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// TestRefCheck runs the checks that must return rather than abort
+func TestRefCheck(t *testing.T) {
+	sizes := map[string]int{"tig1": 100, "tig2": 200, "tig3": 300}
+	refs := makeRefs(t, sizes)
+	allhic.RefCheck{MinOverlap: 1}.Sizes(refs, sizes, "same")
+
+	// 1 of 4 names match, below the minimum but forced
+	renamed := makeRefs(t, map[string]int{"tig1": 100, "tig2": 250, "tig4": 300})
+	allhic.RefCheck{MinOverlap: allhic.MinRefOverlap, Force: true}.Sizes(renamed, sizes, "renamed")
+
+	// Features only need to fit in the sequences
+	extents := map[string]int{"tig1": 90, "tig3": 300}
+	allhic.RefCheck{MinOverlap: 1}.Extents(refs, extents, "bed")
+}
+
+// TestReadSizes reads the sizes from an ids file and a missing file
+func TestReadSizes(t *testing.T) {
+	inTempDir(t, func() {
+		ids := "tig1\t100\n# comment\ntig2\t200\trecover\n"
+		if err := ioutil.WriteFile("genome.ids", []byte(ids), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sizes, ok := allhic.ReadSizes("genome.ids")
+		if !ok || len(sizes) != 2 || sizes["tig1"] != 100 || sizes["tig2"] != 200 {
+			t.Errorf("got %v, %v", sizes, ok)
+		}
+		if _, ok := allhic.ReadSizes("missing.ids"); ok {
+			t.Error("missing file read as sizes")
+		}
+	})
+}
@@ -0,0 +1,155 @@
+/*
+ *  restart.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// restartResult is the best tour of a restart of the GA, which carries the
+// orientations of its tigs, see carrySigns
+type restartResult struct {
+	seed  int64
+	tour  Tour
+	score float64
+}
+
+// restarts returns how many times the GA runs, 1 without Restarts
+func (r *Optimizer) restarts() int {
+	if r.Restarts > 1 {
+		return r.Restarts
+	}
+	return 1
+}
+
+// restartSeed returns the seed of the restart i, Seed for the first one,
+// whose GA is then the same as without restarts
+func (r *Optimizer) restartSeed(i int) int64 {
+	if i == 0 {
+		return r.Seed
+	}
+	return int64(mix64(uint64(r.Seed)+uint64(i)*golden64) >> 1)
+}
+
+// restartFile returns the tour file of the restart i
+func (r *Optimizer) restartFile(i int) string {
+	return fmt.Sprintf("%s.restart%d.tour", r.prefix(), i+1)
+}
+
+// restartsFile returns the TSV of the scores of the restarts
+func (r *Optimizer) restartsFile() string {
+	return r.prefix() + ".restarts.tsv"
+}
+
+// runRestarts runs the GA phases Restarts times, each from the tour of the
+// CLM with its own seed, and writes their tours to their own tour files.
+// The best tour of each restart goes into the tour file, and the best of
+// all ends on the CLM. The restarts picked up from the checkpoint carry on
+// from startPhase of the restart in progress.
+func (r *Optimizer) runRestarts(clm *CLM, fwtour *os.File, startPhase int) error {
+	start := clm.Tour.Clone().(Tour)
+	start.delta, start.counts = nil, nil
+	signs := make([]byte, len(clm.Signs))
+	copy(signs, clm.Signs)
+	first := 0
+	if state := r.checkpoint; state != nil {
+		first = state.Restart
+		for i, indi := range state.restarts {
+			r.restarted = append(r.restarted, restartResult{seed: r.restartSeed(i),
+				tour: indi.Genome.(Tour), score: indi.Fitness})
+		}
+	}
+	for i := 0; i < first; i++ {
+		done := r.restarted[i]
+		clm.printTour(fwtour, done.tour, fmt.Sprintf("RESTART%d", i+1), fmt.Sprintf("restartSeed=%d", done.seed))
+	}
+
+	for i := first; i < r.restarts() && !r.interrupted; i++ {
+		r.restart = i
+		seed := r.restartSeed(i)
+		log.Noticef("Restart %d of %d with seed %d", i+1, r.restarts(), seed)
+		clm.Tour = start.Clone().(Tour)
+		copy(clm.Signs, signs)
+		if i > 0 {
+			r.src = NewRNGStreams(seed).source(0)
+			r.rng = rand.New(r.src)
+		}
+		phase := 1
+		if i == first {
+			phase = startPhase
+		}
+		f, err := os.Create(r.restartFile(i))
+		if err != nil {
+			return fmt.Errorf("cannot create tour file %s: %s", r.restartFile(i), err)
+		}
+		err = r.runPhases(clm, f, phase)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if r.interrupted {
+			break
+		}
+		if !r.KeepRestarts {
+			_ = os.Remove(r.restartFile(i))
+		}
+		done := restartResult{seed: seed, tour: clm.Tour.Clone().(Tour)}
+		done.tour.delta = nil
+		clm.carrySigns(done.tour)
+		done.score, _ = done.tour.Evaluate()
+		r.restarted = append(r.restarted, done)
+		clm.printTour(fwtour, done.tour, fmt.Sprintf("RESTART%d", i+1), fmt.Sprintf("restartSeed=%d", seed))
+		log.Noticef("Restart %d of %d ends on the score %.5f", i+1, r.restarts(), -done.score)
+	}
+	if r.interrupted {
+		// The best tour so far, which may be that of a finished restart
+		current, _ := clm.Tour.Evaluate()
+		for _, done := range r.restarted {
+			if done.score < current {
+				current = done.score
+				clm.Tour = done.tour.Clone().(Tour)
+				clm.takeSigns(clm.Tour)
+			}
+		}
+		return nil
+	}
+
+	best := 0
+	for i, done := range r.restarted {
+		if done.score < r.restarted[best].score {
+			best = i
+		}
+	}
+	if err := r.writeRestarts(best); err != nil {
+		return err
+	}
+	log.Noticef("Restart %d of %d scores best, %.5f, scores written to `%s`",
+		best+1, r.restarts(), -r.restarted[best].score, r.restartsFile())
+	clm.Tour = r.restarted[best].tour.Clone().(Tour)
+	clm.takeSigns(clm.Tour)
+	return nil
+}
+
+// writeRestarts writes the seed and the score of each restart, and which
+// one scores best
+func (r *Optimizer) writeRestarts(best int) error {
+	f, err := CreateAtomic(r.restartsFile())
+	if err != nil {
+		return fmt.Errorf("cannot create restarts file %s: %s", r.restartsFile(), err)
+	}
+	_, _ = fmt.Fprintf(f, "#Restart\tSeed\tScore\tBest\n")
+	for i, done := range r.restarted {
+		_, _ = fmt.Fprintf(f, "%d\t%d\t%.5f\t%t\n", i+1, done.seed, -done.score, i == best)
+	}
+	return f.Close()
+}
@@ -0,0 +1,122 @@
+/*
+ *  restart_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestOptimizeRestarts runs the GA three times, keeps the tour file of each
+// restart, and goes on from the best one, which the seed reproduces
+func TestOptimizeRestarts(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.Restarts, opt.KeepRestarts = 3, true
+	var tours string
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile(opt.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tours = tourTimes.ReplaceAllString(string(s), "")
+		for _, f := range []string{"test.restart1.tour", "test.restart2.tour", "test.restart3.tour"} {
+			if _, err := os.Stat(f); err != nil {
+				t.Error(err)
+			}
+		}
+		s, err = ioutil.ReadFile("test.restarts.tsv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if len(rows) != 4 || rows[0] != "#Restart\tSeed\tScore\tBest" {
+			t.Fatalf("malformed restarts:\n%s", s)
+		}
+		seeds := make(map[string]bool)
+		max, best := 0.0, 0.0
+		for _, row := range rows[1:] {
+			fields := strings.Split(row, "\t")
+			seeds[fields[1]] = true
+			score, _ := strconv.ParseFloat(fields[2], 64)
+			if score > max {
+				max = score
+			}
+			if fields[3] == "true" {
+				best = score
+			}
+		}
+		if best != max {
+			t.Errorf("best restart scores %g, not the highest score %g", best, max)
+		}
+		if !seeds["42"] || len(seeds) != 3 {
+			t.Errorf("restarts do not have distinct seeds from 42:\n%s", s)
+		}
+	})
+	if !strings.Contains(tours, ">RESTART3") || !strings.Contains(tours, "restarts=3") {
+		t.Errorf("tours lack the restarts:\n%s", tours)
+	}
+	if runOptimizer(t, opt) != tours {
+		t.Error("two runs of 3 restarts with the same seed produced different tours")
+	}
+}
+
+// TestResumeRestarts halts a run in its second restart, and checks that
+// resuming it ends on the tour of the run that never stopped
+func TestResumeRestarts(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.Restarts, opt.CheckpointEvery = 3, 10
+	var want string
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		want = lastTour(t, opt)
+	})
+
+	halted, resumed := opt, opt
+	halted.HaltAfterRestartCheckpoint(1, 2)
+	resumed.ResumeCheckpoint = true
+	inTempDir(t, func() {
+		if err := halted.Run(); err == nil {
+			t.Fatal("run was not halted")
+		}
+		wrong := resumed
+		wrong.Restarts = 1
+		if err := wrong.Run(); err == nil || !strings.Contains(err.Error(), "but the run has 1 restarts") {
+			t.Errorf("got error %v, want a checkpoint of another number of restarts", err)
+		}
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := lastTour(t, resumed); got != want {
+			t.Errorf("resumed run ends on\n%s\nwant\n%s", got, want)
+		}
+	})
+}
+
+func TestOptimizeRestartsErrors(t *testing.T) {
+	for _, edit := range []func(*allhic.Optimizer){
+		func(r *allhic.Optimizer) { r.Restarts = -1 },
+		func(r *allhic.Optimizer) { r.Restarts, r.Method = 2, allhic.MethodSA },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		if err := opt.Run(); err == nil || !strings.Contains(err.Error(), "cannot restart") {
+			t.Errorf("got error %v, want the restarts rejected", err)
+		}
+	}
+}
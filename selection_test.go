@@ -0,0 +1,97 @@
+/*
+ *  selection_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MaxHalford/eaopt"
+	"github.com/tanghaibao/allhic"
+)
+
+// TestElites carries the best tours of a population over a generation where
+// every offspring mutates, and then mutates all the other tours, which must
+// leave the elites as they were
+func TestElites(t *testing.T) {
+	const elite = 2
+	tour, _ := syntheticTour(30)
+	rng := rand.New(rand.NewSource(1))
+	pop := eaopt.Population{RNG: rng}
+	for k := 0; k < 10; k++ {
+		c := tour.Clone().(allhic.Tour)
+		c.Shuffle(rng)
+		indi := eaopt.NewIndividual(c, rng)
+		if err := indi.Evaluate(); err != nil {
+			t.Fatal(err)
+		}
+		pop.Individuals = append(pop.Individuals, indi)
+	}
+	pop.Individuals.SortByFitness()
+	// The tours before the generation, and copies of their best
+	parents := append(eaopt.Individuals(nil), pop.Individuals...)
+	best := parents[:elite].Clone(rng)
+	if err := allhic.EvolvePopulation(&pop, 1, elite); err != nil {
+		t.Fatal(err)
+	}
+	n := len(pop.Individuals)
+	for _, indi := range append(parents, pop.Individuals[:n-elite]...) {
+		for k := 0; k < 10; k++ {
+			indi.Genome.Mutate(rng)
+		}
+	}
+	for k, indi := range pop.Individuals[n-elite:] {
+		got, want := indi.Genome.(allhic.Tour).Tigs, best[k].Genome.(allhic.Tour).Tigs
+		if !reflect.DeepEqual(got, want) || indi.Fitness != best[k].Fitness {
+			t.Errorf("elite %d changed with the other tours", k)
+		}
+		if score, _ := indi.Genome.Evaluate(); score != indi.Fitness {
+			t.Errorf("elite %d scores %g, but its fitness is %g", k, score, indi.Fitness)
+		}
+	}
+}
+
+// TestOptimizeSelection checks that the default selection and elitism are
+// those of the GA so far, and that the others are labelled in the tours
+func TestOptimizeSelection(t *testing.T) {
+	explicit := shortOptimizer(t, 42)
+	explicit.Selection, explicit.TournamentSize, explicit.Elite = allhic.SelectionTournament, allhic.TournamentSize, 0
+	if runOptimizer(t, explicit) != runOptimizer(t, shortOptimizer(t, 42)) {
+		t.Error("the default selection differs from the GA so far")
+	}
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"selection=roulette": func(r *allhic.Optimizer) { r.Selection = allhic.SelectionRoulette },
+		"tournament=5":       func(r *allhic.Optimizer) { r.TournamentSize = 5 },
+		"elite=2":            func(r *allhic.Optimizer) { r.Elite = 2 },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		if tours := runOptimizer(t, opt); !strings.Contains(tours, want) {
+			t.Errorf("tours lack %q:\n%s", want, tours)
+		}
+	}
+}
+
+func TestOptimizeSelectionErrors(t *testing.T) {
+	for want, edit := range map[string]func(*allhic.Optimizer){
+		"unknown selection":        func(r *allhic.Optimizer) { r.Selection = "rank" },
+		"tournaments of 1 tours":   func(r *allhic.Optimizer) { r.TournamentSize = 1 },
+		"tournaments of 20 tours":  func(r *allhic.Optimizer) { r.TournamentSize = 20 },
+		"keep 20 elites out of 20": func(r *allhic.Optimizer) { r.Elite = 20 },
+		"keep -1 elites":           func(r *allhic.Optimizer) { r.Elite = -1 },
+	} {
+		opt := shortOptimizer(t, 42)
+		edit(&opt)
+		if err := opt.Run(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ *  splitclm.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CLMSplitter writes one clm and ids file per group of contigs, keeping the
+// rows of the clmfile where both contigs are in the same group
+type CLMSplitter struct {
+	REfile     string
+	Clmfile    string
+	Groupsfile string
+	groups     []string       // Names of the groups, in file order
+	ctgToGroup map[string]int // Contig to its index in groups
+	// Output files
+	OutClmfiles []string
+	OutREfiles  []string
+}
+
+// Subset returns a CLM with only the named contigs, renumbered in the order
+// of names, and the contacts between them. The golden arrays are shared with
+// r. Names that are not in the ids file are skipped.
+func (r *CLM) Subset(names []string) *CLM {
+	p := newCLM()
+	p.REfile, p.Clmfile, p.opts, p.golden = r.REfile, r.Clmfile, r.opts, r.golden
+	p.MinContigSize, p.DensityLowerBound = r.MinContigSize, r.DensityLowerBound
+	p.OrientInit = r.OrientInit
+	newIdx := make(map[int]int, len(names))
+	for _, name := range names {
+		idx, ok := r.tigToIdx[name]
+		if !ok {
+			continue
+		}
+		if _, ok := newIdx[idx]; ok {
+			continue
+		}
+		newIdx[idx] = len(p.Tigs)
+		tig := r.Tigs[idx]
+		q := p.addTig(tig.Name, tig.Size)
+		q.Recovered, q.RECounts = tig.Recovered, tig.RECounts
+	}
+
+	for pair, c := range r.contacts {
+		ai, aok := newIdx[pair.a()]
+		bi, bok := newIdx[pair.b()]
+		if aok && bok {
+			p.contacts[newPair(ai, bi)] = c
+		}
+	}
+	gis := make(map[int32]int32)
+	for key, gi := range r.orientedContacts {
+		ai, aok := newIdx[key.a()]
+		bi, bok := newIdx[key.b()]
+		if !aok || !bok {
+			continue
+		}
+		ngi, ok := gis[gi]
+		if !ok {
+			ngi = int32(len(p.gdists))
+			gis[gi] = ngi
+			p.gdists = append(p.gdists, r.gdists[gi])
+		}
+		ao, bo := key.orientations()
+		p.orientedContacts[newOrientedPair(ai, bi, ao, bo)] = ngi
+	}
+	return p
+}
+
+// Run is the main function body of splitclm
+func (r *CLMSplitter) Run() {
+	r.readGroups()
+	prefix := RemoveExt(path.Base(strings.TrimSuffix(r.Clmfile, ".gz")))
+	for _, group := range r.groups {
+		r.OutClmfiles = append(r.OutClmfiles, fmt.Sprintf("%s.%s.clm", prefix, group))
+		r.OutREfiles = append(r.OutREfiles, fmt.Sprintf("%s.%s.ids", prefix, group))
+	}
+	missing := r.splitREfile()
+	r.splitClmfile()
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Warningf("%d contigs in `%s` are not in `%s`: %s", len(missing),
+			r.Groupsfile, r.REfile, strings.Join(missing, ","))
+	}
+	log.Notice("Success")
+}
+
+// readGroups parses the groups file, with one contig and its group per line
+// tig00015093     g1
+// tig00035238     g2
+func (r *CLMSplitter) readGroups() {
+	f, err := openReader(r.Groupsfile)
+	if err != nil {
+		ErrorAbort(openError("groups", r.Groupsfile, err))
+	}
+	defer f.Close()
+
+	groupIdx := make(map[string]int)
+	r.ctgToGroup = make(map[string]int)
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) < 2 {
+			ErrorAbort(fmt.Errorf("missing group at line %d of %s: %s",
+				lineno, r.Groupsfile, scanner.Text()))
+		}
+		gi, ok := groupIdx[words[1]]
+		if !ok {
+			gi = len(r.groups)
+			groupIdx[words[1]] = gi
+			r.groups = append(r.groups, words[1])
+		}
+		r.ctgToGroup[words[0]] = gi
+	}
+	ErrorAbort(scanner.Err())
+	log.Noticef("Loaded %d contigs in %d groups from `%s`",
+		len(r.ctgToGroup), len(r.groups), r.Groupsfile)
+}
+
+// splitREfile copies the lines of each group from the ids file, and returns
+// the contigs of the groups file that are not in the ids file
+func (r *CLMSplitter) splitREfile() (missing []string) {
+	f, err := openReader(r.REfile)
+	if err != nil {
+		ErrorAbort(openError("ids", r.REfile, err))
+	}
+	defer f.Close()
+
+	files, writers := r.createAll(r.OutREfiles)
+	seen := make(map[string]bool)
+	scanner := newLineScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if words[0][0] == '#' {
+			// Keep the header in every group
+			for _, w := range writers {
+				_, _ = fmt.Fprintln(w, line)
+			}
+			continue
+		}
+		if gi, ok := r.ctgToGroup[words[0]]; ok {
+			_, _ = fmt.Fprintln(writers[gi], line)
+			seen[words[0]] = true
+		}
+	}
+	ErrorAbort(scanner.Err())
+	r.closeAll(files, writers)
+
+	for contig := range r.ctgToGroup {
+		if !seen[contig] {
+			missing = append(missing, contig)
+		}
+	}
+	return
+}
+
+// splitClmfile copies the rows of the clmfile with both contigs in the same
+// group, unchanged so that all the link distances are kept
+func (r *CLMSplitter) splitClmfile() {
+	f, err := openReader(r.Clmfile)
+	if err != nil {
+		ErrorAbort(openError("clm", r.Clmfile, err))
+	}
+	defer f.Close()
+
+	files, writers := r.createAll(r.OutClmfiles)
+	rows := make([]int, len(r.groups))
+	err = scanClmRows(f, func(row, at, bt string) {
+		ai, aok := r.ctgToGroup[at]
+		bi, bok := r.ctgToGroup[bt]
+		if aok && bok && ai == bi {
+			_, _ = writers[ai].WriteString(row)
+			rows[ai]++
+		}
+	})
+	if err != nil {
+		ErrorAbort(fmt.Errorf("cannot read clm file %s: %s", r.Clmfile, err))
+	}
+	r.closeAll(files, writers)
+	for gi, group := range r.groups {
+		log.Noticef("Group %s: %d rows written to `%s`", group, rows[gi], r.OutClmfiles[gi])
+	}
+}
+
+// createAll creates one of the output files per group
+func (r *CLMSplitter) createAll(filenames []string) ([]*AtomicFile, []*bufio.Writer) {
+	files := make([]*AtomicFile, len(filenames))
+	writers := make([]*bufio.Writer, len(filenames))
+	for i, filename := range filenames {
+		files[i] = mustCreateAtomic(filename)
+		writers[i] = bufio.NewWriter(files[i])
+	}
+	return files, writers
+}
+
+// closeAll flushes and closes the output files
+func (r *CLMSplitter) closeAll(files []*AtomicFile, writers []*bufio.Writer) {
+	for i := range files {
+		ErrorAbort(writers[i].Flush())
+		ErrorAbort(files[i].Close())
+	}
+}
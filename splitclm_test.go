@@ -0,0 +1,63 @@
+/*
+ *  splitclm_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestSplitCLM splits the simulated group in two and checks that each split
+// pair of files parses to the same contigs and contacts as Subset
+func TestSplitCLM(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	full := mustNewCLM(t, clmfile, idsfile)
+	var groups strings.Builder
+	names := make([][]string, 2)
+	for i, tig := range full.Tigs {
+		g := i % 2
+		names[g] = append(names[g], tig.Name)
+		fmt.Fprintf(&groups, "%s\tg%d\n", tig.Name, g)
+	}
+	groups.WriteString("tigXXXX\tg0\n")
+
+	inTempDir(t, func() {
+		if err := ioutil.WriteFile("groups.txt", []byte(groups.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := allhic.CLMSplitter{REfile: idsfile, Clmfile: clmfile, Groupsfile: "groups.txt"}
+		p.Run()
+		if want := []string{"test.g0.clm", "test.g1.clm"}; !reflect.DeepEqual(p.OutClmfiles, want) {
+			t.Fatalf("got output files %v, want %v", p.OutClmfiles, want)
+		}
+		for g := range names {
+			split := mustNewCLM(t, p.OutClmfiles[g], p.OutREfiles[g])
+			subset := full.Subset(names[g])
+			if !reflect.DeepEqual(split.Tigs, subset.Tigs) {
+				t.Fatalf("group %d: tigs differ", g)
+			}
+			if !reflect.DeepEqual(split.M(), subset.M()) {
+				t.Errorf("group %d: contact matrices differ", g)
+			}
+			signs := make([]byte, len(split.Tigs))
+			for i := range signs {
+				signs[i] = "+-"[i%3%2]
+			}
+			split.Signs, subset.Signs = signs, signs
+			if !reflect.DeepEqual(split.Q(), subset.Q()) {
+				t.Errorf("group %d: golden arrays differ", g)
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+/*
+ *  starttour_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestActivateWithTour orders the active tigs as in the start tour, drops
+// its pruned, unknown and repeated tigs, and appends the missing ones
+func TestActivateWithTour(t *testing.T) {
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, 10, 3, 10)
+	tourfile := path.Join(dir, "start.tour")
+	start := ">map\ntig0000005- tig0000001+ tig0000003+ nope+ tig0000005+ tig0000008-\n"
+	if err := ioutil.WriteFile(tourfile, []byte(start), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clm := mustNewCLM(t, clmfile, idsfile)
+	clm.MinContigSize = 50002 // Prunes tig0000000 and tig0000001
+	clm.ActivateWithTour(tourfile)
+	var got []string
+	for _, tig := range clm.Tour.Tigs {
+		got = append(got, clm.Tigs[tig.Idx].Name)
+	}
+	want := []string{"tig0000005", "tig0000003", "tig0000008",
+		"tig0000002", "tig0000004", "tig0000006", "tig0000007", "tig0000009"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("start tour is %v, want %v", got, want)
+	}
+	if signs := string([]byte{clm.Signs[5], clm.Signs[3], clm.Signs[8]}); signs != "-+-" {
+		t.Errorf("start tour has signs %s, want -+-", signs)
+	}
+}
+
+// TestOptimizeStartTour starts the GA from the true order, which it keeps,
+// as it does not find it from a random order
+func TestOptimizeStartTour(t *testing.T) {
+	nTigs := 40
+	dir := t.TempDir()
+	idsfile, clmfile := writeSyntheticCLM(dir, nTigs, 3, 10)
+	truth := make([]string, nTigs)
+	for i := range truth {
+		truth[i] = fmt.Sprintf("tig%07d", i)
+	}
+	tourfile := path.Join(dir, "start.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(strings.Join(truth, "+ ")+"+\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true, Seed: 42,
+		NPop: 20, NGen: 50, MutProb: allhic.MutaProb, NoPolish: true, StartTour: tourfile,
+		Stdout: ioutil.Discard}
+	inTempDir(t, func() {
+		opt.OutPrefix = "synthetic"
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := finalOrder(t, opt.OutTourFile); !reflect.DeepEqual(got, truth) {
+			t.Errorf("GA from the true order ended on %v", got)
+		}
+	})
+
+	for name, edit := range map[string]func(*allhic.Optimizer){
+		"resumeCheckpoint": func(r *allhic.Optimizer) { r.ResumeCheckpoint = true },
+		"resume":           func(r *allhic.Optimizer) { r.ResumeFile = tourfile },
+		"startFraction":    func(r *allhic.Optimizer) { r.StartFraction = 1.5 },
+	} {
+		bad := opt
+		edit(&bad)
+		if err := bad.Run(); err == nil {
+			t.Errorf("start tour with %s accepted", name)
+		}
+	}
+
+	// A start tour that cannot be read fails the run, rather than the process
+	inTempDir(t, func() {
+		for name, edit := range map[string]func(*allhic.Optimizer){
+			"startTour":  func(r *allhic.Optimizer) { r.StartTour = path.Join(dir, "missing.tour") },
+			"resumeFile": func(r *allhic.Optimizer) { r.StartTour, r.ResumeFile = "", path.Join(dir, "missing.tour") },
+			"startFrom":  func(r *allhic.Optimizer) { r.StartTour, r.StartFrom = "", allhic.StageGA },
+		} {
+			bad := opt
+			bad.OutPrefix = "bad"
+			edit(&bad)
+			if err := bad.Run(); err == nil || !strings.Contains(err.Error(), "no such file") {
+				t.Errorf("%s: got error %v, want the missing file", name, err)
+			}
+		}
+	})
+}
+
+// TestOptimizeFixOrientation reorders the tigs of the start tour, and
+// writes them with their orientations, or all '+' without a start tour
+func TestOptimizeFixOrientation(t *testing.T) {
+	idsfile, clmfile := simulationFiles(t)
+	clm := shuffledCLM(t)
+	want := map[string]string{}
+	var atoms []string
+	for i, tig := range clm.Tour.Tigs {
+		name, sign := clm.Tigs[tig.Idx].Name, string("+-"[i%3%2])
+		want[name] = sign
+		atoms = append(atoms, name+sign)
+	}
+	tourfile := path.Join(t.TempDir(), "curated.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(strings.Join(atoms, " ")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, start := range []string{tourfile, ""} {
+		opt := shortOptimizer(t, 42)
+		opt.StartTour, opt.FixOrientation = start, true
+		tours := runOptimizer(t, opt)
+		if strings.Contains(tours, ">FLIP") {
+			t.Errorf("start tour %q: orientations flipped with fixed orientations", start)
+		}
+		lines := strings.Split(strings.TrimSpace(tours), "\n")
+		final := strings.Fields(lines[len(lines)-1])
+		for _, atom := range final {
+			name, sign := atom[:len(atom)-1], atom[len(atom)-1:]
+			if w := want[name]; start == "" && sign != "+" || start != "" && sign != w {
+				t.Errorf("start tour %q: %s has orientation %s", start, name, sign)
+			}
+		}
+		if start != "" && strings.Join(final, " ") == strings.Join(atoms, " ") {
+			t.Error("the order of the start tour is left as is")
+		}
+	}
+
+	opt := allhic.Optimizer{REfile: idsfile, Clmfile: clmfile, RunGA: true, FixOrientation: true,
+		JointOrient: true}
+	if err := opt.Run(); err == nil {
+		t.Error("fixed and joint orientations accepted together")
+	}
+}
+
+// TestOptimizeOrientOnly reorients the tigs of the start tour, in its
+// order, without the GA
+func TestOptimizeOrientOnly(t *testing.T) {
+	clm := shuffledCLM(t)
+	var atoms, names []string
+	for i, tig := range clm.Tour.Tigs {
+		name := clm.Tigs[tig.Idx].Name
+		atoms, names = append(atoms, name+string("+-"[i%2])), append(names, name)
+	}
+	tourfile := path.Join(t.TempDir(), "scaffold.tour")
+	if err := ioutil.WriteFile(tourfile, []byte(strings.Join(atoms, " ")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt := shortOptimizer(t, 42)
+	opt.StartTour, opt.OrientOnly = tourfile, true
+	tours := runOptimizer(t, opt)
+	if strings.Contains(tours, ">GA") || strings.Contains(tours, ">POLISH") || !strings.Contains(tours, ">FLIPALL") {
+		t.Errorf("tour file has the wrong stages:\n%s", tours)
+	}
+	lines := strings.Split(strings.TrimSpace(tours), "\n")
+	final := strings.Fields(lines[len(lines)-1])
+	flipped := 0
+	for i, atom := range final {
+		if name := atom[:len(atom)-1]; name != names[i] {
+			t.Fatalf("tig %d is %s, want %s of the start tour", i, name, names[i])
+		}
+		if atom != atoms[i] {
+			flipped++
+		}
+	}
+	if flipped == 0 {
+		t.Error("no tig reoriented from alternating orientations")
+	}
+
+	opt.StartTour = ""
+	if err := opt.Run(); err == nil {
+		t.Error("orient only without a start tour accepted")
+	}
+}
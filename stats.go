@@ -0,0 +1,109 @@
+/*
+ *  stats.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// Statser summarizes the contacts of each contig in a clmfile, to see which
+// contigs the pruning in optimize would drop and why
+type Statser struct {
+	REfile  string
+	Clmfile string
+	// MinContigSize and DensityLowerBound are the cutoffs of optimize
+	MinContigSize     int
+	DensityLowerBound float64
+	// Output files
+	OutStatsFile string
+}
+
+// ContigStat is the summary of the inter-contig links of one contig
+type ContigStat struct {
+	Idx         int
+	Name        string
+	Size        int
+	Partners    int     // Contigs with links to this one
+	Links       int     // Total inter-contig links
+	Density     float64 // Links per bp, as used by pruneByDensity
+	Recovered   bool
+	Inactivated bool // Dropped by the cutoffs before ordering
+}
+
+// Run is the main function body of stats
+func (r *Statser) Run() {
+	clm, err := NewCLM(r.Clmfile, r.REfile)
+	ErrorAbort(err)
+	clm.MinContigSize = r.MinContigSize
+	clm.DensityLowerBound = r.DensityLowerBound
+	stats := clm.ContigStats()
+
+	r.OutStatsFile = RemoveExt(r.Clmfile) + ".stats.txt"
+	writeContigStats(r.OutStatsFile, stats)
+	summarizeContigStats(stats)
+	log.Notice("Success")
+}
+
+// ContigStats returns the stats of every contig, in the order of the ids
+// file. The links are counted over all contigs, before any are inactivated
+// by MinContigSize and DensityLowerBound.
+func (r *CLM) ContigStats() []ContigStat {
+	active := make([]bool, len(r.Tigs))
+	for i, tig := range r.Tigs {
+		active[i] = tig.IsActive
+		tig.IsActive = true
+	}
+	links, partners := r.activeLinks()
+	r.pruneActive()
+
+	stats := make([]ContigStat, len(r.Tigs))
+	for i, tig := range r.Tigs {
+		stats[i] = ContigStat{Idx: tig.Idx, Name: tig.Name, Size: tig.Size,
+			Partners: partners[i], Links: links[i],
+			Density: linkDensity(links[i], tig.Size), Recovered: tig.Recovered,
+			Inactivated: !tig.IsActive}
+		tig.IsActive = active[i]
+	}
+	return stats
+}
+
+// writeContigStats writes one line per contig
+func writeContigStats(filename string, stats []ContigStat) {
+	f := mustCreateAtomic(filename)
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprint(w, StatsHeader)
+	for _, s := range stats {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.6g\t%t\t%t\n", s.Name, s.Idx,
+			s.Size, s.Partners, s.Links, s.Density, s.Recovered, s.Inactivated)
+	}
+	ErrorAbort(w.Flush())
+	ErrorAbort(f.Close())
+	log.Noticef("Write %d contigs to `%s`", len(stats), filename)
+}
+
+// summarizeContigStats logs the contigs left active and their median density
+func summarizeContigStats(stats []ContigStat) {
+	activeCounts, sumLength := 0, 0
+	var densities []float64
+	for _, s := range stats {
+		if s.Inactivated {
+			continue
+		}
+		activeCounts++
+		sumLength += s.Size
+		densities = append(densities, s.Density)
+	}
+	if activeCounts == 0 {
+		log.Warningf("No active contigs out of %d", len(stats))
+		return
+	}
+	log.Noticef("Active tigs: %d of %d (length=%d, median density=%.6g)",
+		activeCounts, len(stats), sumLength, median(densities))
+}
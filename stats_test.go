@@ -0,0 +1,72 @@
+/*
+ *  stats_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeStatsFiles writes three contigs, t2 only linked to t0 and short
+func writeStatsFiles(t *testing.T) {
+	ids := "#Contig\tRECounts\tLength\nt0\t10\t50000\nt1\t10\t50000\nt2\t10\t2000\trecover\n"
+	clm := "t0+ t1+\t4\t1000 2000 3000 4000\nt0- t2+\t3\t1000 2000 3000\n"
+	if err := ioutil.WriteFile("test.ids", []byte(ids), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("test.clm", []byte(clm), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContigStats(t *testing.T) {
+	inTempDir(t, func() {
+		writeStatsFiles(t)
+		r := mustNewCLM(t, "test.clm", "test.ids")
+		r.MinContigSize = 10000
+		got := r.ContigStats()
+		want := []allhic.ContigStat{
+			{Idx: 0, Name: "t0", Size: 50000, Partners: 2, Links: 7, Density: 7.0 / 50000},
+			{Idx: 1, Name: "t1", Size: 50000, Partners: 1, Links: 4, Density: 4.0 / 50000},
+			{Idx: 2, Name: "t2", Size: 2000, Partners: 1, Links: 3, Density: 3.0 / 2000,
+				Recovered: true, Inactivated: true},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		for _, tig := range r.Tigs {
+			if !tig.IsActive {
+				t.Errorf("tig %s left inactive by ContigStats", tig.Name)
+			}
+		}
+	})
+}
+
+func TestStatsRun(t *testing.T) {
+	inTempDir(t, func() {
+		writeStatsFiles(t)
+		p := allhic.Statser{REfile: "test.ids", Clmfile: "test.clm"}
+		p.Run()
+		s, err := ioutil.ReadFile(p.OutStatsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(s)), "\n")
+		if len(rows) != 4 || rows[0]+"\n" != allhic.StatsHeader {
+			t.Fatalf("expected a header and 3 rows, got %q", rows)
+		}
+		if want := "t2\t2\t2000\t1\t3\t0.0015\ttrue\tfalse"; rows[3] != want {
+			t.Errorf("got %q, want %q", rows[3], want)
+		}
+	})
+}
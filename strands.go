@@ -0,0 +1,148 @@
+/*
+ *  strands.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReadStrands reads the orientations known for some contigs, e.g. from long
+// reads, from a file of rows `contig +|-`. The orientation phases and the
+// GA with JointScorer never change them, see imposeStrands. The contigs not
+// in the ids file are skipped.
+func (r *CLM) ReadStrands(filename string) error {
+	f, err := openReader(filename)
+	if err != nil {
+		return openError("strands", filename, err)
+	}
+	defer f.Close()
+
+	strands := make([]byte, len(r.Tigs))
+	n := 0
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if len(words) != 2 || (words[1] != "+" && words[1] != "-") {
+			return fmt.Errorf("expected a contig and + or - at line %d of %s: %s",
+				lineno, filename, scanner.Text())
+		}
+		name := r.opts.Aliases.Name(words[0])
+		idx, ok := r.tigToIdx[name]
+		if !ok {
+			log.Warningf("Contig %s not found in `%s`, strand skipped", name, r.REfile)
+			continue
+		}
+		if strands[idx] != 0 && strands[idx] != words[1][0] {
+			return fmt.Errorf("contig %s has both strands in %s", name, filename)
+		}
+		if strands[idx] == 0 {
+			n++
+		}
+		strands[idx] = words[1][0]
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read strands file %s: %s", filename, err)
+	}
+	r.strands = strands
+	log.Noticef("Loaded the strands of %d contigs from `%s`", n, filename)
+	return nil
+}
+
+// fixedStrand tells whether the orientation of the tig is imposed
+func (r *CLM) fixedStrand(idx int) bool {
+	return r.strands != nil && r.strands[idx] != 0
+}
+
+// alignStrands turns the orientations in signs all around if that agrees
+// with more of the imposed strands, as the orientations from the links
+// alone are only known up to such a flip
+func (r *CLM) alignStrands(signs []byte) {
+	if r.strands == nil {
+		return
+	}
+	agree, disagree := 0, 0
+	for _, tig := range r.Tour.Tigs {
+		switch strand := r.strands[tig.Idx]; {
+		case strand == 0:
+		case signs[tig.Idx] == strand:
+			agree++
+		default:
+			disagree++
+		}
+	}
+	if disagree > agree {
+		for i, s := range signs {
+			signs[i] = rr(s)
+		}
+	}
+}
+
+// imposeStrands sets the imposed orientations in signs, and returns how
+// many it changed
+func (r *CLM) imposeStrands(signs []byte) int {
+	changed := 0
+	for idx, strand := range r.strands {
+		if strand != 0 && signs[idx] != strand {
+			signs[idx] = strand
+			changed++
+		}
+	}
+	return changed
+}
+
+// reportImposed sets the imposed strands over the orientations of a tour
+// read from a file, and logs how many it changed
+func (r *CLM) reportImposed() {
+	if n := r.imposeStrands(r.Signs); n > 0 {
+		log.Noticef("Set %d contigs of the tour to their imposed strands", n)
+	}
+}
+
+// StrandConflict is a contig whose imposed orientation the links disagree
+// with, and the score that flipping it alone would gain
+type StrandConflict struct {
+	Name    string
+	Sign    byte
+	Penalty float64
+}
+
+// StrandConflicts returns the contigs of the tour whose imposed orientation
+// scores lower than the other one, the largest penalty first
+func (r *CLM) StrandConflicts() []StrandConflict {
+	var conflicts []StrandConflict
+	for _, s := range r.OrientationScores() {
+		if r.fixedStrand(s.Idx) && !s.NoData && s.Delta < 0 {
+			conflicts = append(conflicts, StrandConflict{Name: s.Name, Sign: s.Sign, Penalty: -s.Delta})
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Penalty > conflicts[j].Penalty
+	})
+	return conflicts
+}
+
+// reportStrandConflicts warns about the imposed orientations that the links
+// disagree with
+func (r *CLM) reportStrandConflicts() {
+	conflicts := r.StrandConflicts()
+	if len(conflicts) == 0 {
+		return
+	}
+	rows := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		rows[i] = fmt.Sprintf("%s%c (penalty %.5f)", c.Name, c.Sign, c.Penalty)
+	}
+	log.Warningf("%d contigs have imposed strands that the links disagree with: %s",
+		len(conflicts), strings.Join(rows, ", "))
+}
@@ -0,0 +1,141 @@
+/*
+ *  strands_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// writeChainCLM writes four contigs tig0 to tig3 in a chain, where each one
+// has links[i] links to the next, half of them at the ends that face with
+// both contigs +, the others with both -, so that they are short when both
+// have the same orientation, along with the start tour tig0+ tig1+ tig2+
+// tig3+
+func writeChainCLM(t *testing.T, links [3]int) (idsfile, clmfile, tourfile string) {
+	dir := t.TempDir()
+	var contigs []clmContig
+	for i := 0; i < 4; i++ {
+		contigs = append(contigs, clmContig{fmt.Sprintf("tig%d", i), 30000})
+	}
+	var pairs []clmPair
+	for i, n := range links {
+		pair := clmPair{a: fmt.Sprintf("tig%d", i), b: fmt.Sprintf("tig%d", i+1)}
+		for l := 0; l < n; l++ {
+			if l%2 == 0 {
+				pair.links = append(pair.links, clmLink{27000, 3000 + l})
+			} else {
+				pair.links = append(pair.links, clmLink{3000 + l, 27000})
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+	idsfile, clmfile = writeCLMFixture(dir, "chain", contigs, pairs)
+	tourfile = path.Join(dir, "chain.tour")
+	if err := ioutil.WriteFile(tourfile, []byte("tig0+ tig1+ tig2+ tig3+\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// orientChain orients the chain from its start tour, with the strands
+func orientChain(t *testing.T, links [3]int, strands string) *allhic.CLM {
+	idsfile, clmfile, tourfile := writeChainCLM(t, links)
+	strandsfile := path.Join(path.Dir(idsfile), "strands.txt")
+	if err := ioutil.WriteFile(strandsfile, []byte(strands), 0644); err != nil {
+		t.Fatal(err)
+	}
+	clm := mustNewCLM(t, clmfile, idsfile)
+	clm.Stdout = ioutil.Discard
+	if err := clm.ReadStrands(strandsfile); err != nil {
+		t.Fatal(err)
+	}
+	clm.ActivateWithTour(tourfile)
+	fwtour, err := os.Create(path.Join(path.Dir(idsfile), "out.tour"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwtour.Close()
+	for phase := 1; ; phase++ {
+		if tag1, tag2 := clm.OptimizeOrientations(fwtour, phase); tag1 == allhic.REJECT && tag2 == allhic.REJECT {
+			break
+		}
+	}
+	return clm
+}
+
+// chainSigns returns the orientations of tig0 to tig3
+func chainSigns(clm *allhic.CLM) string {
+	return string(clm.Signs[:4])
+}
+
+// TestStrands forces tig1 to its other orientation, which its neighbors
+// follow, and then against that of tig0, which is reported
+func TestStrands(t *testing.T) {
+	clm := orientChain(t, [3]int{50, 50, 50}, "tig1 -\n")
+	if got := chainSigns(clm); got != "----" {
+		t.Errorf("orientations %s, want ---- around tig1-", got)
+	}
+	if conflicts := clm.StrandConflicts(); len(conflicts) != 0 {
+		t.Errorf("got conflicts %v, want none", conflicts)
+	}
+
+	clm = orientChain(t, [3]int{10, 50, 50}, "tig0 +\ntig1 -\n")
+	if got := chainSigns(clm); got != "+---" {
+		t.Errorf("orientations %s, want +---", got)
+	}
+	conflicts := clm.StrandConflicts()
+	if len(conflicts) != 1 || conflicts[0].Name != "tig0" || conflicts[0].Penalty <= 0 {
+		t.Errorf("got conflicts %v, want tig0 with a penalty", conflicts)
+	}
+}
+
+// TestStrandsJoint keeps the imposed strands through the moves of the GA
+// with JointScorer
+func TestStrandsJoint(t *testing.T) {
+	clm := orientChain(t, [3]int{50, 50, 50}, "tig1 -\n")
+	tour := clm.Tour.Clone().(allhic.Tour)
+	tour.Scorer = allhic.NewJointScorer(clm)
+	for i := range tour.Tigs {
+		tour.Tigs[i].Sign = clm.Signs[tour.Tigs[i].Idx]
+	}
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		tour.Mutate(rng)
+		for _, tig := range tour.Tigs {
+			if tig.Idx == 1 && tig.Sign != '-' {
+				t.Fatalf("move %d flipped the imposed strand of tig1", i)
+			}
+		}
+	}
+}
+
+func TestReadStrandsErrors(t *testing.T) {
+	idsfile, clmfile, _ := writeChainCLM(t, [3]int{1, 1, 1})
+	for want, rows := range map[string]string{
+		"expected a contig": "tig1 +-\n",
+		"both strands":      "tig1 +\ntig1 -\n",
+	} {
+		strandsfile := path.Join(path.Dir(idsfile), "strands.txt")
+		if err := ioutil.WriteFile(strandsfile, []byte(rows), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := mustNewCLM(t, clmfile, idsfile).ReadStrands(strandsfile)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ *  summary.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SummaryVersion is the schema_version of the summaries written. It goes up
+// when a field changes its meaning or goes away, not when one is added.
+const SummaryVersion = 1
+
+// OptimizeSummary is the outcome of a run of optimize, written to
+// <prefix>.summary.json for the pipelines, which need not parse the logs
+type OptimizeSummary struct {
+	SchemaVersion int               `json:"schema_version"`
+	Inputs        []SummaryInput    `json:"inputs"`
+	Parameters    SummaryParameters `json:"parameters"`
+	// The contigs in the final tour, and the others by why they were left
+	// out, e.g. PrunedDensity
+	ActiveContigs   int            `json:"active_contigs"`
+	InactiveContigs int            `json:"inactive_contigs"`
+	InactiveReasons map[string]int `json:"inactive_reasons"`
+	// Scores of the initial and the final tours, named as in the tour file
+	Score      string  `json:"score"`
+	StartScore float64 `json:"start_score"`
+	FinalScore float64 `json:"final_score"`
+	// Generations run by the GA over its phases, 0 without it
+	Generations int     `json:"generations"`
+	WallSeconds float64 `json:"wall_seconds"`
+	// Interrupted is set for a run stopped by its time limit or a signal
+	Interrupted bool `json:"interrupted"`
+}
+
+// ExtractSummary is the library QC of a run of extract, written to
+// <prefix>.summary.json as the rows of <prefix>.qc.tsv
+type ExtractSummary struct {
+	SchemaVersion int        `json:"schema_version"`
+	QC            []QCMetric `json:"qc"`
+	// Warnings are the metrics of the warn status
+	Warnings []string `json:"warnings"`
+}
+
+// SummaryInput is an input file of the run, with its size in bytes, -1 for
+// stdin
+type SummaryInput struct {
+	Role string `json:"role"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// SummaryParameters are the effective parameters of the run, after the
+// defaults are applied
+type SummaryParameters struct {
+	Method            string  `json:"method"`
+	Seed              int64   `json:"seed"`
+	NGen              int     `json:"ngen"`
+	NPop              int     `json:"npop"`
+	MutProb           float64 `json:"mutpb"`
+	CrossProb         float64 `json:"cxpb"`
+	Islands           int     `json:"islands"`
+	MinContigSize     int     `json:"min_size"`
+	DensityLowerBound float64 `json:"min_density"`
+	MinLinks          int     `json:"min_links"`
+	Normalize         string  `json:"normalize"`
+}
+
+// summarize collects the summary of the run, which ends on the tour of the
+// CLM, from the score of the initial tour
+func (r *Optimizer) summarize(clm *CLM, startScore float64) *OptimizeSummary {
+	score, _ := clm.Tour.Evaluate()
+	s := &OptimizeSummary{
+		SchemaVersion: SummaryVersion,
+		Parameters: SummaryParameters{
+			Method: r.method(), Seed: r.Seed, NGen: r.NGen, NPop: r.NPop,
+			MutProb: r.MutProb, CrossProb: r.crossProb(), Islands: r.islands(),
+			MinContigSize: r.MinContigSize, DensityLowerBound: r.DensityLowerBound,
+			MinLinks: r.MinLinks, Normalize: r.Normalize,
+		},
+		InactiveReasons: make(map[string]int),
+		Score:           clm.Tour.ScoreName(),
+		StartScore:      -startScore,
+		FinalScore:      -score,
+		Generations:     r.generations,
+		WallSeconds:     time.Since(r.start).Seconds(),
+		Interrupted:     r.interrupted,
+	}
+	if s.Parameters.Normalize == "" {
+		s.Parameters.Normalize = NormalizeNone
+	}
+	for _, input := range []struct{ role, path string }{
+		{"re", r.REfile}, {"clm", r.Clmfile}, {"aliases", r.AliasFile},
+		{"resume", r.ResumeFile}, {"start_tour", r.StartTour},
+		{"constraints", r.ConstraintsFile}, {"strands", r.StrandsFile},
+		{"re_counts", r.REcounts}, {"gfa", r.GFAfile},
+	} {
+		if input.path == "" {
+			continue
+		}
+		size := int64(-1)
+		if info, err := os.Stat(input.path); err == nil && input.path != StdinFile {
+			size = info.Size()
+		}
+		s.Inputs = append(s.Inputs, SummaryInput{Role: input.role, Path: input.path, Size: size})
+	}
+	inTour := make(map[int]bool, clm.Tour.Len())
+	for _, tig := range clm.Tour.Tigs {
+		inTour[tig.Idx] = true
+	}
+	for _, tig := range clm.Tigs {
+		switch {
+		case inTour[tig.Idx]:
+			s.ActiveContigs++
+		case tig.Pruned != "":
+			s.InactiveContigs++
+			s.InactiveReasons[tig.Pruned]++
+		default:
+			s.InactiveContigs++
+			s.InactiveReasons[PrunedNotListed]++
+		}
+	}
+	return s
+}
+
+// writeSummary keeps the summary of the run, and writes it to filename
+func (r *Optimizer) writeSummary(clm *CLM, startScore float64, filename string) error {
+	r.Summary = r.summarize(clm, startScore)
+	s, err := json.MarshalIndent(r.Summary, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return fmt.Errorf("cannot create summary %s: %s", filename, err)
+	}
+	if _, err := f.Write(append(s, '\n')); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	log.Noticef("Summary written to `%s`", filename)
+	return f.Close()
+}
+
+// writeExtractSummary writes the summary of extract with the rows of the
+// library QC
+func writeExtractSummary(rows []QCMetric, filename string) error {
+	summary := ExtractSummary{SchemaVersion: SummaryVersion, QC: rows, Warnings: []string{}}
+	for _, m := range rows {
+		if m.Status == QCStatusWarn {
+			summary.Warnings = append(summary.Warnings, m.Metric)
+		}
+	}
+	s, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return fmt.Errorf("cannot create summary %s: %s", filename, err)
+	}
+	if _, err := f.Write(append(s, '\n')); err != nil {
+		_ = f.Abort()
+		return err
+	}
+	log.Noticef("Summary written to `%s`", filename)
+	return f.Close()
+}
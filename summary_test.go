@@ -0,0 +1,79 @@
+/*
+ *  summary_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestOptimizeSummary reads back the summary of a run, which must match the
+// one of the Optimizer, the tour file and the inputs, under the keys that
+// the pipelines rely on
+func TestOptimizeSummary(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	opt.MinContigSize = 100000 // Leaves out some contigs
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile("test.summary.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(s, &keys); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(keys))
+		for key := range keys {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		want := "active_contigs final_score generations inactive_contigs inactive_reasons inputs " +
+			"interrupted parameters schema_version score start_score wall_seconds"
+		if strings.Join(got, " ") != want {
+			t.Errorf("summary has keys %v, want %s", got, want)
+		}
+
+		var summary allhic.OptimizeSummary
+		if err := json.Unmarshal(s, &summary); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&summary, opt.Summary) {
+			t.Errorf("summary file %+v differs from the run %+v", summary, *opt.Summary)
+		}
+		if summary.SchemaVersion != allhic.SummaryVersion || summary.Generations == 0 ||
+			summary.Parameters.Seed != 42 || summary.Parameters.NPop != 20 {
+			t.Errorf("bad summary %+v", summary)
+		}
+		nTigs := len(allhic.ParseTourWords(opt.OutTourFile))
+		if summary.ActiveContigs != nTigs || summary.FinalScore != opt.OutScore {
+			t.Errorf("summary has %d contigs scoring %g, want %d scoring %g",
+				summary.ActiveContigs, summary.FinalScore, nTigs, opt.OutScore)
+		}
+		if summary.InactiveReasons[allhic.PrunedSize] == 0 ||
+			summary.InactiveReasons[allhic.PrunedSize] != summary.InactiveContigs {
+			t.Errorf("inactive contigs %d by reason %v", summary.InactiveContigs, summary.InactiveReasons)
+		}
+		for _, input := range summary.Inputs {
+			info, err := os.Stat(input.Path)
+			if err != nil || info.Size() != input.Size {
+				t.Errorf("input %+v does not match the file", input)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+/*
+ *  threads_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestOptimizeThreads runs the same seed at several thread counts, which
+// must end on the same tours, for the GA alone and with its options that
+// draw random numbers of their own. With -short, as in the race testing,
+// the GA alone runs on 1 and 8 threads.
+func TestOptimizeThreads(t *testing.T) {
+	threadCounts := []int{1, 2, 8}
+	if testing.Short() {
+		threadCounts = []int{1, 8}
+	}
+	for name, edit := range map[string]func(*allhic.Optimizer){
+		"ga":      func(r *allhic.Optimizer) {},
+		"islands": func(r *allhic.Optimizer) { r.Islands, r.MigrationInterval = 3, 5 },
+		"inject":  func(r *allhic.Optimizer) { r.Inject, r.InjectStall, r.DiversityThreshold = true, 2, 0.5 },
+		"elite":   func(r *allhic.Optimizer) { r.Elite, r.Selection = 2, allhic.SelectionRoulette },
+	} {
+		if testing.Short() && name != "ga" {
+			continue
+		}
+		var want string
+		for _, threads := range threadCounts {
+			opt := shortOptimizer(t, 42)
+			opt.Threads = threads
+			edit(&opt)
+			got := runOptimizer(t, opt)
+			if threads == 1 {
+				want = got
+			} else if got != want {
+				t.Errorf("%s: %d threads produced different tours from 1:\n%s\n%s", name, threads, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ *  tourscore.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// TourScorer re-evaluates every tour in a tour file against a clmfile, to
+// compare the tours of runs with different parameters
+type TourScorer struct {
+	REfile   string
+	Clmfile  string
+	Tourfile string
+	// Output
+	Scores []TourScore
+}
+
+// TourScore is the score of one tour in the tour file
+type TourScore struct {
+	Label  string
+	Score  float64 // The ordering score, as in the score= of the header
+	ScoreQ float64 // The score with the orientations, see EvaluateQ
+}
+
+// Run is the main function body of tourscore
+func (r *TourScorer) Run() {
+	clm, err := NewCLM(r.Clmfile, r.REfile)
+	ErrorAbort(err)
+	clm.Tour.M = clm.M()
+	labels, tours := readTours(r.Tourfile)
+	for i, words := range tours {
+		clm.activateTour(words)
+		score, _ := clm.Tour.Evaluate()
+		r.Scores = append(r.Scores, TourScore{Label: labels[i], Score: -score,
+			ScoreQ: clm.EvaluateQ()})
+	}
+	writeTourScores(os.Stdout, r.Scores)
+	log.Noticef("Scored %d tours in `%s`", len(r.Scores), r.Tourfile)
+}
+
+// readTours parses the label and the tigs of every tour in the tour file.
+// The label is the first word of the header, without the key=value fields.
+func readTours(filename string) (labels []string, tours [][]string) {
+	f := mustOpen(filename)
+	defer f.Close()
+	label := ""
+	scanner := newLineScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		switch {
+		case len(words) == 0:
+		case words[0][0] == '>':
+			label = words[0][1:]
+		default:
+			labels = append(labels, label)
+			tours = append(tours, words)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		ErrorAbort(fmt.Errorf("cannot read tourfile %s: %s", filename, err))
+	}
+	return
+}
+
+// writeTourScores writes one line per tour
+func writeTourScores(w io.Writer, scores []TourScore) {
+	_, _ = fmt.Fprint(w, TourScoreHeader)
+	for _, s := range scores {
+		_, _ = fmt.Fprintf(w, "%s\t%.5f\t%.5f\n", s.Label, s.Score, s.ScoreQ)
+	}
+}
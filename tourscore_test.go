@@ -0,0 +1,57 @@
+/*
+ *  tourscore_test.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tanghaibao/allhic"
+)
+
+// TestTourScore rescores the tours written by optimize and expects the
+// scores in their headers
+func TestTourScore(t *testing.T) {
+	opt := shortOptimizer(t, 42)
+	inTempDir(t, func() {
+		if err := opt.Run(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := ioutil.ReadFile(opt.OutTourFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var headers []string
+		for _, line := range strings.Split(string(s), "\n") {
+			if strings.HasPrefix(line, ">") {
+				headers = append(headers, line)
+			}
+		}
+
+		p := allhic.TourScorer{REfile: opt.REfile, Clmfile: opt.Clmfile, Tourfile: opt.OutTourFile}
+		p.Run()
+		if len(p.Scores) != len(headers) {
+			t.Fatalf("got %d scores for %d tours", len(p.Scores), len(headers))
+		}
+		for i, header := range headers {
+			fields := strings.Fields(header)
+			if want := ">" + p.Scores[i].Label; fields[0] != want {
+				t.Errorf("tour %d: got label %s, want %s", i, fields[0], want)
+			}
+			if want := fmt.Sprintf("score=%.5f", p.Scores[i].Score); fields[1] != want {
+				t.Errorf("%s: got %s, want %s", fields[0], fields[1], want)
+			}
+			if !strings.Contains(header, " seed=42 ") || !strings.Contains(header, " time=") {
+				t.Errorf("missing the run fields in %q", header)
+			}
+		}
+	})
+}
@@ -0,0 +1,185 @@
+/*
+ *  validpairs.go
+ *  allhic
+ *
+ *  Created by Haibao Tang on 10/15/26
+ *  Copyright © 2026 Haibao Tang. All rights reserved.
+ */
+
+package allhic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// isValidPairsFile tells the validPairs of HiC-Pro by their extension, as in
+// sample.allValidPairs or sample.validPairs.gz
+func isValidPairsFile(filename string) bool {
+	name := strings.ToLower(strings.TrimSuffix(filename, ".gz"))
+	return strings.HasSuffix(name, "validpairs")
+}
+
+// inputFormat returns the Format of the read pairs, or the one told by the
+// extension of all of them when empty
+func (r *Extracter) inputFormat() (string, error) {
+	switch r.Format {
+	case FormatBAM, FormatValidPairs:
+		return r.Format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format `%s`", r.Format)
+	}
+	files := r.bamfiles()
+	format := FormatBAM
+	if isValidPairsFile(files[0]) {
+		format = FormatValidPairs
+	}
+	for _, filename := range files[1:] {
+		if isValidPairsFile(filename) != (format == FormatValidPairs) {
+			return "", fmt.Errorf("cannot read %s along with %s, give the files of one format", filename, files[0])
+		}
+	}
+	return format, nil
+}
+
+// validPairsTable gives each contig of a validPairs file an ID, in the
+// order they appear, and maps it to the contigs as refTable does
+type validPairsTable struct {
+	ids      map[string]int32
+	refToIdx []int
+	unknown  []string
+}
+
+// id returns the ID of the contig, mapped to its index among contigToIdx,
+// -1 when it is not there, or refExcluded when the filter leaves it out
+func (r *validPairsTable) id(name string, contigToIdx map[string]int, filter *ContigFilter) int32 {
+	if id, ok := r.ids[name]; ok {
+		return id
+	}
+	id := int32(len(r.refToIdx))
+	r.ids[name] = id
+	idx, ok := contigToIdx[name]
+	switch {
+	case !ok:
+		idx = -1
+		r.unknown = append(r.unknown, name)
+	case !filter.Keep(name):
+		idx = refExcluded
+	}
+	r.refToIdx = append(r.refToIdx, idx)
+	return id
+}
+
+// extractValidPairs reads the read pairs of a validPairs file of HiC-Pro,
+// of the columns read name, chr1, pos1, strand1, chr2, pos2, strand2, and
+// optionally the fragment size, the restriction fragments and the MAPQ of
+// both reads. Each pair is taken as the two records of its reads in a BAM,
+// at the 1-based positions of the file, so that the links and the coverage
+// are those of the BAM.
+func (r *Extracter) extractValidPairs(filename string, agg *LinkAggregator, coverage *CoverageTrack) {
+	f, err := openReader(filename)
+	if err != nil {
+		ErrorAbort(openError("validPairs", filename, err))
+	}
+	defer f.Close()
+
+	log.Noticef("Parse validPairs `%s`", filename)
+	table := &validPairsTable{ids: make(map[string]int32)}
+	progress := NewProgress("Parse validPairs", filename, func() int64 { return fileOffset(f) })
+	add := agg.Add
+	if r.dedup != nil {
+		add = r.dedup.Add
+	}
+	var counts readCounts
+	var recs [2]bamRecord
+	noMapq := 0
+	scanner := newLineScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if progress.Tick() {
+			progress.Report(fmt.Sprintf("%d pairs", lineno))
+		}
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 || words[0][0] == '#' {
+			continue
+		}
+		if err := parseValidPair(words, &recs, func(name string) int32 {
+			return table.id(name, agg.contigToIdx, r.filter)
+		}); err != nil {
+			ErrorAbort(fmt.Errorf("%s at line %d of %s", err, lineno, filename))
+		}
+		if len(recs[0].Aux) == 0 {
+			noMapq++
+		}
+		for i := range recs {
+			if link, ok := r.linkOf(&recs[i], table.refToIdx, coverage, &counts); ok {
+				add(link)
+			}
+		}
+	}
+	ErrorAbort(scanner.Err())
+	if noMapq > 0 && r.MinMapq > 0 {
+		log.Warningf("%d pairs of `%s` without the MAPQ columns kept regardless of --minMapq", noMapq, filename)
+	}
+	if len(table.unknown) > 0 {
+		log.Warningf("%d contigs of `%s` are not in `%s`, e.g. %s, their reads skipped",
+			len(table.unknown), filename, r.Fastafile, table.unknown[0])
+	}
+	r.Skipped.add(counts.skipped)
+	r.SkippedMapq += counts.skippedMapq
+	r.SkippedContigs += counts.skippedContigs
+	r.qc.add(counts.qc)
+	r.BamStats = append(r.BamStats, BamStats{Bamfile: filename, Reads: counts.reads, Used: counts.used})
+}
+
+// parseValidPair makes the records of the two reads of a validPairs row,
+// with the contig IDs given by id, and the MQ tag of the mate when the row
+// has the MAPQ in its 11th and 12th columns
+func parseValidPair(words []string, recs *[2]bamRecord, id func(name string) int32) error {
+	if len(words) < 7 {
+		return fmt.Errorf("expected 7 columns")
+	}
+	var pos, mapq [2]int
+	var reverse [2]bool
+	for i := range pos {
+		chr, p, strand := words[1+3*i], words[2+3*i], words[3+3*i]
+		var err error
+		if pos[i], err = strconv.Atoi(p); err != nil || pos[i] < 1 {
+			return fmt.Errorf("bad position `%s`", p)
+		}
+		if strand != "+" && strand != "-" {
+			return fmt.Errorf("bad strand `%s`", strand)
+		}
+		reverse[i] = strand == "-"
+		recs[i].RefID = id(chr)
+	}
+	hasMapq := len(words) >= 12
+	if hasMapq {
+		for i := range mapq {
+			var err error
+			if mapq[i], err = strconv.Atoi(words[10+i]); err != nil || mapq[i] < 0 || mapq[i] > 255 {
+				return fmt.Errorf("bad MAPQ `%s`", words[10+i])
+			}
+		}
+	}
+	for i := range recs {
+		rec, mate := &recs[i], 1-i
+		rec.Pos, rec.MateRefID, rec.MatePos = int64(pos[i]-1), recs[mate].RefID, int64(pos[mate]-1)
+		// The first and the second reads of the pair
+		rec.Flags = 0x1 | 0x40<<uint(i)
+		if reverse[i] {
+			rec.Flags |= 0x10
+		}
+		if reverse[mate] {
+			rec.Flags |= 0x20
+		}
+		// HiC-Pro keeps the pairs of mapped reads, 255 is an unknown MAPQ
+		rec.MapQ, rec.Aux = 255, rec.Aux[:0]
+		if hasMapq {
+			rec.MapQ = uint8(mapq[i])
+			rec.Aux = append(rec.Aux, 'M', 'Q', 'C', uint8(mapq[mate]))
+		}
+	}
+	return nil
+}